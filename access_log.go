@@ -0,0 +1,160 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Access logs, with a line per proxied call.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// AccessLogFormat is the format of access log lines.
+type AccessLogFormat int
+
+const (
+	// AccessLogJSON writes each line as a JSON object.
+	AccessLogJSON AccessLogFormat = iota
+	// AccessLogCombined writes each line in Apache's combined log format, followed by the gRPC method,
+	// status code and the latency in microseconds.
+	AccessLogCombined
+)
+
+// The timestamp layout of combined log lines.
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogOptions configures an access log of proxied calls.
+type AccessLogOptions struct {
+	// Where lines are written, such as os.Stdout.
+	Writer io.Writer
+	// The format of lines. Defaults to JSON.
+	Format AccessLogFormat
+	// The fraction of successful calls to log, between 0 and 1. Failed calls are always logged. If
+	// zero, every call is logged.
+	SampleRate float64
+
+	// Guards writes, so that concurrent lines don't interleave.
+	mutex sync.Mutex
+}
+
+// An access log line.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	Caller     string    `json:"caller,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Operation  string    `json:"operation"`
+	HTTPMethod string    `json:"httpMethod"`
+	// The backend request path, with path parameters filled in.
+	Path          string        `json:"path"`
+	HTTPStatus    int           `json:"httpStatus,omitempty"`
+	Code          codes.Code    `json:"code"`
+	RequestBytes  int           `json:"requestBytes"`
+	ResponseBytes int           `json:"responseBytes"`
+	Latency       time.Duration `json:"latency"`
+}
+
+// Returns true if a call with the given error should be logged.
+func (o *AccessLogOptions) sampled(err error) bool {
+	return err != nil || o.SampleRate <= 0 || o.SampleRate >= 1 || rand.Float64() < o.SampleRate
+}
+
+// Writes a line to the log.
+func (o *AccessLogOptions) write(entry *accessLogEntry) {
+	var line []byte
+	if o.Format == AccessLogCombined {
+		line = []byte(entry.combined())
+	} else {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			log.Printf("WARNING: Error encoding access log line: %s", err)
+			return
+		}
+	}
+	line = append(line, '\n')
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if _, err := o.Writer.Write(line); err != nil {
+		log.Printf("WARNING: Error writing access log line: %s", err)
+	}
+}
+
+// Returns the entry in combined log format, with the gRPC method, code and latency appended.
+func (e *accessLogEntry) combined() string {
+	status := "-"
+	if e.HTTPStatus != 0 {
+		status = strconv.Itoa(e.HTTPStatus)
+	}
+	return fmt.Sprintf("%s - %s [%s] %q %s %d \"-\" %q %s %s %d",
+		orDash(e.ClientIP), orDash(e.Caller), e.Time.Format(combinedTimeLayout),
+		e.HTTPMethod+" "+e.Path, status, e.ResponseBytes, e.UserAgent, e.Operation, e.Code,
+		e.Latency/time.Microsecond)
+}
+
+// Returns the value, or "-" if it is empty.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Returns the backend request path of a call, with its path parameters filled in.
+func (p *operationAdapter) requestPath(call *proxiedCall) string {
+	path := p.swaggerPath
+	for name, value := range call.pathParams {
+		path = strings.Replace(path, "{"+name+"}", value, -1)
+	}
+	return path
+}
+
+// Writes an access log line for a completed call, if it is sampled.
+func (p *operationAdapter) logAccess(call *proxiedCall, err error) {
+	accessLog := p.options.AccessLog
+	if !accessLog.sampled(err) {
+		return
+	}
+	entry := &accessLogEntry{
+		Time:          call.startTime,
+		Caller:        callerFromContext(call.ctx, p.options.CallerMetadataKey),
+		Operation:     p.info.FullMethod,
+		HTTPMethod:    p.httpMethod,
+		Path:          p.requestPath(call),
+		HTTPStatus:    call.httpStatus,
+		Code:          errorCode(err),
+		RequestBytes:  call.requestBytes,
+		ResponseBytes: call.responseBytes,
+		Latency:       time.Since(call.startTime),
+	}
+	if callerPeer, ok := peer.FromContext(call.ctx); ok && callerPeer.Addr != nil {
+		if ip := peerIP(callerPeer.Addr); ip != nil {
+			entry.ClientIP = ip.String()
+		}
+	}
+	md, _ := metadata.FromIncomingContext(call.ctx)
+	entry.UserAgent = firstMetadataValue(md, "user-agent")
+	accessLog.write(entry)
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Returns a context for a call from 10.1.2.3 with the given user agent.
+func accessLogContext(userAgent string) context.Context {
+	ctx := peer.NewContext(context.Background(),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 5000}})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", userAgent))
+}
+
+// Returns a handler writing a fixed body with the given status.
+func accessLogBackend(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+// Tests that JSON lines describe the call.
+func TestAccessLogJSON(t *testing.T) {
+	assert := assertions.New(t)
+	var output bytes.Buffer
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{AccessLog: &AccessLogOptions{Writer: &output}},
+		accessLogBackend(http.StatusOK, `{"name": "thing"}`))
+	defer closeServer()
+
+	stream := &fakeServerStream{ctx: accessLogContext("test/1.0"), request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+
+	var entry map[string]interface{}
+	require.Nil(t, json.Unmarshal(output.Bytes(), &entry), "Bad line: %s", output.String())
+	assert.Equal("10.1.2.3", entry["clientIp"])
+	assert.Equal("test/1.0", entry["userAgent"])
+	assert.Equal("/test_service.Items/GetItem", entry["operation"])
+	assert.Equal("GET", entry["httpMethod"])
+	assert.Equal("/items/abc", entry["path"])
+	assert.Equal(float64(http.StatusOK), entry["httpStatus"])
+	assert.Equal(float64(codes.OK), entry["code"])
+	assert.True(entry["responseBytes"].(float64) > 0, "Response size not recorded")
+}
+
+// Tests that combined lines follow Apache's format.
+func TestAccessLogCombined(t *testing.T) {
+	var output bytes.Buffer
+	adapter, closeServer := newTestAdapter(t,
+		&ServiceOptions{AccessLog: &AccessLogOptions{Writer: &output, Format: AccessLogCombined}},
+		accessLogBackend(http.StatusOK, `{"name": "thing"}`))
+	defer closeServer()
+
+	stream := &fakeServerStream{ctx: accessLogContext("test/1.0"), request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+
+	pattern := regexp.MustCompile(`^10\.1\.2\.3 - - \[[^\]]+\] "GET /items/abc" 200 \d+ "-" "test/1\.0" ` +
+		`/test_service\.Items/GetItem OK \d+\n$`)
+	assertions.Regexp(t, pattern, output.String())
+}
+
+// Tests that successful calls are sampled, while failures are always logged.
+func TestAccessLogSampling(t *testing.T) {
+	assert := assertions.New(t)
+	var output bytes.Buffer
+	options := &ServiceOptions{AccessLog: &AccessLogOptions{Writer: &output, SampleRate: 1e-12}}
+	success, closeSuccess := newTestAdapter(t, options, accessLogBackend(http.StatusOK, `{"name": "thing"}`))
+	defer closeSuccess()
+	failure, closeFailure := newTestAdapter(t, options, accessLogBackend(http.StatusInternalServerError, `not json`))
+	defer closeFailure()
+
+	success.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assert.Empty(output.String(), "Expected the success not to be sampled")
+	failure.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assert.Equal(1, strings.Count(output.String(), "\n"), "Expected the failure to be logged")
+}
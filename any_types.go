@@ -0,0 +1,140 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Reading polymorphic backend payloads into google.protobuf.Any fields.
+//
+// The JSON form of an Any names its type in an "@type" property. Backends returning polymorphic
+// payloads name the type in a discriminator property instead, like {"petType": "Cat", ...}. Payloads
+// in Any fields without "@type" are given one from their discriminator before the response is
+// read, and types are resolved from the configured registry as well as the operation's proto file
+// and its imports.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// The type URL prefix given to discriminated payloads.
+const anyTypeURLPrefix = "type.googleapis.com/"
+
+// The fully-qualified name of the Any type.
+const anyTypeName = "google.protobuf.Any"
+
+// AnyTypeOptions configures how backend payloads are read into google.protobuf.Any fields.
+type AnyTypeOptions struct {
+	// Message types Any fields may hold, in addition to those in an operation's proto file and its
+	// imports.
+	Types []*desc.MessageDescriptor
+	// The JSON property naming a payload's type, for payloads without "@type", like the spec's
+	// discriminator.
+	Discriminator string
+	// Fully-qualified message type names keyed by discriminator value. A payload whose discriminator
+	// isn't listed is left as it is, and fails to be read unless it has "@type".
+	DiscriminatorTypes map[string]string
+}
+
+// Resolves the types of Any payloads in an operation's responses.
+type anyTypeResolver struct {
+	// The configured types, keyed by fully-qualified name.
+	types map[string]*desc.MessageDescriptor
+	// The file of the operation's output type, whose types and imports are also resolved.
+	file *desc.FileDescriptor
+	// Creates resolved messages.
+	factory *dynamic.MessageFactory
+	// The discriminator property, or empty if payloads aren't tagged.
+	discriminator string
+	// Type names keyed by discriminator value.
+	discriminatorTypes map[string]string
+}
+
+// Returns a resolver for the Any payloads in responses of the given type, or nil if there are no
+// options or the type can't hold Any payloads.
+func newAnyTypeResolver(options *AnyTypeOptions, outputType *desc.MessageDescriptor,
+	factory *dynamic.MessageFactory) *anyTypeResolver {
+	if options == nil || !containsMessageType(outputType, anyTypeName, make(map[*desc.MessageDescriptor]bool)) {
+		return nil
+	}
+	resolver := &anyTypeResolver{
+		types:              make(map[string]*desc.MessageDescriptor, len(options.Types)),
+		file:               outputType.GetFile(),
+		factory:            factory,
+		discriminator:      options.Discriminator,
+		discriminatorTypes: options.DiscriminatorTypes,
+	}
+	for _, messageType := range options.Types {
+		resolver.types[messageType.GetFullyQualifiedName()] = messageType
+	}
+	return resolver
+}
+
+// Resolve implements jsonpb.AnyResolver, for the configured types. Other types are resolved by the
+// dynamic message being read.
+func (r *anyTypeResolver) Resolve(typeURL string) (proto.Message, error) {
+	if messageType := r.find(typeURL); messageType != nil {
+		return dynamic.NewMessageWithMessageFactory(messageType, r.factory), nil
+	}
+	return nil, fmt.Errorf("unknown message type %q", typeURL)
+}
+
+// Returns the message type named by a type URL or name, from the configured types or the
+// operation's file and its imports, or nil if it isn't known.
+func (r *anyTypeResolver) find(typeURL string) *desc.MessageDescriptor {
+	name := typeURL[strings.LastIndex(typeURL, "/")+1:]
+	if messageType, ok := r.types[name]; ok {
+		return messageType
+	}
+	return findFileMessage(r.file, name, make(map[*desc.FileDescriptor]bool))
+}
+
+// Returns the named message type from a file or its imports, or nil if none defines it.
+func findFileMessage(file *desc.FileDescriptor, name string, checked map[*desc.FileDescriptor]bool) *desc.MessageDescriptor {
+	if checked[file] {
+		return nil
+	}
+	checked[file] = true
+	if messageType := file.FindMessage(name); messageType != nil {
+		return messageType
+	}
+	for _, dependency := range file.GetDependencies() {
+		if messageType := findFileMessage(dependency, name, checked); messageType != nil {
+			return messageType
+		}
+	}
+	return nil
+}
+
+// Adds "@type" to a discriminated payload in an Any field's JSON object. Returns the payload's
+// type if it is known, and true if "@type" was added.
+func (r *anyTypeResolver) tagPayload(object map[string]interface{}) (*desc.MessageDescriptor, bool) {
+	tagged := false
+	typeURL, _ := object["@type"].(string)
+	if typeURL == "" && r.discriminator != "" {
+		discriminator, _ := object[r.discriminator].(string)
+		if name, ok := r.discriminatorTypes[discriminator]; ok {
+			typeURL = anyTypeURLPrefix + name
+			object["@type"] = typeURL
+			tagged = true
+		}
+	}
+	if typeURL == "" {
+		return nil, false
+	}
+	return r.find(typeURL), tagged
+}
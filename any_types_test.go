@@ -0,0 +1,136 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto whose responses hold polymorphic payloads.
+const anyTypesProto = `
+syntax = "proto3";
+
+package shelter;
+
+import "google/protobuf/any.proto";
+
+message ListPetsRequest {}
+
+message ListPetsResponse {
+  repeated google.protobuf.Any pets = 1;
+  google.protobuf.Any featured = 2;
+}
+
+message Bird {
+  string name = 1;
+}
+
+service Shelter {
+  rpc ListPets(ListPetsRequest) returns (ListPetsResponse);
+}
+`
+
+// Payload types registered separately from anyTypesProto.
+const anyPayloadsProto = `
+syntax = "proto3";
+
+package pets;
+
+message Cat {
+  string name = 1;
+  int32 lives = 2;
+}
+
+message Dog {
+  string name = 1;
+}
+`
+
+// Returns the type URL and the name field of each Any in a list, reading payloads as the types
+// keyed by type URL.
+func anyPayloadNames(t *testing.T, payloads []interface{}, types map[string]*desc.MessageDescriptor) [][2]string {
+	var names [][2]string
+	for _, payload := range payloads {
+		any, err := dynamic.AsDynamicMessage(payload.(proto.Message))
+		require.Nil(t, err)
+		typeURL := any.GetFieldByName("type_url").(string)
+		payloadType := types[typeURL]
+		require.NotNil(t, payloadType, "Unexpected type %s", typeURL)
+		message := dynamic.NewMessage(payloadType)
+		require.Nil(t, message.Unmarshal(any.GetFieldByName("value").([]byte)))
+		names = append(names, [2]string{typeURL, message.GetFieldByName("name").(string)})
+	}
+	return names
+}
+
+// Tests that discriminated payloads are read into Any fields as their mapped types.
+func TestAnyTypes(t *testing.T) {
+	assert := assertions.New(t)
+	payloads, err := loadProtoFromBytes([]byte(anyPayloadsProto))
+	require.Nil(t, err)
+	cat, dog := payloads.FindMessage("pets.Cat"), payloads.FindMessage("pets.Dog")
+	method := testMethod(t, anyTypesProto, "shelter.Shelter", "ListPets")
+	bird := method.GetFile().FindMessage("shelter.Bird")
+	adapter, err := testOperation{method: method, path: "/pets", operation: &spec.Operation{},
+		parameters: map[string]*spec.Parameter{}, options: &ServiceOptions{AnyTypes: &AnyTypeOptions{
+			Types:              []*desc.MessageDescriptor{cat, dog},
+			Discriminator:      "petType",
+			DiscriminatorTypes: map[string]string{"Cat": "pets.Cat", "Dog": "pets.Dog"},
+		}}}.newAdapter(t, "http://localhost")
+	require.Nil(t, err)
+
+	response := adapter.newMessage(method.GetOutputType())
+	require.Nil(t, adapter.unmarshalResponse([]byte(`{
+    "pets": [
+      {"petType": "Cat", "name": "Tom", "lives": 9},
+      {"@type": "type.googleapis.com/pets.Dog", "name": "Rex"},
+      {"@type": "type.googleapis.com/shelter.Bird", "name": "Tweety"}
+    ],
+    "featured": {"petType": "Dog", "name": "Lassie"}
+  }`), response))
+
+	types := map[string]*desc.MessageDescriptor{
+		"type.googleapis.com/pets.Cat":     cat,
+		"type.googleapis.com/pets.Dog":     dog,
+		"type.googleapis.com/shelter.Bird": bird,
+	}
+	assert.Equal([][2]string{
+		{"type.googleapis.com/pets.Cat", "Tom"},
+		{"type.googleapis.com/pets.Dog", "Rex"},
+		{"type.googleapis.com/shelter.Bird", "Tweety"},
+	}, anyPayloadNames(t, response.GetFieldByName("pets").([]interface{}), types))
+	assert.Equal([][2]string{{"type.googleapis.com/pets.Dog", "Lassie"}},
+		anyPayloadNames(t, []interface{}{response.GetFieldByName("featured")}, types))
+
+	err = adapter.unmarshalResponse([]byte(`{"featured": {"petType": "Fish", "name": "Nemo"}}`),
+		adapter.newMessage(method.GetOutputType()))
+	assert.NotNil(err, "Expected error for an unmapped discriminator")
+}
+
+// Tests that no resolver is used for responses which can't hold Any payloads.
+func TestAnyTypesUnused(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(anyTypesProto))
+	require.Nil(t, err)
+	assertions.Nil(t, newAnyTypeResolver(&AnyTypeOptions{Discriminator: "type"},
+		fileDesc.FindMessage("shelter.Bird"), nil))
+	assertions.Nil(t, newAnyTypeResolver(nil, fileDesc.FindMessage("shelter.ListPetsResponse"), nil))
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// API keys sent to the backend, for operations requiring apiKey security schemes.
+//
+// An operation's security requirements are its own, or else the spec's. The first requirement whose
+// schemes are all apiKey schemes with configured keys is used, and each of its keys is sent in the
+// header or query parameter its scheme names. Requirements naming other kinds of scheme, such as
+// oauth2, are left to other options, like Session.
+
+import (
+	"log"
+	"os"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyOptions configures the API keys sent with backend requests.
+type APIKeyOptions struct {
+	// The spec's securityDefinitions. Schemes other than apiKey are ignored.
+	Definitions spec.SecurityDefinitions
+	// The spec's top-level security requirements, for operations without their own.
+	Security []map[string][]string
+	// The keys of apiKey schemes, by scheme name.
+	Keys map[string]*APIKey
+}
+
+// APIKey is where the key for an apiKey scheme comes from. The first of these which gives a key is
+// used, in the order listed.
+type APIKey struct {
+	// gRPC metadata of calls which carry their own key, like "x-api-key".
+	Metadata string
+	// Environment variable holding the key, read at each call.
+	Env string
+	// The key itself.
+	Value string
+}
+
+// NewAPIKeyOptions returns options sending the given keys as the security requirements of a
+// swagger document require.
+func NewAPIKeyOptions(swagger *spec.Swagger, keys map[string]*APIKey) *APIKeyOptions {
+	return &APIKeyOptions{Definitions: swagger.SecurityDefinitions, Security: swagger.Security, Keys: keys}
+}
+
+// An apiKey scheme an operation's requests are sent with.
+type apiKeyScheme struct {
+	// The scheme's name in securityDefinitions.
+	name string
+	// Where the key is sent: "header" or "query".
+	in string
+	// The header or query parameter the key is sent in.
+	param string
+	// Where the key comes from.
+	key *APIKey
+}
+
+// Returns the apiKey schemes an operation's requests are sent with, or nil if it needs none or no
+// requirement can be met with the configured keys.
+func resolveAPIKeys(operation *spec.Operation, options *APIKeyOptions) []*apiKeyScheme {
+	if options == nil {
+		return nil
+	}
+	requirements := operation.Security
+	if requirements == nil {
+		requirements = options.Security
+	}
+	if len(requirements) == 0 {
+		return nil
+	}
+	for _, requirement := range requirements {
+		if schemes, ok := options.apiKeySchemes(requirement); ok {
+			return schemes
+		}
+	}
+	log.Printf("WARNING: No API keys configured meet any security requirement of %s.", operation.ID)
+	return nil
+}
+
+// Returns the schemes of a security requirement, and true if they're all apiKey schemes with keys.
+func (o *APIKeyOptions) apiKeySchemes(requirement map[string][]string) ([]*apiKeyScheme, bool) {
+	schemes := make([]*apiKeyScheme, 0, len(requirement))
+	for name := range requirement {
+		definition := o.Definitions[name]
+		key := o.Keys[name]
+		if definition == nil || definition.Type != "apiKey" || key == nil {
+			return nil, false
+		}
+		if definition.In != "header" && definition.In != "query" {
+			return nil, false
+		}
+		schemes = append(schemes, &apiKeyScheme{name: name, in: definition.In, param: definition.Name, key: key})
+	}
+	return schemes, true
+}
+
+// Returns the key to send for a scheme with a call, or empty if there is none.
+func (s *apiKeyScheme) value(ctx context.Context) string {
+	if s.key.Metadata != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md[s.key.Metadata]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	if s.key.Env != "" {
+		if value := os.Getenv(s.key.Env); value != "" {
+			return value
+		}
+	}
+	return s.key.Value
+}
+
+// Returns the keys to send with a call's backend requests, one for each of the operation's
+// schemes. Returns Unauthenticated, before any backend request is made, if a key is missing.
+func (p *operationAdapter) apiKeyValues(ctx context.Context) ([]string, error) {
+	values := make([]string, len(p.apiKeys))
+	for i, scheme := range p.apiKeys {
+		if values[i] = scheme.value(ctx); values[i] == "" {
+			return nil, status.Errorf(codes.Unauthenticated, "no API key for %s calling %s",
+				scheme.name, p.operation.ID)
+		}
+	}
+	return values, nil
+}
+
+// Writes the keys from apiKeyValues to a backend request.
+func (p *operationAdapter) writeAPIKeys(request runtime.ClientRequest, values []string) error {
+	for i, scheme := range p.apiKeys {
+		var err error
+		if scheme.in == "header" {
+			err = request.SetHeaderParam(scheme.param, values[i])
+		} else {
+			err = request.SetQueryParam(scheme.param, values[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
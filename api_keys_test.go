@@ -0,0 +1,110 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// A spec with an apiKey scheme in a header, one in a query parameter, and an oauth2 scheme.
+const apiKeySpec = `{
+  "swagger": "2.0",
+  "securityDefinitions": {
+    "headerKey": {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+    "queryKey": {"type": "apiKey", "in": "query", "name": "api_key"},
+    "oauth": {"type": "oauth2", "flow": "application", "tokenUrl": "https://auth.example.com/token"}
+  },
+  "security": [{"headerKey": []}],
+  "paths": {}
+}`
+
+// Tests that API keys are sent as operations' security requirements require.
+func TestAPIKeys(t *testing.T) {
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(apiKeySpec), swagger))
+	require.Nil(t, os.Setenv("SWAGGRPC_TEST_API_KEY", "from-env"))
+	defer os.Unsetenv("SWAGGRPC_TEST_API_KEY")
+
+	fixtures := []struct {
+		name     string
+		security []map[string][]string
+		keys     map[string]*APIKey
+		md       metadata.MD
+		header   string
+		query    string
+		code     codes.Code
+	}{
+		{"spec requirement", nil, map[string]*APIKey{"headerKey": {Value: "secret"}}, nil,
+			"secret", "", codes.OK},
+		{"operation requirement", []map[string][]string{{"queryKey": {}}},
+			map[string]*APIKey{"queryKey": {Value: "secret"}}, nil, "", "secret", codes.OK},
+		{"both schemes", []map[string][]string{{"headerKey": {}, "queryKey": {}}},
+			map[string]*APIKey{"headerKey": {Value: "a"}, "queryKey": {Value: "b"}}, nil, "a", "b", codes.OK},
+		{"first met requirement", []map[string][]string{{"oauth": {}}, {"queryKey": {}}},
+			map[string]*APIKey{"queryKey": {Value: "secret"}}, nil, "", "secret", codes.OK},
+		{"unmet requirements", []map[string][]string{{"oauth": {}}}, map[string]*APIKey{"headerKey": {Value: "a"}},
+			nil, "", "", codes.OK},
+		{"no security", []map[string][]string{}, map[string]*APIKey{"headerKey": {Value: "a"}}, nil,
+			"", "", codes.OK},
+		{"environment", nil, map[string]*APIKey{"headerKey": {Env: "SWAGGRPC_TEST_API_KEY", Value: "default"}},
+			nil, "from-env", "", codes.OK},
+		{"unset environment", nil, map[string]*APIKey{"headerKey": {Env: "SWAGGRPC_TEST_UNSET", Value: "default"}},
+			nil, "default", "", codes.OK},
+		{"metadata", nil, map[string]*APIKey{"headerKey": {Metadata: "x-api-key", Env: "SWAGGRPC_TEST_API_KEY"}},
+			metadata.Pairs("x-api-key", "from-call"), "from-call", "", codes.OK},
+		{"metadata missing", nil, map[string]*APIKey{"headerKey": {Metadata: "x-api-key", Value: "default"}},
+			nil, "default", "", codes.OK},
+		{"no key", nil, map[string]*APIKey{"headerKey": {Metadata: "x-api-key"}}, nil,
+			"", "", codes.Unauthenticated},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			requests := 0
+			operation := &spec.Operation{
+				OperationProps: spec.OperationProps{ID: "getItem", Security: fixture.security},
+			}
+			options := &ServiceOptions{APIKeys: NewAPIKeyOptions(swagger, fixture.keys)}
+			adapter, closeServer := testOperation{operation: operation, options: options,
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					requests++
+					assert.Equal(fixture.header, r.Header.Get("X-API-Key"), "Bad header key")
+					assert.Equal(fixture.query, r.URL.Query().Get("api_key"), "Bad query key")
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"name": "thing"}`))
+				}}.adapter(t)
+			defer closeServer()
+
+			ctx := metadata.NewIncomingContext(context.Background(), fixture.md)
+			err := adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`})
+			assert.Equal(fixture.code, errorCode(err), "Bad result: %v", err)
+			if fixture.code == codes.OK {
+				assert.Equal(1, requests, "Bad backend request count")
+			} else {
+				assert.Equal(0, requests, "Backend called without a key")
+			}
+		})
+	}
+}
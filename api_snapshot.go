@@ -0,0 +1,240 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Snapshots of the gRPC surface a registry exposes, and checks for breaking changes between them.
+//
+// A snapshot serializes to canonical JSON, so the same surface always gives the same bytes, and
+// snapshots can be stored with a deployment and compared against the next one. Fields and enum
+// values are identified by number, as on the wire. Renaming them is still a breaking change, since
+// JSON clients depend on the names.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// APISnapshotVersion is the version of the snapshot format. CheckCompatibility rejects snapshots
+// with other versions.
+const APISnapshotVersion = 1
+
+// APISnapshot describes the gRPC methods a registry exposes, and the messages and enums they use.
+type APISnapshot struct {
+	Version int `json:"version"`
+	// Methods keyed by full gRPC method name.
+	Methods map[string]*MethodSnapshot `json:"methods"`
+	// Messages and enums keyed by fully-qualified name.
+	Messages map[string]*MessageSnapshot `json:"messages"`
+	Enums    map[string]*EnumSnapshot    `json:"enums,omitempty"`
+}
+
+// MethodSnapshot describes a gRPC method.
+type MethodSnapshot struct {
+	// The swagger operation the method proxies. Not part of the gRPC surface.
+	OperationID     string `json:"operationId,omitempty"`
+	InputType       string `json:"inputType"`
+	OutputType      string `json:"outputType"`
+	ClientStreaming bool   `json:"clientStreaming,omitempty"`
+	ServerStreaming bool   `json:"serverStreaming,omitempty"`
+}
+
+// MessageSnapshot describes a message's fields, ordered by number.
+type MessageSnapshot struct {
+	Fields []*FieldSnapshot `json:"fields"`
+}
+
+// FieldSnapshot describes a message field. Type is a scalar type like "string", or the
+// fully-qualified name of a message or enum.
+type FieldSnapshot struct {
+	Number   int32  `json:"number"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Repeated bool   `json:"repeated,omitempty"`
+}
+
+// EnumSnapshot describes an enum's values, keyed by name.
+type EnumSnapshot struct {
+	Values map[string]int32 `json:"values"`
+}
+
+// BreakingChange is a change between snapshots that can break existing clients.
+type BreakingChange struct {
+	// The full method name, or the name of the message or enum, that changed.
+	Element string
+	Reason  string
+}
+
+func (c *BreakingChange) String() string {
+	return c.Element + ": " + c.Reason
+}
+
+// Snapshot returns a description of the gRPC surface of the registered operations.
+func (r *OperationRegistry) Snapshot() *APISnapshot {
+	snapshot := &APISnapshot{
+		Version:  APISnapshotVersion,
+		Methods:  make(map[string]*MethodSnapshot),
+		Messages: make(map[string]*MessageSnapshot),
+		Enums:    make(map[string]*EnumSnapshot),
+	}
+	for fullMethod, operation := range r.current() {
+		if operation.method == nil {
+			continue
+		}
+		method := operation.method
+		snapshot.Methods[fullMethod] = &MethodSnapshot{
+			InputType:       method.GetInputType().GetFullyQualifiedName(),
+			OutputType:      method.GetOutputType().GetFullyQualifiedName(),
+			ClientStreaming: method.IsClientStreaming(),
+			ServerStreaming: method.IsServerStreaming(),
+		}
+		if operation.description != nil {
+			snapshot.Methods[fullMethod].OperationID = operation.description.OperationID
+		}
+		snapshot.addMessage(method.GetInputType())
+		snapshot.addMessage(method.GetOutputType())
+	}
+	return snapshot
+}
+
+// Adds a message and the messages and enums its fields use, if not already added.
+func (s *APISnapshot) addMessage(message *desc.MessageDescriptor) {
+	name := message.GetFullyQualifiedName()
+	if _, ok := s.Messages[name]; ok {
+		return
+	}
+	messageSnapshot := &MessageSnapshot{}
+	s.Messages[name] = messageSnapshot
+	for _, field := range message.GetFields() {
+		fieldSnapshot := &FieldSnapshot{
+			Number:   field.GetNumber(),
+			Name:     field.GetName(),
+			Type:     strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_")),
+			Repeated: field.IsRepeated(),
+		}
+		if fieldMessage := field.GetMessageType(); fieldMessage != nil {
+			fieldSnapshot.Type = fieldMessage.GetFullyQualifiedName()
+			s.addMessage(fieldMessage)
+		} else if fieldEnum := field.GetEnumType(); fieldEnum != nil {
+			fieldSnapshot.Type = fieldEnum.GetFullyQualifiedName()
+			s.addEnum(fieldEnum)
+		}
+		messageSnapshot.Fields = append(messageSnapshot.Fields, fieldSnapshot)
+	}
+	sort.Slice(messageSnapshot.Fields, func(i, j int) bool {
+		return messageSnapshot.Fields[i].Number < messageSnapshot.Fields[j].Number
+	})
+}
+
+// Adds an enum's values.
+func (s *APISnapshot) addEnum(enum *desc.EnumDescriptor) {
+	values := make(map[string]int32)
+	for _, value := range enum.GetValues() {
+		values[value.GetName()] = value.GetNumber()
+	}
+	s.Enums[enum.GetFullyQualifiedName()] = &EnumSnapshot{Values: values}
+}
+
+// CheckCompatibility returns the changes from a previous snapshot to the next one which can break
+// clients of the previous surface, sorted by element. Removed methods, and changes to a method's
+// types or streaming, are breaking. So are removed or changed fields and enum values of messages
+// and enums in both snapshots; added ones are not. Returns an error if either snapshot has an
+// unsupported version.
+func CheckCompatibility(previous, next *APISnapshot) ([]*BreakingChange, error) {
+	for _, snapshot := range []*APISnapshot{previous, next} {
+		if snapshot.Version != APISnapshotVersion {
+			return nil, fmt.Errorf("unsupported API snapshot version %d", snapshot.Version)
+		}
+	}
+	var changes []*BreakingChange
+	addChange := func(element, format string, args ...interface{}) {
+		changes = append(changes, &BreakingChange{Element: element, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	for name, oldMethod := range previous.Methods {
+		newMethod, ok := next.Methods[name]
+		if !ok {
+			addChange(name, "method removed")
+			continue
+		}
+		if oldMethod.InputType != newMethod.InputType {
+			addChange(name, "input type changed from %s to %s", oldMethod.InputType, newMethod.InputType)
+		}
+		if oldMethod.OutputType != newMethod.OutputType {
+			addChange(name, "output type changed from %s to %s", oldMethod.OutputType, newMethod.OutputType)
+		}
+		if oldMethod.ClientStreaming != newMethod.ClientStreaming ||
+			oldMethod.ServerStreaming != newMethod.ServerStreaming {
+			addChange(name, "streaming changed")
+		}
+	}
+
+	for name, oldMessage := range previous.Messages {
+		newMessage, ok := next.Messages[name]
+		if !ok {
+			// Only breaking if still used, which shows up as a changed method or field type.
+			continue
+		}
+		newFields := make(map[int32]*FieldSnapshot, len(newMessage.Fields))
+		for _, field := range newMessage.Fields {
+			newFields[field.Number] = field
+		}
+		for _, oldField := range oldMessage.Fields {
+			newField, ok := newFields[oldField.Number]
+			switch {
+			case !ok:
+				addChange(name, "field %d (%s) removed", oldField.Number, oldField.Name)
+			case oldField.Name != newField.Name:
+				addChange(name, "field %d renamed from %s to %s", oldField.Number, oldField.Name, newField.Name)
+			case oldField.Type != newField.Type || oldField.Repeated != newField.Repeated:
+				addChange(name, "field %s changed from %s to %s", oldField.Name, describeFieldType(oldField),
+					describeFieldType(newField))
+			}
+		}
+	}
+
+	for name, oldEnum := range previous.Enums {
+		newEnum, ok := next.Enums[name]
+		if !ok {
+			continue
+		}
+		for valueName, number := range oldEnum.Values {
+			newNumber, ok := newEnum.Values[valueName]
+			if !ok {
+				addChange(name, "value %s removed", valueName)
+			} else if newNumber != number {
+				addChange(name, "value %s renumbered from %d to %d", valueName, number, newNumber)
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Element != changes[j].Element {
+			return changes[i].Element < changes[j].Element
+		}
+		return changes[i].Reason < changes[j].Reason
+	})
+	return changes, nil
+}
+
+// Returns a field's type for a change description, like "repeated string".
+func describeFieldType(field *FieldSnapshot) string {
+	if field.Repeated {
+		return "repeated " + field.Type
+	}
+	return field.Type
+}
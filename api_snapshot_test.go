@@ -0,0 +1,134 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The first version of a surface, which later versions are compared against.
+const snapshotProto = `
+syntax = "proto3";
+
+package snapshot_test;
+
+enum Color {
+  RED = 0;
+  BLUE = 1;
+}
+
+message Part {
+  string name = 1;
+  Color color = 2;
+}
+
+message GetOrderRequest {
+  string orderId = 1;
+}
+
+message Order {
+  string orderId = 1;
+  repeated Part parts = 2;
+  int32 total = 3;
+}
+
+service Orders {
+  rpc GetOrder(GetOrderRequest) returns (Order);
+  rpc CancelOrder(GetOrderRequest) returns (Order);
+}
+`
+
+// Returns a snapshot of a registry with all methods of the snapshot_test.Orders service in a proto.
+func snapshotOf(t *testing.T, proto string) *APISnapshot {
+	fileDesc, err := loadProtoFromBytes([]byte(proto))
+	require.Nil(t, err)
+	registry := NewOperationRegistry()
+	for _, method := range fileDesc.FindService("snapshot_test.Orders").GetMethods() {
+		registry.set(fullMethodName(method), &registeredOperation{method: method})
+	}
+	return registry.Snapshot()
+}
+
+// Tests that snapshots describe the methods and the types they use, canonically.
+func TestRegistrySnapshot(t *testing.T) {
+	assert := assertions.New(t)
+	snapshot := snapshotOf(t, snapshotProto)
+
+	assert.Equal(&MethodSnapshot{InputType: "snapshot_test.GetOrderRequest", OutputType: "snapshot_test.Order"},
+		snapshot.Methods["/snapshot_test.Orders/GetOrder"])
+	assert.Len(snapshot.Methods, 2)
+	assert.Equal([]*FieldSnapshot{
+		{Number: 1, Name: "orderId", Type: "string"},
+		{Number: 2, Name: "parts", Type: "snapshot_test.Part", Repeated: true},
+		{Number: 3, Name: "total", Type: "int32"},
+	}, snapshot.Messages["snapshot_test.Order"].Fields)
+	assert.Contains(snapshot.Messages, "snapshot_test.Part")
+	assert.Equal(map[string]int32{"RED": 0, "BLUE": 1}, snapshot.Enums["snapshot_test.Color"].Values)
+
+	first, err := json.Marshal(snapshot)
+	require.Nil(t, err)
+	second, err := json.Marshal(snapshotOf(t, snapshotProto))
+	require.Nil(t, err)
+	assert.Equal(string(first), string(second), "Snapshot JSON not canonical")
+}
+
+// Tests that breaking changes between snapshots are reported, and compatible ones aren't.
+func TestCheckCompatibility(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		from, to string
+		expected []string
+	}{
+		{"unchanged", "", "", nil},
+		{"added method", "rpc CancelOrder(GetOrderRequest) returns (Order);",
+			"rpc CancelOrder(GetOrderRequest) returns (Order);\n  rpc ListOrders(GetOrderRequest) returns (Order);", nil},
+		{"added field", "int32 total = 3;", "int32 total = 3;\n  string note = 4;", nil},
+		{"removed method", "rpc CancelOrder(GetOrderRequest) returns (Order);", "",
+			[]string{"/snapshot_test.Orders/CancelOrder: method removed"}},
+		{"changed output", "rpc CancelOrder(GetOrderRequest) returns (Order);",
+			"rpc CancelOrder(GetOrderRequest) returns (Part);",
+			[]string{"/snapshot_test.Orders/CancelOrder: output type changed from snapshot_test.Order to snapshot_test.Part"}},
+		{"streaming", "rpc CancelOrder(GetOrderRequest) returns (Order);",
+			"rpc CancelOrder(GetOrderRequest) returns (stream Order);",
+			[]string{"/snapshot_test.Orders/CancelOrder: streaming changed"}},
+		{"removed field", "int32 total = 3;", "", []string{"snapshot_test.Order: field 3 (total) removed"}},
+		{"renamed field", "int32 total = 3;", "int32 sum = 3;",
+			[]string{"snapshot_test.Order: field 3 renamed from total to sum"}},
+		{"changed field type", "int32 total = 3;", "repeated int64 total = 3;",
+			[]string{"snapshot_test.Order: field total changed from int32 to repeated int64"}},
+		{"removed enum value", "BLUE = 1;", "", []string{"snapshot_test.Color: value BLUE removed"}},
+	}
+	previous := snapshotOf(t, snapshotProto)
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			next := snapshotOf(t, strings.Replace(snapshotProto, fixture.from, fixture.to, 1))
+			changes, err := CheckCompatibility(previous, next)
+			require.Nil(t, err)
+			var descriptions []string
+			for _, change := range changes {
+				descriptions = append(descriptions, change.String())
+			}
+			assertions.Equal(t, fixture.expected, descriptions)
+		})
+	}
+
+	_, err := CheckCompatibility(previous, &APISnapshot{Version: APISnapshotVersion + 1})
+	assertions.Error(t, err, "Unsupported version accepted")
+}
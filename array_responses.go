@@ -0,0 +1,67 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Reading of array-rooted response bodies.
+//
+// A message can't be read from a bare JSON array, so openapi2proto wraps operations returning
+// arrays in a message with a single repeated field. A response which is an array is read into that
+// field, as though it were the object {"<field>": [...]}. Responses which are objects are read as
+// usual.
+
+import (
+	"bytes"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Returns the field array responses are read into: the output type's only field, if it's a list.
+// Returns nil if the output type has other fields, or the success response's schema is declared as
+// something other than an array.
+func resolveArrayField(operation *spec.Operation, outputType *desc.MessageDescriptor) *desc.FieldDescriptor {
+	fields := outputType.GetFields()
+	if len(fields) != 1 || !fields[0].IsRepeated() || fields[0].IsMap() {
+		return nil
+	}
+	if response := successResponse(operation); response != nil && response.Schema != nil {
+		schema := response.Schema
+		// Referenced schemas can't be resolved here, so are assumed to be arrays.
+		if len(schema.Type) > 0 && !schema.Type.Contains("array") && schema.Ref.String() == "" {
+			return nil
+		}
+	}
+	return fields[0]
+}
+
+// Returns a response body with an array at its root wrapped in an object, as the value of the
+// operation's array field. Other bodies are returned unchanged.
+func (p *operationAdapter) wrapArrayResponse(body []byte) []byte {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return body
+	}
+	return wrapRootValue(p.arrayField, trimmed)
+}
+
+// Returns the JSON object {"<field>": <value>}, with the given field's name.
+func wrapRootValue(field *desc.FieldDescriptor, value []byte) []byte {
+	wrapped := make([]byte, 0, len(value)+len(field.GetName())+5)
+	wrapped = append(wrapped, `{"`...)
+	wrapped = append(wrapped, field.GetName()...)
+	wrapped = append(wrapped, `":`...)
+	wrapped = append(wrapped, value...)
+	return append(wrapped, '}')
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const arrayResponsesProto = `
+syntax = "proto3";
+
+package array_test;
+
+message ListItemsRequest {
+  string filter = 1;
+}
+
+message Item {
+  string name = 1;
+}
+
+message ListItemsResponse {
+  repeated Item items = 1;
+}
+
+message Page {
+  repeated Item items = 1;
+  string next = 2;
+}
+
+message Index {
+  map<string, Item> items = 1;
+}
+
+service Items {
+  rpc ListItems(ListItemsRequest) returns (ListItemsResponse);
+}
+`
+
+// Tests that only outputs with a single list field, for array schemas, get an array field.
+func TestResolveArrayField(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(arrayResponsesProto))
+	require.Nil(t, err)
+	withSchema := func(schema *spec.Schema) *spec.Operation {
+		return &spec.Operation{OperationProps: spec.OperationProps{Responses: &spec.Responses{
+			ResponsesProps: spec.ResponsesProps{StatusCodeResponses: map[int]spec.Response{
+				200: {ResponseProps: spec.ResponseProps{Schema: schema}},
+			}},
+		}}}
+	}
+	fixtures := []struct {
+		name      string
+		operation *spec.Operation
+		output    string
+		found     bool
+	}{
+		{"array schema", withSchema(spec.ArrayProperty(spec.RefProperty("#/definitions/Item"))),
+			"array_test.ListItemsResponse", true},
+		{"referenced schema", withSchema(spec.RefProperty("#/definitions/Items")),
+			"array_test.ListItemsResponse", true},
+		{"no schema", &spec.Operation{}, "array_test.ListItemsResponse", true},
+		{"object schema", withSchema(&spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"object"}}}),
+			"array_test.ListItemsResponse", false},
+		{"other fields", &spec.Operation{}, "array_test.Page", false},
+		{"map field", &spec.Operation{}, "array_test.Index", false},
+		{"singular field", &spec.Operation{}, "array_test.ListItemsRequest", false},
+	}
+	for _, fixture := range fixtures {
+		field := resolveArrayField(fixture.operation, fileDesc.FindMessage(fixture.output))
+		assertions.Equal(t, fixture.found, field != nil, "Wrong array field for %s", fixture.name)
+	}
+}
+
+// Tests that array responses are read into the output's list field.
+func TestArrayResponses(t *testing.T) {
+	fixtures := []struct {
+		name string
+		body string
+	}{
+		{"array", ` [{"name": "a"}, {"name": "b"}]`},
+		{"object", `{"items": [{"name": "a"}, {"name": "b"}]}`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adapter, closeServer := testOperation{
+				method:     testMethod(t, arrayResponsesProto, "array_test.Items", "ListItems"),
+				path:       "/items",
+				operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "listItems"}},
+				parameters: map[string]*spec.Parameter{},
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(fixture.body))
+				},
+			}.adapter(t)
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{}`}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			require.Len(t, stream.sent, 1)
+			items := stream.sent[0].GetFieldByName("items").([]interface{})
+			if assertions.Len(t, items, 2) {
+				assertions.Equal(t, "b", items[1].(*dynamic.Message).GetFieldByName("name"))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Structured audit events for proxied calls.
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// AuditEvent is a record of a single proxied call.
+type AuditEvent struct {
+	// When the call was received.
+	Time time.Time `json:"time"`
+	// The caller's identity: the authenticated subject, or else as read from incoming metadata. Empty
+	// if unknown.
+	Caller string `json:"caller"`
+	// The fully-qualified gRPC method name that was called.
+	Operation string `json:"operation"`
+	// The HTTP method of the backend request.
+	HTTPMethod string `json:"httpMethod"`
+	// The swagger path template of the backend request.
+	Path string `json:"path"`
+	// Values of all path parameters sent to the backend, keyed by parameter name.
+	PathParams map[string]string `json:"pathParams,omitempty"`
+	// The gRPC status code returned to the caller.
+	Code codes.Code `json:"code"`
+	// The time spent handling the call.
+	Latency time.Duration `json:"latency"`
+}
+
+// AuditSink receives audit events. Implementations must be safe for concurrent use, and should not
+// block for long; they are called inline at the end of every call.
+type AuditSink interface {
+	Audit(event *AuditEvent)
+}
+
+// AuditSinkFunc adapts a plain function to an AuditSink.
+type AuditSinkFunc func(event *AuditEvent)
+
+// Audit calls f(event).
+func (f AuditSinkFunc) Audit(event *AuditEvent) {
+	f(event)
+}
+
+// An AuditSink writing one JSON object per line to a writer.
+type jsonAuditSink struct {
+	// Guards writes, so that concurrent events don't interleave.
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONAuditSink returns an AuditSink writing each event as a line of JSON to the given writer,
+// such as os.Stdout or an open file.
+func NewJSONAuditSink(writer io.Writer) AuditSink {
+	return &jsonAuditSink{encoder: json.NewEncoder(writer)}
+}
+
+func (s *jsonAuditSink) Audit(event *AuditEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.encoder.Encode(event); err != nil {
+		log.Printf("WARNING: Error writing audit event: %s", err)
+	}
+}
+
+// Returns the authenticated caller's subject, or else the caller identity from the first value of
+// the given incoming metadata key, or the empty string if it is unset.
+func callerFromContext(ctx context.Context, metadataKey string) string {
+	if caller := CallerFromContext(ctx); caller != nil {
+		return caller.Subject
+	}
+	if metadataKey == "" {
+		return ""
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return firstMetadataValue(md, metadataKey)
+}
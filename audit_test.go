@@ -0,0 +1,76 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that the JSON sink writes one parseable line per event.
+func TestJSONAuditSink(t *testing.T) {
+	assert := assertions.New(t)
+	var buffer bytes.Buffer
+	sink := NewJSONAuditSink(&buffer)
+	sink.Audit(&AuditEvent{Caller: "alice", Operation: "a.B", Code: codes.NotFound})
+	sink.Audit(&AuditEvent{Caller: "bob", Operation: "a.C", Latency: time.Second})
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	if assert.Equal(2, len(lines), "Expected one line per event") {
+		var event AuditEvent
+		assert.Nil(json.Unmarshal(lines[0], &event), "Bad JSON written")
+		assert.Equal("alice", event.Caller)
+		assert.Equal(codes.NotFound, event.Code)
+		assert.Nil(json.Unmarshal(lines[1], &event), "Bad JSON written")
+		assert.Equal(time.Second, event.Latency)
+	}
+}
+
+// Tests that proxied calls emit an audit event with the caller and path parameters.
+func TestHandleGRPCRequestAudits(t *testing.T) {
+	assert := assertions.New(t)
+	var events []*AuditEvent
+	options := &ServiceOptions{
+		AuditSink:         AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) }),
+		CallerMetadataKey: "X-Caller",
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-caller", "alice"))
+	stream := &fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}
+	assert.Nil(adapter.handleGRPCRequest(stream), "Error handling request")
+
+	if assert.Equal(1, len(events), "Expected a single audit event") {
+		event := events[0]
+		assert.Equal("alice", event.Caller)
+		assert.Equal("test_service.Items.GetItem", event.Operation)
+		assert.Equal("GET", event.HTTPMethod)
+		assert.Equal("/items/{itemId}", event.Path)
+		assert.Equal(map[string]string{"itemId": "abc"}, event.PathParams)
+		assert.Equal(codes.OK, event.Code)
+	}
+}
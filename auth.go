@@ -0,0 +1,116 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Authentication of incoming calls, before any backend request is made.
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Caller is the authenticated caller of a call.
+type Caller struct {
+	// The caller's identity, such as a JWT subject or a certificate's common name.
+	Subject string
+	// Claims or attributes established by the authenticator. May be nil.
+	Claims map[string]interface{}
+}
+
+// Authenticator authenticates incoming calls. Implementations must be safe for concurrent use.
+type Authenticator interface {
+	// Authenticate returns the caller of a call, from the metadata and peer in its context. An error
+	// rejects the call; errors without a gRPC status are returned as Unauthenticated.
+	Authenticate(ctx context.Context) (*Caller, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator.
+type AuthenticatorFunc func(ctx context.Context) (*Caller, error)
+
+// Authenticate calls f(ctx).
+func (f AuthenticatorFunc) Authenticate(ctx context.Context) (*Caller, error) {
+	return f(ctx)
+}
+
+// Context key for a *Caller.
+type callerKey struct{}
+
+// CallerFromContext returns the authenticated caller of a call, or nil if the call wasn't
+// authenticated. The caller is set on the context passed to hooks called while proxying.
+func CallerFromContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+// Authenticates a call with the configured authenticator, returning its context with the caller
+// set.
+func (p *operationAdapter) authenticate(ctx context.Context) (context.Context, error) {
+	caller, err := p.options.Authenticator.Authenticate(ctx)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return ctx, err
+		}
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if caller == nil {
+		return ctx, status.Error(codes.Unauthenticated, "no caller identity")
+	}
+	return context.WithValue(ctx, callerKey{}, caller), nil
+}
+
+// TLSAuthenticator authenticates callers by their verified TLS client certificate. The server's TLS
+// configuration must verify client certificates. The caller's subject is the certificate's common
+// name.
+type TLSAuthenticator struct {
+	// If set, only certificates with one of these names, as the common name or a DNS name, are
+	// accepted.
+	AllowedNames []string
+}
+
+// Authenticate returns the caller named by the call's verified client certificate.
+func (a *TLSAuthenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	callerPeer, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no peer information")
+	}
+	tlsInfo, ok := callerPeer.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "connection does not use TLS")
+	}
+	if len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no verified client certificate")
+	}
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	if len(a.AllowedNames) > 0 && !a.allowed(append([]string{cert.Subject.CommonName}, cert.DNSNames...)) {
+		return nil, status.Errorf(codes.Unauthenticated,
+			"client certificate %q is not allowed", cert.Subject.CommonName)
+	}
+	return &Caller{Subject: cert.Subject.CommonName}, nil
+}
+
+// Returns true if any of the given names is allowed.
+func (a *TLSAuthenticator) allowed(names []string) bool {
+	for _, name := range names {
+		for _, allowed := range a.AllowedNames {
+			if name == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Tests that calls failing authentication are rejected without a backend request, and that
+// authenticated callers are audited.
+func TestHandleGRPCRequestAuthenticates(t *testing.T) {
+	assert := assertions.New(t)
+	var events []*AuditEvent
+	backendCalls := 0
+	options := &ServiceOptions{
+		AuditSink: AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) }),
+		Authenticator: AuthenticatorFunc(func(ctx context.Context) (*Caller, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if firstMetadataValue(md, "token") != "secret" {
+				return nil, fmt.Errorf("bad token")
+			}
+			return &Caller{Subject: "alice"}, nil
+		}),
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assert.Equal(codes.Unauthenticated, errorCode(err))
+	assert.Equal(0, backendCalls, "Backend called for unauthenticated call")
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("token", "secret"))
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}))
+	assert.Equal(1, backendCalls)
+	require.Len(t, events, 2)
+	assert.Equal(codes.Unauthenticated, events[0].Code)
+	assert.Equal("alice", events[1].Caller, "Authenticated caller not audited")
+}
+
+// Returns a context for a call over TLS with the given verified client certificate.
+func tlsPeerContext(cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{}
+	if cert != nil {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+// Tests authentication by client certificate.
+func TestTLSAuthenticator(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}, DNSNames: []string{"orders.internal"}}
+	fixtures := []struct {
+		name        string
+		ctx         context.Context
+		allowed     []string
+		wantSubject string
+	}{
+		{"AnyVerified", tlsPeerContext(cert), nil, "orders"},
+		{"AllowedByCommonName", tlsPeerContext(cert), []string{"orders"}, "orders"},
+		{"AllowedByDNSName", tlsPeerContext(cert), []string{"orders.internal"}, "orders"},
+		{"NotAllowed", tlsPeerContext(cert), []string{"payments"}, ""},
+		{"Unverified", tlsPeerContext(nil), nil, ""},
+		{"NoTLS", peer.NewContext(context.Background(), &peer.Peer{}), nil, ""},
+		{"NoPeer", context.Background(), nil, ""},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			authenticator := &TLSAuthenticator{AllowedNames: fixture.allowed}
+			caller, err := authenticator.Authenticate(fixture.ctx)
+			if fixture.wantSubject == "" {
+				assert.Equal(codes.Unauthenticated, errorCode(err))
+				return
+			}
+			require.Nil(t, err, "Error authenticating: %v", err)
+			assert.Equal(fixture.wantSubject, caller.Subject)
+		})
+	}
+}
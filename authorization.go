@@ -0,0 +1,65 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Authorization of incoming calls, before any backend request is made.
+
+import (
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationRequest describes a call to be authorized.
+type AuthorizationRequest struct {
+	// The authenticated caller, or nil if calls aren't authenticated.
+	Caller *Caller
+	// The operation called.
+	Operation *OperationInfo
+	// The request message. This must not be modified.
+	Message *dynamic.Message
+}
+
+// Authorizer decides whether calls may be proxied. Implementations must be safe for concurrent use.
+type Authorizer interface {
+	// Authorize returns nil if the call may be proxied. An error rejects the call; errors without a
+	// gRPC status are returned as PermissionDenied.
+	Authorize(ctx context.Context, request *AuthorizationRequest) error
+}
+
+// AuthorizerFunc adapts a function to an Authorizer.
+type AuthorizerFunc func(ctx context.Context, request *AuthorizationRequest) error
+
+// Authorize calls f(ctx, request).
+func (f AuthorizerFunc) Authorize(ctx context.Context, request *AuthorizationRequest) error {
+	return f(ctx, request)
+}
+
+// Authorizes a call with the configured authorizer.
+func (p *operationAdapter) authorize(ctx context.Context, msg *dynamic.Message) error {
+	err := p.options.Authorizer.Authorize(ctx, &AuthorizationRequest{
+		Caller:    CallerFromContext(ctx),
+		Operation: p.info,
+		Message:   msg,
+	})
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.PermissionDenied, err.Error())
+}
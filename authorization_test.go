@@ -0,0 +1,58 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests that calls are authorized by caller, operation and message before any backend request.
+func TestHandleGRPCRequestAuthorizes(t *testing.T) {
+	assert := assertions.New(t)
+	backendCalls := 0
+	options := &ServiceOptions{
+		Authenticator: AuthenticatorFunc(func(ctx context.Context) (*Caller, error) {
+			return &Caller{Subject: "alice"}, nil
+		}),
+		Authorizer: AuthorizerFunc(func(ctx context.Context, request *AuthorizationRequest) error {
+			if request.Operation.ID != "getItem" {
+				return fmt.Errorf("unexpected operation %s", request.Operation.ID)
+			}
+			if request.Message.GetFieldByName("itemId") != request.Caller.Subject {
+				return fmt.Errorf("not your item")
+			}
+			return nil
+		}),
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "bob"}`})
+	assert.Equal(codes.PermissionDenied, errorCode(err))
+	assert.Equal(0, backendCalls, "Backend called for unauthorized call")
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "alice"}`}))
+	assert.Equal(1, backendCalls)
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command bench is a load-test harness for swaggrpc. It serves a fake swagger backend and a gRPC
+// proxy in front of it, drives calls through the proxy at a fixed rate, and reports latencies.
+// Profiles of the running proxy are served by net/http/pprof, e.g.:
+//
+//	go run ./bench -qps 2000 -duration 30s &
+//	go tool pprof http://localhost:6060/debug/pprof/profile?seconds=20
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nordstrom/swaggrpc"
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The proxied service. Items have a map and repeated field so that responses exercise more of the
+// conversion layer than scalars alone.
+const benchProto = `
+syntax = "proto3";
+
+package bench;
+
+message GetItemRequest {
+  string itemId = 1;
+  string filter = 2;
+}
+
+message Item {
+  string itemId = 1;
+  string name = 2;
+  string description = 3;
+  repeated string tags = 4;
+  map<string, string> attributes = 5;
+}
+
+service Items {
+  rpc GetItem (GetItemRequest) returns (Item) {}
+}
+`
+
+// The file name the proto is parsed as.
+const benchProtoFile = "bench.proto"
+
+// The proxied gRPC method.
+const benchMethod = "/bench.Items/GetItem"
+
+var (
+	qps         = flag.Int("qps", 1000, "target calls per second")
+	duration    = flag.Duration("duration", 10*time.Second, "how long to drive calls for")
+	concurrency = flag.Int("concurrency", 32, "maximum concurrent calls")
+	items       = flag.Int("items", 20, "number of tags and attributes in each response")
+	pprofAddr   = flag.String("pprof", "localhost:6060", "address to serve pprof on; empty to disable")
+)
+
+func main() {
+	flag.Parse()
+	if *pprofAddr != "" {
+		go func() {
+			log.Printf("Serving pprof on http://%s/debug/pprof/", *pprofAddr)
+			log.Print(http.ListenAndServe(*pprofAddr, nil))
+		}()
+	}
+
+	method, err := loadMethod()
+	if err != nil {
+		log.Fatalf("Could not load proto: %s", err)
+	}
+	backend, err := serveBackend(backendResponse(*items))
+	if err != nil {
+		log.Fatalf("Could not start backend: %s", err)
+	}
+	proxy, err := serveProxy(backend, method)
+	if err != nil {
+		log.Fatalf("Could not start proxy: %s", err)
+	}
+	conn, err := grpc.Dial(proxy, grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("Could not dial proxy: %s", err)
+	}
+	defer conn.Close()
+
+	log.Printf("Driving %d calls per second for %s", *qps, *duration)
+	result := drive(conn, method, *qps, *duration, *concurrency)
+	fmt.Println(result)
+}
+
+// Returns a representative backend response body with the given number of tags and attributes.
+func backendResponse(count int) []byte {
+	tags := make([]string, count)
+	attributes := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		tags[i] = fmt.Sprintf("tag-%d", i)
+		attributes[fmt.Sprintf("attribute-%d", i)] = strings.Repeat("v", 32)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"itemId":      "item-1",
+		"name":        "A representative item",
+		"description": strings.Repeat("A long description. ", 20),
+		"tags":        tags,
+		"attributes":  attributes,
+		// Fields unknown to the proto are skipped by the proxy.
+		"unmapped": map[string]interface{}{"nested": []int{1, 2, 3}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+// Serves the fake backend on a local port, returning its address.
+func serveBackend(body []byte) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	return listener.Addr().String(), nil
+}
+
+// Serves a proxy for the method to the given backend on a local port, returning its address.
+func serveProxy(backend string, method *desc.MethodDescriptor) (string, error) {
+	registry := swaggrpc.NewOperationRegistry()
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	parameters := map[string]*spec.Parameter{
+		"itemId": spec.PathParam("itemId"),
+		"filter": spec.QueryParam("filter"),
+	}
+	httpClient := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+	swaggerClient := runtimeclient.NewWithClient(backend, "/", []string{"http"}, httpClient)
+	err := registry.Add(httpClient, swaggerClient, "GET", "/items/{itemId}", operation, parameters, method, nil)
+	if err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(registry.Handler()))
+	go server.Serve(listener)
+	return listener.Addr().String(), nil
+}
+
+// Parses the benchmark proto, returning the proxied method.
+func loadMethod() (*desc.MethodDescriptor, error) {
+	parser := protoparse.Parser{Accessor: func(filename string) (io.ReadCloser, error) {
+		if filename != benchProtoFile {
+			return nil, fmt.Errorf("unknown file %s", filename)
+		}
+		return ioutil.NopCloser(bytes.NewReader([]byte(benchProto))), nil
+	}}
+	files, err := parser.ParseFiles(benchProtoFile)
+	if err != nil {
+		return nil, err
+	}
+	return files[0].FindService("bench.Items").FindMethodByName("GetItem"), nil
+}
+
+// The outcome of a load test.
+type result struct {
+	elapsed   time.Duration
+	latencies []time.Duration
+	errors    int
+}
+
+// Calls the method at the given rate for the given duration, with at most concurrency calls in
+// flight. Calls are delayed, rather than dropped, while all workers are busy.
+func drive(
+	conn *grpc.ClientConn,
+	method *desc.MethodDescriptor,
+	qps int,
+	duration time.Duration,
+	concurrency int,
+) *result {
+	calls := make(chan struct{}, concurrency)
+	var mutex sync.Mutex
+	outcome := &result{}
+	var wait sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			request := dynamic.NewMessage(method.GetInputType())
+			request.SetFieldByName("itemId", "item-1")
+			request.SetFieldByName("filter", "all")
+			for range calls {
+				response := dynamic.NewMessage(method.GetOutputType())
+				start := time.Now()
+				err := grpc.Invoke(context.Background(), benchMethod, request, response, conn)
+				latency := time.Since(start)
+				mutex.Lock()
+				if err != nil {
+					outcome.errors++
+				} else {
+					outcome.latencies = append(outcome.latencies, latency)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(qps))
+	for time.Since(start) < duration {
+		<-ticker.C
+		calls <- struct{}{}
+	}
+	ticker.Stop()
+	close(calls)
+	wait.Wait()
+	outcome.elapsed = time.Since(start)
+	return outcome
+}
+
+// Returns the latency at the given quantile, from sorted latencies.
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func (r *result) String() string {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	completed := len(r.latencies) + r.errors
+	return fmt.Sprintf("calls: %d (%.0f/s), errors: %d, latency p50: %s, p90: %s, p99: %s, max: %s",
+		completed, float64(completed)/r.elapsed.Seconds(), r.errors,
+		quantile(r.latencies, 0.5), quantile(r.latencies, 0.9), quantile(r.latencies, 0.99),
+		quantile(r.latencies, 1))
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Raw binary request and response bodies, for bytes fields.
+//
+// Bytes fields are sent as base64, swagger's "byte" format, except for parameters of the "binary"
+// format. A binary body parameter's field is sent as the request body, as the first media type the
+// operation consumes which isn't JSON or a form, or else application/octet-stream. Binary form
+// parameters are uploaded as files; see form_params.go.
+//
+// Responses for an output message with a single bytes field (see scalar_responses.go) are read into
+// that field as-is, unless they're JSON.
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+const octetStreamMediaType = "application/octet-stream"
+
+// Returns true for body parameters of the "binary" format.
+func isBinaryBodyParam(param *spec.Parameter) bool {
+	return param.In == "body" && param.Schema != nil && param.Schema.Format == "binary"
+}
+
+// Checks that a binary body parameter's field is a single bytes field.
+func checkBinaryBodyField(param *spec.Parameter, field *desc.FieldDescriptor) error {
+	if field.IsRepeated() || field.GetType() != descriptor.FieldDescriptorProto_TYPE_BYTES {
+		return fmt.Errorf("binary body parameter %s must map to a singular bytes field, not %s",
+			param.Name, field.GetFullyQualifiedName())
+	}
+	return nil
+}
+
+// Returns the media type of an operation's binary bodies, or empty if it has no binary body
+// parameter.
+func binaryMediaTypeFor(operation *spec.Operation, parameters map[string]*spec.Parameter) string {
+	for _, param := range parameters {
+		if !isBinaryBodyParam(param) {
+			continue
+		}
+		for _, consumed := range operation.Consumes {
+			if !isJSONMediaType(consumed) && baseMediaType(consumed) != formMediaType &&
+				baseMediaType(consumed) != multipartMediaType {
+				return consumed
+			}
+		}
+		return octetStreamMediaType
+	}
+	return ""
+}
+
+// Writes the value of a bytes field as the request body.
+func (step *paramStep) writeBinaryBody(value interface{}, request runtime.ClientRequest) error {
+	contents, _ := value.([]byte)
+	return request.SetBodyParam(bytes.NewReader(contents))
+}
+
+// Returns true if responses which aren't JSON are read as-is into the output's bytes field.
+func (p *operationAdapter) readsBinary() bool {
+	return p.scalarField != nil && p.scalarField.GetType() == descriptor.FieldDescriptorProto_TYPE_BYTES
+}
+
+// Reads a response body as-is into the output's bytes field.
+func (p *operationAdapter) readBinaryResponse(response runtime.ClientResponse) (interface{}, error) {
+	body, err := p.readResponseBody(response.Body(), response.GetHeader("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	message := p.newMessage(p.outputProtoType)
+	if err := message.TrySetField(p.scalarField, body); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
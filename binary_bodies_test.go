@@ -0,0 +1,108 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const binaryBodiesProto = `
+syntax = "proto3";
+
+package binary_test;
+
+message Upload {
+  bytes data = 1;
+  string name = 2;
+}
+
+message Blob {
+  bytes data = 1;
+}
+
+service Blobs {
+  rpc PutBlob(Upload) returns (Blob);
+}
+`
+
+// Tests that binary bodies are sent and read as raw bytes.
+func TestBinaryBodies(t *testing.T) {
+	// "AAEC/w==" is the JSON encoding of the bytes below.
+	contents := []byte{0, 1, 2, 255}
+	fixtures := []struct {
+		name                string
+		consumes            []string
+		produces            []string
+		requestContentType  string
+		responseContentType string
+		responseBody        string
+	}{
+		{"octet streams", nil, nil, "application/octet-stream", "application/octet-stream",
+			string(contents)},
+		{"declared types", []string{"application/json", "image/png"}, []string{"image/png"}, "image/png",
+			"image/png", string(contents)},
+		{"JSON response", nil, nil, "application/octet-stream", "application/json", `{"data": "AAEC/w=="}`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			operation := &spec.Operation{OperationProps: spec.OperationProps{
+				ID: "putBlob", Consumes: fixture.consumes, Produces: fixture.produces,
+			}}
+			params := map[string]*spec.Parameter{
+				"data": spec.BodyParam("data", &spec.Schema{SchemaProps: spec.SchemaProps{
+					Type: spec.StringOrArray{"string"}, Format: "binary",
+				}}),
+			}
+			adapter, closeServer := testOperation{
+				method:     testMethod(t, binaryBodiesProto, "binary_test.Blobs", "PutBlob"),
+				httpMethod: "PUT",
+				path:       "/blob",
+				operation:  operation,
+				parameters: params,
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					body, err := ioutil.ReadAll(r.Body)
+					assert.Nil(err)
+					assert.Equal(contents, body, "Bad request body")
+					assert.Equal(fixture.requestContentType, r.Header.Get("Content-Type"))
+					w.Header().Set("Content-Type", fixture.responseContentType)
+					w.Write([]byte(fixture.responseBody))
+				},
+			}.adapter(t)
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"data": "AAEC/w==", "name": "ignored"}`}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			require.Len(t, stream.sent, 1)
+			assert.Equal(contents, stream.sent[0].GetFieldByName("data"))
+		})
+	}
+}
+
+// Tests that binary body parameters must map to a single bytes field.
+func TestBinaryBodyFieldType(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(binaryBodiesProto))
+	require.Nil(t, err)
+	upload := fileDesc.FindMessage("binary_test.Upload")
+	param := spec.BodyParam("data", &spec.Schema{SchemaProps: spec.SchemaProps{Format: "binary"}})
+	assertions.Nil(t, checkBinaryBodyField(param, upload.FindFieldByName("data")))
+	assertions.Error(t, checkBinaryBodyField(param, upload.FindFieldByName("name")))
+}
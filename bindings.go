@@ -0,0 +1,197 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Explicit bindings of hand-written proto methods to swagger operations.
+//
+// Protos generated by openapi2proto are bound to the spec by naming: services after tags, methods
+// after operation IDs, and fields after parameters. Curated protos needn't follow these names; a
+// sidecar bindings file declares which operation each method proxies, and which field each of the
+// operation's parameters is sent from:
+//
+//   {
+//     "methods": [
+//       {
+//         "method": "catalog.v1.Catalog/FindProducts",
+//         "operation": "GET /products",
+//         "params": {"q": "query.text", "page": "page_token"}
+//       }
+//     ]
+//   }
+//
+// Operations are named by ID or as "<HTTP method> <path>". Parameters without a binding are matched
+// to fields as usual; see param_fields.go.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Bindings declares the swagger operations proxied by the methods of hand-written protos.
+type Bindings struct {
+	Methods []MethodBinding `json:"methods"`
+}
+
+// MethodBinding binds one gRPC method to a swagger operation.
+type MethodBinding struct {
+	// The method's full name, like "package.Service/Method". A leading slash is allowed.
+	Method string `json:"method"`
+	// The operation's ID, or its HTTP method and path template, like "GET /items/{itemId}".
+	Operation string `json:"operation"`
+	// Request fields to send parameters from, as field names keyed by parameter. Fields of nested
+	// messages are named with dots, like "filter.date_range.start".
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// BoundMethod is a gRPC method bound to the swagger operation it proxies.
+type BoundMethod struct {
+	OperationMethod
+	// The method's descriptor.
+	Descriptor *desc.MethodDescriptor
+}
+
+// LoadBindings reads a JSON bindings file.
+func LoadBindings(reader io.Reader) (*Bindings, error) {
+	bindings := &Bindings{}
+	if err := json.NewDecoder(reader).Decode(bindings); err != nil {
+		return nil, fmt.Errorf("bad bindings: %s", err)
+	}
+	return bindings, nil
+}
+
+// Bind resolves each binding's method in the given proto files and its operation in the spec.
+// Parameter bindings are added to the returned operations as x-swaggrpc-param-fields mappings, so
+// OperationOptions.ParamFields still take precedence. Returns an error if a method or operation
+// can't be found, a method is bound twice, or a parameter isn't one of the operation's.
+func (b *Bindings) Bind(swagger *spec.Swagger, files ...*desc.FileDescriptor) ([]BoundMethod, error) {
+	bound := make([]BoundMethod, 0, len(b.Methods))
+	seen := make(map[string]bool, len(b.Methods))
+	for _, binding := range b.Methods {
+		name := strings.TrimPrefix(binding.Method, "/")
+		if seen[name] {
+			return nil, fmt.Errorf("method %s is bound more than once", name)
+		}
+		seen[name] = true
+		method := findBoundMethod(name, files)
+		if method == nil {
+			return nil, fmt.Errorf("no method %s in the given protos", name)
+		}
+		operationMethod, pathItem := findBoundOperation(swagger, binding.Operation)
+		if operationMethod == nil {
+			return nil, fmt.Errorf("method %s is bound to unknown operation %q", name, binding.Operation)
+		}
+		for param := range binding.Params {
+			if !declaresParam(swagger, operationMethod.Operation, pathItem, param) {
+				return nil, fmt.Errorf("method %s binds parameter %s, which operation %q doesn't declare",
+					name, param, binding.Operation)
+			}
+		}
+		operationMethod.Service = method.GetService().GetName()
+		operationMethod.Method = method.GetName()
+		if len(binding.Params) > 0 {
+			operation, err := withParamFields(operationMethod.Operation, binding.Params)
+			if err != nil {
+				return nil, fmt.Errorf("operation %q: %s", binding.Operation, err)
+			}
+			operationMethod.Operation = operation
+		}
+		bound = append(bound, BoundMethod{OperationMethod: *operationMethod, Descriptor: method})
+	}
+	return bound, nil
+}
+
+// Returns the method with a full name like "package.Service/Method" from the given files, or nil if
+// none defines it.
+func findBoundMethod(name string, files []*desc.FileDescriptor) *desc.MethodDescriptor {
+	slash := strings.LastIndex(name, "/")
+	if slash < 0 {
+		return nil
+	}
+	for _, file := range files {
+		if service := file.FindService(name[:slash]); service != nil {
+			return service.FindMethodByName(name[slash+1:])
+		}
+	}
+	return nil
+}
+
+// Returns the operation named by an ID or "<HTTP method> <path>", and the path item holding it, or
+// nil if the spec has no such operation.
+func findBoundOperation(swagger *spec.Swagger, name string) (*OperationMethod, *spec.PathItem) {
+	if swagger.Paths == nil {
+		return nil, nil
+	}
+	if fields := strings.Fields(name); len(fields) == 2 {
+		httpMethod := strings.ToUpper(fields[0])
+		if pathItem, ok := swagger.Paths.Paths[fields[1]]; ok {
+			if operation := pathItemOperation(&pathItem, httpMethod); operation != nil {
+				return &OperationMethod{HTTPMethod: httpMethod, Path: fields[1], Operation: operation}, &pathItem
+			}
+		}
+		return nil, nil
+	}
+	for path, pathItem := range swagger.Paths.Paths {
+		pathItem := pathItem
+		for _, httpMethod := range []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH"} {
+			if operation := pathItemOperation(&pathItem, httpMethod); operation != nil && operation.ID == name {
+				return &OperationMethod{HTTPMethod: httpMethod, Path: path, Operation: operation}, &pathItem
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Returns true if an operation or its path item declares a parameter, directly or by reference.
+func declaresParam(swagger *spec.Swagger, operation *spec.Operation, pathItem *spec.PathItem, name string) bool {
+	for _, params := range [][]spec.Parameter{operation.Parameters, pathItem.Parameters} {
+		for _, param := range params {
+			if param.Ref.String() != "" {
+				resolved, err := spec.ResolveParameter(swagger, param.Ref)
+				if err != nil {
+					continue
+				}
+				param = *resolved
+			}
+			if param.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns a copy of an operation with parameter to field mappings added to its
+// x-swaggrpc-param-fields extension, replacing mappings for the same parameters.
+func withParamFields(operation *spec.Operation, params map[string]string) (*spec.Operation, error) {
+	mapping := make(map[string]string)
+	if _, err := decodeExtension(operation.Extensions, paramFieldsExtension, &mapping); err != nil {
+		return nil, err
+	}
+	for param, field := range params {
+		mapping[param] = field
+	}
+	bound := *operation
+	bound.Extensions = make(spec.Extensions, len(operation.Extensions)+1)
+	for key, value := range operation.Extensions {
+		bound.Extensions[key] = value
+	}
+	setExtension(&bound, paramFieldsExtension, mapping)
+	return &bound, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Hand-written proto, named unlike the bindingsSpec operations.
+const bindingsProto = `
+syntax = "proto3";
+
+package catalog.v1;
+
+message FindProductsRequest {
+  Query query = 1;
+  string page_token = 2;
+}
+
+message Query {
+  string text = 1;
+}
+
+message Product {
+  string id = 1;
+}
+
+message ProductList {
+  repeated Product products = 1;
+}
+
+message GetProductRequest {
+  string id = 1;
+}
+
+service Catalog {
+  rpc FindProducts(FindProductsRequest) returns (ProductList);
+  rpc GetProduct(GetProductRequest) returns (Product);
+}
+`
+
+// Spec for the operations bound to bindingsProto.
+const bindingsSpec = `{
+  "swagger": "2.0",
+  "parameters": {
+    "page": {"name": "page", "in": "query", "type": "string"}
+  },
+  "paths": {
+    "/products": {
+      "get": {
+        "operationId": "listProducts",
+        "x-swaggrpc-param-fields": {"page": "cursor"},
+        "parameters": [
+          {"name": "q", "in": "query", "type": "string"},
+          {"$ref": "#/parameters/page"}
+        ]
+      }
+    },
+    "/products/{productId}": {
+      "parameters": [{"name": "productId", "in": "path", "required": true, "type": "string"}],
+      "get": {"operationId": "showProduct"}
+    }
+  }
+}`
+
+// Tests that bindings resolve methods and operations, and add parameter mappings to operations.
+func TestBind(t *testing.T) {
+	assert := assertions.New(t)
+	fileDesc, err := loadProtoFromBytes([]byte(bindingsProto))
+	require.Nil(t, err)
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(bindingsSpec), swagger))
+
+	bindings, err := LoadBindings(strings.NewReader(`{"methods": [
+    {
+      "method": "catalog.v1.Catalog/FindProducts",
+      "operation": "GET /products",
+      "params": {"q": "query.text", "page": "page_token"}
+    },
+    {
+      "method": "/catalog.v1.Catalog/GetProduct",
+      "operation": "showProduct",
+      "params": {"productId": "id"}
+    }
+  ]}`))
+	require.Nil(t, err)
+	bound, err := bindings.Bind(swagger, fileDesc)
+	require.Nil(t, err)
+	require.Len(t, bound, 2)
+
+	assert.Equal("Catalog", bound[0].Service)
+	assert.Equal("FindProducts", bound[0].Method)
+	assert.Equal("GET", bound[0].HTTPMethod)
+	assert.Equal("/products", bound[0].Path)
+	assert.Equal("FindProducts", bound[0].Descriptor.GetName())
+	mapping, err := resolveParamFields(bound[0].Operation, &OperationOptions{})
+	require.Nil(t, err)
+	assert.Equal(map[string]string{"q": "query.text", "page": "page_token"}, mapping)
+	assert.Equal(map[string]interface{}{"page": "cursor"},
+		swagger.Paths.Paths["/products"].Get.Extensions[paramFieldsExtension], "Spec was modified")
+
+	assert.Equal("GetProduct", bound[1].Method)
+	assert.Equal("/products/{productId}", bound[1].Path)
+	assert.Equal("showProduct", bound[1].Operation.ID)
+}
+
+// Tests that bindings to missing methods, operations and parameters are errors.
+func TestBindErrors(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(bindingsProto))
+	require.Nil(t, err)
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(bindingsSpec), swagger))
+
+	fixtures := []struct {
+		name     string
+		bindings []MethodBinding
+	}{
+		{"UnknownMethod", []MethodBinding{{Method: "catalog.v1.Catalog/Delete", Operation: "showProduct"}}},
+		{"UnknownService", []MethodBinding{{Method: "catalog.v1.Nope/GetProduct", Operation: "showProduct"}}},
+		{"UnknownOperation", []MethodBinding{{Method: "catalog.v1.Catalog/GetProduct", Operation: "getProduct"}}},
+		{"UnknownPath", []MethodBinding{{Method: "catalog.v1.Catalog/GetProduct", Operation: "POST /products"}}},
+		{"UnknownParam", []MethodBinding{{
+			Method:    "catalog.v1.Catalog/GetProduct",
+			Operation: "showProduct",
+			Params:    map[string]string{"id": "id"},
+		}}},
+		{"BoundTwice", []MethodBinding{
+			{Method: "catalog.v1.Catalog/GetProduct", Operation: "showProduct"},
+			{Method: "/catalog.v1.Catalog/GetProduct", Operation: "listProducts"},
+		}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			_, err := (&Bindings{Methods: fixture.bindings}).Bind(swagger, fileDesc)
+			assertions.NotNil(t, err)
+		})
+	}
+
+	_, err = LoadBindings(strings.NewReader(`{"methods": {}}`))
+	assertions.NotNil(t, err, "Expected error for malformed bindings")
+}
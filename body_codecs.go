@@ -0,0 +1,149 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Codecs for backends speaking media types other than JSON, such as SOAP or XML-RPC.
+//
+// A codec is installed for a media type in ServiceOptions.Codecs. Operations consuming that type,
+// when it is chosen as in resolveBodyMediaType, have their request bodies encoded by the codec, and
+// responses with that Content-Type are decoded by it. Unlike plugins, which wrap the JSON stages
+// once per operation, codecs are called with each call's context, its whole request message, and the
+// raw response, which is enough to build and unwrap envelopes like SOAP's. Plugins don't wrap codecs.
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/go-openapi/runtime"
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+)
+
+// BodyCodec encodes request bodies, and decodes response bodies, of a media type.
+type BodyCodec interface {
+	// EncodeRequest returns the body of a backend request, encoding body, the value of the
+	// operation's body parameter.
+	EncodeRequest(request *CodecRequest, body proto.Message) (io.Reader, error)
+	// DecodeResponse reads a backend response body into an empty message of the output type.
+	DecodeResponse(response *CodecResponse, body []byte, message *dynamic.Message) error
+}
+
+// CodecCall describes the call a codec is encoding or decoding for.
+type CodecCall struct {
+	// The context of the gRPC call. OperationFromContext returns the call's operation.
+	Context context.Context
+	// The swagger operation called.
+	Operation *spec.Operation
+	// The gRPC method called.
+	Method *desc.MethodDescriptor
+	// The media type being encoded or decoded.
+	MediaType string
+}
+
+// CodecRequest describes a backend request being encoded.
+type CodecRequest struct {
+	CodecCall
+	// The whole request message, of which the body is a field.
+	Message proto.Message
+	// Sets a header on the backend request, such as SOAPAction.
+	SetHeader func(name string, values ...string) error
+}
+
+// CodecResponse describes a backend response being decoded.
+type CodecResponse struct {
+	CodecCall
+	// The response's HTTP status code.
+	StatusCode int
+	// Returns a header of the response.
+	Header func(name string) string
+}
+
+// Returns the codec installed for a media type, or nil if there is none.
+func (o *ServiceOptions) codecFor(mediaType string) BodyCodec {
+	if len(o.Codecs) == 0 || mediaType == "" {
+		return nil
+	}
+	for codecType, codec := range o.Codecs {
+		if baseMediaType(codecType) == baseMediaType(mediaType) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// Returns a copy of a swagger client accepting responses of the codecs' media types, which it would
+// otherwise reject before they reach the codecs. The copy shares the original's HTTP client.
+func withCodecConsumers(swaggerClient *runtimeclient.Runtime, codecs map[string]BodyCodec) *runtimeclient.Runtime {
+	copied := *swaggerClient
+	copied.Consumers = make(map[string]runtime.Consumer, len(swaggerClient.Consumers)+len(codecs))
+	for mediaType, consumer := range swaggerClient.Consumers {
+		copied.Consumers[mediaType] = consumer
+	}
+	for mediaType := range codecs {
+		// Codec responses are read by the codec, never by this consumer.
+		copied.Consumers[baseMediaType(mediaType)] = runtime.ByteStreamConsumer()
+	}
+	return &copied
+}
+
+// Returns the description of a call for codecs.
+func (p *operationAdapter) codecCall(call *proxiedCall, mediaType string) CodecCall {
+	return CodecCall{
+		Context:   call.ctx,
+		Operation: p.operation,
+		Method:    p.method,
+		MediaType: mediaType,
+	}
+}
+
+// Returns a body producer encoding a call's request bodies with a codec.
+func (p *operationAdapter) codecBodyProducer(codec BodyCodec, call *proxiedCall, message proto.Message,
+	request runtime.ClientRequest) BodyProducer {
+	codecRequest := &CodecRequest{
+		CodecCall: p.codecCall(call, p.bodyMediaType),
+		Message:   message,
+		SetHeader: request.SetHeaderParam,
+	}
+	return func(body proto.Message) (io.ReadCloser, error) {
+		reader, err := codec.EncodeRequest(codecRequest, body)
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := reader.(io.ReadCloser); ok {
+			return closer, nil
+		}
+		return ioutil.NopCloser(reader), nil
+	}
+}
+
+// Reads a backend response with a codec.
+func (p *operationAdapter) readCodecResponse(codec BodyCodec, call *proxiedCall,
+	response runtime.ClientResponse) (*dynamic.Message, error) {
+	body, err := p.readResponseBody(response.Body(), response.GetHeader("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	message := p.newMessage(p.outputProtoType)
+	codecResponse := &CodecResponse{
+		CodecCall:  p.codecCall(call, response.GetHeader("Content-Type")),
+		StatusCode: response.Code(),
+		Header:     response.GetHeader,
+	}
+	return message, codec.DecodeResponse(codecResponse, body, message)
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SOAP envelope exchanged with the test backend.
+type testEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Name    string   `xml:"Body>Widget>name"`
+	Owner   string   `xml:"Body>Widget>owner,omitempty"`
+}
+
+// A codec wrapping widgets in SOAP envelopes.
+type soapCodec struct{}
+
+func (soapCodec) EncodeRequest(request *CodecRequest, body proto.Message) (io.Reader, error) {
+	if err := request.SetHeader("SOAPAction", request.Operation.ID); err != nil {
+		return nil, err
+	}
+	widget, err := dynamic.AsDynamicMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	owner := request.Message.(*dynamic.Message).GetFieldByName("owner").(string)
+	encoded, err := xml.Marshal(testEnvelope{Name: widget.GetFieldByName("name").(string), Owner: owner})
+	return bytes.NewReader(encoded), err
+}
+
+func (soapCodec) DecodeResponse(response *CodecResponse, body []byte, message *dynamic.Message) error {
+	var envelope testEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return err
+	}
+	return message.TrySetFieldByName("name", envelope.Name+" from "+response.Header("X-Server"))
+}
+
+// Tests that codecs encode requests and decode responses of their media types.
+func TestBodyCodecs(t *testing.T) {
+	assert := assertions.New(t)
+	var contentType, action string
+	var received testEnvelope
+	adapter, closeServer := testOperation{
+		method:     testMethod(t, pluginsProto, "plugins_test.Widgets", "CreateWidget"),
+		httpMethod: "POST",
+		path:       "/widgets",
+		operation: &spec.Operation{OperationProps: spec.OperationProps{
+			ID:       "createWidget",
+			Consumes: []string{"text/xml"},
+		}},
+		parameters: map[string]*spec.Parameter{
+			"widget": spec.BodyParam("widget", nil),
+			"owner":  spec.QueryParam("owner").Typed("string", ""),
+		},
+		options: &ServiceOptions{Codecs: map[string]BodyCodec{"text/xml": soapCodec{}}},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			contentType, action = r.Header.Get("Content-Type"), r.Header.Get("SOAPAction")
+			body, _ := ioutil.ReadAll(r.Body)
+			xml.Unmarshal(body, &received)
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.Header().Set("X-Server", "soap")
+			w.Write([]byte(`<Envelope><Body><Widget><name>created</name></Widget></Body></Envelope>`))
+		},
+	}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"widget": {"name": "gear"}, "owner": "me"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.Equal("text/xml", contentType)
+	assert.Equal("createWidget", action)
+	assert.Equal(testEnvelope{XMLName: xml.Name{Local: "Envelope"}, Name: "gear", Owner: "me"}, received)
+	require.Len(t, stream.sent, 1)
+	assert.Equal("created from soap", stream.sent[0].GetFieldByName("name"))
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Selection of the media type request bodies are sent as.
+//
+// Bodies are sent as JSON, as URL-encoded forms, or by a BodyCodec. When an operation consumes several media types,
+// the first supported type in the preference order is chosen, and bodies are encoded to match. JSON
+// is preferred unless configured otherwise; a preference for "application/json" also matches
+// structured types like "application/merge-patch+json", which are sent as JSON.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	jsonMediaType = "application/json"
+	formMediaType = "application/x-www-form-urlencoded"
+)
+
+// The preference order used when none is configured.
+var defaultConsumesPreference = []string{jsonMediaType, formMediaType}
+
+// Returns the media type an operation's bodies are sent as, from the types it consumes and the
+// configured preference order. Operations declaring no supported type are sent JSON.
+func resolveBodyMediaType(operation *spec.Operation, options *ServiceOptions,
+	operationOptions *OperationOptions) (string, error) {
+	preference := operationOptions.ConsumesPreference
+	if preference == nil {
+		preference = options.ConsumesPreference
+	}
+	if preference == nil {
+		preference = defaultConsumesPreference
+		if len(options.Codecs) > 0 {
+			codecTypes := make([]string, 0, len(options.Codecs))
+			for codecType := range options.Codecs {
+				codecTypes = append(codecTypes, codecType)
+			}
+			sort.Strings(codecTypes)
+			preference = append(append([]string(nil), preference...), codecTypes...)
+		}
+	}
+	for _, preferred := range preference {
+		if baseMediaType(preferred) != jsonMediaType && baseMediaType(preferred) != formMediaType &&
+			options.codecFor(preferred) == nil {
+			return "", fmt.Errorf("unsupported media type %q in consumes preference for %s", preferred,
+				operation.ID)
+		}
+	}
+	if len(operation.Consumes) == 0 {
+		return jsonMediaType, nil
+	}
+	for _, preferred := range preference {
+		for _, consumed := range operation.Consumes {
+			if mediaTypeMatches(preferred, consumed) {
+				return consumed, nil
+			}
+		}
+	}
+	log.Printf("WARNING: operation %s consumes no supported media type in %v; sending JSON.",
+		operation.ID, operation.Consumes)
+	return jsonMediaType, nil
+}
+
+// Returns true if a consumed media type satisfies a preferred one.
+func mediaTypeMatches(preferred, consumed string) bool {
+	preferred, consumed = baseMediaType(preferred), baseMediaType(consumed)
+	return consumed == preferred || preferred == jsonMediaType && isJSONMediaType(consumed)
+}
+
+// Returns true for JSON media types, including structured syntax types like "application/foo+json".
+func isJSONMediaType(mediaType string) bool {
+	mediaType = baseMediaType(mediaType)
+	return mediaType == jsonMediaType || strings.HasPrefix(mediaType, "application/") &&
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// Returns a media type without its parameters, in lower case.
+func baseMediaType(mediaType string) string {
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		return parsed
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// Returns the BodyProducer for a media type chosen by resolveBodyMediaType.
+func bodyProducerFor(mediaType string) BodyProducer {
+	if baseMediaType(mediaType) == formMediaType {
+		return produceFormBody
+	}
+	return produceJSONBody
+}
+
+// A BodyProducer encoding messages as URL-encoded forms. Each field set in the message is a form
+// value, written as in the message's JSON: scalars as their JSON strings or literals, repeated fields
+// as a value per element, and messages and maps as JSON objects.
+func produceFormBody(message proto.Message) (io.ReadCloser, error) {
+	encoded, err := (&jsonpb.Marshaler{}).MarshalToString(message)
+	if err != nil {
+		return nil, err
+	}
+	return formBodyFromJSON([]byte(encoded))
+}
+
+// Returns a form body holding the fields of a JSON object, encoded as for produceFormBody.
+func formBodyFromJSON(data []byte) (io.ReadCloser, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	form := make(url.Values, len(fields))
+	for name, value := range fields {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(value, &elements); err != nil {
+			elements = []json.RawMessage{value}
+		}
+		for _, element := range elements {
+			form[name] = append(form[name], formValue(element))
+		}
+	}
+	return ioutil.NopCloser(bytes.NewReader([]byte(form.Encode()))), nil
+}
+
+// Returns the form value of a JSON value: strings unquoted, and everything else as written.
+func formValue(value json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text
+	}
+	return string(value)
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto for an operation sending a message body.
+const bodyMediaTypesProto = `
+syntax = "proto3";
+
+package body_media_types_test;
+
+message Size {
+  int32 width = 1;
+}
+
+message Gadget {
+  string name = 1;
+  repeated string tags = 2;
+  Size size = 3;
+  bool active = 4;
+}
+
+message CreateGadgetRequest {
+  Gadget gadget = 1;
+}
+
+service Gadgets {
+  rpc CreateGadget(CreateGadgetRequest) returns (Gadget);
+}
+`
+
+// Tests choosing the media type of request bodies, and encoding them to match.
+func TestBodyMediaTypes(t *testing.T) {
+	var contentType string
+	var body []byte
+	createGadget := testOperation{
+		method:     testMethod(t, bodyMediaTypesProto, "body_media_types_test.Gadgets", "CreateGadget"),
+		httpMethod: "POST",
+		path:       "/gadgets",
+		parameters: map[string]*spec.Parameter{"gadget": spec.BodyParam("gadget", nil)},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			body, _ = ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		},
+	}
+	request := `{"gadget": {"name": "gear box", "tags": ["a", "b"], "size": {"width": 3}, "active": true}}`
+	jsonBody := `{"name": "gear box", "tags": ["a", "b"], "size": {"width": 3}, "active": true}`
+	formBody := url.Values{"name": {"gear box"}, "tags": {"a", "b"}, "size": {`{"width":3}`}, "active": {"true"}}
+
+	fixtures := []struct {
+		name        string
+		consumes    []string
+		preference  []string
+		contentType string
+	}{
+		{"Undeclared", nil, nil, "application/json"},
+		{"JSON preferred", []string{"application/xml", formMediaType, jsonMediaType}, nil, "application/json"},
+		{"Form only", []string{formMediaType}, nil, formMediaType},
+		{"Configured", []string{jsonMediaType, formMediaType}, []string{formMediaType}, formMediaType},
+		{"Structured JSON", []string{"application/merge-patch+json"}, nil, "application/merge-patch+json"},
+		{"Unsupported", []string{"application/xml"}, nil, "application/json"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			operation := createGadget
+			operation.operation = &spec.Operation{OperationProps: spec.OperationProps{
+				ID:       "createGadget",
+				Consumes: fixture.consumes,
+			}}
+			operation.options = &ServiceOptions{Operations: map[string]*OperationOptions{
+				"createGadget": {ConsumesPreference: fixture.preference},
+			}}
+			adapter, closeServer := operation.adapter(t)
+			defer closeServer()
+
+			require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: request}))
+			assertions.Equal(t, fixture.contentType, contentType)
+			if fixture.contentType == formMediaType {
+				form, err := url.ParseQuery(string(body))
+				require.Nil(t, err)
+				assertions.Equal(t, formBody, form)
+			} else {
+				assertions.JSONEq(t, jsonBody, string(body))
+			}
+		})
+	}
+
+	createGadget.options = &ServiceOptions{ConsumesPreference: []string{"application/xml"}}
+	_, err := createGadget.newAdapter(t, "http://localhost")
+	assertions.NotNil(t, err, "Expected error for an unsupported preference")
+}
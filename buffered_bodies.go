@@ -0,0 +1,105 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Buffering of small request bodies.
+//
+// Message bodies may be encoded as they're sent, through a pipe, so that large messages aren't
+// encoded ahead of time. Such bodies have no length, so are sent chunked, and can't be sent again by
+// transports retrying requests, like NewFallbackTransport's. Bodies whose encoding fits within
+// maxBufferedBodyBytes are instead encoded in memory as the request is written, and sent with their
+// length and a GetBody function.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// The largest request body encoded in memory, in bytes.
+const maxBufferedBodyBytes = 64 << 10
+
+// Returned by a limitedBuffer when a write would take it past its limit.
+var errBufferFull = errors.New("buffer is full")
+
+// A buffer refusing writes beyond a limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if b.Len()+len(data) > b.limit {
+		return 0, errBufferFull
+	}
+	return b.Buffer.Write(data)
+}
+
+// A request body encoded in memory.
+type bufferedBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+// Returns a body reading the given data.
+func newBufferedBody(data []byte) *bufferedBody {
+	return &bufferedBody{Reader: bytes.NewReader(data), data: data}
+}
+
+func (b *bufferedBody) Close() error {
+	return nil
+}
+
+// Returns a body of the JSON encoding of msg: encoded now if it's no larger than
+// maxBufferedBodyBytes, or else as it's read.
+func jsonBody(msg proto.Message) io.ReadCloser {
+	buffer := &limitedBuffer{limit: maxBufferedBodyBytes}
+	if err := (&jsonpb.Marshaler{}).Marshal(buffer, msg); err == nil {
+		return newBufferedBody(buffer.Bytes())
+	}
+	// Errors other than the limit are reported as the streamed body is read.
+	return jsonBodyReader(msg)
+}
+
+// A transport sending buffered bodies with their length, and a GetBody function returning them
+// again.
+type bufferedBodyTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *bufferedBodyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, ok := request.Body.(*bufferedBody)
+	if !ok {
+		return t.transport.RoundTrip(request)
+	}
+	// Round trippers mustn't modify their requests, so the length is set on a copy.
+	withLength := request.WithContext(request.Context())
+	withLength.ContentLength = int64(len(body.data))
+	withLength.GetBody = func() (io.ReadCloser, error) {
+		return newBufferedBody(body.data), nil
+	}
+	return t.transport.RoundTrip(withLength)
+}
+
+// Returns a copy of an HTTP client sending buffered bodies with their length.
+func withBufferedBodies(client *http.Client) *http.Client {
+	return wrapClientTransport(client, func(transport http.RoundTripper) http.RoundTripper {
+		return &bufferedBodyTransport{transport: transport}
+	})
+}
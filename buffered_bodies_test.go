@@ -0,0 +1,88 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that small bodies are sent with their length and may be sent again, and large ones are
+// streamed.
+func TestBufferedBodies(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(bodyServiceProto))
+	require.Nil(t, err)
+	widgetType := fileDesc.FindMessage("body_test.Widget")
+	large := `{"name": "` + strings.Repeat("x", maxBufferedBodyBytes) + `"}`
+	fixtures := []struct {
+		name          string
+		message       string
+		contentLength bool
+	}{
+		{"small", `{"name": "gear"}`, true},
+		{"large", large, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			var received string
+			var contentLength int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				received, contentLength = string(data), r.ContentLength
+			}))
+			defer server.Close()
+
+			body := jsonBody(messageFromJSON(t, widgetType, fixture.message))
+			_, buffered := body.(*bufferedBody)
+			assert.Equal(fixture.contentLength, buffered)
+			request, err := http.NewRequest(http.MethodPost, server.URL, body)
+			require.Nil(t, err)
+			response, err := withBufferedBodies(http.DefaultClient).Do(request)
+			require.Nil(t, err)
+			response.Body.Close()
+			assert.JSONEq(fixture.message, received)
+			if fixture.contentLength {
+				assert.Equal(int64(len(received)), contentLength)
+			} else {
+				assert.Equal(int64(-1), contentLength, "Large body not streamed")
+			}
+		})
+	}
+}
+
+// Tests that buffered bodies can be sent again, as by NewFallbackTransport.
+func TestBufferedBodiesGetBody(t *testing.T) {
+	var sent *http.Request
+	transport := &bufferedBodyTransport{transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		sent = r
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}
+	request, err := http.NewRequest(http.MethodPost, "http://backend", newBufferedBody([]byte(`{}`)))
+	require.Nil(t, err)
+	_, err = transport.RoundTrip(request)
+	require.Nil(t, err)
+	require.NotNil(t, sent.GetBody)
+	body, err := sent.GetBody()
+	require.Nil(t, err)
+	data, _ := ioutil.ReadAll(body)
+	assertions.Equal(t, "{}", string(data))
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Concurrent construction of the handlers for a service's operations.
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// The number of slowest operations listed in a startup report.
+const slowestReported = 5
+
+// A swagger operation to build a handler for.
+type operationSource struct {
+	httpMethod  string
+	swaggerPath string
+	operation   *spec.Operation
+	// The operation's parameters, keyed by name. Set from resolveParameters if that is set.
+	parameters map[string]*spec.Parameter
+	// If set, resolves the operation's parameters and their $refs, on the worker building its handler.
+	resolveParameters func() (map[string]*spec.Parameter, error)
+	method            *desc.MethodDescriptor
+}
+
+// StartupReport has timings from building the handlers of a proxy's operations.
+type StartupReport struct {
+	// The number of handlers built.
+	Operations int
+	// The number of workers used.
+	Workers int
+	// The wall-clock time taken.
+	Total time.Duration
+	// The slowest operations to build, slowest first.
+	Slowest []OperationTiming
+}
+
+// OperationTiming is the time taken to build one operation's handler.
+type OperationTiming struct {
+	// The operation's fully-qualified gRPC method name.
+	Method   string
+	Duration time.Duration
+}
+
+func (r *StartupReport) String() string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "built %d operations in %s with %d workers", r.Operations, r.Total, r.Workers)
+	if len(r.Slowest) > 0 {
+		buffer.WriteString("; slowest:")
+		for _, timing := range r.Slowest {
+			fmt.Fprintf(&buffer, " %s (%s)", timing.Method, timing.Duration)
+		}
+	}
+	return buffer.String()
+}
+
+// Builds handlers for the given operations on a pool of workers, returning them in the same order.
+// Sources' parameters are resolved as they're built. If workers is zero or less, one worker per CPU
+// is used. Returns the first error encountered, in operation order.
+func buildOperationHandlers(
+	httpClient *http.Client,
+	swaggerClient *runtimeclient.Runtime,
+	sources []operationSource,
+	options *ServiceOptions,
+	workers int,
+) ([]operationHandler, *StartupReport, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+	start := time.Now()
+	handlers := make([]operationHandler, len(sources))
+	errs := make([]error, len(sources))
+	timings := make([]OperationTiming, len(sources))
+
+	indexes := make(chan int)
+	var wait sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for index := range indexes {
+				// Each worker writes only the sources it's given.
+				source := &sources[index]
+				operationStart := time.Now()
+				if source.resolveParameters != nil {
+					if source.parameters, errs[index] = source.resolveParameters(); errs[index] != nil {
+						continue
+					}
+				}
+				handlers[index], errs[index] = newOperationHandler(httpClient, swaggerClient,
+					source.httpMethod, source.swaggerPath, source.operation, source.parameters, source.method,
+					options)
+				timings[index] = OperationTiming{
+					Method:   source.method.GetFullyQualifiedName(),
+					Duration: time.Since(operationStart),
+				}
+			}
+		}()
+	}
+	for index := range sources {
+		indexes <- index
+	}
+	close(indexes)
+	wait.Wait()
+
+	for index, err := range errs {
+		if err != nil {
+			return nil, nil, fmt.Errorf("building %s: %s", sources[index].method.GetFullyQualifiedName(), err)
+		}
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i].Duration > timings[j].Duration })
+	if len(timings) > slowestReported {
+		timings = timings[:slowestReported]
+	}
+	return handlers, &StartupReport{
+		Operations: len(sources),
+		Workers:    workers,
+		Total:      time.Since(start),
+		Slowest:    timings,
+	}, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns sources for count copies of the GetItem operation, with the given parameters.
+func testOperationSources(t *testing.T, count int, parameters map[string]*spec.Parameter) []operationSource {
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+	sources := make([]operationSource, count)
+	for i := range sources {
+		sources[i] = operationSource{
+			httpMethod:  "GET",
+			swaggerPath: fmt.Sprintf("/items%d/{itemId}", i),
+			operation:   &spec.Operation{OperationProps: spec.OperationProps{ID: fmt.Sprintf("getItem%d", i)}},
+			parameters:  parameters,
+			method:      method,
+		}
+	}
+	return sources
+}
+
+// Tests that handlers are built in operation order, with a timing report.
+func TestBuildOperationHandlers(t *testing.T) {
+	assert := assertions.New(t)
+	sources := testOperationSources(t, 20, testServiceParams)
+	handlers, report, err := buildOperationHandlers(http.DefaultClient, runtimeclient.New("localhost", "/", nil),
+		sources, nil, 4)
+	require.Nil(t, err, "Error building: %v", err)
+	require.Len(t, handlers, len(sources))
+	for i, handler := range handlers {
+		assert.Equal(sources[i].swaggerPath, handler.(*operationAdapter).swaggerPath, "Handlers out of order")
+	}
+	assert.Equal(20, report.Operations)
+	assert.Equal(4, report.Workers)
+	assert.Len(report.Slowest, slowestReported)
+	assert.True(strings.HasPrefix(report.String(), "built 20 operations in "), report.String())
+}
+
+// Tests that a failure to build any handler is returned.
+func TestBuildOperationHandlersError(t *testing.T) {
+	sources := testOperationSources(t, 3, testServiceParams)
+	sources[1].parameters = unmappableParams
+	_, _, err := buildOperationHandlers(http.DefaultClient, runtimeclient.New("localhost", "/", nil),
+		sources, nil, 0)
+	assertions.NotNil(t, err, "Expected build error")
+}
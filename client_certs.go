@@ -0,0 +1,117 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Client certificates for mutual TLS with backends, reloaded from files as they are rotated.
+//
+// The certificate is read when each new connection is made, so rotating the files (as cert-manager
+// does) takes effect for new connections without a restart, while calls on existing connections
+// carry on undisturbed. The files are checked for changes at most once per CheckInterval.
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClientCertificateOptions configures the client certificate presented to backends.
+type ClientCertificateOptions struct {
+	// Paths to the PEM certificate chain and private key.
+	CertFile string
+	KeyFile  string
+	// How often the files are checked for changes. Defaults to ten seconds.
+	CheckInterval time.Duration
+}
+
+// Loads a client certificate, reloading it when its files change.
+type clientCertificate struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	// Overridden by tests.
+	now func() time.Time
+
+	// Guards the fields below.
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	// The files' modification times when the certificate was loaded.
+	certModTime time.Time
+	keyModTime  time.Time
+	nextCheck   time.Time
+}
+
+// Loads the client certificate in the given files, failing if it can't be read.
+func newClientCertificate(options *ClientCertificateOptions) (*clientCertificate, error) {
+	c := &clientCertificate{
+		certFile:      options.CertFile,
+		keyFile:       options.KeyFile,
+		checkInterval: options.CheckInterval,
+		now:           time.Now,
+	}
+	if c.checkInterval <= 0 {
+		c.checkInterval = 10 * time.Second
+	}
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.load(certModTime, keyModTime); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Returns the certificate for a new connection, as tls.Config.GetClientCertificate. If the files
+// changed but can't be loaded, as while they are partly rewritten, the previous certificate is kept.
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if now := c.now(); now.After(c.nextCheck) {
+		c.nextCheck = now.Add(c.checkInterval)
+		certModTime, keyModTime, err := c.modTimes()
+		if err == nil && (!certModTime.Equal(c.certModTime) || !keyModTime.Equal(c.keyModTime)) {
+			err = c.load(certModTime, keyModTime)
+		}
+		if err != nil {
+			log.Printf("WARNING: Keeping previous client certificate: %s.", err)
+		}
+	}
+	return c.certificate, nil
+}
+
+// Returns the modification times of the certificate and key files.
+func (c *clientCertificate) modTimes() (certModTime, keyModTime time.Time, err error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// Loads the certificate, recording the modification times of the files it was loaded from.
+func (c *clientCertificate) load(certModTime, keyModTime time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.certificate, c.certModTime, c.keyModTime = &certificate, certModTime, keyModTime
+	return nil
+}
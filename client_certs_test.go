@@ -0,0 +1,140 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Writes a self-signed certificate with the given common name and its key to cert.pem and key.pem in
+// dir, with the given modification time.
+func writeTestCertificate(t *testing.T, dir, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	for name, block := range map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		path := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+		require.Nil(t, os.Chtimes(path, modTime, modTime))
+	}
+}
+
+// Returns the common name of a loaded certificate.
+func certificateName(t *testing.T, certificate *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.Nil(t, err)
+	return parsed.Subject.CommonName
+}
+
+// Tests that client certificates are reloaded when their files change.
+func TestClientCertificateReload(t *testing.T) {
+	assert := assertions.New(t)
+	dir, err := ioutil.TempDir("", "client-certs")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	modTime := time.Now().Add(-time.Hour)
+	writeTestCertificate(t, dir, "first", modTime)
+
+	options := &ClientCertificateOptions{
+		CertFile:      filepath.Join(dir, "cert.pem"),
+		KeyFile:       filepath.Join(dir, "key.pem"),
+		CheckInterval: time.Minute,
+	}
+	certificate, err := newClientCertificate(options)
+	require.Nil(t, err)
+	now := time.Now()
+	certificate.now = func() time.Time { return now }
+	loaded, err := certificate.get(nil)
+	require.Nil(t, err)
+	assert.Equal("first", certificateName(t, loaded))
+
+	writeTestCertificate(t, dir, "second", modTime.Add(time.Minute))
+	loaded, _ = certificate.get(nil)
+	assert.Equal("first", certificateName(t, loaded), "Files shouldn't be checked again so soon")
+	now = now.Add(2 * time.Minute)
+	loaded, _ = certificate.get(nil)
+	assert.Equal("second", certificateName(t, loaded))
+
+	// A half-written rotation keeps the previous certificate.
+	require.Nil(t, ioutil.WriteFile(options.KeyFile, []byte("garbage"), 0600))
+	now = now.Add(2 * time.Minute)
+	loaded, _ = certificate.get(nil)
+	assert.Equal("second", certificateName(t, loaded))
+
+	_, err = newClientCertificate(&ClientCertificateOptions{CertFile: options.CertFile, KeyFile: "missing.pem"})
+	assert.NotNil(err, "Expected error for a missing key")
+}
+
+// Tests presenting a client certificate to a backend requiring one.
+func TestBackendTransportClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-certs")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	writeTestCertificate(t, dir, "proxy", time.Now())
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	serverCertificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.Nil(t, err)
+
+	transport, err := NewBackendTransport(server.URL, &TransportOptions{
+		Pins: &PinOptions{Certificates: []string{pinDigest(serverCertificate.Raw)}, PinsOnly: true},
+		ClientCertificate: &ClientCertificateOptions{
+			CertFile: filepath.Join(dir, "cert.pem"),
+			KeyFile:  filepath.Join(dir, "key.pem"),
+		},
+	})
+	require.Nil(t, err)
+	response, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.Nil(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	require.Nil(t, err)
+	assertions.Equal(t, "proxy", string(body))
+}
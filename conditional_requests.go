@@ -0,0 +1,60 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Conditional backend requests.
+//
+// Callers send If-None-Match and If-Modified-Since as request fields mapped to headers (see
+// request_headers.go), or as metadata if ServiceOptions.ConditionalRequests is set. A 304 Not
+// Modified response is answered with an empty message and "not-modified: true" header metadata,
+// along with the response's ETag and Last-Modified, rather than an error.
+
+import (
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Headers of conditional requests, copied from the caller's metadata of the same name.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since"}
+
+// Header metadata key signalling that the backend's resource wasn't modified.
+const notModifiedMetadataKey = "not-modified"
+
+// Sets the conditional request headers the caller sent as metadata on a request.
+func writeConditionalHeaders(ctx context.Context, request runtime.ClientRequest) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range conditionalHeaders {
+		if values := md[strings.ToLower(header)]; len(values) > 0 {
+			if err := request.SetHeaderParam(header, values...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the header metadata answering a 304 Not Modified response.
+func notModifiedMetadata(response runtime.ClientResponse) metadata.MD {
+	md := metadata.Pairs(notModifiedMetadataKey, "true")
+	for _, header := range []string{"ETag", "Last-Modified"} {
+		if value := response.GetHeader(header); value != "" {
+			md[strings.ToLower(header)] = []string{value}
+		}
+	}
+	return md
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that conditional headers are forwarded, and unmodified resources answered without error.
+func TestConditionalRequests(t *testing.T) {
+	fixtures := []struct {
+		name      string
+		enabled   bool
+		callerTag string
+		itemName  string
+		header    metadata.MD
+	}{
+		{"not modified", true, `"v1"`, "", metadata.MD{"not-modified": {"true"}, "etag": {`"v1"`}}},
+		{"modified", true, `"v0"`, "thing", nil},
+		{"not forwarded", false, `"v1"`, "thing", nil},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			options := &ServiceOptions{ConditionalRequests: fixture.enabled}
+			adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+				if fixture.enabled {
+					assert.Equal(fixture.callerTag, r.Header.Get("If-None-Match"))
+					assert.Equal("Sat, 01 Jan 2000 00:00:00 GMT", r.Header.Get("If-Modified-Since"))
+				} else {
+					assert.Empty(r.Header.Get("If-None-Match"))
+				}
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "thing"}`))
+			})
+			defer closeServer()
+
+			md := metadata.Pairs("if-none-match", fixture.callerTag,
+				"if-modified-since", "Sat, 01 Jan 2000 00:00:00 GMT")
+			stream := &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), md),
+				request: `{"itemId": "abc"}`}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			require.Len(t, stream.sent, 1)
+			assert.Equal(fixture.itemName, stream.sent[0].GetFieldByName("name"))
+			assert.Equal(fixture.header, stream.header)
+		})
+	}
+}
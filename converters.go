@@ -0,0 +1,77 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// User-installed serializers for fields sent as parameters.
+//
+// Fields are serialized by their proto type; see getStringConverter. A converter registered for an
+// operation's parameter, or for a message's field wherever it is sent, replaces the built-in
+// serialization, for values like internal IDs which the backend expects in its own encoding.
+// Converters for a parameter take precedence over those for its field.
+
+import (
+	"github.com/jhump/protoreflect/desc"
+)
+
+// ParamConverter serializes a field value sent as a parameter. Values are as held by dynamic
+// messages: scalars as Go values, enums as int32, messages as proto.Message, and maps as
+// map[interface{}]interface{}. Repeated fields are converted an element at a time.
+type ParamConverter func(value interface{}) string
+
+// ConverterRegistry holds the ParamConverters installed for parameters and fields. Converters are
+// looked up when an operation's adapter is built, so should be registered before then. It isn't safe
+// for concurrent use.
+type ConverterRegistry struct {
+	// Converters keyed by operation ID, then parameter name.
+	params map[string]map[string]ParamConverter
+	// Converters keyed by fully-qualified field name, like "package.Message.field".
+	fields map[string]ParamConverter
+}
+
+// NewConverterRegistry returns an empty registry.
+func NewConverterRegistry() *ConverterRegistry {
+	return &ConverterRegistry{
+		params: make(map[string]map[string]ParamConverter),
+		fields: make(map[string]ParamConverter),
+	}
+}
+
+// RegisterParam installs a converter for a parameter of the operation with the given ID, replacing
+// any converter already installed for it.
+func (r *ConverterRegistry) RegisterParam(operationID, param string, converter ParamConverter) {
+	if r.params[operationID] == nil {
+		r.params[operationID] = make(map[string]ParamConverter)
+	}
+	r.params[operationID][param] = converter
+}
+
+// RegisterField installs a converter for a field of the message with the given fully-qualified
+// name, like "package.Message", wherever it is sent as a parameter. This replaces any converter
+// already installed for the field.
+func (r *ConverterRegistry) RegisterField(messageName, field string, converter ParamConverter) {
+	r.fields[messageName+"."+field] = converter
+}
+
+// Returns the converter for a parameter sent from a field, or nil if none is installed. A nil
+// registry has no converters.
+func (r *ConverterRegistry) lookup(operationID, param string, field *desc.FieldDescriptor) ParamConverter {
+	if r == nil {
+		return nil
+	}
+	if converter, ok := r.params[operationID][param]; ok {
+		return converter
+	}
+	return r.fields[field.GetFullyQualifiedName()]
+}
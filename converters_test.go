@@ -0,0 +1,58 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that registered converters replace the built-in serialization, with parameter converters
+// taking precedence over field converters.
+func TestConverters(t *testing.T) {
+	assert := assertions.New(t)
+	converters := NewConverterRegistry()
+	converters.RegisterField("test_service.GetItemRequest", "itemId", func(value interface{}) string {
+		return "id-" + strings.ToUpper(value.(string))
+	})
+	converters.RegisterField("test_service.GetItemRequest", "filter", func(value interface{}) string {
+		return "field"
+	})
+	converters.RegisterParam("getItem", "filter", func(value interface{}) string {
+		return "param:" + value.(string)
+	})
+	var path, filter string
+	adapter, closeServer := testOperation{options: &ServiceOptions{Converters: converters},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			path, filter = r.URL.Path, r.URL.Query().Get("filter")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}}.adapter(t)
+	defer closeServer()
+
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc", "filter": "new"}`}))
+	assert.Equal("/items/id-ABC", path)
+	assert.Equal("param:new", filter)
+}
+
+// Tests that a nil registry has no converters.
+func TestNilConverterRegistry(t *testing.T) {
+	var converters *ConverterRegistry
+	assertions.Nil(t, converters.lookup("getItem", "filter", nil))
+}
@@ -0,0 +1,337 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Capture of failed calls, for replay once a backend recovers.
+//
+// A call is dead-lettered when it fails after its backend request was written. The letter holds
+// the request message and the backend request as it was written, so that it can be replayed
+// through the proxy or straight to the backend. Calls failing before then, such as those rejected
+// by authorization or quotas, aren't captured.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+)
+
+// The most bytes of a backend request body captured in a dead letter.
+const maxDeadLetterBodyBytes = 64 << 10
+
+// DeadLetter records a failed call.
+type DeadLetter struct {
+	// Identifies the letter in a DeadLetterQueue. Empty until it is queued.
+	ID string `json:"id,omitempty"`
+	// When the call was received.
+	Time time.Time `json:"time"`
+	// The caller's identity, as for audit events. Empty if unknown.
+	Caller string `json:"caller"`
+	// The fully-qualified gRPC method name that was called.
+	Operation string `json:"operation"`
+	// The full gRPC method name, like "/package.Service/Method".
+	FullMethod string `json:"fullMethod"`
+	// The request message, in its JSON encoding.
+	Request json.RawMessage `json:"request"`
+	// The last backend request written for the call.
+	HTTPRequest *DeadLetterRequest `json:"httpRequest"`
+	// The HTTP status code of the backend response, or 0 if none was received.
+	HTTPStatus int `json:"httpStatus,omitempty"`
+	// The gRPC status code returned to the caller.
+	Code codes.Code `json:"code"`
+	// The error returned to the caller.
+	Error string `json:"error"`
+}
+
+// DeadLetterRequest is a backend request as written. Headers added by the transport, or by
+// WrapTransport, aren't included, nor are the session token and API keys. Credential headers, such
+// as Authorization copied from the caller's metadata, are left out.
+type DeadLetterRequest struct {
+	// The HTTP method.
+	Method string `json:"method"`
+	// The swagger path template.
+	Path string `json:"path"`
+	// Values of path parameters, keyed by name.
+	PathParams map[string]string `json:"pathParams,omitempty"`
+	Query      url.Values        `json:"query,omitempty"`
+	Header     http.Header       `json:"header,omitempty"`
+	// The request body, up to 64 KiB.
+	Body []byte `json:"body,omitempty"`
+	// True if the body was longer than was captured.
+	BodyTruncated bool `json:"bodyTruncated,omitempty"`
+}
+
+// NewRequest returns the captured request, sent to a backend at the given base URL, like
+// "https://backend.example.com/api". The request has the captured headers and body, so a truncated
+// body can't be resent; this returns an error instead.
+func (r *DeadLetterRequest) NewRequest(baseURL string) (*http.Request, error) {
+	if r.BodyTruncated {
+		return nil, errors.New("request body was truncated when captured")
+	}
+	path := r.Path
+	for name, value := range r.PathParams {
+		// Path values were captured escaped.
+		path = strings.Replace(path, "{"+name+"}", value, -1)
+	}
+	requestURL, err := url.Parse(strings.TrimSuffix(baseURL, "/") + path)
+	if err != nil {
+		return nil, err
+	}
+	requestURL.RawQuery = r.Query.Encode()
+	var body io.Reader
+	if len(r.Body) > 0 {
+		body = bytes.NewReader(r.Body)
+	}
+	request, err := http.NewRequest(r.Method, requestURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.Header {
+		request.Header[name] = append([]string(nil), values...)
+	}
+	return request, nil
+}
+
+// DeadLetterSink receives dead letters. Implementations must be safe for concurrent use, and should
+// not block for long; they are called inline at the end of every failed call.
+type DeadLetterSink interface {
+	DeadLetter(letter *DeadLetter)
+}
+
+// DeadLetterSinkFunc adapts a plain function to a DeadLetterSink.
+type DeadLetterSinkFunc func(letter *DeadLetter)
+
+// DeadLetter calls f(letter).
+func (f DeadLetterSinkFunc) DeadLetter(letter *DeadLetter) {
+	f(letter)
+}
+
+// A DeadLetterSink writing one JSON object per line to a writer.
+type jsonDeadLetterSink struct {
+	// Guards writes, so that concurrent letters don't interleave.
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONDeadLetterSink returns a DeadLetterSink writing each letter as a line of JSON to the given
+// writer, such as an open file. Letters written this way can be replayed by the replay command.
+func NewJSONDeadLetterSink(writer io.Writer) DeadLetterSink {
+	return &jsonDeadLetterSink{encoder: json.NewEncoder(writer)}
+}
+
+func (s *jsonDeadLetterSink) DeadLetter(letter *DeadLetter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.encoder.Encode(letter); err != nil {
+		log.Printf("WARNING: Error writing dead letter: %s", err)
+	}
+}
+
+// DeadLetterQueue is a DeadLetterSink holding the most recent letters in memory, for replay with
+// Replay. It is safe for concurrent use.
+type DeadLetterQueue struct {
+	capacity int
+
+	// Guards the fields below.
+	mutex sync.Mutex
+	// The number of letters queued, from which IDs are assigned.
+	queued int
+	// Held letters, oldest first.
+	letters []*DeadLetter
+	// The number of letters discarded to make room for newer ones.
+	dropped int
+}
+
+// NewDeadLetterQueue returns an empty queue holding up to capacity letters. Once full, the oldest
+// letter is discarded for each new one.
+func NewDeadLetterQueue(capacity int) *DeadLetterQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &DeadLetterQueue{capacity: capacity}
+}
+
+// DeadLetter queues a letter, assigning its ID.
+func (q *DeadLetterQueue) DeadLetter(letter *DeadLetter) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.queued++
+	letter.ID = strconv.Itoa(q.queued)
+	if len(q.letters) == q.capacity {
+		q.letters = q.letters[1:]
+		q.dropped++
+	}
+	q.letters = append(q.letters, letter)
+}
+
+// Letters returns the held letters, oldest first.
+func (q *DeadLetterQueue) Letters() []*DeadLetter {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]*DeadLetter(nil), q.letters...)
+}
+
+// Get returns the held letter with the given ID, or nil if there is none.
+func (q *DeadLetterQueue) Get(id string) *DeadLetter {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, letter := range q.letters {
+		if letter.ID == id {
+			return letter
+		}
+	}
+	return nil
+}
+
+// Remove discards the held letter with the given ID. Returns false if there is none.
+func (q *DeadLetterQueue) Remove(id string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, letter := range q.letters {
+		if letter.ID == id {
+			q.letters = append(q.letters[:i:i], q.letters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Drain removes and returns the held letters, oldest first, for replay.
+func (q *DeadLetterQueue) Drain() []*DeadLetter {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	letters := q.letters
+	q.letters = nil
+	return letters
+}
+
+// Dropped returns the number of letters discarded to make room for newer ones.
+func (q *DeadLetterQueue) Dropped() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.dropped
+}
+
+// Headers carrying credentials, which aren't captured.
+var credentialHeaders = map[string]bool{
+	"Authorization": true, "Proxy-Authorization": true, "Cookie": true, "X-Api-Key": true,
+}
+
+// The backend request written for a call, captured for dead letters.
+type capturedRequest struct {
+	query  url.Values
+	header http.Header
+	body   bytes.Buffer
+	// True if the body was longer than was captured.
+	truncated bool
+}
+
+// A writer capturing up to maxDeadLetterBodyBytes of a request body.
+type bodyCapture struct {
+	request *capturedRequest
+}
+
+func (c bodyCapture) Write(data []byte) (int, error) {
+	if room := maxDeadLetterBodyBytes - c.request.body.Len(); len(data) > room {
+		c.request.body.Write(data[:room])
+		c.request.truncated = true
+	} else {
+		c.request.body.Write(data)
+	}
+	return len(data), nil
+}
+
+// A request body read through a capture.
+type capturingBody struct {
+	io.Reader
+	io.Closer
+}
+
+// Starts capturing a backend request for a call, replacing anything captured for an earlier attempt.
+func (call *proxiedCall) startCapture() {
+	call.captured = &capturedRequest{query: make(url.Values), header: make(http.Header)}
+}
+
+func (r recordingRequest) SetQueryParam(name string, values ...string) error {
+	if r.call.captured != nil {
+		r.call.captured.query[name] = append([]string(nil), values...)
+	}
+	return r.ClientRequest.SetQueryParam(name, values...)
+}
+
+func (r recordingRequest) SetHeaderParam(name string, values ...string) error {
+	if name = http.CanonicalHeaderKey(name); r.call.captured != nil && !credentialHeaders[name] {
+		r.call.captured.header[name] = append([]string(nil), values...)
+	}
+	return r.ClientRequest.SetHeaderParam(name, values...)
+}
+
+func (r recordingRequest) SetBodyParam(payload interface{}) error {
+	if r.call.captured != nil {
+		switch body := payload.(type) {
+		case io.ReadCloser:
+			payload = capturingBody{io.TeeReader(body, bodyCapture{r.call.captured}), body}
+		case io.Reader:
+			payload = io.TeeReader(body, bodyCapture{r.call.captured})
+		}
+	}
+	return r.ClientRequest.SetBodyParam(payload)
+}
+
+// Emits a dead letter for a failed call to the configured sink, if its backend request was written.
+func (p *operationAdapter) deadLetter(call *proxiedCall, request *dynamic.Message, err error) {
+	if err == nil || call.captured == nil || request == nil {
+		return
+	}
+	encoded, marshalErr := (&jsonpb.Marshaler{}).MarshalToString(request)
+	if marshalErr != nil {
+		encoded = "null"
+	}
+	captured := call.captured
+	pathParams := make(map[string]string, len(call.pathParams))
+	for name, value := range call.pathParams {
+		pathParams[name] = value
+	}
+	p.options.DeadLetters.DeadLetter(&DeadLetter{
+		Time:       call.startTime,
+		Caller:     callerFromContext(call.ctx, p.options.CallerMetadataKey),
+		Operation:  p.method.GetFullyQualifiedName(),
+		FullMethod: fullMethodName(p.method),
+		Request:    json.RawMessage(encoded),
+		HTTPRequest: &DeadLetterRequest{
+			Method:        p.httpMethod,
+			Path:          p.swaggerPath,
+			PathParams:    pathParams,
+			Query:         captured.query,
+			Header:        captured.header,
+			Body:          captured.body.Bytes(),
+			BodyTruncated: captured.truncated,
+		},
+		HTTPStatus: call.httpStatus,
+		Code:       errorCode(err),
+		Error:      err.Error(),
+	})
+}
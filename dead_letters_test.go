@@ -0,0 +1,142 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that calls failing after their backend request is written are dead-lettered.
+func TestDeadLetters(t *testing.T) {
+	assert := assertions.New(t)
+	queue := NewDeadLetterQueue(10)
+	var body string
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{
+		DeadLetters:     queue,
+		Headers:         map[string]string{"X-Api-Version": "2"},
+		MetadataHeaders: &MetadataHeaderOptions{Allow: []string{"authorization", "x-request-id"}},
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+	defer closeServer()
+
+	body = `{"name": "thing"}`
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	assert.Empty(queue.Letters(), "Successful calls shouldn't be dead-lettered")
+
+	body = `not json`
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer secret", "x-request-id", "r1"))
+	err := adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "abc", "filter": "new"}`})
+	require.NotNil(t, err)
+	letters := queue.Drain()
+	require.Len(t, letters, 1)
+	letter := letters[0]
+	assert.Equal("test_service.Items.GetItem", letter.Operation)
+	assert.JSONEq(`{"itemId": "abc", "filter": "new"}`, string(letter.Request))
+	assert.Equal("GET", letter.HTTPRequest.Method)
+	assert.Equal("/items/{itemId}", letter.HTTPRequest.Path)
+	assert.Equal(map[string]string{"itemId": "abc"}, letter.HTTPRequest.PathParams)
+	assert.Equal(url.Values{"filter": {"new"}}, letter.HTTPRequest.Query)
+	assert.Equal("2", letter.HTTPRequest.Header.Get("X-Api-Version"))
+	assert.Equal("r1", letter.HTTPRequest.Header.Get("X-Request-Id"))
+	assert.Empty(letter.HTTPRequest.Header.Get("Authorization"), "Credentials captured")
+	assert.Equal(http.StatusOK, letter.HTTPStatus)
+	assert.Equal(errorCode(err), letter.Code)
+	assert.Equal(err.Error(), letter.Error)
+	assert.Empty(queue.Letters())
+}
+
+// Tests capturing request bodies, up to the limit.
+func TestDeadLetterBodies(t *testing.T) {
+	queue := NewDeadLetterQueue(10)
+	adapter, closeServer := testOperation{
+		method:     testMethod(t, bodyMediaTypesProto, "body_media_types_test.Gadgets", "CreateGadget"),
+		httpMethod: "POST",
+		path:       "/gadgets",
+		operation:  &spec.Operation{},
+		parameters: map[string]*spec.Parameter{"gadget": spec.BodyParam("gadget", nil)},
+		options:    &ServiceOptions{DeadLetters: queue},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[`))
+		},
+	}.adapter(t)
+	defer closeServer()
+
+	require.NotNil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"gadget": {"name": "gear"}}`}))
+	letters := queue.Drain()
+	require.Len(t, letters, 1)
+	assertions.JSONEq(t, `{"name": "gear"}`, string(letters[0].HTTPRequest.Body))
+	assertions.False(t, letters[0].HTTPRequest.BodyTruncated)
+
+	long := strings.Repeat("x", maxDeadLetterBodyBytes)
+	require.NotNil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"gadget": {"name": "` + long + `"}}`}))
+	letters = queue.Drain()
+	require.Len(t, letters, 1)
+	assertions.Len(t, letters[0].HTTPRequest.Body, maxDeadLetterBodyBytes)
+	assertions.True(t, letters[0].HTTPRequest.BodyTruncated)
+}
+
+// Tests that full queues discard their oldest letters.
+func TestDeadLetterQueue(t *testing.T) {
+	assert := assertions.New(t)
+	queue := NewDeadLetterQueue(2)
+	for _, code := range []codes.Code{codes.Internal, codes.Unavailable, codes.DeadlineExceeded} {
+		queue.DeadLetter(&DeadLetter{Code: code})
+	}
+	letters := queue.Letters()
+	require.Len(t, letters, 2)
+	assert.Equal(codes.Unavailable, letters[0].Code)
+	assert.Equal(codes.DeadlineExceeded, letters[1].Code)
+	assert.Equal(1, queue.Dropped())
+}
+
+// Tests rebuilding captured backend requests.
+func TestDeadLetterRequestNewRequest(t *testing.T) {
+	assert := assertions.New(t)
+	captured := &DeadLetterRequest{
+		Method:     "PUT",
+		Path:       "/items/{itemId}/parts/{part}",
+		PathParams: map[string]string{"itemId": "a%2Fb", "part": "wheel"},
+		Query:      url.Values{"filter": {"new"}},
+		Header:     http.Header{"X-Api-Version": {"2"}},
+		Body:       []byte(`{"name": "thing"}`),
+	}
+	request, err := captured.NewRequest("https://backend.example.com/api/")
+	require.Nil(t, err)
+	assert.Equal("PUT", request.Method)
+	assert.Equal("https://backend.example.com/api/items/a%2Fb/parts/wheel?filter=new", request.URL.String())
+	assert.Equal("2", request.Header.Get("X-Api-Version"))
+	body, err := ioutil.ReadAll(request.Body)
+	require.Nil(t, err)
+	assert.Equal(`{"name": "thing"}`, string(body))
+
+	captured.BodyTruncated = true
+	_, err = captured.NewRequest("https://backend.example.com")
+	assert.NotNil(err, "Expected error for a truncated body")
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Signaling of deprecated operations to callers, to drive client migrations.
+//
+// Operations are deprecated by "deprecated: true" in the spec, or by a sunset time, set in the
+// x-swaggrpc-sunset operation extension (in RFC 3339 format) or in OperationOptions.Sunset. Calls to
+// deprecated operations get a "warning" trailer, in the form of an HTTP Warning header, and a
+// "sunset" trailer if the operation has a sunset time. If ServiceOptions.EnforceSunset is set, calls
+// after the sunset fail with Unimplemented.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the operation extension holding a sunset time.
+const sunsetExtension = "x-swaggrpc-sunset"
+
+// Trailer keys for deprecation signals.
+const (
+	warningTrailer = "warning"
+	sunsetTrailer  = "sunset"
+)
+
+// DeprecationMetrics records calls to deprecated operations. A CallMetrics implementation may also
+// implement this to receive deprecated calls.
+type DeprecationMetrics interface {
+	// Adds one to the MetricDeprecatedCalls counter.
+	AddDeprecatedCall(ctx context.Context, attributes CallAttributes)
+}
+
+// The deprecation of an operation.
+type deprecation struct {
+	// When the operation is removed, or the zero time if it has no sunset.
+	sunset time.Time
+	// The trailer sent with every call.
+	trailer metadata.MD
+}
+
+// Returns the operation's deprecation, or nil if it isn't deprecated.
+func resolveDeprecation(operation *spec.Operation, operationOptions *OperationOptions) (*deprecation, error) {
+	sunset := operationOptions.Sunset
+	if sunset.IsZero() {
+		if _, err := decodeExtension(operation.Extensions, sunsetExtension, &sunset); err != nil {
+			return nil, err
+		}
+	}
+	if !operation.Deprecated && sunset.IsZero() {
+		return nil, nil
+	}
+	warning := fmt.Sprintf("operation %s is deprecated", operation.ID)
+	trailer := metadata.MD{}
+	if !sunset.IsZero() {
+		warning = fmt.Sprintf("operation %s is deprecated, and will be removed at %s", operation.ID,
+			sunset.UTC().Format(time.RFC3339))
+		trailer[sunsetTrailer] = []string{sunset.UTC().Format(http.TimeFormat)}
+	}
+	// The HTTP Warning header's "miscellaneous persistent warning" code.
+	trailer[warningTrailer] = []string{fmt.Sprintf("299 - %q", warning)}
+	return &deprecation{sunset: sunset, trailer: trailer}, nil
+}
+
+// Signals a call to this deprecated operation, returning Unimplemented if it is past its sunset and
+// sunsets are enforced.
+func (p *operationAdapter) checkDeprecation(ctx context.Context, stream grpc.ServerStream) error {
+	stream.SetTrailer(p.deprecation.trailer)
+	if deprecationMetrics, ok := p.options.Metrics.(DeprecationMetrics); ok {
+		deprecationMetrics.AddDeprecatedCall(ctx, p.methodAttributes())
+	}
+	if p.options.EnforceSunset && !p.deprecation.sunset.IsZero() && !time.Now().Before(p.deprecation.sunset) {
+		return status.Errorf(codes.Unimplemented, "operation %s was removed at %s", p.operation.ID,
+			p.deprecation.sunset.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
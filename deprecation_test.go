@@ -0,0 +1,125 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Counts deprecated calls, as well as call metrics.
+type deprecationRecordingMetrics struct {
+	fakeCallMetrics
+	deprecated []CallAttributes
+}
+
+func (m *deprecationRecordingMetrics) AddDeprecatedCall(ctx context.Context, attributes CallAttributes) {
+	m.deprecated = append(m.deprecated, attributes)
+}
+
+// Returns a getItem operation, deprecated if requested, with the given extensions.
+func deprecatedOperation(deprecated bool, extensions spec.Extensions) *spec.Operation {
+	return &spec.Operation{
+		OperationProps:   spec.OperationProps{ID: "getItem", Deprecated: deprecated},
+		VendorExtensible: spec.VendorExtensible{Extensions: extensions},
+	}
+}
+
+// Tests that deprecation and sunsets are read from the spec and options.
+func TestResolveDeprecation(t *testing.T) {
+	sunset := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	fixtures := []struct {
+		name      string
+		operation *spec.Operation
+		options   *OperationOptions
+		sunset    string
+		warning   string
+	}{
+		{"NotDeprecated", deprecatedOperation(false, nil), &OperationOptions{}, "", ""},
+		{"Deprecated", deprecatedOperation(true, nil), &OperationOptions{}, "",
+			`299 - "operation getItem is deprecated"`},
+		{"Extension", deprecatedOperation(false, spec.Extensions{"x-swaggrpc-sunset": "2030-01-02T03:04:05Z"}),
+			&OperationOptions{}, "Wed, 02 Jan 2030 03:04:05 GMT",
+			`299 - "operation getItem is deprecated, and will be removed at 2030-01-02T03:04:05Z"`},
+		{"Options", deprecatedOperation(true, spec.Extensions{"x-swaggrpc-sunset": "2031-01-01T00:00:00Z"}),
+			&OperationOptions{Sunset: sunset}, "Wed, 02 Jan 2030 03:04:05 GMT",
+			`299 - "operation getItem is deprecated, and will be removed at 2030-01-02T03:04:05Z"`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			got, err := resolveDeprecation(fixture.operation, fixture.options)
+			require.Nil(t, err)
+			if fixture.warning == "" {
+				assert.Nil(got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal([]string{fixture.warning}, got.trailer[warningTrailer])
+			if fixture.sunset == "" {
+				assert.Empty(got.trailer[sunsetTrailer])
+			} else {
+				assert.Equal([]string{fixture.sunset}, got.trailer[sunsetTrailer])
+			}
+		})
+	}
+
+	_, err := resolveDeprecation(deprecatedOperation(false, spec.Extensions{"x-swaggrpc-sunset": "soon"}),
+		&OperationOptions{})
+	assertions.NotNil(t, err, "Expected error for a bad sunset")
+}
+
+// Tests that calls to deprecated operations are signaled, and refused after an enforced sunset.
+func TestDeprecatedCalls(t *testing.T) {
+	assert := assertions.New(t)
+	backendCalls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	}
+	metrics := &deprecationRecordingMetrics{}
+	options := &ServiceOptions{
+		Metrics:    metrics,
+		Operations: map[string]*OperationOptions{"getItem": {Sunset: time.Now().Add(time.Hour)}},
+	}
+	adapter, closeServer := newTestAdapter(t, options, handler)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.Len(stream.trailer[warningTrailer], 1)
+	assert.Len(stream.trailer[sunsetTrailer], 1)
+	assert.Equal([]CallAttributes{{Service: "test_service.Items", Method: "GetItem"}}, metrics.deprecated)
+
+	options = &ServiceOptions{
+		EnforceSunset: true,
+		Operations:    map[string]*OperationOptions{"getItem": {Sunset: time.Now().Add(-time.Hour)}},
+	}
+	adapter, closeServer = newTestAdapter(t, options, handler)
+	defer closeServer()
+
+	stream = &fakeServerStream{request: `{"itemId": "abc"}`}
+	assert.Equal(codes.Unimplemented, errorCode(adapter.handleGRPCRequest(stream)))
+	assert.Len(stream.trailer[warningTrailer], 1)
+	assert.Equal(1, backendCalls, "Backend called after sunset")
+}
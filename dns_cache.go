@@ -0,0 +1,295 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// A caching DNS resolver for backend hostnames.
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// The default for net.Dialer.FallbackDelay.
+	defaultFallbackDelay = 300 * time.Millisecond
+	// The least time given to each address dialed in turn, as net.Dialer gives.
+	minDialAttemptTimeout = 2 * time.Second
+)
+
+// DNSCacheOptions configures a DNSCache.
+type DNSCacheOptions struct {
+	// How long successful lookups are cached. Defaults to one minute.
+	TTL time.Duration
+	// How long failed lookups are cached. If zero, failures are not cached.
+	NegativeTTL time.Duration
+	// The maximum number of hostnames cached; the least recently used are evicted past this. Defaults
+	// to 1024.
+	MaxEntries int
+	// The resolver to use for lookups. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+}
+
+// DNSCache caches host lookups for backend connections. It is safe for concurrent use, and may be
+// shared between transports.
+type DNSCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+	// Performs uncached lookups.
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	// Guards entries and lru.
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	// Cache entries, most recently used first.
+	lru *list.List
+}
+
+// A single cached lookup.
+type dnsCacheEntry struct {
+	host    string
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// NewDNSCache returns a new, empty cache with the given options.
+func NewDNSCache(options DNSCacheOptions) *DNSCache {
+	if options.TTL <= 0 {
+		options.TTL = time.Minute
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = 1024
+	}
+	resolver := options.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DNSCache{
+		ttl:         options.TTL,
+		negativeTTL: options.NegativeTTL,
+		maxEntries:  options.MaxEntries,
+		lookup:      resolver.LookupHost,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// LookupHost returns the addresses of a host, from the cache if an unexpired entry exists.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if entry, ok := c.get(host); ok {
+		return entry.addrs, entry.err
+	}
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Don't cache the caller giving up.
+			return nil, err
+		}
+		if c.negativeTTL > 0 {
+			c.put(&dnsCacheEntry{host: host, err: err, expires: time.Now().Add(c.negativeTTL)})
+		}
+		return nil, err
+	}
+	c.put(&dnsCacheEntry{host: host, addrs: addrs, expires: time.Now().Add(c.ttl)})
+	return addrs, nil
+}
+
+// Returns the unexpired cache entry for a host, if there is one.
+func (c *DNSCache) get(host string) (*dnsCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[host]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*dnsCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, host)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+// Adds or replaces a cache entry, evicting the least recently used entry if the cache is full.
+func (c *DNSCache) put(entry *dnsCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[entry.host]; ok {
+		c.lru.Remove(element)
+	}
+	c.entries[entry.host] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dnsCacheEntry).host)
+	}
+}
+
+// Wraps a dialer's dial function to resolve hostnames through the cache. Resolved addresses are
+// dialed as the dialer would dial them: those of the first address's family in turn, sharing the
+// dialer's Timeout, and if it's dual-stack, those of the other family in parallel after its
+// FallbackDelay, or once the first family's fail. Addresses which are already IPs are dialed
+// directly.
+func (c *DNSCache) wrapDial(dialer *net.Dialer, dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		ips, err := c.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no addresses", Name: host}
+		}
+		if dialer.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+			defer cancel()
+		}
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.JoinHostPort(ip, port)
+		}
+		primaries, fallbacks := partitionAddrs(ips, addrs)
+		if !dialer.DualStack || len(fallbacks) == 0 {
+			return dialSerial(ctx, dial, network, addrs)
+		}
+		delay := dialer.FallbackDelay
+		if delay <= 0 {
+			delay = defaultFallbackDelay
+		}
+		return dialParallel(ctx, dial, network, primaries, fallbacks, delay)
+	}
+}
+
+// Splits addresses into those of the same family as the first, and the rest.
+func partitionAddrs(ips []string, addrs []string) ([]string, []string) {
+	var primaries, fallbacks []string
+	isIPv4 := func(ip string) bool { return net.ParseIP(ip).To4() != nil }
+	for i, ip := range ips {
+		if isIPv4(ip) == isIPv4(ips[0]) {
+			primaries = append(primaries, addrs[i])
+		} else {
+			fallbacks = append(fallbacks, addrs[i])
+		}
+	}
+	return primaries, fallbacks
+}
+
+// Dials addresses in turn until one connects, giving each an equal share of the time left, but no
+// less than minDialAttemptTimeout. Returns the first error if none connect.
+func dialSerial(ctx context.Context, dial DialFunc, network string, addrs []string) (net.Conn, error) {
+	var firstErr error
+	for i, addr := range addrs {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout := time.Until(deadline) / time.Duration(len(addrs)-i)
+			if timeout < minDialAttemptTimeout {
+				timeout = minDialAttemptTimeout
+			}
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		conn, err := dial(attemptCtx, network, addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// Dials the primary addresses, and the fallbacks after the given delay or once the primaries fail,
+// returning the first connection made. Returns the primaries' error if none connect.
+func dialParallel(
+	ctx context.Context,
+	dial DialFunc,
+	network string,
+	primaries []string,
+	fallbacks []string,
+	delay time.Duration,
+) (net.Conn, error) {
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Closed once a result is returned, so that the losing dial's connection is closed.
+	returned := make(chan struct{})
+	defer close(returned)
+	results := make(chan dialResult)
+	race := func(addrs []string, primary bool) {
+		conn, err := dialSerial(ctx, dial, network, addrs)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+	go race(primaries, true)
+	fallbackTimer := time.NewTimer(delay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr, fallbackErr error
+	pending, fallbackStarted := 1, false
+	startFallback := func() {
+		if !fallbackStarted {
+			fallbackStarted = true
+			pending++
+			go race(fallbacks, false)
+		}
+	}
+	for {
+		select {
+		case <-fallbackTimer.C:
+			startFallback()
+		case result := <-results:
+			if result.err == nil {
+				return result.conn, nil
+			}
+			pending--
+			if result.primary {
+				primaryErr = result.err
+			} else {
+				fallbackErr = result.err
+			}
+			startFallback()
+			if pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, fallbackErr
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// Returns a cache with a fake lookup function, and a map counting lookups per host.
+func newTestDNSCache(options DNSCacheOptions) (*DNSCache, map[string]int) {
+	cache := NewDNSCache(options)
+	lookups := make(map[string]int)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups[host]++
+		if host == "missing.internal" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+	return cache, lookups
+}
+
+// Tests that lookups are cached until their TTL expires.
+func TestDNSCacheTTL(t *testing.T) {
+	assert := assertions.New(t)
+	cache, lookups := newTestDNSCache(DNSCacheOptions{TTL: 20 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.LookupHost(context.Background(), "backend.internal")
+		assert.Nil(err)
+		assert.Equal([]string{"127.0.0.1"}, addrs)
+	}
+	assert.Equal(1, lookups["backend.internal"], "Expected cached lookups")
+	time.Sleep(30 * time.Millisecond)
+	cache.LookupHost(context.Background(), "backend.internal")
+	assert.Equal(2, lookups["backend.internal"], "Expected expired entry to be looked up again")
+}
+
+// Tests that failures are only cached when negative caching is enabled.
+func TestDNSCacheNegative(t *testing.T) {
+	fixtures := []struct {
+		name        string
+		negativeTTL time.Duration
+		lookups     int
+	}{
+		{"Disabled", 0, 2},
+		{"Enabled", time.Minute, 1},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			cache, lookups := newTestDNSCache(DNSCacheOptions{NegativeTTL: fixture.negativeTTL})
+			for i := 0; i < 2; i++ {
+				_, err := cache.LookupHost(context.Background(), "missing.internal")
+				assert.NotNil(err, "Expected lookup failure")
+			}
+			assert.Equal(fixture.lookups, lookups["missing.internal"], "Bad lookup count")
+		})
+	}
+}
+
+// Tests that the least recently used entries are evicted past the size limit.
+func TestDNSCacheEviction(t *testing.T) {
+	assert := assertions.New(t)
+	cache, lookups := newTestDNSCache(DNSCacheOptions{MaxEntries: 2})
+	ctx := context.Background()
+	cache.LookupHost(ctx, "a")
+	cache.LookupHost(ctx, "b")
+	cache.LookupHost(ctx, "a")
+	cache.LookupHost(ctx, "c")
+	cache.LookupHost(ctx, "a")
+	cache.LookupHost(ctx, "b")
+	assert.Equal(1, lookups["a"], "Recently-used entry evicted")
+	assert.Equal(2, lookups["b"], "Least-recently-used entry not evicted")
+}
+
+// Tests that dials resolve through the cache, and skip it for IP addresses.
+func TestDNSCacheWrapDial(t *testing.T) {
+	assert := assertions.New(t)
+	cache, lookups := newTestDNSCache(DNSCacheOptions{})
+	var dialed []string
+	dial := cache.wrapDial(&net.Dialer{}, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, nil
+	})
+	dial(context.Background(), "tcp", "backend.internal:443")
+	dial(context.Background(), "tcp", "10.0.0.1:80")
+	assert.Equal([]string{"127.0.0.1:443", "10.0.0.1:80"}, dialed)
+	assert.Equal(1, len(lookups), "IP addresses should not be looked up")
+}
+
+// Tests that addresses of the other family are raced after the fallback delay, and that addresses
+// dialed in turn share the dialer's timeout.
+func TestDNSCacheWrapDialFallback(t *testing.T) {
+	assert := assertions.New(t)
+	cache, _ := newTestDNSCache(DNSCacheOptions{})
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"2001:db8::1", "2001:db8::2", "10.0.0.1"}, nil
+	}
+	var mutex sync.Mutex
+	timeouts := make(map[string]time.Duration)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		deadline, _ := ctx.Deadline()
+		mutex.Lock()
+		timeouts[addr] = time.Until(deadline)
+		mutex.Unlock()
+		if addr == "10.0.0.1:443" {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		// IPv6 hangs.
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, DualStack: true, FallbackDelay: 10 * time.Millisecond}
+	start := time.Now()
+	conn, err := cache.wrapDial(dialer, dial)(context.Background(), "tcp", "backend.internal:443")
+	assert.Nil(err)
+	assert.NotNil(conn)
+	assert.True(time.Since(start) < time.Second, "Fallback not raced")
+	mutex.Lock()
+	assert.InDelta(float64(5*time.Second), float64(timeouts["[2001:db8::1]:443"]), float64(time.Second),
+		"Timeout not shared")
+	mutex.Unlock()
+
+	// Without dual-stack dialing, the addresses are only dialed in turn.
+	dialer = &net.Dialer{Timeout: 100 * time.Millisecond}
+	_, err = cache.wrapDial(dialer, dial)(context.Background(), "tcp", "backend.internal:443")
+	assert.Equal(context.DeadlineExceeded, err)
+}
@@ -0,0 +1,256 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Durations, for swagger values with "format: duration", held in google.protobuf.Duration fields.
+//
+// Parameters are sent as ISO 8601 durations, like "PT1H30M", by default. A parameter may select
+// plain seconds, like "5400" or "1.5", with the x-swaggrpc-duration-format parameter extension, or
+// with OperationOptions.DurationFormats.
+//
+// Durations in responses may be written in either form, or in the proto JSON form, "5400s".
+// ISO 8601 durations may use weeks, days, hours, minutes and seconds; days are 24 hours. Years and
+// months have no fixed length, so aren't read.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Name of the parameter extension selecting a DurationFormat.
+const durationFormatExtension = "x-swaggrpc-duration-format"
+
+// The fully-qualified name of the Duration type.
+const durationTypeName = "google.protobuf.Duration"
+
+// The number of nanoseconds in a second.
+const nanosPerSecond = 1000000000
+
+// DurationFormat is how a Duration field is sent as a parameter.
+type DurationFormat string
+
+const (
+	// An ISO 8601 duration, like "PT1H30M". This is the default.
+	DurationISO8601 DurationFormat = "iso8601"
+	// A decimal number of seconds, like "5400" or "1.5".
+	DurationSeconds DurationFormat = "seconds"
+)
+
+// Returns true if a field holds Duration messages.
+func isDurationField(field *desc.FieldDescriptor) bool {
+	return !field.IsMap() && field.GetMessageType() != nil &&
+		field.GetMessageType().GetFullyQualifiedName() == durationTypeName
+}
+
+// Returns the format for a Duration parameter, from options or else from the spec. Returns an error
+// if the format is unknown.
+func resolveDurationFormat(param *spec.Parameter, operationOptions *OperationOptions) (DurationFormat, error) {
+	format, ok := operationOptions.DurationFormats[param.Name]
+	if !ok {
+		var fromSpec string
+		if _, err := decodeExtension(param.Extensions, durationFormatExtension, &fromSpec); err != nil {
+			return "", err
+		}
+		format = DurationFormat(fromSpec)
+	}
+	switch format {
+	case "":
+		return DurationISO8601, nil
+	case DurationISO8601, DurationSeconds:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown duration format %q for parameter %s", format, param.Name)
+}
+
+// Returns a serializer for the value of a Duration field in the given format.
+func durationStringConverter(field *desc.FieldDescriptor, format DurationFormat) func(interface{}) string {
+	durationType := field.GetMessageType()
+	secondsField := durationType.FindFieldByName("seconds")
+	nanosField := durationType.FindFieldByName("nanos")
+	return func(value interface{}) string {
+		source, ok := value.(proto.Message)
+		if !ok {
+			return ""
+		}
+		// The value may be a generated or dynamic message.
+		duration := dynamic.NewMessage(durationType)
+		if err := duration.MergeFrom(source); err != nil {
+			return ""
+		}
+		seconds := duration.GetField(secondsField).(int64)
+		nanos := duration.GetField(nanosField).(int32)
+		if format == DurationSeconds {
+			return formatSeconds(seconds, nanos)
+		}
+		return formatISO8601Duration(seconds, nanos)
+	}
+}
+
+// Returns a duration as a decimal number of seconds, without trailing zeros.
+func formatSeconds(seconds int64, nanos int32) string {
+	sign := ""
+	if seconds < 0 || nanos < 0 {
+		sign = "-"
+		seconds, nanos = -seconds, -nanos
+	}
+	formatted := sign + strconv.FormatInt(seconds, 10)
+	if nanos != 0 {
+		formatted += strings.TrimRight(fmt.Sprintf(".%09d", nanos), "0")
+	}
+	return formatted
+}
+
+// Returns a duration in ISO 8601 form, in hours, minutes and seconds, like "PT1H30M".
+func formatISO8601Duration(seconds int64, nanos int32) string {
+	sign := ""
+	if seconds < 0 || nanos < 0 {
+		sign = "-"
+		seconds, nanos = -seconds, -nanos
+	}
+	formatted := sign + "PT"
+	if hours := seconds / 3600; hours != 0 {
+		formatted += strconv.FormatInt(hours, 10) + "H"
+	}
+	if minutes := seconds % 3600 / 60; minutes != 0 {
+		formatted += strconv.FormatInt(minutes, 10) + "M"
+	}
+	if seconds%60 != 0 || nanos != 0 || formatted == sign+"PT" {
+		formatted += formatSeconds(seconds%60, nanos) + "S"
+	}
+	return formatted
+}
+
+// Returns the seconds and nanoseconds of an ISO 8601 duration.
+func parseISO8601Duration(value string) (int64, int32, error) {
+	rest := value
+	negative := strings.HasPrefix(rest, "-")
+	rest = strings.TrimPrefix(strings.TrimPrefix(rest, "-"), "+")
+	if !strings.HasPrefix(rest, "P") || len(rest) < 2 {
+		return 0, 0, fmt.Errorf("bad ISO 8601 duration %q", value)
+	}
+	rest = rest[1:]
+	var seconds int64
+	var nanos int32
+	inTime := false
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime || len(rest) == 1 {
+				return 0, 0, fmt.Errorf("bad ISO 8601 duration %q", value)
+			}
+			inTime = true
+			rest = rest[1:]
+			continue
+		}
+		end := strings.IndexAny(rest, "WDHMSYwdhmsy")
+		if end <= 0 {
+			return 0, 0, fmt.Errorf("bad ISO 8601 duration %q", value)
+		}
+		number, designator := rest[:end], rest[end]
+		rest = rest[end+1:]
+		var unit int64
+		switch {
+		case !inTime && designator == 'W':
+			unit = 7 * 24 * 3600
+		case !inTime && designator == 'D':
+			unit = 24 * 3600
+		case inTime && designator == 'H':
+			unit = 3600
+		case inTime && designator == 'M':
+			unit = 60
+		case inTime && designator == 'S':
+			unit = 1
+		default:
+			return 0, 0, fmt.Errorf("unsupported ISO 8601 duration %q: only weeks, days, hours, minutes "+
+				"and seconds are read", value)
+		}
+		if unit == 1 {
+			whole, fraction, err := parseSeconds(number)
+			if err != nil {
+				return 0, 0, fmt.Errorf("bad ISO 8601 duration %q", value)
+			}
+			seconds += whole
+			nanos += fraction
+			continue
+		}
+		count, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || count < 0 {
+			return 0, 0, fmt.Errorf("bad ISO 8601 duration %q", value)
+		}
+		seconds += count * unit
+	}
+	if negative {
+		seconds, nanos = -seconds, -nanos
+	}
+	return seconds, nanos, nil
+}
+
+// Returns the seconds and nanoseconds of a decimal number of seconds, like "1.5".
+func parseSeconds(value string) (int64, int32, error) {
+	negative := strings.HasPrefix(value, "-")
+	digits := strings.TrimPrefix(value, "-")
+	whole, fraction := digits, ""
+	if dot := strings.Index(digits, "."); dot >= 0 {
+		whole, fraction = digits[:dot], digits[dot+1:]
+	}
+	if whole == "" || len(fraction) > 9 || strings.HasPrefix(whole, "+") {
+		return 0, 0, fmt.Errorf("bad seconds %q", value)
+	}
+	seconds, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad seconds %q", value)
+	}
+	var nanos int64
+	if fraction != "" {
+		if nanos, err = strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 32); err != nil || nanos < 0 {
+			return 0, 0, fmt.Errorf("bad seconds %q", value)
+		}
+	}
+	if negative {
+		seconds, nanos = -seconds, -nanos
+	}
+	return seconds, int32(nanos), nil
+}
+
+// Rewrites a duration in a response, written as ISO 8601 or a number of seconds, in the proto JSON
+// form. Returns the value, and true if it changed.
+func normalizeDurationJSON(value interface{}) (interface{}, bool) {
+	var seconds int64
+	var nanos int32
+	var err error
+	switch value := value.(type) {
+	case json.Number:
+		seconds, nanos, err = parseSeconds(value.String())
+	case string:
+		if !strings.HasPrefix(strings.TrimLeft(value, "-+"), "P") {
+			// Already in the proto JSON form.
+			return value, false
+		}
+		seconds, nanos, err = parseISO8601Duration(value)
+	default:
+		return value, false
+	}
+	if err != nil {
+		// Left for jsonpb to report.
+		return value, false
+	}
+	return formatSeconds(seconds, nanos) + "s", true
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/jsonpb"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto with Duration request and response fields.
+const durationsProto = `
+syntax = "proto3";
+
+package durations_test;
+
+import "google/protobuf/duration.proto";
+
+message WaitRequest {
+  google.protobuf.Duration timeout = 1;
+  google.protobuf.Duration interval = 2;
+}
+
+message Step {
+  google.protobuf.Duration elapsed = 1;
+}
+
+message WaitResponse {
+  google.protobuf.Duration waited = 1;
+  repeated Step steps = 2;
+  map<string, google.protobuf.Duration> limits = 3;
+}
+
+service Waiter {
+  rpc Wait(WaitRequest) returns (WaitResponse);
+}
+`
+
+// Tests formatting and parsing of ISO 8601 durations and seconds.
+func TestDurationForms(t *testing.T) {
+	fixtures := []struct {
+		seconds int64
+		nanos   int32
+		iso8601 string
+		decimal string
+	}{
+		{0, 0, "PT0S", "0"},
+		{5400, 0, "PT1H30M", "5400"},
+		{90061, 0, "PT25H1M1S", "90061"},
+		{1, 500000000, "PT1.5S", "1.5"},
+		{-60, 0, "-PT1M", "-60"},
+		{0, -250000000, "-PT0.25S", "-0.25"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.iso8601, func(t *testing.T) {
+			assert := assertions.New(t)
+			assert.Equal(fixture.iso8601, formatISO8601Duration(fixture.seconds, fixture.nanos))
+			assert.Equal(fixture.decimal, formatSeconds(fixture.seconds, fixture.nanos))
+			seconds, nanos, err := parseISO8601Duration(fixture.iso8601)
+			require.Nil(t, err)
+			assert.Equal([]int64{fixture.seconds, int64(fixture.nanos)}, []int64{seconds, int64(nanos)})
+			seconds, nanos, err = parseSeconds(fixture.decimal)
+			require.Nil(t, err)
+			assert.Equal([]int64{fixture.seconds, int64(fixture.nanos)}, []int64{seconds, int64(nanos)})
+		})
+	}
+
+	seconds, _, err := parseISO8601Duration("P1W2DT3H")
+	require.Nil(t, err)
+	assertions.Equal(t, int64(9*24*3600+3*3600), seconds)
+	for _, bad := range []string{"P", "PT", "P1Y", "P1M", "PT1D", "1H", "PT1.5H", "PTxS"} {
+		_, _, err := parseISO8601Duration(bad)
+		assertions.NotNil(t, err, "Expected error for %q", bad)
+	}
+}
+
+// Tests that Duration fields are sent as parameters in their configured formats.
+func TestDurationParams(t *testing.T) {
+	var received url.Values
+	interval := spec.QueryParam("interval").Typed("string", "duration")
+	interval.AddExtension(durationFormatExtension, "seconds")
+	wait := testOperation{
+		method:    testMethod(t, durationsProto, "durations_test.Waiter", "Wait"),
+		path:      "/wait",
+		operation: &spec.Operation{OperationProps: spec.OperationProps{ID: "wait"}},
+		parameters: map[string]*spec.Parameter{
+			"timeout":  spec.QueryParam("timeout").Typed("string", "duration"),
+			"interval": interval,
+		},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			received = r.URL.Query()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		},
+	}
+	adapter, closeServer := wait.adapter(t)
+	defer closeServer()
+
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{
+		request: `{"timeout": "5400s", "interval": "1.500s"}`,
+	}))
+	assertions.Equal(t, url.Values{"timeout": {"PT1H30M"}, "interval": {"1.5"}}, received)
+
+	wait.options = &ServiceOptions{Operations: map[string]*OperationOptions{
+		"wait": {DurationFormats: map[string]DurationFormat{"timeout": "minutes"}},
+	}}
+	_, err := wait.newAdapter(t, "http://localhost")
+	assertions.NotNil(t, err, "Expected error for unknown format")
+}
+
+// Tests that durations in responses are read from ISO 8601 and seconds.
+func TestDurationResponses(t *testing.T) {
+	method := testMethod(t, durationsProto, "durations_test.Waiter", "Wait")
+	adapter, err := testOperation{method: method, path: "/wait", operation: &spec.Operation{},
+		parameters: map[string]*spec.Parameter{}}.newAdapter(t, "http://localhost")
+	require.Nil(t, err)
+
+	response := adapter.newMessage(method.GetOutputType())
+	require.Nil(t, adapter.unmarshalResponse([]byte(`{
+    "waited": "PT2M",
+    "steps": [{"elapsed": 1.25}, {"elapsed": "3s"}],
+    "limits": {"max": "P1D"}
+  }`), response))
+	encoded, err := (&jsonpb.Marshaler{}).MarshalToString(response)
+	require.Nil(t, err)
+	assertions.JSONEq(t, `{
+    "waited": "120s",
+    "steps": [{"elapsed": "1.250s"}, {"elapsed": "3s"}],
+    "limits": {"max": "86400s"}
+  }`, encoded)
+
+	err = adapter.unmarshalResponse([]byte(`{"waited": "P1M"}`), adapter.newMessage(method.GetOutputType()))
+	assertions.NotNil(t, err, "Expected error for a duration in months")
+}
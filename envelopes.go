@@ -0,0 +1,189 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Unwrapping of enveloped backend responses.
+//
+// Legacy APIs often wrap payloads, as in {"data": {...}, "meta": {...}}, while the response message
+// models only the payload. The x-swaggrpc-envelope operation extension names the payload with a
+// JSON pointer, and optionally an object whose members are returned to the caller as response
+// header metadata:
+//
+//   x-swaggrpc-envelope:
+//     payload: /data
+//     metadata: /meta
+//
+// Responses are unwrapped before any response transform is applied.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/jsonpointer"
+	"github.com/go-openapi/spec"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the operation extension describing the response envelope.
+const envelopeExtension = "x-swaggrpc-envelope"
+
+// EnvelopeOptions describes the envelope an operation's responses are wrapped in.
+type EnvelopeOptions struct {
+	// JSON pointer to the payload read into the response message, like "/data".
+	Payload string `json:"payload"`
+	// If set, a JSON pointer to an object, like "/meta", whose string, number and boolean members
+	// are sent to the caller as response header metadata, keyed by member name in lower case.
+	Metadata string `json:"metadata"`
+}
+
+// A parsed envelope.
+type responseEnvelope struct {
+	options  *EnvelopeOptions
+	payload  jsonpointer.Pointer
+	metadata *jsonpointer.Pointer
+}
+
+// Returns an operation's envelope, from its options or else the spec, or nil if it has none.
+// Returns an error if the envelope's pointers can't be parsed.
+func resolveEnvelope(operation *spec.Operation, operationOptions *OperationOptions) (*responseEnvelope, error) {
+	options := operationOptions.Envelope
+	if options == nil {
+		options = &EnvelopeOptions{}
+		found, err := decodeExtension(operation.Extensions, envelopeExtension, options)
+		if err != nil || !found {
+			return nil, err
+		}
+	}
+	payload, err := jsonpointer.New(options.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("bad envelope payload for %s: %v", operation.ID, err)
+	}
+	envelope := &responseEnvelope{options: options, payload: payload}
+	if options.Metadata != "" {
+		metadataPointer, err := jsonpointer.New(options.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("bad envelope metadata for %s: %v", operation.ID, err)
+		}
+		envelope.metadata = &metadataPointer
+	}
+	return envelope, nil
+}
+
+// Returns the payload of an enveloped response body, recording the envelope's metadata on the call.
+func (p *operationAdapter) unwrapResponse(body []byte, call *proxiedCall) ([]byte, error) {
+	payload, md, err := p.unwrapEnvelope(body)
+	if err != nil {
+		return nil, err
+	}
+	call.responseMetadata = metadata.Join(call.responseMetadata, md)
+	return payload, nil
+}
+
+// Returns the payload of an enveloped response body, and the metadata from the envelope. Fails with
+// Internal if the body isn't JSON or has no payload. A null payload is read as an empty message.
+func (p *operationAdapter) unwrapEnvelope(body []byte) ([]byte, metadata.MD, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are kept as written, so that large integers aren't rounded.
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "reading envelope for %s: %v", p.operation.ID, err)
+	}
+	payload, ok := resolveJSONPointer(p.envelope.payload, document)
+	if !ok {
+		return nil, nil, status.Errorf(codes.Internal, "no payload at %s in envelope for %s",
+			p.envelope.payload.String(), p.operation.ID)
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	unwrapped, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.envelope.metadata == nil {
+		return unwrapped, nil, nil
+	}
+	// Metadata is optional in the envelope; the payload is still returned without it.
+	members, _ := resolveJSONPointer(*p.envelope.metadata, document)
+	return unwrapped, envelopeMetadata(members), nil
+}
+
+// Returns the value a JSON pointer refers to in a decoded document, and whether there is one. Unlike
+// Pointer.Get, this finds null values.
+func resolveJSONPointer(pointer jsonpointer.Pointer, document interface{}) (interface{}, bool) {
+	value := document
+	for _, token := range pointer.DecodedTokens() {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = typed[token]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil, false
+			}
+			value = typed[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Returns the scalar members of an envelope's metadata object as metadata. Members whose names
+// aren't valid metadata keys, or are reserved by gRPC, are skipped.
+func envelopeMetadata(members interface{}) metadata.MD {
+	object, ok := members.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	md := metadata.MD{}
+	for name, value := range object {
+		key := strings.ToLower(name)
+		if !isMetadataKey(key) {
+			continue
+		}
+		switch typed := value.(type) {
+		case string:
+			md[key] = append(md[key], typed)
+		case json.Number:
+			md[key] = append(md[key], typed.String())
+		case bool:
+			md[key] = append(md[key], fmt.Sprint(typed))
+		}
+	}
+	return md
+}
+
+// Returns true for lower-case ASCII metadata keys which aren't reserved or binary.
+func isMetadataKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "grpc-") || strings.HasSuffix(key, "-bin") {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that payloads are unwrapped from envelopes, with the envelope's metadata sent to the caller.
+func TestEnvelopeUnwrapping(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		body     string
+		itemName string
+		header   metadata.MD
+		code     codes.Code
+	}{
+		{"payload and metadata",
+			`{"data": {"name": "thing"}, "meta": {"requestId": "r1", "page": 2, "cached": true, ` +
+				`"tags": ["x"], "grpc-status": "5"}}`,
+			"thing", metadata.MD{"requestid": {"r1"}, "page": {"2"}, "cached": {"true"}}, codes.OK},
+		{"no metadata", `{"data": {"name": "thing"}}`, "thing", nil, codes.OK},
+		{"null payload", `{"data": null}`, "", nil, codes.OK},
+		{"no payload", `{"name": "thing"}`, "", nil, codes.Internal},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			operation := &spec.Operation{
+				VendorExtensible: spec.VendorExtensible{Extensions: spec.Extensions{
+					envelopeExtension: map[string]interface{}{"payload": "/data", "metadata": "/meta"},
+				}},
+				OperationProps: spec.OperationProps{ID: "getItem"},
+			}
+			adapter, closeServer := testOperation{operation: operation,
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(fixture.body))
+				}}.adapter(t)
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			err := adapter.handleGRPCRequest(stream)
+			assert.Equal(fixture.code, errorCode(err))
+			if fixture.code != codes.OK {
+				return
+			}
+			require.Len(t, stream.sent, 1)
+			assert.Equal(fixture.itemName, stream.sent[0].GetFieldByName("name"))
+			assert.Equal(fixture.header, stream.header)
+		})
+	}
+}
+
+// Tests that an envelope in options overrides the spec's.
+func TestEnvelopeOptions(t *testing.T) {
+	operation := &spec.Operation{
+		VendorExtensible: spec.VendorExtensible{Extensions: spec.Extensions{
+			envelopeExtension: map[string]interface{}{"payload": "/data"},
+		}},
+		OperationProps: spec.OperationProps{ID: "getItem"},
+	}
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{
+		"getItem": {Envelope: &EnvelopeOptions{Payload: "/results/0"}},
+	}}
+	adapter, closeServer := testOperation{operation: operation, options: options,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"results": [{"name": "first"}, {"name": "second"}]}`))
+		}}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	require.Len(t, stream.sent, 1)
+	assertions.Equal(t, "first", stream.sent[0].GetFieldByName("name"))
+
+	_, err := resolveEnvelope(operation, &OperationOptions{Envelope: &EnvelopeOptions{Payload: "data"}})
+	assertions.Error(t, err, "Bad pointer accepted")
+}
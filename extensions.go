@@ -0,0 +1,70 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Helpers for reading swaggrpc's vendor extensions from a swagger spec.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// Decodes the vendor extension with the given name into target, which should be a pointer to a
+// struct with JSON tags. Returns false if the extension is not present.
+//
+// Extension names are matched case-insensitively; go-openapi lowercases extension names added
+// programmatically, but not those read from JSON.
+func decodeExtension(extensions spec.Extensions, name string, target interface{}) (bool, error) {
+	for key, value := range extensions {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		// Round-trip through JSON to decode the generic value into the target's structure.
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return true, err
+		}
+		if err := json.Unmarshal(bytes, target); err != nil {
+			return true, fmt.Errorf("bad %s extension: %s", name, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// A time.Duration which is read from and written to JSON as a duration string, such as "250ms" or
+// "1m30s".
+type jsonDuration time.Duration
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("durations must be strings such as \"1s\": %s", err)
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(duration)
+	return nil
+}
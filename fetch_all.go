@@ -0,0 +1,159 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Aggregation of every page of a paginated list operation into a single response.
+
+import (
+	"fmt"
+
+	"github.com/go-openapi/runtime"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Names of the pagination fields of list requests and responses.
+const (
+	pageTokenFieldName     = "page_token"
+	nextPageTokenFieldName = "next_page_token"
+)
+
+// FetchAllOptions configures an operation to page through the backend within a single call. The
+// request message must have a page_token field, and the response message a next_page_token field.
+// The items of every page are concatenated into the first page's response. If a limit stops paging
+// early, the response's next_page_token is left set, so that the caller can continue from there.
+// Paging fails if the backend gives a page token it already gave.
+type FetchAllOptions struct {
+	// The repeated response field holding each page's items. If empty, the response must have exactly
+	// one repeated field, which is used.
+	ItemsField string
+	// The maximum number of backend requests per call. Zero means no limit.
+	MaxPages int
+	// The number of items after which paging stops. If a page takes the response past it, the items
+	// beyond it are dropped and next_page_token is cleared, so the response is truncated rather than
+	// continuable. Zero means no limit.
+	MaxItems int
+}
+
+// Fields used to page through an operation.
+type fetchAllFields struct {
+	options       *FetchAllOptions
+	pageToken     *desc.FieldDescriptor
+	nextPageToken *desc.FieldDescriptor
+	items         *desc.FieldDescriptor
+}
+
+// Returns the fields used to page through an operation with the given request and response types.
+func newFetchAllFields(
+	options *FetchAllOptions,
+	inputType *desc.MessageDescriptor,
+	outputType *desc.MessageDescriptor,
+) (*fetchAllFields, error) {
+	fields := &fetchAllFields{
+		options:       options,
+		pageToken:     inputType.FindFieldByName(pageTokenFieldName),
+		nextPageToken: outputType.FindFieldByName(nextPageTokenFieldName),
+	}
+	if fields.pageToken == nil || fields.nextPageToken == nil {
+		return nil, fmt.Errorf("fetching all pages requires %s.%s and %s.%s fields",
+			inputType.GetFullyQualifiedName(), pageTokenFieldName,
+			outputType.GetFullyQualifiedName(), nextPageTokenFieldName)
+	}
+	if options.ItemsField != "" {
+		fields.items = outputType.FindFieldByName(options.ItemsField)
+		if fields.items == nil || !fields.items.IsRepeated() || fields.items.IsMap() {
+			return nil, fmt.Errorf("%s has no repeated field %s",
+				outputType.GetFullyQualifiedName(), options.ItemsField)
+		}
+		return fields, nil
+	}
+	for _, field := range outputType.GetFields() {
+		if !field.IsRepeated() || field.IsMap() {
+			continue
+		}
+		if fields.items != nil {
+			return nil, fmt.Errorf("%s has several repeated fields; set the items field to page through",
+				outputType.GetFullyQualifiedName())
+		}
+		fields.items = field
+	}
+	if fields.items == nil {
+		return nil, fmt.Errorf("%s has no repeated field to page through", outputType.GetFullyQualifiedName())
+	}
+	return fields, nil
+}
+
+// Submits backend requests for every page of results, within the configured limits, returning the
+// aggregated response. Pages after the first are requested with a copy of the request, whose page
+// token is updated for each page, so that the caller's request is left as it was received.
+func (p *operationAdapter) submitAllPages(
+	call *proxiedCall,
+	operation *runtime.ClientOperation,
+	request *dynamic.Message,
+) (interface{}, error) {
+	fields := p.fetchAll
+	result, err := p.submit(call, operation)
+	if err != nil {
+		return result, err
+	}
+	aggregate, ok := result.(*dynamic.Message)
+	if !ok {
+		return result, err
+	}
+	pageToken, _ := request.GetField(fields.pageToken).(string)
+	seen := map[string]bool{pageToken: true}
+	var pageRequest *dynamic.Message
+	for pages := 1; ; pages++ {
+		nextPageToken, _ := aggregate.GetField(fields.nextPageToken).(string)
+		items, _ := aggregate.GetField(fields.items).([]interface{})
+		if maxItems := fields.options.MaxItems; maxItems > 0 && len(items) >= maxItems {
+			if len(items) > maxItems {
+				aggregate.SetField(fields.items, items[:maxItems])
+				aggregate.ClearField(fields.nextPageToken)
+			}
+			return aggregate, nil
+		}
+		if nextPageToken == "" || (fields.options.MaxPages > 0 && pages >= fields.options.MaxPages) {
+			return aggregate, nil
+		}
+		if seen[nextPageToken] {
+			return nil, status.Errorf(codes.Internal, "backend repeated page token %q for %s", nextPageToken,
+				p.operation.ID)
+		}
+		seen[nextPageToken] = true
+
+		if pageRequest == nil {
+			pageRequest = dynamic.NewMessage(request.GetMessageDescriptor())
+			if err := pageRequest.MergeFrom(request); err != nil {
+				return nil, err
+			}
+			operation.Params = p.getRequestWriter(pageRequest, call)
+		}
+		pageRequest.SetField(fields.pageToken, nextPageToken)
+		result, err := p.submit(call, operation)
+		if err != nil {
+			return result, err
+		}
+		page, ok := result.(*dynamic.Message)
+		if !ok {
+			return result, fmt.Errorf("could not cast to expected result type")
+		}
+		pageItems, _ := page.GetField(fields.items).([]interface{})
+		aggregate.SetField(fields.items, append(items, pageItems...))
+		aggregate.SetField(fields.nextPageToken, page.GetField(fields.nextPageToken))
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Backend pages of items, keyed by cursor.
+var testPages = map[string]string{
+	"":   `{"items": ["a", "b"], "next_page_token": "p2"}`,
+	"p2": `{"items": ["c", "d"], "next_page_token": "p3"}`,
+	"p3": `{"items": ["e"]}`,
+}
+
+// Backend pages repeating a page token.
+var repeatingPages = map[string]string{
+	"":   `{"items": ["a"], "next_page_token": "p2"}`,
+	"p2": `{"items": ["b"], "next_page_token": "p2"}`,
+}
+
+// Tests that every page is aggregated into one response, within the configured limits.
+func TestFetchAllPages(t *testing.T) {
+	fixtures := []struct {
+		name          string
+		pages         map[string]string
+		options       FetchAllOptions
+		wantCode      codes.Code
+		wantItems     []interface{}
+		wantNextToken string
+		wantRequests  int
+	}{
+		{"AllPages", testPages, FetchAllOptions{}, codes.OK, []interface{}{"a", "b", "c", "d", "e"}, "", 3},
+		{"MaxPages", testPages, FetchAllOptions{MaxPages: 2}, codes.OK, []interface{}{"a", "b", "c", "d"}, "p3", 2},
+		{"MaxItems", testPages, FetchAllOptions{MaxItems: 2}, codes.OK, []interface{}{"a", "b"}, "p2", 1},
+		{"MaxItems within page", testPages, FetchAllOptions{MaxItems: 3}, codes.OK,
+			[]interface{}{"a", "b", "c"}, "", 2},
+		{"repeated token", repeatingPages, FetchAllOptions{}, codes.Internal, nil, "", 2},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			requests := 0
+			var letters []*DeadLetter
+			adapter, closeServer := testOperation{
+				method: listMethod(t),
+				path:   "/items",
+				operation: parseTestOperation(t,
+					`{"operationId": "listItems", "x-swaggrpc-list-params": {"filter": "search_text"}}`),
+				parameters: listServiceParams,
+				options: &ServiceOptions{
+					Operations: map[string]*OperationOptions{
+						"listItems": {FetchAll: &fixture.options},
+					},
+					DeadLetters: DeadLetterSinkFunc(func(letter *DeadLetter) { letters = append(letters, letter) }),
+				},
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					requests++
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(fixture.pages[r.URL.Query().Get("cursor")]))
+				},
+			}.adapter(t)
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{}`}
+			err := adapter.handleGRPCRequest(stream)
+			assert.Equal(fixture.wantRequests, requests)
+			require.Equal(t, fixture.wantCode, errorCode(err), "Bad result: %v", err)
+			if fixture.wantCode != codes.OK {
+				// The caller's request is reported as received, without the page token of a later page.
+				require.Len(t, letters, 1)
+				assert.JSONEq(`{}`, string(letters[0].Request))
+				return
+			}
+			require.Len(t, stream.sent, 1)
+			assert.Equal(fixture.wantItems, stream.sent[0].GetFieldByName("items"))
+			assert.Equal(fixture.wantNextToken, stream.sent[0].GetFieldByName("next_page_token"))
+		})
+	}
+}
+
+// Tests that operations without pagination fields can't fetch all pages.
+func TestFetchAllRequiresPagination(t *testing.T) {
+	method := listMethod(t)
+	_, err := newFetchAllFields(&FetchAllOptions{}, method.GetOutputType(), method.GetOutputType())
+	assertions.NotNil(t, err, "Expected error without a page_token request field")
+	_, err = newFetchAllFields(&FetchAllOptions{ItemsField: "next_page_token"},
+		method.GetInputType(), method.GetOutputType())
+	assertions.NotNil(t, err, "Expected error for non-repeated items field")
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Pruning of responses to the fields a caller asked for.
+//
+// Callers name the fields they want with a google.protobuf.FieldMask field named read_mask in the
+// request message, or with comma-separated paths in the metadata key configured in
+// ServiceOptions.ReadMaskMetadataKey. Paths may use proto or JSON field names, and name nested
+// fields with dots, like "item.name". Fields not named are cleared from the response.
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Name of the request field holding a read mask.
+const readMaskFieldName = "read_mask"
+
+// Fully-qualified name of the FieldMask message type.
+const fieldMaskTypeName = "google.protobuf.FieldMask"
+
+// Returns the read mask field of a request message type, or nil if it has none.
+func findReadMaskField(inputType *desc.MessageDescriptor) *desc.FieldDescriptor {
+	field := inputType.FindFieldByName(readMaskFieldName)
+	if field == nil || field.IsRepeated() || field.GetMessageType() == nil ||
+		field.GetMessageType().GetFullyQualifiedName() != fieldMaskTypeName {
+		return nil
+	}
+	return field
+}
+
+// Returns the read mask paths for a call: those in the request's read mask, or else those in the
+// configured metadata key. Returns nil if there are none.
+func (p *operationAdapter) readMaskPaths(ctx context.Context, request *dynamic.Message) []string {
+	if p.readMaskField != nil && request.HasField(p.readMaskField) {
+		if paths := fieldMaskPaths(p.readMaskField, request.GetField(p.readMaskField)); len(paths) > 0 {
+			return paths
+		}
+	}
+	if p.options.ReadMaskMetadataKey != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var paths []string
+		for _, path := range strings.Split(firstMetadataValue(md, p.options.ReadMaskMetadataKey), ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+	return nil
+}
+
+// Returns the paths of a FieldMask value.
+func fieldMaskPaths(field *desc.FieldDescriptor, value interface{}) []string {
+	source, ok := value.(proto.Message)
+	if !ok {
+		return nil
+	}
+	// The value may be a generated or dynamic message.
+	mask := dynamic.NewMessage(field.GetMessageType())
+	if err := mask.MergeFrom(source); err != nil {
+		return nil
+	}
+	values, _ := mask.GetFieldByName("paths").([]interface{})
+	paths := make([]string, 0, len(values))
+	for _, path := range values {
+		if path, ok := path.(string); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// A tree of masked field names. An empty tree means all fields are kept.
+type fieldMaskTree map[string]fieldMaskTree
+
+// Returns the tree for the given paths.
+func newFieldMaskTree(paths []string) fieldMaskTree {
+	tree := fieldMaskTree{}
+	for _, path := range paths {
+		node := tree
+		for _, name := range strings.Split(path, ".") {
+			child, ok := node[name]
+			if !ok {
+				child = fieldMaskTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// Clears the fields of msg not named in the given paths.
+func applyFieldMask(msg *dynamic.Message, paths []string) {
+	newFieldMaskTree(paths).prune(msg)
+}
+
+// Clears the fields of msg not in this tree, recursing into nested messages.
+func (t fieldMaskTree) prune(msg *dynamic.Message) {
+	if len(t) == 0 {
+		return
+	}
+	for _, field := range msg.GetMessageDescriptor().GetFields() {
+		subtree, ok := t[field.GetName()]
+		if !ok {
+			subtree, ok = t[field.GetJSONName()]
+		}
+		if !ok {
+			msg.ClearField(field)
+			continue
+		}
+		if len(subtree) == 0 || field.GetMessageType() == nil || field.IsMap() || !msg.HasField(field) {
+			continue
+		}
+		value := msg.GetField(field)
+		if field.IsRepeated() {
+			for _, element := range value.([]interface{}) {
+				if nested, ok := element.(*dynamic.Message); ok {
+					subtree.prune(nested)
+				}
+			}
+		} else if nested, ok := value.(*dynamic.Message); ok {
+			subtree.prune(nested)
+		}
+		msg.SetField(field, value)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Proto with a read mask and nested response messages.
+const maskedServiceProto = `
+syntax = "proto3";
+
+package mask_test;
+
+import "google/protobuf/field_mask.proto";
+
+message GetThingRequest {
+  string id = 1;
+  google.protobuf.FieldMask read_mask = 2;
+}
+
+message Detail {
+  string color = 1;
+  int32 weight = 2;
+}
+
+message Thing {
+  string id = 1;
+  string display_name = 2;
+  Detail detail = 3;
+  repeated Detail variants = 4;
+}
+
+service Things {
+  rpc GetThing(GetThingRequest) returns (Thing);
+}
+`
+
+// Returns the GetThing method of the masked service.
+func maskedMethod(t *testing.T) *desc.MethodDescriptor {
+	return testMethod(t, maskedServiceProto, "mask_test.Things", "GetThing")
+}
+
+// Returns a message of the given type, decoded from JSON.
+func messageFromJSON(t *testing.T, messageType *desc.MessageDescriptor, json string) *dynamic.Message {
+	msg := dynamic.NewMessage(messageType)
+	require.Nil(t, msg.UnmarshalJSON([]byte(json)), "Bad message JSON")
+	return msg
+}
+
+// Tests that fields not named by a mask are cleared, recursing into nested messages.
+func TestApplyFieldMask(t *testing.T) {
+	thingType := maskedMethod(t).GetOutputType()
+	thing := `{
+		"id": "a",
+		"displayName": "Thing",
+		"detail": {"color": "red", "weight": 3},
+		"variants": [{"color": "blue", "weight": 4}]
+	}`
+	fixtures := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"TopLevel", []string{"id"}, `{"id": "a"}`},
+		{"JSONName", []string{"displayName"}, `{"displayName": "Thing"}`},
+		{"WholeMessage", []string{"detail"}, `{"detail": {"color": "red", "weight": 3}}`},
+		{"Nested", []string{"id", "detail.color"}, `{"id": "a", "detail": {"color": "red"}}`},
+		{"Repeated", []string{"variants.weight"}, `{"variants": [{"weight": 4}]}`},
+		{"Unknown", []string{"missing"}, `{}`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			msg := messageFromJSON(t, thingType, thing)
+			applyFieldMask(msg, fixture.paths)
+			got, err := msg.MarshalJSON()
+			require.Nil(t, err)
+			assertions.JSONEq(t, fixture.want, string(got))
+		})
+	}
+}
+
+// Tests that paths come from the request's read mask, or else from metadata.
+func TestReadMaskPaths(t *testing.T) {
+	assert := assertions.New(t)
+	method := maskedMethod(t)
+	adapter := &operationAdapter{
+		options:       &ServiceOptions{ReadMaskMetadataKey: "X-Read-Mask"},
+		readMaskField: findReadMaskField(method.GetInputType()),
+	}
+	require.NotNil(t, adapter.readMaskField, "Read mask field not found")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-read-mask", "id, detail"))
+
+	request := messageFromJSON(t, method.GetInputType(), `{"readMask": {"paths": ["display_name", "detail.color"]}}`)
+	assert.Equal([]string{"display_name", "detail.color"}, adapter.readMaskPaths(ctx, request))
+
+	request = messageFromJSON(t, method.GetInputType(), `{"id": "a"}`)
+	assert.Equal([]string{"id", "detail"}, adapter.readMaskPaths(ctx, request))
+	assert.Nil(adapter.readMaskPaths(context.Background(), request))
+}
+
+// Tests that responses are pruned to the fields named in metadata.
+func TestHandleGRPCRequestAppliesReadMask(t *testing.T) {
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{ReadMaskMetadataKey: "X-Read-Mask"},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"itemId": "abc", "name": "thing"}`))
+		})
+	defer closeServer()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-read-mask", "name"))
+	stream := &fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	require.Len(t, stream.sent, 1)
+	got, err := stream.sent[0].MarshalJSON()
+	require.Nil(t, err)
+	assertions.JSONEq(t, `{"name": "thing"}`, string(got))
+}
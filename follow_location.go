@@ -0,0 +1,127 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Fetching resources created by a call, from the backend response's Location header.
+//
+// The resource is requested as the call's backend request was, with the same headers, credentials
+// and trace context. Locations on other hosts aren't followed, since they'd be sent those too.
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Returns the Location header of a response to follow, or the empty string if the operation doesn't
+// follow locations or the response isn't a 201 or 303 with a location.
+func (p *operationAdapter) locationToFollow(response runtime.ClientResponse) string {
+	if !p.operationOptions.FollowLocation {
+		return ""
+	}
+	if code := response.Code(); code != http.StatusCreated && code != http.StatusSeeOther {
+		return ""
+	}
+	return response.GetHeader("Location")
+}
+
+// Fetches the resource at the location a call's response named, resolved against the backend
+// request's URL. The resource is requested as the call's backend request was, with the same headers
+// and credentials, so it must be on the same host, under the swagger client's base path.
+func (p *operationAdapter) fetchLocation(call *proxiedCall) (*dynamic.Message, error) {
+	requestURL := &url.URL{
+		Scheme: preferredScheme(p.schemes),
+		Host:   p.swaggerClient.Host,
+		Path:   path.Join(p.swaggerClient.BasePath, p.requestPath(call)),
+	}
+	location, err := requestURL.Parse(call.location)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "bad Location %q from backend: %v", call.location, err)
+	}
+	if location.Host != requestURL.Host {
+		return nil, status.Errorf(codes.Internal, "not following Location %s from backend to another host",
+			location)
+	}
+	basePath := strings.TrimSuffix(p.swaggerClient.BasePath, "/")
+	if !strings.HasPrefix(location.Path, basePath+"/") {
+		return nil, status.Errorf(codes.Internal, "not following Location %s from backend outside %s/",
+			location, basePath)
+	}
+	authInfo, err := p.getAuthInfoWriter(call)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.swaggerClient.Submit(&runtime.ClientOperation{
+		Method:             http.MethodGet,
+		PathPattern:        strings.TrimPrefix(location.Path, basePath),
+		ProducesMediaTypes: []string{"application/json"},
+		Schemes:            p.schemes,
+		Params:             p.getLocationWriter(call, location.Query()),
+		Reader:             p.getLocationReader(call, location),
+		AuthInfo:           authInfo,
+		Context:            call.ctx,
+		Client:             p.httpClient,
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Unavailable, "fetching created resource at %s: %v", location, err)
+	}
+	return result.(*dynamic.Message), nil
+}
+
+// Returns the writer of a request for a created resource, with the query from its location, and
+// the headers and query parameters sent with every backend request for the call.
+func (p *operationAdapter) getLocationWriter(call *proxiedCall, query url.Values) runtime.ClientRequestWriterFunc {
+	return func(request runtime.ClientRequest, format strfmt.Registry) error {
+		call.backendStart = time.Now()
+		if err := p.writeCallHeaders(call, request); err != nil {
+			return err
+		}
+		for name, values := range query {
+			if err := request.SetQueryParam(name, values...); err != nil {
+				return err
+			}
+		}
+		if err := p.writeQueryParams(call.ctx, request); err != nil {
+			return err
+		}
+		return p.writeCallContext(call, request)
+	}
+}
+
+// Returns the reader of a created resource, which fails with Internal unless it's found.
+func (p *operationAdapter) getLocationReader(call *proxiedCall, location *url.URL) runtime.ClientResponseReaderFunc {
+	return func(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+		call.httpStatus = response.Code()
+		if call.httpStatus == http.StatusUnauthorized && call.sessionToken != "" {
+			p.options.backendSession().invalidate(call.sessionToken)
+		}
+		if call.httpStatus/100 != 2 {
+			return nil, status.Errorf(codes.Internal, "fetching created resource at %s: HTTP status %d",
+				location, call.httpStatus)
+		}
+		return p.readJSONResponse(response, call)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Returns a backend answering the GetItem request with 201 and a relative Location, and serving the
+// created item there with the given status.
+func createdItemBackend(createdStatus int) http.HandlerFunc {
+	return createdItemBackendAt("abc/created?view=full", createdStatus)
+}
+
+// Returns a backend as createdItemBackend does, with the given Location.
+func createdItemBackendAt(location string, createdStatus int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items/abc":
+			w.Header().Set("Location", location)
+			w.WriteHeader(http.StatusCreated)
+		case "/items/abc/created":
+			if r.URL.Query().Get("view") != "full" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(createdStatus)
+			w.Write([]byte(`{"itemId": "abc", "name": "created"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// Tests that created resources are fetched from their location when the operation follows
+// locations.
+func TestFollowLocation(t *testing.T) {
+	assert := assertions.New(t)
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{"getItem": {FollowLocation: true}}}
+	adapter, closeServer := newTestAdapter(t, options, createdItemBackend(http.StatusOK))
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	require.Len(t, stream.sent, 1)
+	assert.Equal("created", stream.sent[0].GetFieldByName("name"))
+}
+
+// Tests that created resources are fetched with the call's headers and credentials.
+func TestFollowLocationCredentials(t *testing.T) {
+	assert := assertions.New(t)
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(apiKeySpec), swagger))
+	options := &ServiceOptions{
+		Headers:         map[string]string{"X-Api-Version": "2"},
+		MetadataHeaders: &MetadataHeaderOptions{Allow: []string{"x-request-id"}},
+		APIKeys:         NewAPIKeyOptions(swagger, map[string]*APIKey{"headerKey": {Value: "secret"}}),
+		Operations:      map[string]*OperationOptions{"getItem": {FollowLocation: true}},
+	}
+	var requests []*http.Request
+	backend := createdItemBackend(http.StatusOK)
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		backend(w, r)
+	})
+	defer closeServer()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "r1"))
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}))
+	require.Len(t, requests, 2)
+	fetch := requests[1]
+	assert.Equal("/items/abc/created", fetch.URL.Path)
+	assert.Equal("2", fetch.Header.Get("X-Api-Version"))
+	assert.Equal("r1", fetch.Header.Get("X-Request-Id"))
+	assert.Equal("secret", fetch.Header.Get("X-Api-Key"))
+	assert.Equal(requests[0].Header.Get("User-Agent"), fetch.Header.Get("User-Agent"))
+}
+
+// Tests that locations on other hosts, or outside the base path, aren't followed.
+func TestFollowLocationElsewhere(t *testing.T) {
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{"getItem": {FollowLocation: true}}}
+	for _, location := range []string{"http://elsewhere.example.com/items/abc/created", "//elsewhere/items"} {
+		t.Run(location, func(t *testing.T) {
+			adapter, closeServer := newTestAdapter(t, options, createdItemBackendAt(location, http.StatusOK))
+			defer closeServer()
+
+			err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+			assertions.Equal(t, codes.Internal, errorCode(err), "Bad error: %v", err)
+		})
+	}
+}
+
+// Tests that failures fetching the created resource are returned.
+func TestFollowLocationFailure(t *testing.T) {
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{"getItem": {FollowLocation: true}}}
+	adapter, closeServer := newTestAdapter(t, options, createdItemBackend(http.StatusNotFound))
+	defer closeServer()
+
+	err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assertions.Equal(t, codes.Internal, errorCode(err), "Bad error: %v", err)
+}
+
+// Tests that locations aren't followed by default.
+func TestFollowLocationDisabled(t *testing.T) {
+	adapter, closeServer := newTestAdapter(t, nil, createdItemBackend(http.StatusOK))
+	defer closeServer()
+
+	// The empty 201 body isn't valid JSON.
+	err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assertions.NotNil(t, err, "Expected the 201 body to be decoded")
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Form parameters, sent as URL-encoded or multipart form bodies.
+//
+// Operations with "formData" parameters send them as fields of a form body in place of a body
+// parameter, which Swagger 2.0 doesn't allow alongside them. Fields are serialized as for query
+// parameters. Operations with a "file" parameter are sent as multipart/form-data, with the file's
+// contents read from a bytes or string field; others are sent URL-encoded.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+const multipartMediaType = "multipart/form-data"
+
+// Returns the media type of an operation's form bodies, or empty if it has no form parameters.
+func formMediaTypeFor(parameters map[string]*spec.Parameter) string {
+	mediaType := ""
+	for _, param := range parameters {
+		if param.In != "formData" {
+			continue
+		}
+		if isFileParam(param) {
+			return multipartMediaType
+		}
+		mediaType = formMediaType
+	}
+	return mediaType
+}
+
+// Returns true for file form parameters, and those of the "binary" format, which are also uploaded
+// as files.
+func isFileParam(param *spec.Parameter) bool {
+	return param.In == "formData" && (param.Type == "file" || param.Format == "binary")
+}
+
+// Checks that a file parameter's field holds a single file's contents.
+func checkFileField(param *spec.Parameter, field *desc.FieldDescriptor) error {
+	fieldType := field.GetType()
+	if field.IsRepeated() || (fieldType != descriptor.FieldDescriptorProto_TYPE_BYTES &&
+		fieldType != descriptor.FieldDescriptorProto_TYPE_STRING) {
+		return fmt.Errorf("file parameter %s must map to a singular bytes or string field, not %s",
+			param.Name, field.GetFullyQualifiedName())
+	}
+	return nil
+}
+
+// Writes the value of a bytes or string field as an uploaded file, named after the parameter.
+func (step *paramStep) writeFile(value interface{}, request runtime.ClientRequest) error {
+	var contents []byte
+	switch typed := value.(type) {
+	case []byte:
+		contents = typed
+	case string:
+		contents = []byte(typed)
+	}
+	return request.SetFileParam(step.name, &namedReadCloser{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(contents)),
+		name:       step.name,
+	})
+}
+
+// An in-memory file for multipart bodies.
+type namedReadCloser struct {
+	io.ReadCloser
+	name string
+}
+
+func (f *namedReadCloser) Name() string {
+	return f.name
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const formParamsProto = `
+syntax = "proto3";
+
+package form_params_test;
+
+message UploadRequest {
+  string name = 1;
+  bytes file = 2;
+  string note = 3;
+  repeated string tags = 4;
+}
+
+message UploadResponse {
+  string name = 1;
+}
+
+service Uploads {
+  rpc Upload(UploadRequest) returns (UploadResponse);
+}
+`
+
+// Tests that form parameters are sent as a URL-encoded body, or as a multipart body for operations
+// with a file parameter.
+func TestFormParams(t *testing.T) {
+	fixtures := []struct {
+		name         string
+		parameters   map[string]*spec.Parameter
+		request      string
+		mediaType    string
+		wantForm     url.Values
+		wantFile     string
+		wantFilename string
+	}{
+		{"URL-encoded", map[string]*spec.Parameter{
+			"name": spec.FormDataParam("name").Typed("string", "").AsRequired(),
+			"note": spec.FormDataParam("note").Typed("string", ""),
+			"tags": spec.FormDataParam("tags").CollectionOf(spec.NewItems().Typed("string", ""), "multi"),
+		}, `{"name": "report", "tags": ["a", "b"]}`, formMediaType,
+			url.Values{"name": {"report"}, "tags": {"a", "b"}}, "", ""},
+		// "aGVsbG8=" is the JSON encoding of the bytes "hello".
+		{"multipart", map[string]*spec.Parameter{
+			"name": spec.FormDataParam("name").Typed("string", "").AsRequired(),
+			"file": spec.FileParam("file").AsRequired(),
+		}, `{"name": "greeting", "file": "aGVsbG8="}`, multipartMediaType,
+			url.Values{"name": {"greeting"}}, "hello", "file"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			var mediaType, file, filename string
+			var form url.Values
+			adapter, closeServer := testOperation{
+				method:     testMethod(t, formParamsProto, "form_params_test.Uploads", "Upload"),
+				httpMethod: "POST",
+				path:       "/uploads",
+				operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "upload"}},
+				parameters: fixture.parameters,
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					mediaType, _, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+					if mediaType == multipartMediaType {
+						assert.Nil(r.ParseMultipartForm(1 << 20))
+						if formFile, header, err := r.FormFile("file"); err == nil {
+							contents, _ := ioutil.ReadAll(formFile)
+							file, filename = string(contents), header.Filename
+						}
+					} else {
+						assert.Nil(r.ParseForm())
+					}
+					form = r.PostForm
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"name": "stored"}`))
+				},
+			}.adapter(t)
+			defer closeServer()
+			assert.Equal(fixture.mediaType, adapter.bodyMediaType)
+
+			stream := &fakeServerStream{request: fixture.request}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			assert.Equal(fixture.mediaType, mediaType)
+			assert.Equal(fixture.wantForm, form, "Unset fields should be omitted")
+			assert.Equal(fixture.wantFile, file)
+			assert.Equal(fixture.wantFilename, filename)
+			require.Len(t, stream.sent, 1)
+			assert.Equal("stored", stream.sent[0].GetFieldByName("name"))
+		})
+	}
+}
+
+// Tests that file parameters must map to a single bytes or string field.
+func TestFileParamFieldType(t *testing.T) {
+	_, err := testOperation{
+		method:     testMethod(t, formParamsProto, "form_params_test.Uploads", "Upload"),
+		httpMethod: "POST",
+		path:       "/uploads",
+		operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "upload"}},
+		parameters: map[string]*spec.Parameter{"tags": spec.FileParam("tags")},
+	}.newAdapter(t, "http://localhost")
+	assertions.Error(t, err)
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Forwarding of the caller's address to backends, in the de-facto X-Forwarded-For header and the
+// RFC 7239 Forwarded header.
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Header & metadata key names.
+const (
+	xForwardedForHeader = "X-Forwarded-For"
+	forwardedHeader     = "Forwarded"
+)
+
+// Appends the caller's address to the forwarding headers of a backend request. Values for these
+// headers in the caller's metadata are kept if the caller is one of the trusted proxies, and dropped
+// otherwise, so that callers can't forge the addresses backends see. Does nothing if the caller has
+// no IP address, such as when connected over a unix socket.
+func forwardClientAddress(ctx context.Context, request runtime.ClientRequest, trustedProxies []*net.IPNet) error {
+	callerPeer, ok := peer.FromContext(ctx)
+	if !ok || callerPeer.Addr == nil {
+		return nil
+	}
+	ip := peerIP(callerPeer.Addr)
+	if ip == nil {
+		return nil
+	}
+	var md metadata.MD
+	if containsIP(trustedProxies, ip) {
+		md, _ = metadata.FromIncomingContext(ctx)
+	}
+
+	// Copied, so as not to modify the caller's metadata.
+	forwardedFor := append(append([]string{}, md[strings.ToLower(xForwardedForHeader)]...), ip.String())
+	if err := request.SetHeaderParam(xForwardedForHeader, strings.Join(forwardedFor, ", ")); err != nil {
+		return err
+	}
+	forwarded := append(append([]string{}, md[strings.ToLower(forwardedHeader)]...), "for="+forwardedNode(ip))
+	return request.SetHeaderParam(forwardedHeader, strings.Join(forwarded, ", "))
+}
+
+// Parses trusted proxy addresses, as IPs or CIDR ranges.
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %q: not an IP address or CIDR range", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Returns true if any of the networks contains ip.
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IP address of a peer, or nil if it doesn't have one.
+func peerIP(addr net.Addr) net.IP {
+	switch typed := addr.(type) {
+	case *net.TCPAddr:
+		return typed.IP
+	case *net.UDPAddr:
+		return typed.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// Returns an IP address as a Forwarded header node. IPv6 addresses are bracketed and quoted, as RFC
+// 7239 requires.
+func forwardedNode(ip net.IP) string {
+	if ip.To4() == nil {
+		return `"[` + ip.String() + `]"`
+	}
+	return ip.String()
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Tests that the caller's address is appended to the forwarding headers, after those of trusted
+// proxies.
+func TestForwardClientAddress(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies([]string{"192.0.2.0/24", "2001:db8::1"})
+	require.Nil(t, err)
+	fixtures := []struct {
+		name             string
+		addr             net.Addr
+		md               metadata.MD
+		wantForwardedFor string
+		wantForwarded    string
+	}{
+		{
+			name:             "IPv4",
+			addr:             &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234},
+			wantForwardedFor: "192.0.2.1",
+			wantForwarded:    "for=192.0.2.1",
+		},
+		{
+			name:             "IPv6",
+			addr:             &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234},
+			wantForwardedFor: "2001:db8::1",
+			wantForwarded:    `for="[2001:db8::1]"`,
+		},
+		{
+			name: "AppendsToMetadata",
+			addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234},
+			md: metadata.Pairs(
+				"x-forwarded-for", "203.0.113.7",
+				"forwarded", "for=203.0.113.7;proto=https",
+			),
+			wantForwardedFor: "203.0.113.7, 192.0.2.1",
+			wantForwarded:    "for=203.0.113.7;proto=https, for=192.0.2.1",
+		},
+		{
+			name: "DropsUntrustedMetadata",
+			addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.9"), Port: 1234},
+			md: metadata.Pairs(
+				"x-forwarded-for", "203.0.113.7",
+				"forwarded", "for=203.0.113.7",
+			),
+			wantForwardedFor: "198.51.100.9",
+			wantForwarded:    "for=198.51.100.9",
+		},
+		{
+			name: "UnixSocket",
+			addr: &net.UnixAddr{Name: "/tmp/socket", Net: "unix"},
+		},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: fixture.addr})
+			if fixture.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, fixture.md)
+			}
+			request := newFakeClientRequest()
+			assert.Nil(forwardClientAddress(ctx, request, trustedProxies))
+			assert.Equal(fixture.wantForwardedFor, request.headers.Get("X-Forwarded-For"))
+			assert.Equal(fixture.wantForwarded, request.headers.Get("Forwarded"))
+		})
+	}
+}
+
+// Tests that nothing is forwarded without peer information.
+func TestForwardClientAddressNoPeer(t *testing.T) {
+	request := newFakeClientRequest()
+	assertions.Nil(t, forwardClientAddress(context.Background(), request, nil))
+	assertions.Empty(t, request.headers)
+}
+
+// Tests that trusted proxies must be IPs or CIDR ranges.
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := parseTrustedProxies([]string{"10.0.0.1", "10.1.0.0/16"})
+	require.Nil(t, err)
+	assertions.True(t, containsIP(networks, net.ParseIP("10.0.0.1")))
+	assertions.False(t, containsIP(networks, net.ParseIP("10.0.0.2")))
+	assertions.True(t, containsIP(networks, net.ParseIP("10.1.2.3")))
+	_, err = parseTrustedProxies([]string{"proxy.internal"})
+	assertions.Error(t, err)
+}
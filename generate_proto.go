@@ -0,0 +1,545 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Generation of proto service definitions from swagger specs, in place of openapi2proto.
+//
+// Each definition becomes a message of the same name, in upper camel case. Each operation's method
+// takes a <Method>Request message with a field per parameter, and returns its success response's
+// referenced definition, a <Method>Response message, or google.protobuf.Empty if the response has no
+// schema. Fields are named after properties and parameters, with characters proto doesn't allow
+// replaced by underscores, and keep the spec's names as their JSON names. Inline objects become
+// nested messages; free-form objects and untyped values become google.protobuf.Struct and Value.
+// Array and scalar schemas become messages with a single "items" or "value" field, as read by
+// array_responses.go and scalar_responses.go.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// The prefix of references to a spec's definitions.
+const definitionRefPrefix = "#/definitions/"
+
+// Well-known types used by generated protos, keyed by fully-qualified name, with their files.
+var generatedWellKnownTypes = map[string]string{
+	".google.protobuf.Empty":     "google/protobuf/empty.proto",
+	".google.protobuf.Struct":    "google/protobuf/struct.proto",
+	".google.protobuf.Value":     "google/protobuf/struct.proto",
+	".google.protobuf.ListValue": "google/protobuf/struct.proto",
+}
+
+// A generated message.
+type protoMessage struct {
+	name   string
+	fields []protoField
+	nested []*protoMessage
+	// Names of the message's fields and nested messages, which share a scope.
+	scope map[string]bool
+}
+
+// A generated field.
+type protoField struct {
+	name string
+	// The spec's name for the field, if it isn't the default JSON name.
+	jsonName  string
+	fieldType protoType
+}
+
+// A generated field type.
+type protoType struct {
+	// The type name, fully-qualified for messages.
+	name     string
+	repeated bool
+	// True for maps with string keys and values of the named type.
+	isMap bool
+}
+
+// Generates the proto for a spec.
+type protoGenerator struct {
+	swagger     *spec.Swagger
+	packageName string
+	// Top-level names in use.
+	names map[string]bool
+	// Message names keyed by definition name.
+	definitions map[string]string
+	messages    []*protoMessage
+	// True if a method returns google.protobuf.Empty.
+	emptyOutput bool
+}
+
+// Returns a proto file declaring the services and methods for the given operations of a spec, with
+// messages for its definitions and operations. Services keep their names, and definitions clashing
+// with them are given numeric suffixes. Returns an error if a schema can't be represented, such as
+// one referring to something other than a definition.
+func generateProto(swagger *spec.Swagger, methods []OperationMethod, packageName string) ([]byte, error) {
+	g := &protoGenerator{
+		swagger:     swagger,
+		packageName: packageName,
+		names:       make(map[string]bool),
+		definitions: make(map[string]string),
+	}
+	// Services claim their names first, since methods are found by them.
+	for _, method := range methods {
+		g.names[method.Service] = true
+	}
+
+	definitionNames := make([]string, 0, len(swagger.Definitions))
+	for name := range swagger.Definitions {
+		definitionNames = append(definitionNames, name)
+	}
+	sort.Strings(definitionNames)
+	for _, name := range definitionNames {
+		g.definitions[name] = g.uniqueName(messageName(name))
+	}
+	for _, name := range definitionNames {
+		schema := swagger.Definitions[name]
+		message, err := g.schemaMessage(g.definitions[name], &schema)
+		if err != nil {
+			return nil, fmt.Errorf("definition %s: %v", name, err)
+		}
+		g.messages = append(g.messages, message)
+	}
+
+	// Method signatures, keyed by service and then method.
+	services := make(map[string][]string)
+	var serviceNames []string
+	for _, method := range methods {
+		input, output, err := g.methodMessages(&method)
+		if err != nil {
+			return nil, fmt.Errorf("operation %s: %v", method.Operation.ID, err)
+		}
+		if services[method.Service] == nil {
+			serviceNames = append(serviceNames, method.Service)
+		}
+		services[method.Service] = append(services[method.Service],
+			fmt.Sprintf("rpc %s (%s) returns (%s) {}", method.Method, input, output))
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "syntax = \"proto3\";\n\npackage %s;\n\n", packageName)
+	for _, file := range g.imports() {
+		fmt.Fprintf(&out, "import %q;\n", file)
+	}
+	for _, message := range g.messages {
+		out.WriteString("\n")
+		writeMessage(&out, message, "")
+	}
+	for _, service := range serviceNames {
+		fmt.Fprintf(&out, "\nservice %s {\n", service)
+		for _, rpc := range services[service] {
+			fmt.Fprintf(&out, "  %s\n", rpc)
+		}
+		out.WriteString("}\n")
+	}
+	return out.Bytes(), nil
+}
+
+// Returns the input and output type names of a method, adding messages for them as needed.
+func (g *protoGenerator) methodMessages(method *OperationMethod) (string, string, error) {
+	params, err := operationParameters(g.swagger, method.Path, method.Operation)
+	if err != nil {
+		return "", "", err
+	}
+	request := &protoMessage{name: g.uniqueName(method.Method + "Request"), scope: make(map[string]bool)}
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = request.claim(fieldName(param.Name))
+	}
+	for i, param := range params {
+		fieldType, err := g.paramType(request, param)
+		if err != nil {
+			return "", "", fmt.Errorf("parameter %s: %v", param.Name, err)
+		}
+		request.fields = append(request.fields, newProtoField(names[i], param.Name, fieldType))
+	}
+	g.messages = append(g.messages, request)
+
+	response := g.resolveResponse(successResponse(method.Operation))
+	if response == nil || response.Schema == nil {
+		g.emptyOutput = true
+		return g.qualify(request.name), ".google.protobuf.Empty", nil
+	}
+	if ref := response.Schema.Ref.String(); ref != "" {
+		output, err := g.definitionType(ref)
+		return g.qualify(request.name), output, err
+	}
+	message, err := g.schemaMessage(g.uniqueName(method.Method+"Response"), response.Schema)
+	if err != nil {
+		return "", "", err
+	}
+	g.messages = append(g.messages, message)
+	return g.qualify(request.name), g.qualify(message.name), nil
+}
+
+// Returns the response a reference refers to, or the response if it isn't a reference.
+func (g *protoGenerator) resolveResponse(response *spec.Response) *spec.Response {
+	if response == nil || response.Ref.String() == "" {
+		return response
+	}
+	name := strings.TrimPrefix(response.Ref.String(), "#/responses/")
+	if resolved, ok := g.swagger.Responses[name]; ok {
+		return &resolved
+	}
+	return nil
+}
+
+// Returns a message for a schema: its properties for objects, or a single "items" or "value" field
+// for arrays and other values.
+func (g *protoGenerator) schemaMessage(name string, schema *spec.Schema) (*protoMessage, error) {
+	message := &protoMessage{name: name, scope: make(map[string]bool)}
+	properties, err := g.properties(schema)
+	if err != nil {
+		return nil, err
+	}
+	if properties != nil || schema.Type.Contains("object") {
+		return message, g.addProperties(message, properties)
+	}
+	fieldType, err := g.schemaType(message, "Item", schema)
+	if err != nil {
+		return nil, err
+	}
+	name = "value"
+	if fieldType.repeated {
+		name = "items"
+	}
+	message.fields = append(message.fields, newProtoField(message.claim(name), name, fieldType))
+	return message, nil
+}
+
+// Returns an object schema's properties, with those of any schemas it's composed of with allOf, or
+// nil if it has none.
+func (g *protoGenerator) properties(schema *spec.Schema) (map[string]spec.Schema, error) {
+	if len(schema.AllOf) == 0 {
+		return schema.Properties, nil
+	}
+	properties := make(map[string]spec.Schema)
+	for i := range schema.AllOf {
+		part := &schema.AllOf[i]
+		if ref := part.Ref.String(); ref != "" {
+			definition, ok := g.swagger.Definitions[strings.TrimPrefix(ref, definitionRefPrefix)]
+			if !strings.HasPrefix(ref, definitionRefPrefix) || !ok {
+				return nil, fmt.Errorf("unknown reference %s", ref)
+			}
+			part = &definition
+		}
+		partProperties, err := g.properties(part)
+		if err != nil {
+			return nil, err
+		}
+		for name, property := range partProperties {
+			properties[name] = property
+		}
+	}
+	for name, property := range schema.Properties {
+		properties[name] = property
+	}
+	return properties, nil
+}
+
+// Adds fields to a message for properties, in name order.
+func (g *protoGenerator) addProperties(message *protoMessage, properties map[string]spec.Schema) error {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fieldNames := make([]string, len(names))
+	for i, name := range names {
+		fieldNames[i] = message.claim(fieldName(name))
+	}
+	for i, name := range names {
+		property := properties[name]
+		fieldType, err := g.schemaType(message, messageName(name), &property)
+		if err != nil {
+			return fmt.Errorf("property %s: %v", name, err)
+		}
+		message.fields = append(message.fields, newProtoField(fieldNames[i], name, fieldType))
+	}
+	return nil
+}
+
+// Returns the type of a field holding a schema's values. Inline objects are added to the parent
+// message as nested messages, named after nestedName.
+func (g *protoGenerator) schemaType(parent *protoMessage, nestedName string, schema *spec.Schema) (
+	protoType, error) {
+	if ref := schema.Ref.String(); ref != "" {
+		name, err := g.definitionType(ref)
+		return protoType{name: name}, err
+	}
+	properties, err := g.properties(schema)
+	if err != nil {
+		return protoType{}, err
+	}
+	switch {
+	case schema.Type.Contains("array"):
+		if schema.Items == nil || schema.Items.Schema == nil {
+			return protoType{name: ".google.protobuf.Value", repeated: true}, nil
+		}
+		item, err := g.schemaType(parent, nestedName, schema.Items.Schema)
+		if err != nil {
+			return protoType{}, err
+		}
+		if item.repeated || item.isMap {
+			// Lists can't hold lists or maps, so these hold JSON values.
+			item = protoType{name: ".google.protobuf.ListValue"}
+			if schema.Items.Schema.Type.Contains("object") {
+				item.name = ".google.protobuf.Struct"
+			}
+		}
+		item.repeated = true
+		return item, nil
+	case properties != nil:
+		nested := &protoMessage{name: parent.claim(nestedName), scope: make(map[string]bool)}
+		if err := g.addProperties(nested, properties); err != nil {
+			return protoType{}, err
+		}
+		parent.nested = append(parent.nested, nested)
+		return protoType{name: nested.name}, nil
+	case schema.Type.Contains("object"):
+		if schema.AdditionalProperties == nil || schema.AdditionalProperties.Schema == nil {
+			return protoType{name: ".google.protobuf.Struct"}, nil
+		}
+		value, err := g.schemaType(parent, nestedName, schema.AdditionalProperties.Schema)
+		if err != nil {
+			return protoType{}, err
+		}
+		if value.repeated || value.isMap {
+			return protoType{name: ".google.protobuf.Struct"}, nil
+		}
+		value.isMap = true
+		return value, nil
+	case len(schema.Type) > 0:
+		if name := scalarTypeName(schema.Type[0], schema.Format); name != "" {
+			return protoType{name: name}, nil
+		}
+		return protoType{}, fmt.Errorf("unsupported type %s", schema.Type[0])
+	}
+	return protoType{name: ".google.protobuf.Value"}, nil
+}
+
+// Returns the type of a field holding a parameter's values.
+func (g *protoGenerator) paramType(parent *protoMessage, param *spec.Parameter) (protoType, error) {
+	if param.In == "body" {
+		if param.Schema == nil {
+			return protoType{name: ".google.protobuf.Value"}, nil
+		}
+		return g.schemaType(parent, messageName(param.Name), param.Schema)
+	}
+	typeName, format := param.Type, param.Format
+	repeated := typeName == "array"
+	if repeated {
+		if param.Items == nil {
+			return protoType{}, fmt.Errorf("array parameter has no items")
+		}
+		typeName, format = param.Items.Type, param.Items.Format
+	}
+	name := scalarTypeName(typeName, format)
+	if name == "" {
+		return protoType{}, fmt.Errorf("unsupported type %s", typeName)
+	}
+	return protoType{name: name, repeated: repeated}, nil
+}
+
+// Returns the message type name for a reference to a definition.
+func (g *protoGenerator) definitionType(ref string) (string, error) {
+	name, ok := g.definitions[strings.TrimPrefix(ref, definitionRefPrefix)]
+	if !strings.HasPrefix(ref, definitionRefPrefix) || !ok {
+		return "", fmt.Errorf("unknown reference %s", ref)
+	}
+	return g.qualify(name), nil
+}
+
+// Returns the fully-qualified name of a top-level message, so that nested messages of the same name
+// don't hide it.
+func (g *protoGenerator) qualify(name string) string {
+	return "." + g.packageName + "." + name
+}
+
+// Returns a top-level name, with a numeric suffix if it's already in use, and claims it.
+func (g *protoGenerator) uniqueName(name string) string {
+	unique := name
+	for suffix := 2; g.names[unique]; suffix++ {
+		unique = name + strconv.Itoa(suffix)
+	}
+	g.names[unique] = true
+	return unique
+}
+
+// Returns the well-known files the generated messages import, sorted.
+func (g *protoGenerator) imports() []string {
+	files := make(map[string]bool)
+	var visit func(messages []*protoMessage)
+	visit = func(messages []*protoMessage) {
+		for _, message := range messages {
+			for _, field := range message.fields {
+				if file, ok := generatedWellKnownTypes[field.fieldType.name]; ok {
+					files[file] = true
+				}
+			}
+			visit(message.nested)
+		}
+	}
+	visit(g.messages)
+	if g.emptyOutput {
+		files[generatedWellKnownTypes[".google.protobuf.Empty"]] = true
+	}
+	sorted := make([]string, 0, len(files))
+	for file := range files {
+		sorted = append(sorted, file)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Returns a name in the message's scope, with a numeric suffix if it's already in use, and claims it.
+func (m *protoMessage) claim(name string) string {
+	unique := name
+	for suffix := 2; m.scope[unique]; suffix++ {
+		unique = name + strconv.Itoa(suffix)
+	}
+	m.scope[unique] = true
+	return unique
+}
+
+// Returns a field, keeping its spec name as its JSON name unless that's the default.
+func newProtoField(name, specName string, fieldType protoType) protoField {
+	field := protoField{name: name, fieldType: fieldType}
+	if specName != name || strings.Contains(name, "_") {
+		field.jsonName = specName
+	}
+	return field
+}
+
+// Writes a message declaration, indented.
+func writeMessage(out *bytes.Buffer, message *protoMessage, indent string) {
+	fmt.Fprintf(out, "%smessage %s {\n", indent, message.name)
+	for _, nested := range message.nested {
+		writeMessage(out, nested, indent+"  ")
+	}
+	for i, field := range message.fields {
+		typeName := field.fieldType.name
+		if field.fieldType.isMap {
+			typeName = "map<string, " + typeName + ">"
+		} else if field.fieldType.repeated {
+			typeName = "repeated " + typeName
+		}
+		fmt.Fprintf(out, "%s  %s %s = %d", indent, typeName, field.name, i+1)
+		if field.jsonName != "" {
+			fmt.Fprintf(out, " [json_name = %s]", quoteProtoString(field.jsonName))
+		}
+		out.WriteString(";\n")
+	}
+	fmt.Fprintf(out, "%s}\n", indent)
+}
+
+// Returns the proto scalar type for a swagger type and format, or the empty string if there is none.
+func scalarTypeName(typeName, format string) string {
+	switch typeName {
+	case "integer":
+		switch format {
+		case "int64":
+			return "int64"
+		case "uint32":
+			return "uint32"
+		case "uint64":
+			return "uint64"
+		}
+		return "int32"
+	case "number":
+		if format == "float" {
+			return "float"
+		}
+		return "double"
+	case "boolean":
+		return "bool"
+	case "string":
+		if format == "byte" || format == "binary" {
+			return "bytes"
+		}
+		return "string"
+	case "file":
+		return "bytes"
+	}
+	return ""
+}
+
+// Returns a message name for a spec name, in upper camel case.
+func messageName(name string) string {
+	if name = camelCase(name); name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "Message" + name
+	}
+	return name
+}
+
+// Returns a field name for a spec name, with characters other than ASCII letters, digits and
+// underscores replaced by underscores.
+func fieldName(name string) string {
+	replaced := []byte(name)
+	for i, c := range replaced {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			replaced[i] = '_'
+		}
+	}
+	if len(replaced) == 0 || replaced[0] >= '0' && replaced[0] <= '9' || replaced[0] == '_' {
+		return "field_" + string(replaced)
+	}
+	return string(replaced)
+}
+
+// Returns a proto string literal.
+func quoteProtoString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// Returns an operation's parameters, including those of its path item, with references to the
+// spec's parameters resolved. Operation parameters override path item parameters of the same name
+// and location. Returns an error if a reference can't be resolved, or two parameters share a name.
+func operationParameters(swagger *spec.Swagger, path string, operation *spec.Operation) ([]*spec.Parameter, error) {
+	var declared []spec.Parameter
+	if swagger.Paths != nil {
+		declared = append(declared, swagger.Paths.Paths[path].Parameters...)
+	}
+	declared = append(declared, operation.Parameters...)
+
+	var params []*spec.Parameter
+	indexes := make(map[string]int)
+	for i := range declared {
+		param := &declared[i]
+		if ref := param.Ref.String(); ref != "" {
+			resolved, ok := swagger.Parameters[strings.TrimPrefix(ref, "#/parameters/")]
+			if !strings.HasPrefix(ref, "#/parameters/") || !ok {
+				return nil, fmt.Errorf("unknown parameter reference %s", ref)
+			}
+			param = &resolved
+		}
+		if index, ok := indexes[param.Name]; ok {
+			if params[index].In != param.In {
+				return nil, fmt.Errorf("parameters %s in %s and %s share a name", param.Name, params[index].In,
+					param.In)
+			}
+			params[index] = param
+			continue
+		}
+		indexes[param.Name] = len(params)
+		params = append(params, param)
+	}
+	return params, nil
+}
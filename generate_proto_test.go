@@ -0,0 +1,203 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Swagger fixture for proto generation, with definitions, inline schemas and shared parameters.
+const generatedProtoSpec = `{
+	"swagger": "2.0",
+	"info": {"title": "Items", "version": "1"},
+	"parameters": {
+		"requestId": {"name": "X-Request-Id", "in": "header", "type": "string"}
+	},
+	"definitions": {
+		"Item": {
+			"type": "object",
+			"properties": {
+				"itemId": {"type": "string"},
+				"item_count": {"type": "integer", "format": "int64"},
+				"price": {"type": "number"},
+				"tags": {"type": "array", "items": {"type": "string"}},
+				"attributes": {"type": "object", "additionalProperties": {"type": "string"}},
+				"extra": {"type": "object"},
+				"dimensions": {"type": "object", "properties": {"width": {"type": "number", "format": "float"}}},
+				"owner": {"$ref": "#/definitions/owner"}
+			}
+		},
+		"owner": {"properties": {"name": {"type": "string"}}},
+		"Items": {"type": "object"}
+	},
+	"paths": {
+		"/items/{itemId}": {
+			"parameters": [{"$ref": "#/parameters/requestId"}],
+			"get": {
+				"operationId": "getItem",
+				"tags": ["items"],
+				"parameters": [
+					{"name": "itemId", "in": "path", "required": true, "type": "string"},
+					{"name": "fields", "in": "query", "type": "array", "items": {"type": "string"}}
+				],
+				"responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/Item"}}}
+			},
+			"delete": {
+				"operationId": "deleteItem",
+				"tags": ["items"],
+				"parameters": [{"name": "itemId", "in": "path", "required": true, "type": "string"}],
+				"responses": {"204": {"description": "Deleted"}}
+			}
+		},
+		"/items": {
+			"get": {
+				"operationId": "listItems",
+				"tags": ["items"],
+				"responses": {"200": {"description": "OK", "schema": {
+					"type": "array", "items": {"$ref": "#/definitions/Item"}
+				}}}
+			},
+			"post": {
+				"operationId": "countItems",
+				"tags": ["items"],
+				"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Item"}}],
+				"responses": {"200": {"description": "OK", "schema": {"type": "integer"}}}
+			}
+		}
+	}
+}`
+
+// Returns the file generated from the fixture spec.
+func generateFixtureProto(t *testing.T) *desc.FileDescriptor {
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(generatedProtoSpec), swagger))
+	contents, err := generateProto(swagger, GroupOperationsByTag(swagger, nil), "items.v1")
+	require.Nil(t, err)
+	fileDesc, err := loadProtoFromBytes(contents)
+	require.Nil(t, err, "Generated proto doesn't load:\n%s", contents)
+	return fileDesc
+}
+
+// Tests that definitions become messages with fields for their properties.
+func TestGenerateProtoDefinitions(t *testing.T) {
+	assert := assertions.New(t)
+	fileDesc := generateFixtureProto(t)
+
+	// Items clashes with the service, so the definition is renamed.
+	assert.NotNil(fileDesc.FindMessage("items.v1.Items2"))
+	item := fileDesc.FindMessage("items.v1.Item")
+	require.NotNil(t, item)
+	fields := make(map[string]string)
+	for _, field := range item.GetFields() {
+		typeName := field.GetType().String()
+		if field.GetMessageType() != nil {
+			typeName = field.GetMessageType().GetFullyQualifiedName()
+		}
+		if field.IsMap() {
+			typeName = "map"
+		} else if field.IsRepeated() {
+			typeName = "repeated " + typeName
+		}
+		fields[field.GetJSONName()] = typeName
+	}
+	assert.Equal(map[string]string{
+		"attributes": "map",
+		"dimensions": "items.v1.Item.Dimensions",
+		"extra":      "google.protobuf.Struct",
+		"itemId":     "TYPE_STRING",
+		"item_count": "TYPE_INT64",
+		"owner":      "items.v1.Owner",
+		"price":      "TYPE_DOUBLE",
+		"tags":       "repeated TYPE_STRING",
+	}, fields)
+}
+
+// Tests that methods take requests with a field per parameter, and return their response schemas.
+func TestGenerateProtoMethods(t *testing.T) {
+	assert := assertions.New(t)
+	fileDesc := generateFixtureProto(t)
+	service := fileDesc.FindService("items.v1.Items")
+	require.NotNil(t, service)
+
+	fixtures := []struct {
+		method string
+		fields []string
+		output string
+	}{
+		{"GetItem", []string{"X_Request_Id", "itemId", "fields"}, "items.v1.Item"},
+		{"DeleteItem", []string{"X_Request_Id", "itemId"}, "google.protobuf.Empty"},
+		{"ListItems", nil, "items.v1.ListItemsResponse"},
+		{"CountItems", []string{"body"}, "items.v1.CountItemsResponse"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.method, func(t *testing.T) {
+			method := service.FindMethodByName(fixture.method)
+			require.NotNil(t, method)
+			var fields []string
+			for _, field := range method.GetInputType().GetFields() {
+				fields = append(fields, field.GetName())
+			}
+			assertions.Equal(t, fixture.fields, fields)
+			assertions.Equal(t, fixture.output, method.GetOutputType().GetFullyQualifiedName())
+		})
+	}
+
+	list := fileDesc.FindMessage("items.v1.ListItemsResponse")
+	require.Len(t, list.GetFields(), 1)
+	assert.Equal("items", list.GetFields()[0].GetName())
+	assert.True(list.GetFields()[0].IsRepeated())
+	count := fileDesc.FindMessage("items.v1.CountItemsResponse")
+	require.Len(t, count.GetFields(), 1)
+	assert.Equal("value", count.GetFields()[0].GetName())
+	header := fileDesc.FindMessage("items.v1.GetItemRequest").FindFieldByName("X_Request_Id")
+	assert.Equal("X-Request-Id", header.GetJSONName())
+}
+
+// Tests that unresolvable schemas are rejected.
+func TestGenerateProtoErrors(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		schema spec.Schema
+	}{
+		{"remote reference", *spec.RefProperty("other.json#/definitions/Thing")},
+		{"unknown definition", *spec.RefProperty("#/definitions/Missing")},
+		{"unknown type", *new(spec.Schema).Typed("null", "")},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			swagger := &spec.Swagger{SwaggerProps: spec.SwaggerProps{Definitions: spec.Definitions{
+				"Thing": *new(spec.Schema).SetProperty("value", fixture.schema),
+			}}}
+			_, err := generateProto(swagger, nil, "things")
+			assertions.Error(t, err)
+		})
+	}
+}
+
+// Tests naming fields after spec names.
+func TestGeneratedFieldName(t *testing.T) {
+	assert := assertions.New(t)
+	assert.Equal("itemId", fieldName("itemId"))
+	assert.Equal("X_Request_Id", fieldName("X-Request-Id"))
+	assert.Equal("filter_start", fieldName("filter.start"))
+	assert.Equal("field_3d", fieldName("3d"))
+	assert.Equal("field_", fieldName(""))
+}
@@ -0,0 +1,271 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Generation of the swagger spec effectively served by a set of adapters.
+//
+// Each operation is as it was loaded, with the effective settings of programmatic overrides written
+// to swaggrpc's extensions, so that the spec round-trips to adapters behaving the same way. Settings
+// which can only be configured in options, like static headers and hedging, are written to
+// extensions too, for reference; these aren't read from specs.
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// Names of the operation extensions describing settings configured only in options.
+const (
+	hostHeaderExtension  = "x-swaggrpc-host-header"
+	headersExtension     = "x-swaggrpc-headers"
+	queryParamsExtension = "x-swaggrpc-query-params"
+	hedgingExtension     = "x-swaggrpc-hedging"
+	spillExtension       = "x-swaggrpc-spill"
+)
+
+// HedgingOptions, as written to a generated spec.
+type hedgingDescription struct {
+	Delay jsonDuration `json:"delay"`
+	Hosts []string     `json:"hosts"`
+}
+
+// SpillOptions, as written to a generated spec.
+type spillDescription struct {
+	Threshold int    `json:"threshold"`
+	Dir       string `json:"dir,omitempty"`
+}
+
+// Spec returns the swagger spec effectively served by the registry's operations. Operations which
+// are built lazily are built first; those which fail to build are left out. Document-level fields,
+// like definitions, are those of the spec the operations were loaded from by NewProxyFromSwagger,
+// if they were.
+func (r *OperationRegistry) Spec() *spec.Swagger {
+	operations, source := r.currentWithSource()
+	methods := make([]string, 0, len(operations))
+	for method := range operations {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	adapters := make([]*operationAdapter, 0, len(methods))
+	for _, method := range methods {
+		switch handler := operations[method].handler.(type) {
+		case *operationAdapter:
+			adapters = append(adapters, handler)
+		case *lazyAdapter:
+			if adapter, err := handler.get(); err == nil {
+				adapters = append(adapters, adapter)
+			}
+		}
+	}
+	return generateSpec(adapters, source)
+}
+
+// Returns the swagger spec served by the given adapters, with the document-level fields of source,
+// if it isn't nil. The host and base path are those of the first adapter's swagger client.
+func generateSpec(adapters []*operationAdapter, source *spec.Swagger) *spec.Swagger {
+	generated := &spec.Swagger{SwaggerProps: spec.SwaggerProps{Swagger: "2.0"}}
+	if source != nil {
+		generated.Info = source.Info
+		generated.Schemes = source.Schemes
+		generated.Consumes = source.Consumes
+		generated.Produces = source.Produces
+		generated.Definitions = source.Definitions
+		generated.Parameters = source.Parameters
+		generated.Responses = source.Responses
+		generated.SecurityDefinitions = source.SecurityDefinitions
+		generated.Security = source.Security
+		generated.Tags = source.Tags
+		generated.ExternalDocs = source.ExternalDocs
+	}
+	if len(adapters) > 0 {
+		generated.Host = adapters[0].swaggerClient.Host
+		generated.BasePath = adapters[0].swaggerClient.BasePath
+	}
+	paths := make(map[string]spec.PathItem)
+	for _, adapter := range adapters {
+		pathItem := paths[adapter.swaggerPath]
+		operation := adapter.effectiveOperation()
+		switch strings.ToUpper(adapter.httpMethod) {
+		case "GET":
+			pathItem.Get = operation
+		case "PUT":
+			pathItem.Put = operation
+		case "POST":
+			pathItem.Post = operation
+		case "DELETE":
+			pathItem.Delete = operation
+		case "OPTIONS":
+			pathItem.Options = operation
+		case "HEAD":
+			pathItem.Head = operation
+		case "PATCH":
+			pathItem.Patch = operation
+		}
+		paths[adapter.swaggerPath] = pathItem
+	}
+	generated.Paths = &spec.Paths{Paths: paths}
+	return generated
+}
+
+// Returns this adapter's operation, with its parameters and effective settings.
+func (p *operationAdapter) effectiveOperation() *spec.Operation {
+	operation := &spec.Operation{
+		OperationProps: p.operation.OperationProps,
+		VendorExtensible: spec.VendorExtensible{
+			Extensions: make(spec.Extensions, len(p.operation.Extensions)),
+		},
+	}
+	for key, value := range p.operation.Extensions {
+		operation.Extensions[key] = value
+	}
+
+	// Parameters are sorted by name, for a stable document.
+	names := make([]string, 0, len(p.parameters))
+	for name := range p.parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	operation.Parameters = make([]spec.Parameter, 0, len(names))
+	// Resolved formats, as extension values keyed by extension, keyed by parameter.
+	formats := make(map[string]map[string]string)
+	for _, step := range p.params.steps {
+		extensions := make(map[string]string)
+		if step.messageFormat != "" {
+			extensions[messageFormatExtension] = string(step.messageFormat)
+		}
+		if step.durationFormat != "" {
+			extensions[durationFormatExtension] = string(step.durationFormat)
+		}
+		if len(extensions) > 0 {
+			formats[step.name] = extensions
+		}
+	}
+	for _, name := range names {
+		param := *p.parameters[name]
+		if extensions, ok := formats[name]; ok {
+			param.Extensions = make(spec.Extensions, len(param.Extensions)+len(extensions))
+			for key, value := range p.parameters[name].Extensions {
+				if _, ok := extensions[strings.ToLower(key)]; !ok {
+					param.Extensions[key] = value
+				}
+			}
+			for key, value := range extensions {
+				param.AddExtension(key, value)
+			}
+		}
+		operation.Parameters = append(operation.Parameters, param)
+	}
+
+	setExtension(operation, resilienceExtension, p.resilience.options)
+	if p.requestTransform != nil {
+		setExtension(operation, requestTransformExtension, p.requestTransform.source)
+	}
+	if p.responseTransform != nil {
+		setExtension(operation, responseTransformExtension, p.responseTransform.source)
+	}
+	if p.costClass != "" {
+		setExtension(operation, costClassExtension, p.costClass)
+	}
+	if p.deprecation != nil {
+		operation.Deprecated = true
+		if !p.deprecation.sunset.IsZero() {
+			setExtension(operation, sunsetExtension, p.deprecation.sunset.UTC().Format(time.RFC3339))
+		}
+	}
+	if len(p.listFields) > 0 {
+		listParams := &ListParams{}
+		for param, field := range p.listFields {
+			switch field {
+			case "page_size":
+				listParams.PageSize = param
+			case "page_token":
+				listParams.PageToken = param
+			case "order_by":
+				listParams.OrderBy = param
+			case "filter":
+				listParams.Filter = param
+			}
+		}
+		setExtension(operation, listParamsExtension, listParams)
+	}
+	if len(p.paramFields) > 0 {
+		setExtension(operation, paramFieldsExtension, p.paramFields)
+	}
+	if len(p.requestHeaders) > 0 {
+		setExtension(operation, requestHeadersExtension, headerFieldNames(p.requestHeaders))
+	}
+	if len(p.responseHeaders) > 0 {
+		setExtension(operation, responseHeadersExtension, headerFieldNames(p.responseHeaders))
+	}
+	if p.envelope != nil {
+		setExtension(operation, envelopeExtension, p.envelope.options)
+	}
+	if p.pageStream != nil {
+		setExtension(operation, pageStreamExtension, p.pageStream.options)
+	}
+	if p.schemes != nil {
+		operation.Schemes = p.schemes
+	}
+	p.setOptionExtensions(operation)
+	return operation
+}
+
+// Sets the extensions describing this adapter's settings configured only in options.
+func (p *operationAdapter) setOptionExtensions(operation *spec.Operation) {
+	if p.hostHeader != "" {
+		setExtension(operation, hostHeaderExtension, p.hostHeader)
+	}
+	if len(p.staticHeaders) > 0 {
+		setExtension(operation, headersExtension, p.staticHeaders)
+	}
+	if len(p.queryParams) > 0 {
+		templates := make(map[string]string, len(p.queryParams))
+		for i := range p.queryParams {
+			templates[p.queryParams[i].name] = p.queryParams[i].template()
+		}
+		setExtension(operation, queryParamsExtension, templates)
+	}
+	if p.hedging != nil {
+		setExtension(operation, hedgingExtension, &hedgingDescription{
+			Delay: jsonDuration(p.hedging.Delay),
+			Hosts: p.hedging.Hosts,
+		})
+	}
+	if p.spill != nil {
+		setExtension(operation, spillExtension, &spillDescription{Threshold: p.spill.Threshold, Dir: p.spill.Dir})
+	}
+}
+
+// Sets an extension on an operation, replacing any with the same name in a different case.
+func setExtension(operation *spec.Operation, name string, value interface{}) {
+	for key := range operation.Extensions {
+		if strings.EqualFold(key, name) {
+			delete(operation.Extensions, key)
+		}
+	}
+	operation.Extensions.Add(name, value)
+}
+
+// Returns the field names of header mappings, keyed by header.
+func headerFieldNames(fields []headerField) map[string]string {
+	names := make(map[string]string, len(fields))
+	for _, mapped := range fields {
+		names[mapped.header] = mapped.field.GetName()
+	}
+	return names
+}
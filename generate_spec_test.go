@@ -0,0 +1,111 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that the generated spec round-trips to an adapter with the same effective settings.
+func TestGenerateSpecRoundTrip(t *testing.T) {
+	assert := assertions.New(t)
+	operation := parseTestOperation(t, `{
+		"operationId": "getItem",
+		"tags": ["items"],
+		"x-swaggrpc-cost-class": "cheap",
+		"x-swaggrpc-resilience": {"maxConcurrency": 5}
+	}`)
+	options := &ServiceOptions{
+		Resilience: &ResilienceOptions{CircuitBreaker: &CircuitBreakerPolicy{FailureThreshold: 3, OpenDuration: time.Second}},
+		Operations: map[string]*OperationOptions{"getItem": {
+			Resilience: &ResilienceOptions{Retry: &RetryPolicy{MaxAttempts: 2, InitialBackoff: 50 * time.Millisecond}},
+			CostClass:  "expensive",
+		}},
+	}
+	adapter, closeServer := testOperation{operation: operation, options: options}.adapter(t)
+	defer closeServer()
+
+	generated, err := json.Marshal(generateSpec([]*operationAdapter{adapter}, nil))
+	require.Nil(t, err, "Error encoding spec: %v", err)
+	var parsed spec.Swagger
+	require.Nil(t, json.Unmarshal(generated, &parsed), "Error decoding spec")
+
+	pathItem, ok := parsed.Paths.Paths["/items/{itemId}"]
+	require.True(t, ok, "Path missing from %s", generated)
+	require.NotNil(t, pathItem.Get, "GET operation missing")
+	assert.Equal("getItem", pathItem.Get.ID)
+	assert.Equal([]string{"items"}, pathItem.Get.Tags)
+	assert.Len(pathItem.Get.Parameters, len(testServiceParams))
+
+	roundTripped, closeRoundTripped := testOperation{operation: pathItem.Get}.adapter(t)
+	defer closeRoundTripped()
+	assert.Equal(adapter.resilience.options, roundTripped.resilience.options, "Resilience settings changed")
+	assert.Equal("expensive", roundTripped.costClass)
+}
+
+// Tests that a registry's spec has the document's fields, and the settings of options.
+func TestRegistrySpec(t *testing.T) {
+	assert := assertions.New(t)
+	registry, err := NewProxyFromSwagger([]byte(generatedProtoSpec), &ProxyOptions{
+		SpecURL: "https://items.example.com/api/swagger.json",
+		Service: &ServiceOptions{
+			HostHeader: "items.internal",
+			Hedging:    &HedgingOptions{Delay: 50 * time.Millisecond, Hosts: []string{"items-b.internal"}},
+			Spill:      &SpillOptions{Threshold: 1024},
+			Operations: map[string]*OperationOptions{"getItem": {
+				Headers:     map[string]string{"X-Api-Version": "2"},
+				QueryParams: map[string]string{"tenant": "t-{metadata:x-tenant}"},
+				Envelope:    &EnvelopeOptions{Payload: "/data"},
+			}},
+		},
+	})
+	require.Nil(t, err)
+	generated, err := json.Marshal(registry.Spec())
+	require.Nil(t, err)
+	var parsed spec.Swagger
+	require.Nil(t, json.Unmarshal(generated, &parsed), "Error decoding spec")
+
+	assert.Equal("items.example.com", parsed.Host)
+	assert.Equal("/", parsed.BasePath)
+	assert.Equal("Items", parsed.Info.Title)
+	assert.Contains(parsed.Definitions, "Item")
+	assert.Contains(parsed.Parameters, "requestId")
+	require.Contains(t, parsed.Paths.Paths, "/items/{itemId}")
+	getItem := parsed.Paths.Paths["/items/{itemId}"].Get
+	require.NotNil(t, getItem)
+	extensions := getItem.Extensions
+	assert.Equal("items.internal", extensions[hostHeaderExtension])
+	assert.Equal(map[string]interface{}{"X-Api-Version": "2"}, extensions[headersExtension])
+	assert.Equal(map[string]interface{}{"tenant": "t-{metadata:x-tenant}"}, extensions[queryParamsExtension])
+	assert.Equal(map[string]interface{}{"delay": "50ms", "hosts": []interface{}{"items-b.internal"}},
+		extensions[hedgingExtension])
+	assert.Equal(map[string]interface{}{"threshold": float64(1024)}, extensions[spillExtension])
+
+	roundTripped, closeRoundTripped := testOperation{operation: getItem}.adapter(t)
+	defer closeRoundTripped()
+	require.NotNil(t, roundTripped.envelope, "Envelope not round-tripped")
+	assert.Equal("/data", roundTripped.envelope.options.Payload)
+
+	// Hedging applies only to reads.
+	deleteItem := parsed.Paths.Paths["/items/{itemId}"].Delete
+	require.NotNil(t, deleteItem)
+	assert.NotContains(deleteItem.Extensions, hedgingExtension)
+}
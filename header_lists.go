@@ -0,0 +1,86 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Serialization of repeated fields sent as headers.
+//
+// RFC 7230 allows a list-valued header to be sent as several header lines, or as one line of
+// comma-separated values; recipients must treat the two the same. Backends don't always, so the
+// form is configurable. When joined, values which contain commas or quotes, or which are empty or
+// padded with whitespace, are sent as quoted strings, so that they split back into the same values.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderListFormat is how a repeated field is sent as a header.
+type HeaderListFormat string
+
+const (
+	// A header line per value. This is the default.
+	HeaderListRepeated HeaderListFormat = "repeated"
+	// A single header line, with values separated by commas.
+	HeaderListJoined HeaderListFormat = "joined"
+)
+
+// Sets how each of the plan's repeated header steps is sent: from the operation's formats, else the
+// service's, else as repeated lines. Returns an error if a format is unknown.
+func (plan *paramPlan) applyHeaderListFormats(options *ServiceOptions, operationOptions *OperationOptions) error {
+	formats := make(map[string]HeaderListFormat, len(operationOptions.HeaderListFormats))
+	for header, format := range operationOptions.HeaderListFormats {
+		formats[http.CanonicalHeaderKey(header)] = format
+	}
+	for i := range plan.steps {
+		step := &plan.steps[i]
+		if step.location != paramInHeader || !step.repeated {
+			continue
+		}
+		format, ok := formats[http.CanonicalHeaderKey(step.name)]
+		if !ok {
+			format = options.HeaderListFormat
+		}
+		switch format {
+		case "", HeaderListRepeated:
+		case HeaderListJoined:
+			step.joinHeader = true
+		default:
+			return fmt.Errorf("unknown header list format %q for header %s", format, step.name)
+		}
+	}
+	return nil
+}
+
+// Returns values joined into a single header value, quoting those which need it.
+func joinHeaderValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quoteHeaderValue(value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Escapes the characters of a quoted-string which need it.
+var headerQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Returns a list element of a header value, as an RFC 7230 quoted-string if it is empty, padded
+// with whitespace, or contains commas, quotes or backslashes.
+func quoteHeaderValue(value string) string {
+	if value != "" && value == strings.TrimSpace(value) && !strings.ContainsAny(value, `,"\`) {
+		return value
+	}
+	return `"` + headerQuoteEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests quoting of list elements in joined header values.
+func TestQuoteHeaderValue(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"Plain", "gzip", "gzip"},
+		{"InnerSpace", "a b", "a b"},
+		{"Empty", "", `""`},
+		{"Padded", " a ", `" a "`},
+		{"Comma", "a,b", `"a,b"`},
+		{"Quote", `say "hi"`, `"say \"hi\""`},
+		{"Backslash", `a\b`, `"a\\b"`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assertions.Equal(t, fixture.expected, quoteHeaderValue(fixture.value))
+		})
+	}
+}
+
+// Tests that repeated header fields are sent as configured.
+func TestHeaderListFormats(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(messageParamsProto))
+	require.Nil(t, err)
+	pointType := fileDesc.FindMessage("message_params_test.Point")
+	point := messageFromJSON(t, pointType, `{"tags": ["a", "b,c", "say \"hi\""]}`)
+	fixtures := []struct {
+		name      string
+		options   *ServiceOptions
+		operation *OperationOptions
+		expected  []string
+		badFormat bool
+	}{
+		{"Default", &ServiceOptions{}, &OperationOptions{}, []string{"a", "b,c", `say "hi"`}, false},
+		{"Service", &ServiceOptions{HeaderListFormat: HeaderListJoined}, &OperationOptions{},
+			[]string{`a, "b,c", "say \"hi\""`}, false},
+		{"Operation", &ServiceOptions{HeaderListFormat: HeaderListJoined},
+			&OperationOptions{HeaderListFormats: map[string]HeaderListFormat{"x-tags": HeaderListRepeated}},
+			[]string{"a", "b,c", `say "hi"`}, false},
+		{"Unknown", &ServiceOptions{HeaderListFormat: "folded"}, &OperationOptions{}, nil, true},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			field := pointType.FindFieldByName("tags")
+			toString, err := getStringConverter(field, &spec.Parameter{})
+			require.Nil(t, err)
+			plan := paramPlan{}
+			plan.add(paramStep{name: "X-Tags", location: paramInHeader, field: field, repeated: true, toString: toString})
+			err = plan.applyHeaderListFormats(fixture.options, fixture.operation)
+			if fixture.badFormat {
+				assertions.NotNil(t, err, "Expected error for unknown format")
+				return
+			}
+			require.Nil(t, err)
+
+			request := newFakeClientRequest()
+			require.Nil(t, plan.write(point, request))
+			assertions.Equal(t, fixture.expected, request.headers["X-Tags"])
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Hedged backend requests, for latency-sensitive reads.
+//
+// A request which hasn't been answered within a delay is sent again to another backend host, and
+// whichever response arrives first is used; the other request is cancelled. Only requests of safe
+// HTTP methods without bodies are hedged, since the backend may see both. A request which fails
+// without a response waits for the other, so hedging also masks a host being unreachable. Each
+// attempt of a retried request is hedged separately.
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// HedgingOptions configures hedged backend requests.
+type HedgingOptions struct {
+	// How long to wait for a response before sending the hedged request. Zero sends both at once.
+	Delay time.Duration
+	// Hosts hedged requests are sent to in turn, as host or host:port, like "items-b.internal:8080".
+	// The scheme and path are those of the original request. Empty disables hedging.
+	Hosts []string
+}
+
+// HTTP methods whose requests may be hedged, since they only read.
+var hedgeableMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true}
+
+// Returns the hedging settings for an operation: the operation's, or else the service's. Returns nil
+// if hedging is disabled, or the operation's HTTP method isn't safe to hedge.
+func resolveHedging(httpMethod string, options *ServiceOptions, operationOptions *OperationOptions) *HedgingOptions {
+	hedging := options.Hedging
+	if operationOptions.Hedging != nil {
+		hedging = operationOptions.Hedging
+	}
+	if hedging == nil || len(hedging.Hosts) == 0 || !hedgeableMethods[httpMethod] {
+		return nil
+	}
+	return hedging
+}
+
+// A transport hedging requests to other hosts.
+type hedgingTransport struct {
+	transport http.RoundTripper
+	options   *HedgingOptions
+	// The number of requests hedged, for choosing hosts in turn. Accessed atomically.
+	hedged uint32
+}
+
+// The outcome of one of a hedged request's attempts.
+type hedgedAttempt struct {
+	// The attempt's index in the request's attempts.
+	index    int
+	response *http.Response
+	err      error
+}
+
+func (t *hedgingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil && request.Body != http.NoBody {
+		return t.transport.RoundTrip(request)
+	}
+	// Buffered, so that attempts finishing after the result is chosen don't block.
+	attempts := make(chan *hedgedAttempt, 2)
+	cancels := []context.CancelFunc{t.send(0, request, attempts)}
+
+	timer := time.NewTimer(t.options.Delay)
+	defer timer.Stop()
+	select {
+	case attempt := <-attempts:
+		return attempt.result(cancels[0])
+	case <-timer.C:
+	case <-request.Context().Done():
+		// The attempt fails with the context's error.
+		return (<-attempts).result(cancels[0])
+	}
+	cancels = append(cancels, t.send(1, t.hedgedRequest(request), attempts))
+
+	for pending := len(cancels); ; {
+		attempt := <-attempts
+		pending--
+		if attempt.err != nil && pending > 0 {
+			cancels[attempt.index]()
+			continue
+		}
+		for i, cancel := range cancels {
+			if i != attempt.index {
+				cancel()
+			}
+		}
+		go discardAttempts(attempts, pending)
+		return attempt.result(cancels[attempt.index])
+	}
+}
+
+// Sends a request in the background, returning a function cancelling it.
+func (t *hedgingTransport) send(index int, request *http.Request, attempts chan<- *hedgedAttempt) context.CancelFunc {
+	ctx, cancel := context.WithCancel(request.Context())
+	go func() {
+		response, err := t.transport.RoundTrip(request.WithContext(ctx))
+		attempts <- &hedgedAttempt{index: index, response: response, err: err}
+	}()
+	return cancel
+}
+
+// Returns a copy of a request sent to the next host.
+func (t *hedgingTransport) hedgedRequest(request *http.Request) *http.Request {
+	index := atomic.AddUint32(&t.hedged, 1) - 1
+	host := t.options.Hosts[int(index%uint32(len(t.options.Hosts)))]
+	hedged := request.WithContext(request.Context())
+	hedgedURL := *request.URL
+	hedgedURL.Host = host
+	hedged.URL = &hedgedURL
+	// A Host header naming the original host follows the request; an overridden one is kept.
+	if request.Host == request.URL.Host {
+		hedged.Host = host
+	}
+	return hedged
+}
+
+// Returns an attempt's response, whose body cancels the attempt once it's closed.
+func (a *hedgedAttempt) result(cancel context.CancelFunc) (*http.Response, error) {
+	if a.err != nil {
+		cancel()
+		return nil, a.err
+	}
+	a.response.Body = &cancelOnClose{ReadCloser: a.response.Body, cancel: cancel}
+	return a.response, nil
+}
+
+// Waits for the given number of cancelled attempts, closing any responses they got.
+func discardAttempts(attempts <-chan *hedgedAttempt, pending int) {
+	for ; pending > 0; pending-- {
+		if attempt := <-attempts; attempt.response != nil {
+			attempt.response.Body.Close()
+		}
+	}
+}
+
+// A response body which cancels its request when closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// Returns a copy of an HTTP client hedging requests as configured.
+func withHedging(client *http.Client, options *HedgingOptions) *http.Client {
+	return wrapClientTransport(client, func(transport http.RoundTripper) http.RoundTripper {
+		return &hedgingTransport{transport: transport, options: options}
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that slow requests are hedged to another host, cancelling the slower request.
+func TestHedgedRequests(t *testing.T) {
+	fixtures := []struct {
+		name string
+		// How long the original host takes to respond.
+		primaryDelay time.Duration
+		// The name the caller receives.
+		itemName string
+		// True if the hedged host is sent a request.
+		hedged bool
+	}{
+		{"fast original", 0, "primary", false},
+		{"slow original", time.Second, "hedged", true},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			hedgedHost := ""
+			hedgedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hedgedHost = r.Host
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "hedged"}`))
+			}))
+			defer hedgedServer.Close()
+			hedgedURL, err := url.Parse(hedgedServer.URL)
+			require.Nil(t, err)
+
+			cancelled := make(chan bool, 1)
+			options := &ServiceOptions{Hedging: &HedgingOptions{
+				Delay: 50 * time.Millisecond,
+				Hosts: []string{hedgedURL.Host},
+			}}
+			adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(fixture.primaryDelay):
+				case <-r.Context().Done():
+					cancelled <- true
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "primary"}`))
+			})
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			require.Len(t, stream.sent, 1)
+			assert.Equal(fixture.itemName, stream.sent[0].GetFieldByName("name"))
+			if !fixture.hedged {
+				assert.Empty(hedgedHost, "Fast request hedged")
+				return
+			}
+			assert.Equal(hedgedURL.Host, hedgedHost)
+			select {
+			case <-cancelled:
+			case <-time.After(time.Second):
+				t.Error("Slower request not cancelled")
+			}
+		})
+	}
+}
+
+// Tests that only requests of safe HTTP methods are hedged, with operation settings overriding the
+// service's.
+func TestResolveHedging(t *testing.T) {
+	assert := assertions.New(t)
+	hedging := &HedgingOptions{Delay: time.Millisecond, Hosts: []string{"items-b.internal"}}
+	options := &ServiceOptions{Hedging: hedging}
+	assert.Equal(hedging, resolveHedging("GET", options, &OperationOptions{}))
+	assert.Nil(resolveHedging("POST", options, &OperationOptions{}))
+	assert.Nil(resolveHedging("DELETE", options, &OperationOptions{}))
+	assert.Nil(resolveHedging("GET", options, &OperationOptions{Hedging: &HedgingOptions{}}))
+	assert.Nil(resolveHedging("GET", &ServiceOptions{}, &OperationOptions{}))
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Overriding the Host header of backend requests.
+//
+// Backends behind shared ingress are reached at one address and routed by virtual host, so the Host
+// header must name the backend rather than the address connected to. The Host header is set on each
+// request as it's sent; the TLS server name is still the connection's host, unless the HTTP
+// client's transport configures one.
+
+import (
+	"net/http"
+)
+
+// Returns the Host header an operation's backend requests are sent with: the operation's, or else
+// the service's. Empty means the host connected to.
+func resolveHostHeader(options *ServiceOptions, operationOptions *OperationOptions) string {
+	if operationOptions.HostHeader != "" {
+		return operationOptions.HostHeader
+	}
+	return options.HostHeader
+}
+
+// A transport sending requests with a fixed Host header.
+type hostHeaderTransport struct {
+	transport http.RoundTripper
+	host      string
+}
+
+func (t *hostHeaderTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// Round trippers mustn't modify their requests, so the Host is set on a copy.
+	withHost := request.WithContext(request.Context())
+	withHost.Host = t.host
+	return t.transport.RoundTrip(withHost)
+}
+
+// Returns a copy of an HTTP client sending requests with the given Host header.
+func withHostHeader(client *http.Client, host string) *http.Client {
+	return wrapClientTransport(client, func(transport http.RoundTripper) http.RoundTripper {
+		return &hostHeaderTransport{transport: transport, host: host}
+	})
+}
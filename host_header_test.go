@@ -0,0 +1,58 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that backend requests are sent with the configured Host header.
+func TestHostHeader(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		options  *ServiceOptions
+		expected string
+	}{
+		{"default", &ServiceOptions{}, ""},
+		{"service", &ServiceOptions{HostHeader: "items.internal"}, "items.internal"},
+		{"operation", &ServiceOptions{HostHeader: "items.internal", Operations: map[string]*OperationOptions{
+			"getItem": {HostHeader: "items-v2.internal"},
+		}}, "items-v2.internal"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			var host, address string
+			adapter, closeServer := newTestAdapter(t, fixture.options, func(w http.ResponseWriter, r *http.Request) {
+				host = r.Host
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "thing"}`))
+			})
+			defer closeServer()
+			address = adapter.swaggerClient.Host
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			if fixture.expected == "" {
+				assertions.Equal(t, address, host)
+			} else {
+				assertions.Equal(t, fixture.expected, host)
+			}
+		})
+	}
+}
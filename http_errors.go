@@ -0,0 +1,137 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Backend error responses, returned to callers as gRPC errors.
+//
+// Error statuses map to the gRPC code with the same meaning, following the mapping in
+// google/rpc/code.proto. The response body is attached as a google.api.HttpBody detail, so callers
+// can read the backend's error payload.
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime"
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The most of an error response body attached to an error. Details are sent in trailers, which
+// callers may limit in size.
+const maxErrorBodyBytes = 8 << 10
+
+// Media types of error bodies which swagger clients have no consumer for by default. Without one,
+// the client rejects the response before its status can be mapped.
+var errorMediaTypes = []string{"application/problem+json", "application/problem+xml", "text/html"}
+
+// gRPC codes for HTTP error statuses.
+var httpStatusCodes = map[int]codes.Code{
+	http.StatusBadRequest:                   codes.InvalidArgument,
+	http.StatusUnauthorized:                 codes.Unauthenticated,
+	http.StatusForbidden:                    codes.PermissionDenied,
+	http.StatusNotFound:                     codes.NotFound,
+	http.StatusMethodNotAllowed:             codes.Unimplemented,
+	http.StatusRequestTimeout:               codes.DeadlineExceeded,
+	http.StatusConflict:                     codes.Aborted,
+	http.StatusGone:                         codes.NotFound,
+	http.StatusPreconditionFailed:           codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge:        codes.ResourceExhausted,
+	http.StatusRequestedRangeNotSatisfiable: codes.OutOfRange,
+	http.StatusTooManyRequests:              codes.ResourceExhausted,
+	// Non-standard, but widely used for requests the client cancelled.
+	499:                            codes.Canceled,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// Returns the gRPC code for an HTTP error status. Statuses in overrides take precedence over the
+// built-in mapping. Other client errors are InvalidArgument, and other statuses are Internal.
+func codeForHTTPStatus(httpStatus int, overrides map[int]codes.Code) codes.Code {
+	if code, ok := overrides[httpStatus]; ok {
+		return code
+	}
+	if code, ok := httpStatusCodes[httpStatus]; ok {
+		return code
+	}
+	if httpStatus >= 400 && httpStatus < 500 {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+// Returns true for backend responses which should be returned as errors: any status of 400 or more.
+func isErrorResponse(response runtime.ClientResponse) bool {
+	return response.Code() >= http.StatusBadRequest
+}
+
+// Returns the gRPC error for a backend error response, with the response body attached.
+func (p *operationAdapter) responseError(response runtime.ClientResponse) error {
+	httpStatus := response.Code()
+	backendError := status.New(codeForHTTPStatus(httpStatus, p.options.StatusCodes),
+		fmt.Sprintf("backend returned HTTP %d %s for %s", httpStatus, http.StatusText(httpStatus),
+			p.operation.ID))
+	body, err := p.readResponseBody(response.Body(), response.GetHeader("Content-Encoding"))
+	if err != nil || len(body) == 0 {
+		return backendError.Err()
+	}
+	if len(body) > maxErrorBodyBytes {
+		body = body[:maxErrorBodyBytes]
+	}
+	withDetails, err := backendError.WithDetails(&httpbody.HttpBody{
+		ContentType: response.GetHeader("Content-Type"),
+		Data:        body,
+	})
+	if err != nil {
+		return backendError.Err()
+	}
+	return withDetails.Err()
+}
+
+// Returns a swagger client accepting responses of errorMediaTypes, copying the client if it doesn't
+// already. The copy shares the original's HTTP client.
+func withErrorConsumers(swaggerClient *runtimeclient.Runtime) *runtimeclient.Runtime {
+	// Error bodies are read by responseError, never by these consumers.
+	return withByteStreamConsumers(swaggerClient, errorMediaTypes)
+}
+
+// Returns a swagger client accepting responses of the given media types, for those it has no
+// consumer for. Returns the client itself if it needn't be copied.
+func withByteStreamConsumers(swaggerClient *runtimeclient.Runtime, mediaTypes []string) *runtimeclient.Runtime {
+	var missing []string
+	for _, mediaType := range mediaTypes {
+		mediaType = baseMediaType(mediaType)
+		if _, ok := swaggerClient.Consumers[mediaType]; !ok {
+			missing = append(missing, mediaType)
+		}
+	}
+	if len(missing) == 0 {
+		return swaggerClient
+	}
+	copied := *swaggerClient
+	copied.Consumers = make(map[string]runtime.Consumer, len(swaggerClient.Consumers)+len(missing))
+	for mediaType, consumer := range swaggerClient.Consumers {
+		copied.Consumers[mediaType] = consumer
+	}
+	for _, mediaType := range missing {
+		copied.Consumers[mediaType] = runtime.ByteStreamConsumer()
+	}
+	return &copied
+}
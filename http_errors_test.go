@@ -0,0 +1,90 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tests that HTTP error statuses map to the expected codes.
+func TestCodeForHTTPStatus(t *testing.T) {
+	overrides := map[int]codes.Code{http.StatusNotFound: codes.FailedPrecondition}
+	fixtures := []struct {
+		httpStatus int
+		overrides  map[int]codes.Code
+		code       codes.Code
+	}{
+		{http.StatusBadRequest, nil, codes.InvalidArgument},
+		{http.StatusUnauthorized, nil, codes.Unauthenticated},
+		{http.StatusForbidden, nil, codes.PermissionDenied},
+		{http.StatusNotFound, nil, codes.NotFound},
+		{http.StatusNotFound, overrides, codes.FailedPrecondition},
+		{http.StatusConflict, nil, codes.Aborted},
+		{http.StatusTooManyRequests, nil, codes.ResourceExhausted},
+		{http.StatusTeapot, nil, codes.InvalidArgument},
+		{http.StatusInternalServerError, nil, codes.Internal},
+		{http.StatusServiceUnavailable, nil, codes.Unavailable},
+		{http.StatusGatewayTimeout, nil, codes.DeadlineExceeded},
+		{599, nil, codes.Internal},
+	}
+	for _, fixture := range fixtures {
+		assertions.Equal(t, fixture.code, codeForHTTPStatus(fixture.httpStatus, fixture.overrides),
+			"Bad code for %d", fixture.httpStatus)
+	}
+}
+
+// Tests that error responses fail calls with the mapped code and the body attached.
+func TestHandleGRPCRequestErrorResponse(t *testing.T) {
+	assert := assertions.New(t)
+	adapter, closeServer := newTestAdapter(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"title": "no such item"}`))
+	})
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	err := adapter.handleGRPCRequest(stream)
+	assert.Equal(codes.NotFound, errorCode(err))
+	assert.Empty(stream.sent)
+	backendError, _ := status.FromError(err)
+	details := backendError.Details()
+	require.Len(t, details, 1)
+	body, ok := details[0].(*httpbody.HttpBody)
+	require.True(t, ok, "Unexpected detail %T", details[0])
+	assert.Equal("application/problem+json", body.ContentType)
+	assert.JSONEq(`{"title": "no such item"}`, string(body.Data))
+}
+
+// Tests that configured codes override the built-in mapping.
+func TestHandleGRPCRequestStatusCodes(t *testing.T) {
+	options := &ServiceOptions{StatusCodes: map[int]codes.Code{http.StatusConflict: codes.AlreadyExists}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	defer closeServer()
+
+	err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assertions.Equal(t, codes.AlreadyExists, errorCode(err))
+	backendError, _ := status.FromError(err)
+	assertions.Empty(t, backendError.Details(), "Empty body attached")
+}
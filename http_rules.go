@@ -0,0 +1,192 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Binding of protos annotated with google.api.http rules, as used by grpc-gateway.
+//
+// A method's rule names the HTTP method and path template it is served at; the spec operation at
+// the same method and path is the one it proxies. Path templates match when they differ only in
+// their variable names, so the rule's "/shelves/{shelf.id}" matches the spec's
+// "/shelves/{shelfId}", and the shelfId parameter is sent from the shelf.id field. The rule's body
+// field, if any, is bound to the operation's body parameter. Other parameters are matched to fields
+// as usual; see param_fields.go.
+//
+// Only a method's primary rule is used; additional_bindings are ignored, since each method proxies
+// one operation. Variables must match a single path segment, and bodies must name a field rather
+// than "*", since the whole request can't be sent as a body parameter.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// Matches the variables of a path template, like "{id}" or "{shelf.id=*}", capturing the field path
+// and any pattern.
+var pathVariable = regexp.MustCompile(`\{([^{}=]*)(?:=([^{}]*))?\}`)
+
+// BindHTTPRules binds every method of the given proto files which has a google.api.http rule to the
+// spec operation at the rule's HTTP method and path. Methods without rules are skipped. Returns an
+// error if a rule has no matching operation, or can't be represented by one.
+func BindHTTPRules(swagger *spec.Swagger, files ...*desc.FileDescriptor) ([]BoundMethod, error) {
+	var bound []BoundMethod
+	for _, file := range files {
+		for _, service := range file.GetServices() {
+			for _, method := range service.GetMethods() {
+				rule, err := methodHTTPRule(method)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", method.GetFullyQualifiedName(), err)
+				}
+				if rule == nil {
+					continue
+				}
+				operationMethod, err := bindHTTPRule(swagger, rule)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", method.GetFullyQualifiedName(), err)
+				}
+				operationMethod.Service = service.GetName()
+				operationMethod.Method = method.GetName()
+				bound = append(bound, BoundMethod{OperationMethod: *operationMethod, Descriptor: method})
+			}
+		}
+	}
+	return bound, nil
+}
+
+// Returns a method's google.api.http rule, or nil if it has none.
+func methodHTTPRule(method *desc.MethodDescriptor) (*annotations.HttpRule, error) {
+	options := method.GetMethodOptions()
+	if options == nil || !proto.HasExtension(options, annotations.E_Http) {
+		return nil, nil
+	}
+	extension, err := proto.GetExtension(options, annotations.E_Http)
+	if err != nil {
+		return nil, fmt.Errorf("bad google.api.http option: %s", err)
+	}
+	return extension.(*annotations.HttpRule), nil
+}
+
+// Returns the operation a rule binds to, with its path and body parameters mapped to the rule's
+// fields.
+func bindHTTPRule(swagger *spec.Swagger, rule *annotations.HttpRule) (*OperationMethod, error) {
+	httpMethod, template := httpRulePattern(rule)
+	if template == "" {
+		return nil, fmt.Errorf("google.api.http rule has no path")
+	}
+	ruleShape, fields, err := httpRuleShape(template)
+	if err != nil {
+		return nil, err
+	}
+	var operationMethod *OperationMethod
+	var pathItem spec.PathItem
+	var params []string
+	if swagger.Paths != nil {
+		for path, item := range swagger.Paths.Paths {
+			shape, names := templateShape(path)
+			if shape != ruleShape {
+				continue
+			}
+			item := item
+			if operation := pathItemOperation(&item, httpMethod); operation != nil {
+				operationMethod = &OperationMethod{HTTPMethod: httpMethod, Path: path, Operation: operation}
+				pathItem, params = item, names
+				break
+			}
+		}
+	}
+	if operationMethod == nil {
+		return nil, fmt.Errorf("no operation matches %s %s", httpMethod, template)
+	}
+
+	mapping := make(map[string]string, len(fields)+1)
+	for i, param := range params {
+		mapping[param] = fields[i]
+	}
+	switch body := rule.GetBody(); body {
+	case "":
+	case "*":
+		return nil, fmt.Errorf("google.api.http body \"*\" isn't supported; name a field instead")
+	default:
+		param := bodyParamName(operationMethod.Operation, &pathItem)
+		if param == "" {
+			return nil, fmt.Errorf("body %s has no body parameter in %s %s", body, httpMethod,
+				operationMethod.Path)
+		}
+		mapping[param] = body
+	}
+	if operationMethod.Operation, err = withParamFields(operationMethod.Operation, mapping); err != nil {
+		return nil, err
+	}
+	return operationMethod, nil
+}
+
+// Returns the HTTP method and path template of a rule's pattern.
+func httpRulePattern(rule *annotations.HttpRule) (string, string) {
+	switch {
+	case rule.GetGet() != "":
+		return "GET", rule.GetGet()
+	case rule.GetPut() != "":
+		return "PUT", rule.GetPut()
+	case rule.GetPost() != "":
+		return "POST", rule.GetPost()
+	case rule.GetDelete() != "":
+		return "DELETE", rule.GetDelete()
+	case rule.GetPatch() != "":
+		return "PATCH", rule.GetPatch()
+	case rule.GetCustom() != nil:
+		return strings.ToUpper(rule.GetCustom().GetKind()), rule.GetCustom().GetPath()
+	}
+	return "", ""
+}
+
+// Returns a rule's path template with its variables' names removed, and their field paths in order.
+// Returns an error if a variable matches more than one segment.
+func httpRuleShape(template string) (string, []string, error) {
+	var fields []string
+	for _, match := range pathVariable.FindAllStringSubmatch(template, -1) {
+		if match[2] != "" && match[2] != "*" {
+			return "", nil, fmt.Errorf("path variable %s matches %q; only single segments are supported",
+				match[1], match[2])
+		}
+		fields = append(fields, match[1])
+	}
+	return pathVariable.ReplaceAllString(template, "{}"), fields, nil
+}
+
+// Returns a swagger path template with its parameters' names removed, and their names in order.
+func templateShape(template string) (string, []string) {
+	var names []string
+	for _, match := range pathVariable.FindAllStringSubmatch(template, -1) {
+		names = append(names, match[1])
+	}
+	return pathVariable.ReplaceAllString(template, "{}"), names
+}
+
+// Returns the name of an operation's body parameter, or empty if it has none.
+func bodyParamName(operation *spec.Operation, pathItem *spec.PathItem) string {
+	for _, params := range [][]spec.Parameter{operation.Parameters, pathItem.Parameters} {
+		for _, param := range params {
+			if param.In == "body" {
+				return param.Name
+			}
+		}
+	}
+	return ""
+}
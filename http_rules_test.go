@@ -0,0 +1,159 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	descriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// grpc-gateway style proto. Rules are set on its methods by tests, since the parser can't import
+// google/api/annotations.proto.
+const httpRulesProto = `
+syntax = "proto3";
+
+package library.v1;
+
+message Shelf {
+  string id = 1;
+}
+
+message Book {
+  string title = 1;
+}
+
+message GetShelfRequest {
+  Shelf shelf = 1;
+}
+
+message CreateBookRequest {
+  string shelf = 1;
+  Book book = 2;
+}
+
+message Empty {}
+
+service Library {
+  rpc GetShelf(GetShelfRequest) returns (Shelf);
+  rpc CreateBook(CreateBookRequest) returns (Book);
+  rpc Ping(Empty) returns (Empty);
+}
+`
+
+// Spec for the operations bound to httpRulesProto.
+const httpRulesSpec = `{
+  "swagger": "2.0",
+  "paths": {
+    "/v1/shelves/{shelfId}": {
+      "get": {
+        "operationId": "getShelf",
+        "parameters": [{"name": "shelfId", "in": "path", "required": true, "type": "string"}]
+      }
+    },
+    "/v1/shelves/{shelfName}/books": {
+      "parameters": [{"name": "shelfName", "in": "path", "required": true, "type": "string"}],
+      "post": {
+        "operationId": "createBook",
+        "parameters": [{"name": "payload", "in": "body", "schema": {"type": "object"}}]
+      }
+    }
+  }
+}`
+
+// Returns the methods of httpRulesProto with the given rules set, keyed by method name. The proto
+// is parsed afresh, so rules don't leak between tests.
+func loadHTTPRulesProto(t *testing.T, rules map[string]*annotations.HttpRule) *desc.FileDescriptor {
+	fileDesc, err := parseProtoFromBytes("library.proto", []byte(httpRulesProto))
+	require.Nil(t, err)
+	for name, rule := range rules {
+		method := fileDesc.FindService("library.v1.Library").FindMethodByName(name)
+		options := method.GetMethodOptions()
+		if options == nil {
+			options = &descriptor.MethodOptions{}
+			method.AsMethodDescriptorProto().Options = options
+		}
+		require.Nil(t, proto.SetExtension(options, annotations.E_Http, rule))
+	}
+	return fileDesc
+}
+
+// Tests that annotated methods are bound to the operations at their rules' paths.
+func TestBindHTTPRules(t *testing.T) {
+	assert := assertions.New(t)
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(httpRulesSpec), swagger))
+	fileDesc := loadHTTPRulesProto(t, map[string]*annotations.HttpRule{
+		"GetShelf": {Pattern: &annotations.HttpRule_Get{Get: "/v1/shelves/{shelf.id}"}},
+		"CreateBook": {
+			Pattern: &annotations.HttpRule_Post{Post: "/v1/shelves/{shelf=*}/books"},
+			Body:    "book",
+		},
+	})
+
+	bound, err := BindHTTPRules(swagger, fileDesc)
+	require.Nil(t, err)
+	require.Len(t, bound, 2, "Expected Ping to be skipped")
+
+	assert.Equal("Library", bound[0].Service)
+	assert.Equal("GetShelf", bound[0].Method)
+	assert.Equal("GET", bound[0].HTTPMethod)
+	assert.Equal("/v1/shelves/{shelfId}", bound[0].Path)
+	mapping, err := resolveParamFields(bound[0].Operation, &OperationOptions{})
+	require.Nil(t, err)
+	assert.Equal(map[string]string{"shelfId": "shelf.id"}, mapping)
+
+	assert.Equal("CreateBook", bound[1].Method)
+	assert.Equal("POST", bound[1].HTTPMethod)
+	mapping, err = resolveParamFields(bound[1].Operation, &OperationOptions{})
+	require.Nil(t, err)
+	assert.Equal(map[string]string{"shelfName": "shelf", "payload": "book"}, mapping)
+}
+
+// Tests that rules which don't match the spec, or can't be proxied, are errors.
+func TestBindHTTPRulesErrors(t *testing.T) {
+	swagger := &spec.Swagger{}
+	require.Nil(t, json.Unmarshal([]byte(httpRulesSpec), swagger))
+	fixtures := []struct {
+		name string
+		rule *annotations.HttpRule
+	}{
+		{"NoOperation", &annotations.HttpRule{Pattern: &annotations.HttpRule_Delete{Delete: "/v1/shelves/{id}"}}},
+		{"NoPath", &annotations.HttpRule{}},
+		{"MultiSegment", &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*}"}}},
+		{"WholeBody", &annotations.HttpRule{
+			Pattern: &annotations.HttpRule_Post{Post: "/v1/shelves/{shelf}/books"},
+			Body:    "*",
+		}},
+		{"NoBodyParam", &annotations.HttpRule{
+			Pattern: &annotations.HttpRule_Get{Get: "/v1/shelves/{shelf.id}"},
+			Body:    "shelf",
+		}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			fileDesc := loadHTTPRulesProto(t, map[string]*annotations.HttpRule{"GetShelf": fixture.rule})
+			_, err := BindHTTPRules(swagger, fileDesc)
+			assertions.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// JSON-encoded gRPC messages, for clients which can't produce protobuf, such as some scripting
+// environments.
+//
+// These clients send messages as JSON, with the content type application/grpc+json, and receive
+// JSON responses. The gRPC server's own transport doesn't pass the content type on to handlers, so
+// the server must be served through NewContentSubtypeHandler, which passes it on in metadata. The
+// server must also be created with the codec from NewServerCodec, which hands proxied operations
+// their messages' bytes and encodes every other service's messages as protobuf, as usual.
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The incoming metadata key holding a call's content-subtype, such as "json" for a content type of
+// application/grpc+json, as set by NewContentSubtypeHandler.
+const contentSubtypeMetadataKey = "swaggrpc-content-subtype"
+
+// NewContentSubtypeHandler returns a handler serving gRPC calls with the given server, for use with
+// an HTTP/2 net/http server, passing each call's content-subtype on to operations with AcceptJSON
+// set. Any content-subtype the client sends in metadata is replaced.
+func NewContentSubtypeHandler(server *grpc.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set(contentSubtypeMetadataKey, contentSubtype(r.Header.Get("Content-Type")))
+		server.ServeHTTP(w, r)
+	})
+}
+
+// Returns the content-subtype of a gRPC content type: "json" for application/grpc+json, or empty if
+// there is none.
+func contentSubtype(contentType string) string {
+	const prefix = "application/grpc+"
+	if !strings.HasPrefix(contentType, prefix) {
+		return ""
+	}
+	subtype := contentType[len(prefix):]
+	if i := strings.IndexByte(subtype, ';'); i >= 0 {
+		subtype = subtype[:i]
+	}
+	return strings.ToLower(subtype)
+}
+
+// Returns whether a call's messages are JSON, by its content-subtype.
+func isJSONCall(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return firstMetadataValue(md, contentSubtypeMetadataKey) == "json"
+}
+
+// NewServerCodec returns a codec for a gRPC server proxying operations with AcceptJSON set, for use
+// with grpc.CustomCodec.
+func NewServerCodec() grpc.Codec {
+	return serverCodec{}
+}
+
+// A message's encoded bytes, passed through the server codec unchanged.
+type rawFrame struct {
+	data []byte
+}
+
+// A codec passing raw frames through, and encoding other messages as protobuf.
+type serverCodec struct{}
+
+func (serverCodec) Marshal(v interface{}) ([]byte, error) {
+	if frame, ok := v.(*rawFrame); ok {
+		return frame.data, nil
+	}
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T as a proto message", v)
+	}
+	return proto.Marshal(message)
+}
+
+func (serverCodec) Unmarshal(data []byte, v interface{}) error {
+	if frame, ok := v.(*rawFrame); ok {
+		// The transport may reuse its buffer.
+		frame.data = append([]byte(nil), data...)
+		return nil
+	}
+	message, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal %T as a proto message", v)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+// Names the codec by what it encodes: protobuf, and the raw bytes of proxied operations' messages,
+// which are JSON for calls with the content-subtype json.
+func (serverCodec) String() string {
+	return "proto+raw"
+}
+
+// A stream receiving protobuf or JSON messages, by the call's content-subtype, and answering in
+// kind.
+type jsonAwareStream struct {
+	grpc.ServerStream
+	// True if the call's content-subtype is json.
+	json bool
+}
+
+// Returns a stream for a call with protobuf or JSON messages, by its content-subtype.
+func newJSONAwareStream(stream grpc.ServerStream) *jsonAwareStream {
+	return &jsonAwareStream{ServerStream: stream, json: isJSONCall(stream.Context())}
+}
+
+func (s *jsonAwareStream) RecvMsg(m interface{}) error {
+	frame := &rawFrame{}
+	if err := s.ServerStream.RecvMsg(frame); err != nil {
+		return err
+	}
+	message := m.(proto.Message)
+	if !s.json {
+		return proto.Unmarshal(frame.data, message)
+	}
+	if err := (&jsonpb.Unmarshaler{}).Unmarshal(bytes.NewReader(frame.data), message); err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad JSON message: %v", err)
+	}
+	return nil
+}
+
+func (s *jsonAwareStream) SendMsg(m interface{}) error {
+	if !s.json {
+		return s.ServerStream.SendMsg(m)
+	}
+	encoded, err := (&jsonpb.Marshaler{}).MarshalToString(m.(proto.Message))
+	if err != nil {
+		return status.Errorf(codes.Internal, "encoding JSON response: %v", err)
+	}
+	return s.ServerStream.SendMsg(&rawFrame{data: []byte(encoded)})
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// Invokes GetItem with a JSON request on a server at the given URL, with an HTTP/2 client, returning
+// the JSON response and the call's gRPC status code.
+func invokeJSON(t *testing.T, client *http.Client, serverURL, request string) (string, string) {
+	body := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(request)))
+	body = append(body, request...)
+	httpRequest, err := http.NewRequest("POST", serverURL+"/test_service.Items/GetItem", bytes.NewReader(body))
+	require.Nil(t, err)
+	httpRequest.Header.Set("Content-Type", "application/grpc+json")
+	httpRequest.Header.Set("TE", "trailers")
+	response, err := client.Do(httpRequest)
+	require.Nil(t, err)
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	require.Nil(t, err)
+	code := response.Trailer.Get("Grpc-Status")
+	if code == "" {
+		code = response.Header.Get("Grpc-Status")
+	}
+	if len(data) < 5 {
+		return "", code
+	}
+	return string(data[5:]), code
+}
+
+// Tests calling a proxied operation with JSON and protobuf messages on a server using the server
+// codec, chosen by the call's content-subtype.
+func TestJSONClients(t *testing.T) {
+	assert := assertions.New(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/items/abc", r.URL.Path, "Bad request path")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.Nil(t, err)
+
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+	registry := NewOperationRegistry()
+	require.Nil(t, registry.Add(http.DefaultClient, runtimeclient.New(backendURL.Host, "/", []string{"http"}),
+		"GET", "/items/{itemId}", documentedOperation(), testServiceParams, method,
+		&ServiceOptions{AcceptJSON: true}))
+
+	grpcServer := grpc.NewServer(grpc.CustomCodec(NewServerCodec()), grpc.UnknownServiceHandler(registry.Handler()))
+	server := httptest.NewUnstartedServer(NewContentSubtypeHandler(grpcServer))
+	require.Nil(t, http2.ConfigureServer(server.Config, nil))
+	server.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	server.StartTLS()
+	defer server.Close()
+	clientTLS := &tls.Config{InsecureSkipVerify: true}
+
+	t.Run("JSON", func(t *testing.T) {
+		client := &http.Client{Transport: &http2.Transport{TLSClientConfig: clientTLS}}
+		response, code := invokeJSON(t, client, server.URL, `{"itemId": "abc"}`)
+		assertions.Equal(t, "0", code)
+		assertions.JSONEq(t, `{"name": "thing"}`, response)
+
+		_, code = invokeJSON(t, client, server.URL, `{"itemId": "abc", "unknown": 1}`)
+		assertions.Equal(t, strconv.Itoa(int(codes.InvalidArgument)), code)
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		conn, err := grpc.Dial(strings.TrimPrefix(server.URL, "https://"),
+			grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+		require.Nil(t, err)
+		defer conn.Close()
+
+		request := dynamic.NewMessage(method.GetInputType())
+		request.SetFieldByName("itemId", "abc")
+		response := dynamic.NewMessage(method.GetOutputType())
+		// A content-subtype sent in metadata is ignored.
+		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(contentSubtypeMetadataKey, "json"))
+		require.Nil(t, grpc.Invoke(ctx, "/test_service.Items/GetItem", request, response, conn))
+		assertions.Equal(t, "thing", response.GetFieldByName("name"))
+	})
+}
+
+// Tests reading the content-subtype of gRPC content types.
+func TestContentSubtype(t *testing.T) {
+	fixtures := map[string]string{
+		"application/grpc":               "",
+		"application/grpc+json":          "json",
+		"application/grpc+JSON; q=1":     "json",
+		"application/grpc;charset=utf-8": "",
+		"application/grpc+proto":         "proto",
+	}
+	for contentType, expected := range fixtures {
+		assertions.Equal(t, expected, contentSubtype(contentType), contentType)
+	}
+}
@@ -0,0 +1,699 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Transforms of request and response JSON, for backends which don't quite match their spec.
+//
+// A transform is written in a subset of jq. A request transform is applied to the JSON of each
+// request body before it is sent (and before it is form-encoded, for forms), and a response transform
+// to each response body before it is read into the output message. Supported are:
+//
+//   .                    the input
+//   .name, ."name"       a field of an object; null for null
+//   .[2], .[-1]          an element of an array, from the end if negative; null if out of range
+//   .["name"]            a field of an object, by a quoted name
+//   .[]                  each element of an array, or value of an object
+//   a | b                b applied to each output of a
+//   a, b                 the outputs of a, then those of b
+//   a // b               the outputs of a which aren't null or false, or if there are none, those of b
+//   [a]                  an array of a's outputs
+//   {key: a, "k": b}     an object; {name} is short for {name: .name}, and (a): b computes a key
+//   map(a)               short for [.[] | a]
+//   "text", 1, true, null  literals
+//
+// For example, {items: .data.results, nextPageToken: .paging.next // ""} unwraps a paged envelope.
+// A transform must produce exactly one output.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Name of the operation extension holding the request transform.
+	requestTransformExtension = "x-swaggrpc-request-transform"
+	// Name of the operation extension holding the response transform.
+	responseTransformExtension = "x-swaggrpc-response-transform"
+)
+
+// A parsed transform.
+type jsonTransform struct {
+	// The transform's source, as configured.
+	source string
+	expr   transformExpr
+}
+
+// Returns an operation's transform, from its options or else the given spec extension, or nil if it
+// has none. Returns an error if the transform can't be parsed.
+func resolveTransform(operation *spec.Operation, extension, option string) (*jsonTransform, error) {
+	source := option
+	if source == "" {
+		if _, err := decodeExtension(operation.Extensions, extension, &source); err != nil {
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(source) == "" {
+		return nil, nil
+	}
+	expr, err := parseTransform(source)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s for %s: %s", extension, operation.ID, err)
+	}
+	return &jsonTransform{source: source, expr: expr}, nil
+}
+
+// Returns JSON rewritten by the transform.
+func (t *jsonTransform) apply(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers are kept as written, so that large integers aren't rounded.
+	decoder.UseNumber()
+	var input interface{}
+	if err := decoder.Decode(&input); err != nil {
+		return nil, err
+	}
+	outputs, err := t.expr.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("transform produced %d values, not one", len(outputs))
+	}
+	return json.Marshal(outputs[0])
+}
+
+// Returns a response body rewritten by an operation's transform. Fails with Internal if the body
+// isn't JSON, or the transform doesn't apply to it.
+func (p *operationAdapter) transformResponse(body []byte) ([]byte, error) {
+	transformed, err := p.responseTransform.apply(body)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "transforming response for %s: %v", p.operation.ID, err)
+	}
+	return transformed, nil
+}
+
+// Returns a BodyProducer encoding messages of the given media type from JSON rewritten by a request
+// transform. Fails with Internal if the transform doesn't apply to a message.
+func transformedBodyProducer(transform *jsonTransform, operationID, mediaType string) BodyProducer {
+	return func(message proto.Message) (io.ReadCloser, error) {
+		encoded, err := (&jsonpb.Marshaler{}).MarshalToString(message)
+		if err != nil {
+			return nil, err
+		}
+		transformed, err := transform.apply([]byte(encoded))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "transforming request for %s: %v", operationID, err)
+		}
+		if baseMediaType(mediaType) == formMediaType {
+			return formBodyFromJSON(transformed)
+		}
+		return ioutil.NopCloser(bytes.NewReader(transformed)), nil
+	}
+}
+
+// A transform expression, producing any number of outputs from an input.
+type transformExpr interface {
+	eval(input interface{}) ([]interface{}, error)
+}
+
+// The input.
+type identityExpr struct{}
+
+func (identityExpr) eval(input interface{}) ([]interface{}, error) {
+	return []interface{}{input}, nil
+}
+
+// A literal value.
+type literalExpr struct {
+	value interface{}
+}
+
+func (e literalExpr) eval(input interface{}) ([]interface{}, error) {
+	return []interface{}{e.value}, nil
+}
+
+// An index into each output of target, by a field name or array position.
+type indexExpr struct {
+	target transformExpr
+	index  interface{}
+}
+
+func (e indexExpr) eval(input interface{}) ([]interface{}, error) {
+	return evalEach(e.target, input, func(value interface{}) ([]interface{}, error) {
+		switch container := value.(type) {
+		case nil:
+			return []interface{}{nil}, nil
+		case map[string]interface{}:
+			if name, ok := e.index.(string); ok {
+				return []interface{}{container[name]}, nil
+			}
+		case []interface{}:
+			if position, ok := e.index.(int); ok {
+				if position < 0 {
+					position += len(container)
+				}
+				if position < 0 || position >= len(container) {
+					return []interface{}{nil}, nil
+				}
+				return []interface{}{container[position]}, nil
+			}
+		}
+		return nil, fmt.Errorf("can't index %s with %v", jsonTypeName(value), e.index)
+	})
+}
+
+// Each element or value of each output of target.
+type iterateExpr struct {
+	target transformExpr
+}
+
+func (e iterateExpr) eval(input interface{}) ([]interface{}, error) {
+	return evalEach(e.target, input, func(value interface{}) ([]interface{}, error) {
+		switch container := value.(type) {
+		case []interface{}:
+			return container, nil
+		case map[string]interface{}:
+			// Values are produced in key order, for stable output.
+			keys := sortedKeys(container)
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				values[i] = container[key]
+			}
+			return values, nil
+		}
+		return nil, fmt.Errorf("can't iterate over %s", jsonTypeName(value))
+	})
+}
+
+// right applied to each output of left.
+type pipeExpr struct {
+	left, right transformExpr
+}
+
+func (e pipeExpr) eval(input interface{}) ([]interface{}, error) {
+	return evalEach(e.left, input, e.right.eval)
+}
+
+// The outputs of left, then those of right.
+type commaExpr struct {
+	left, right transformExpr
+}
+
+func (e commaExpr) eval(input interface{}) ([]interface{}, error) {
+	left, err := e.left.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+// The truthy outputs of left, or if there are none, or left fails, the outputs of right.
+type alternativeExpr struct {
+	left, right transformExpr
+}
+
+func (e alternativeExpr) eval(input interface{}) ([]interface{}, error) {
+	left, err := e.left.eval(input)
+	if err == nil {
+		var truthy []interface{}
+		for _, value := range left {
+			if value != nil && value != false {
+				truthy = append(truthy, value)
+			}
+		}
+		if len(truthy) > 0 {
+			return truthy, nil
+		}
+	}
+	return e.right.eval(input)
+}
+
+// An array of the outputs of body, or an empty array if body is nil.
+type arrayExpr struct {
+	body transformExpr
+}
+
+func (e arrayExpr) eval(input interface{}) ([]interface{}, error) {
+	elements := []interface{}{}
+	if e.body != nil {
+		var err error
+		if elements, err = e.body.eval(input); err != nil {
+			return nil, err
+		}
+		if elements == nil {
+			elements = []interface{}{}
+		}
+	}
+	return []interface{}{elements}, nil
+}
+
+// An object, with an output for each combination of its entries' outputs.
+type objectExpr struct {
+	entries []objectEntry
+}
+
+// An entry of an object expression.
+type objectEntry struct {
+	key, value transformExpr
+}
+
+func (e objectExpr) eval(input interface{}) ([]interface{}, error) {
+	objects := []map[string]interface{}{{}}
+	for _, entry := range e.entries {
+		keys, err := entry.key.eval(input)
+		if err != nil {
+			return nil, err
+		}
+		values, err := entry.value.eval(input)
+		if err != nil {
+			return nil, err
+		}
+		var combined []map[string]interface{}
+		for _, object := range objects {
+			for _, key := range keys {
+				name, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, not %s", jsonTypeName(key))
+				}
+				for _, value := range values {
+					extended := make(map[string]interface{}, len(object)+1)
+					for k, v := range object {
+						extended[k] = v
+					}
+					extended[name] = value
+					combined = append(combined, extended)
+				}
+			}
+		}
+		objects = combined
+	}
+	outputs := make([]interface{}, len(objects))
+	for i, object := range objects {
+		outputs[i] = object
+	}
+	return outputs, nil
+}
+
+// Evaluates target, then calls apply on each of its outputs, concatenating their outputs.
+func evalEach(target transformExpr, input interface{},
+	apply func(value interface{}) ([]interface{}, error)) ([]interface{}, error) {
+	values, err := target.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, value := range values {
+		applied, err := apply(value)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, applied...)
+	}
+	return outputs, nil
+}
+
+// Returns the JSON type of a decoded value, for errors.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Parses a transform.
+func parseTransform(source string) (transformExpr, error) {
+	tokens, err := tokenizeTransform(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &transformParser{tokens: tokens}
+	expr, err := parser.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q", tokens[parser.pos])
+	}
+	return expr, nil
+}
+
+// Splits a transform into tokens: punctuation, identifiers, numbers, and JSON strings with their
+// quotes.
+func tokenizeTransform(source string) ([]string, error) {
+	var tokens []string
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			i += 2
+		case strings.ContainsRune(".[]{}()|,:", r):
+			i++
+		case r == '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+		case r == '-' || unicode.IsDigit(r):
+			for i++; i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE+-", runes[i])); i++ {
+			}
+		case r == '_' || unicode.IsLetter(r):
+			for i++; i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])); i++ {
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", r, start)
+		}
+		tokens = append(tokens, string(runes[start:i]))
+	}
+	return tokens, nil
+}
+
+// A recursive descent parser of transform tokens.
+type transformParser struct {
+	tokens []string
+	pos    int
+}
+
+// Returns the next token without consuming it, or "" at the end.
+func (p *transformParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// Consumes the next token, failing if it isn't the expected one.
+func (p *transformParser) expect(token string) error {
+	if next := p.peek(); next != token {
+		if next == "" {
+			return fmt.Errorf("expected %q at end", token)
+		}
+		return fmt.Errorf("expected %q, not %q", token, next)
+	}
+	p.pos++
+	return nil
+}
+
+// Parses "a | b | ...".
+func (p *transformParser) parsePipe() (transformExpr, error) {
+	return p.parseBinary("|", p.parseComma, func(left, right transformExpr) transformExpr {
+		return pipeExpr{left, right}
+	})
+}
+
+// Parses "a, b, ...".
+func (p *transformParser) parseComma() (transformExpr, error) {
+	return p.parseBinary(",", p.parseAlternative, func(left, right transformExpr) transformExpr {
+		return commaExpr{left, right}
+	})
+}
+
+// Parses "a // b // ...".
+func (p *transformParser) parseAlternative() (transformExpr, error) {
+	return p.parseBinary("//", p.parsePostfix, func(left, right transformExpr) transformExpr {
+		return alternativeExpr{left, right}
+	})
+}
+
+// Parses operands separated by a left-associative operator.
+func (p *transformParser) parseBinary(operator string, parseOperand func() (transformExpr, error),
+	combine func(left, right transformExpr) transformExpr) (transformExpr, error) {
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == operator {
+		p.pos++
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = combine(left, right)
+	}
+	return left, nil
+}
+
+// Parses a primary expression followed by any field accesses and brackets.
+func (p *transformParser) parsePostfix() (transformExpr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case ".":
+			p.pos++
+			if expr, err = p.parseField(expr); err != nil {
+				return nil, err
+			}
+		case "[":
+			if expr, err = p.parseBracket(expr); err != nil {
+				return nil, err
+			}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// Parses the name following a ".", as an index into target.
+func (p *transformParser) parseField(target transformExpr) (transformExpr, error) {
+	token := p.peek()
+	if isIdentifier(token) {
+		p.pos++
+		return indexExpr{target, token}, nil
+	}
+	if strings.HasPrefix(token, `"`) {
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return indexExpr{target, name}, nil
+	}
+	if token == "" {
+		return nil, fmt.Errorf("expected a field name at end")
+	}
+	return nil, fmt.Errorf("expected a field name, not %q", token)
+}
+
+// Parses "[]", "[n]" or ["name"] following target.
+func (p *transformParser) parseBracket(target transformExpr) (transformExpr, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var expr transformExpr
+	switch token := p.peek(); {
+	case token == "]":
+		expr = iterateExpr{target}
+	case strings.HasPrefix(token, `"`):
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		expr = indexExpr{target, name}
+	default:
+		position, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, fmt.Errorf("expected an array index, not %q", token)
+		}
+		p.pos++
+		expr = indexExpr{target, position}
+	}
+	return expr, p.expect("]")
+}
+
+// Parses a JSON string token.
+func (p *transformParser) parseString() (string, error) {
+	var value string
+	if err := json.Unmarshal([]byte(p.peek()), &value); err != nil {
+		return "", fmt.Errorf("bad string %s: %s", p.peek(), err)
+	}
+	p.pos++
+	return value, nil
+}
+
+// Parses ".", a path from it, a literal, or an array, object, parenthesized or map expression.
+func (p *transformParser) parsePrimary() (transformExpr, error) {
+	token := p.peek()
+	switch {
+	case token == ".":
+		p.pos++
+		if next := p.peek(); isIdentifier(next) || strings.HasPrefix(next, `"`) {
+			return p.parseField(identityExpr{})
+		}
+		return identityExpr{}, nil
+	case token == "(":
+		p.pos++
+		expr, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case token == "[":
+		p.pos++
+		if p.peek() == "]" {
+			p.pos++
+			return arrayExpr{}, nil
+		}
+		body, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return arrayExpr{body}, p.expect("]")
+	case token == "{":
+		return p.parseObject()
+	case strings.HasPrefix(token, `"`):
+		value, err := p.parseString()
+		return literalExpr{value}, err
+	case token == "true" || token == "false":
+		p.pos++
+		return literalExpr{token == "true"}, nil
+	case token == "null":
+		p.pos++
+		return literalExpr{nil}, nil
+	case token == "map":
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		body, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return arrayExpr{pipeExpr{iterateExpr{identityExpr{}}, body}}, p.expect(")")
+	case token != "" && (token[0] == '-' || unicode.IsDigit(rune(token[0]))):
+		if _, err := strconv.ParseFloat(token, 64); err != nil {
+			return nil, fmt.Errorf("bad number %q", token)
+		}
+		p.pos++
+		return literalExpr{json.Number(token)}, nil
+	case isIdentifier(token):
+		return nil, fmt.Errorf("unknown function %q", token)
+	case token == "":
+		return nil, fmt.Errorf("unexpected end")
+	default:
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+}
+
+// Parses an object construction.
+func (p *transformParser) parseObject() (transformExpr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var object objectExpr
+	for p.peek() != "}" {
+		if len(object.entries) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		var entry objectEntry
+		token := p.peek()
+		var shorthand string
+		switch {
+		case isIdentifier(token):
+			p.pos++
+			entry.key, shorthand = literalExpr{token}, token
+		case strings.HasPrefix(token, `"`):
+			name, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			entry.key, shorthand = literalExpr{name}, name
+		case token == "(":
+			p.pos++
+			key, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			entry.key = key
+		default:
+			return nil, fmt.Errorf("expected an object key, not %q", token)
+		}
+		if p.peek() == ":" {
+			p.pos++
+			value, err := p.parseAlternative()
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		} else if shorthand != "" {
+			entry.value = indexExpr{identityExpr{}, shorthand}
+		} else {
+			return nil, fmt.Errorf("computed object key has no value")
+		}
+		object.entries = append(object.entries, entry)
+	}
+	p.pos++
+	return object, nil
+}
+
+// Returns the keys of an object, sorted.
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns true if a token is an identifier.
+func isIdentifier(token string) bool {
+	if token == "" {
+		return false
+	}
+	first := rune(token[0])
+	return first == '_' || unicode.IsLetter(first)
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests evaluating transforms.
+func TestTransformExpressions(t *testing.T) {
+	input := `{
+    "data": {"results": [{"id": 1, "title": "a"}, {"id": 2, "title": "b"}]},
+    "paging": {"next": null},
+    "odd key": true
+  }`
+	fixtures := []struct {
+		transform string
+		output    string
+	}{
+		{".", input},
+		{".data.results[1].title", `"b"`},
+		{".data.results[-1].id", `2`},
+		{".data.results[5]", `null`},
+		{`."odd key"`, `true`},
+		{`.["odd key"]`, `true`},
+		{".missing.nested", `null`},
+		{"[.data.results[].id]", `[1, 2]`},
+		{".data.results | map(.title)", `["a", "b"]`},
+		{"[.data.results[] | {name: .title}]", `[{"name": "a"}, {"name": "b"}]`},
+		{`{items: .data.results, nextPageToken: .paging.next // ""}`,
+			`{"items": [{"id": 1, "title": "a"}, {"id": 2, "title": "b"}], "nextPageToken": ""}`},
+		{`{paging, "count": 2, (.data.results[0].title): [], flag: false, none: null}`,
+			`{"paging": {"next": null}, "count": 2, "a": [], "flag": false, "none": null}`},
+		{"[.paging[]]", `[null]`},
+		{"[.data.results[0].id, -1.5e0]", `[1, -1.5]`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.transform, func(t *testing.T) {
+			expr, err := parseTransform(fixture.transform)
+			require.Nil(t, err)
+			decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+			decoder.UseNumber()
+			var value interface{}
+			require.Nil(t, decoder.Decode(&value))
+			outputs, err := expr.eval(value)
+			require.Nil(t, err)
+			require.Len(t, outputs, 1)
+			output, err := json.Marshal(outputs[0])
+			require.Nil(t, err)
+			assertions.JSONEq(t, fixture.output, string(output))
+		})
+	}
+}
+
+// Tests rejecting malformed transforms.
+func TestTransformParseErrors(t *testing.T) {
+	for _, transform := range []string{
+		"", ".a |", "[.a", "{a: }", "{(.a)}", ".[x]", `."unterminated`, "length", ".a $", "map(.a", ". .",
+	} {
+		_, err := parseTransform(transform)
+		assertions.NotNil(t, err, "Expected error for %q", transform)
+	}
+}
+
+// Tests that responses are transformed before they're read, with options overriding the spec.
+func TestResponseTransform(t *testing.T) {
+	fixtures := []struct {
+		name      string
+		extension string
+		option    string
+		code      codes.Code
+		itemName  string
+	}{
+		{"Untransformed", "", "", codes.OK, ""},
+		{"Spec", ".item", "", codes.OK, "from spec"},
+		{"Options", ".item", "{name: .label}", codes.OK, "from options"},
+		{"Failed", ".label[0]", "", codes.Internal, ""},
+		{"Several values", ".item, .item", "", codes.Internal, ""},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+			if fixture.extension != "" {
+				operation.AddExtension(responseTransformExtension, fixture.extension)
+			}
+			options := &ServiceOptions{Operations: map[string]*OperationOptions{
+				"getItem": {ResponseTransform: fixture.option},
+			}}
+			adapter, closeServer := testOperation{operation: operation, options: options,
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"item": {"name": "from spec"}, "label": "from options"}`))
+				}}.adapter(t)
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			err := adapter.handleGRPCRequest(stream)
+			require.Equal(t, fixture.code, errorCode(err), "Bad result: %v", err)
+			if err == nil {
+				assertions.Equal(t, fixture.itemName, stream.sent[0].GetFieldByName("name"))
+			}
+		})
+	}
+
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	operation.AddExtension(responseTransformExtension, "{")
+	_, err := resolveTransform(operation, responseTransformExtension, "")
+	assertions.NotNil(t, err, "Expected error for a malformed transform")
+}
+
+// Tests that request bodies are transformed before they're sent, as JSON or forms.
+func TestRequestTransform(t *testing.T) {
+	var body []byte
+	createGadget := testOperation{
+		method:     testMethod(t, bodyMediaTypesProto, "body_media_types_test.Gadgets", "CreateGadget"),
+		httpMethod: "POST",
+		path:       "/gadgets",
+		parameters: map[string]*spec.Parameter{"gadget": spec.BodyParam("gadget", nil)},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		},
+	}
+
+	fixtures := []struct {
+		name      string
+		consumes  []string
+		transform string
+		code      codes.Code
+		body      string
+	}{
+		{"JSON", nil, `{title: .name, labels: .tags}`, codes.OK, `{"title": "gear", "labels": ["a"]}`},
+		{"Form", []string{formMediaType}, `{title: .name}`, codes.OK, `title=gear`},
+		{"Failed", nil, `.name[0]`, codes.Internal, ""},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			operation := &spec.Operation{OperationProps: spec.OperationProps{
+				ID:       "createGadget",
+				Consumes: fixture.consumes,
+			}}
+			operation.AddExtension(requestTransformExtension, fixture.transform)
+			createGadget.operation = operation
+			adapter, closeServer := createGadget.adapter(t)
+			defer closeServer()
+
+			err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"gadget": {"name": "gear", "tags": ["a"]}}`})
+			require.Equal(t, fixture.code, errorCode(err), "Bad result: %v", err)
+			if fixture.consumes != nil {
+				assertions.Equal(t, fixture.body, string(body))
+			} else if err == nil {
+				assertions.JSONEq(t, fixture.body, string(body))
+			}
+		})
+	}
+}
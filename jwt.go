@@ -0,0 +1,374 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Authentication of bearer JWTs, signed with keys from a JWKS endpoint.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	// Registers the SHA-2 hashes used by the supported algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Tolerance for clock differences when checking token lifetimes.
+const jwtClockSkew = time.Minute
+
+// The minimum time between key fetches triggered by an unknown key ID, or after a failed fetch.
+const jwksMinRefresh = time.Minute
+
+// How long a key fetch may take. Fetches aren't bound to the call triggering them, whose deadline
+// would otherwise fail the fetch for every call waiting on it.
+const jwksFetchTimeout = 10 * time.Second
+
+// JWTOptions configures a JWTAuthenticator.
+type JWTOptions struct {
+	// URL of the JSON Web Key Set holding the token signing keys.
+	JWKSURL string
+	// If set, tokens must have this issuer.
+	Issuer string
+	// If set, tokens must list this audience.
+	Audience string
+	// The incoming gRPC metadata key holding the token, as "Bearer <token>". Defaults to
+	// "authorization".
+	MetadataKey string
+	// Client to fetch keys with. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// How long fetched keys are used before being fetched again. Defaults to an hour. Keys are also
+	// fetched again, at most once a minute, when a token names an unknown key. A failed fetch isn't
+	// retried for a minute.
+	CacheTTL time.Duration
+}
+
+// JWTAuthenticator authenticates callers by a bearer JWT in their metadata. Tokens must be signed
+// with RS256, RS384, RS512, ES256, ES384 or ES512. The caller's subject is the token's "sub" claim,
+// and its claims are the token's claims.
+type JWTAuthenticator struct {
+	options JWTOptions
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// Signing keys, from the last fetch.
+	keys []jsonWebKey
+	// When keys were last fetched.
+	fetchedAt time.Time
+	// Closed when the fetch in progress finishes, or nil if none is.
+	fetching chan struct{}
+	// The error of the last fetch, if it failed.
+	fetchErr error
+	// When the last fetch failed, if it did.
+	failedAt time.Time
+}
+
+// NewJWTAuthenticator returns an authenticator for tokens with the given options.
+func NewJWTAuthenticator(options JWTOptions) *JWTAuthenticator {
+	if options.MetadataKey == "" {
+		options.MetadataKey = "authorization"
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.CacheTTL <= 0 {
+		options.CacheTTL = time.Hour
+	}
+	return &JWTAuthenticator{options: options}
+}
+
+// A parsed signing key.
+type jsonWebKey struct {
+	id  string
+	key crypto.PublicKey
+}
+
+// Hashes for the supported signing algorithms.
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// Authenticate returns the caller named by the call's token.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	value := firstMetadataValue(md, a.options.MetadataKey)
+	if len(value) < 7 || !strings.EqualFold(value[:7], "bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	parts := strings.Split(strings.TrimSpace(value[7:]), ".")
+	if len(parts) != 3 {
+		return nil, status.Error(codes.Unauthenticated, "malformed token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "malformed token header: %v", err)
+	}
+	hash, ok := jwtHashes[header.Algorithm]
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "unsupported token algorithm %q", header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "malformed token signature: %v", err)
+	}
+	keys, err := a.signingKeys(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	if !verifyJWTSignature(keys, hash, signed, signature) {
+		return nil, status.Error(codes.Unauthenticated, "invalid token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "malformed token claims: %v", err)
+	}
+	if err := a.validateClaims(claims, time.Now()); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	subject, _ := claims["sub"].(string)
+	return &Caller{Subject: subject, Claims: claims}, nil
+}
+
+// Decodes a base64url JSON token segment.
+func decodeJWTSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// Returns true if any of the keys produced the signature. ECDSA signatures are the concatenated R
+// and S values.
+func verifyJWTSignature(keys []crypto.PublicKey, hash crypto.Hash, signed, signature []byte) bool {
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+	for _, key := range keys {
+		switch typed := key.(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(typed, hash, digest, signature) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			size := (typed.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(typed, digest, r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks the time, issuer and audience claims of a token.
+func (a *JWTAuthenticator) validateClaims(claims map[string]interface{}, now time.Time) error {
+	if expiry, ok := claims["exp"].(float64); ok && now.Add(-jwtClockSkew).Unix() >= int64(expiry) {
+		return fmt.Errorf("token has expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(jwtClockSkew).Unix() < int64(notBefore) {
+		return fmt.Errorf("token is not yet valid")
+	}
+	if a.options.Issuer != "" {
+		if issuer, _ := claims["iss"].(string); issuer != a.options.Issuer {
+			return fmt.Errorf("token issuer %q is not trusted", issuer)
+		}
+	}
+	if a.options.Audience != "" && !hasAudience(claims["aud"], a.options.Audience) {
+		return fmt.Errorf("token is not for audience %q", a.options.Audience)
+	}
+	return nil
+}
+
+// Returns true if an "aud" claim, a string or list of strings, contains the given audience.
+func hasAudience(claim interface{}, audience string) bool {
+	switch typed := claim.(type) {
+	case string:
+		return typed == audience
+	case []interface{}:
+		for _, value := range typed {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check returns nil if the authenticator's token signing keys can be fetched, for use as a
+// ReadinessCheck.
+func (a *JWTAuthenticator) Check(ctx context.Context) error {
+	_, err := a.signingKeys(ctx, "")
+	return err
+}
+
+// Returns the keys a token with the given key ID may be signed with, fetching keys if the cache is
+// stale or doesn't have the key. A token without a key ID may be signed with any key. Only one fetch
+// is made at a time; while it's in progress, other calls use the cached keys, or wait for it if none
+// match. After a failed fetch, the cached keys are used without fetching again for jwksMinRefresh.
+func (a *JWTAuthenticator) signingKeys(ctx context.Context, keyID string) ([]crypto.PublicKey, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	age := time.Since(a.fetchedAt)
+	stale := age >= a.options.CacheTTL || (age >= jwksMinRefresh && len(a.matchingKeys(keyID)) == 0)
+	if stale && (a.fetching != nil || time.Since(a.failedAt) >= jwksMinRefresh) {
+		if a.fetching == nil {
+			a.fetchKeys()
+		} else if len(a.matchingKeys(keyID)) == 0 {
+			fetching := a.fetching
+			a.mutex.Unlock()
+			select {
+			case <-fetching:
+			case <-ctx.Done():
+				a.mutex.Lock()
+				return nil, contextError(ctx)
+			}
+			a.mutex.Lock()
+		}
+	}
+	if len(a.keys) == 0 && a.fetchErr != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not fetch token signing keys: %v", a.fetchErr)
+	}
+	keys := a.matchingKeys(keyID)
+	if len(keys) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "unknown token signing key %q", keyID)
+	}
+	return keys, nil
+}
+
+// Fetches the signing keys, keeping the cached keys if the fetch fails. Must be called with the mutex
+// held, which is released during the fetch.
+func (a *JWTAuthenticator) fetchKeys() {
+	fetching := make(chan struct{})
+	a.fetching = fetching
+	a.mutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	keys, err := fetchJWKS(ctx, a.options.HTTPClient, a.options.JWKSURL)
+	cancel()
+	a.mutex.Lock()
+	a.fetchErr = err
+	if err == nil {
+		a.keys = keys
+		a.fetchedAt = time.Now()
+	} else {
+		a.failedAt = time.Now()
+	}
+	a.fetching = nil
+	close(fetching)
+}
+
+// Returns the cached keys with the given ID, or all keys if the ID is empty. Must be called with the
+// mutex held.
+func (a *JWTAuthenticator) matchingKeys(keyID string) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	for _, key := range a.keys {
+		if keyID == "" || key.id == keyID {
+			keys = append(keys, key.key)
+		}
+	}
+	return keys
+}
+
+// Fetches and parses a JSON Web Key Set. Keys of unsupported types, or not for signing, are skipped.
+func fetchJWKS(ctx context.Context, client *http.Client, url string) ([]jsonWebKey, error) {
+	response, err := ctxhttp.Get(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: HTTP status %d", url, response.StatusCode)
+	}
+	var keySet struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&keySet); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", url, err)
+	}
+
+	var keys []jsonWebKey
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		switch jwk.KeyType {
+		case "RSA":
+			n, nErr := decodeJWKInt(jwk.N)
+			e, eErr := decodeJWKInt(jwk.E)
+			if nErr != nil || eErr != nil || !e.IsInt64() {
+				continue
+			}
+			key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve, ok := map[string]elliptic.Curve{
+				"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521(),
+			}[jwk.Curve]
+			x, xErr := decodeJWKInt(jwk.X)
+			y, yErr := decodeJWKInt(jwk.Y)
+			if !ok || xErr != nil || yErr != nil {
+				continue
+			}
+			key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			continue
+		}
+		keys = append(keys, jsonWebKey{id: jwk.KeyID, key: key})
+	}
+	return keys, nil
+}
+
+// Decodes a base64url big-endian integer from a JSON Web Key.
+func decodeJWKInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
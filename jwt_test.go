@@ -0,0 +1,195 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Returns a signed token with the given header and claims.
+func signTestJWT(t *testing.T, key crypto.Signer, header, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		require.Nil(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	var signature []byte
+	switch typed := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, typed, crypto.SHA256, digest.Sum(nil))
+		require.Nil(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, typed, digest.Sum(nil))
+		require.Nil(t, err)
+		// R and S, each left-padded to 32 bytes.
+		signature = make([]byte, 64)
+		copy(signature[32-len(r.Bytes()):32], r.Bytes())
+		copy(signature[64-len(s.Bytes()):], s.Bytes())
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Returns a context carrying the given bearer token.
+func bearerContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// Tests validation of tokens against keys from a JWKS endpoint.
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	encodeInt := func(value *big.Int) string { return base64.RawURLEncoding.EncodeToString(value.Bytes()) }
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig",
+				"n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeInt(ecKey.X), "y": encodeInt(ecKey.Y)},
+		}})
+	}))
+	defer server.Close()
+	authenticator := NewJWTAuthenticator(JWTOptions{
+		JWKSURL: server.URL, Issuer: "https://issuer", Audience: "items",
+	})
+
+	now := time.Now().Unix()
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "alice", "iss": "https://issuer", "aud": []string{"items", "orders"}, "exp": now + 60,
+		}
+	}
+	expired := validClaims()
+	expired["exp"] = now - 3600
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "orders"
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://elsewhere"
+
+	fixtures := []struct {
+		name     string
+		key      crypto.Signer
+		header   map[string]interface{}
+		claims   map[string]interface{}
+		wantCode codes.Code
+	}{
+		{"RS256", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, validClaims(), codes.OK},
+		{"ES256", ecKey, map[string]interface{}{"alg": "ES256", "kid": "ec"}, validClaims(), codes.OK},
+		{"NoKeyID", rsaKey, map[string]interface{}{"alg": "RS256"}, validClaims(), codes.OK},
+		{"WrongKey", otherKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, validClaims(), codes.Unauthenticated},
+		{"UnknownKey", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "gone"}, validClaims(), codes.Unauthenticated},
+		{"NoneAlgorithm", rsaKey, map[string]interface{}{"alg": "none", "kid": "rsa"}, validClaims(), codes.Unauthenticated},
+		{"Expired", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, expired, codes.Unauthenticated},
+		{"WrongAudience", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, wrongAudience, codes.Unauthenticated},
+		{"WrongIssuer", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, wrongIssuer, codes.Unauthenticated},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			token := signTestJWT(t, fixture.key, fixture.header, fixture.claims)
+			caller, err := authenticator.Authenticate(bearerContext(token))
+			assert.Equal(fixture.wantCode, errorCode(err), "Unexpected result: %v", err)
+			if fixture.wantCode == codes.OK {
+				assert.Equal("alice", caller.Subject)
+			}
+		})
+	}
+	assert := assertions.New(t)
+	assert.Equal(1, fetches, "Keys should be cached")
+
+	_, err = authenticator.Authenticate(context.Background())
+	assert.Equal(codes.Unauthenticated, errorCode(err), "Expected rejection without a token")
+}
+
+// Tests that an unreachable JWKS endpoint fails calls with Unavailable, without being fetched from
+// again until jwksMinRefresh has passed, and regardless of the triggering call's cancellation.
+func TestJWTAuthenticatorFetchFailure(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	authenticator := NewJWTAuthenticator(JWTOptions{JWKSURL: server.URL})
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	token := signTestJWT(t, key, map[string]interface{}{"alg": "RS256"}, map[string]interface{}{"sub": "alice"})
+	ctx, cancel := context.WithCancel(bearerContext(token))
+	cancel()
+	_, err = authenticator.Authenticate(ctx)
+	assertions.Equal(t, codes.Unavailable, errorCode(err))
+	assertions.Equal(t, 1, fetches, "Fetch abandoned with the cancelled call")
+	_, err = authenticator.Authenticate(bearerContext(token))
+	assertions.Equal(t, codes.Unavailable, errorCode(err))
+	assertions.Equal(t, codes.Unavailable, errorCode(authenticator.Check(context.Background())))
+	assertions.Equal(t, 1, fetches, "Failed fetch retried immediately")
+}
+
+// Tests that cached keys are used while a fetch is in progress, rather than waiting for it.
+func TestJWTAuthenticatorStaleKeysDuringFetch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	authenticator := NewJWTAuthenticator(JWTOptions{JWKSURL: server.URL})
+	// Cached keys, past their TTL.
+	authenticator.keys = []jsonWebKey{{id: "rsa", key: &key.PublicKey}}
+	token := signTestJWT(t, key, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+		map[string]interface{}{"sub": "alice"})
+
+	fetched := make(chan error)
+	go func() {
+		_, err := authenticator.Authenticate(bearerContext(token))
+		fetched <- err
+	}()
+	<-started
+	caller, err := authenticator.Authenticate(bearerContext(token))
+	assertions.Nil(t, err, "Call waited for the fetch")
+	assertions.Equal(t, "alice", caller.Subject)
+	close(release)
+	assertions.Nil(t, <-fetched, "Stale keys not used after a failed fetch")
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Deferred construction of operation adapters, for very large specs.
+
+import (
+	"net/http"
+	"sync"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Handles gRPC calls for a single operation.
+type operationHandler interface {
+	handleGRPCRequest(stream grpc.ServerStream) error
+}
+
+// Returns a handler for an operation. By default, the operation's adapter is built immediately, and
+// any error is returned. If options.LazyAdapters is set, the adapter is built on the first call
+// instead, and errors are returned to callers.
+func newOperationHandler(
+	httpClient *http.Client,
+	swaggerClient *runtimeclient.Runtime,
+	httpMethod string,
+	swaggerPath string,
+	operation *spec.Operation,
+	parameters map[string]*spec.Parameter,
+	method *desc.MethodDescriptor,
+	options *ServiceOptions,
+) (operationHandler, error) {
+	build := func() (*operationAdapter, error) {
+		return newPathWrapper(httpClient, swaggerClient, httpMethod, swaggerPath, operation, parameters,
+			method, options)
+	}
+	if options == nil || !options.LazyAdapters {
+		return build()
+	}
+	return &lazyAdapter{build: build, method: method}, nil
+}
+
+// An operation handler which builds its adapter on first use.
+type lazyAdapter struct {
+	// Builds the adapter.
+	build func() (*operationAdapter, error)
+	// The gRPC method, for errors.
+	method *desc.MethodDescriptor
+
+	// Guards all fields below. Held while building, so that concurrent first calls build once.
+	mutex sync.Mutex
+	// True once the adapter has been built, or failed to build.
+	built bool
+	// The built adapter, or nil if building failed.
+	adapter *operationAdapter
+	// The error from building, returned for every call.
+	err error
+}
+
+func (l *lazyAdapter) handleGRPCRequest(stream grpc.ServerStream) error {
+	adapter, err := l.get()
+	if err != nil {
+		return err
+	}
+	return adapter.handleGRPCRequest(stream)
+}
+
+// Returns the adapter, building it if this is the first call.
+func (l *lazyAdapter) get() (*operationAdapter, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.built {
+		l.adapter, l.err = l.build()
+		if l.err != nil {
+			l.err = status.Errorf(codes.Internal, "could not build operation for %s: %s",
+				l.method.GetFullyQualifiedName(), l.err)
+		}
+		l.built = true
+		// Release the arguments once built.
+		l.build = nil
+	}
+	return l.adapter, l.err
+}
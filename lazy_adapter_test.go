@@ -0,0 +1,83 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Returns a handler for GetItem with the given parameters, backed by a test server.
+func newTestOperationHandler(
+	t *testing.T,
+	parameters map[string]*spec.Parameter,
+	options *ServiceOptions,
+) (operationHandler, func(), error) {
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	}))
+	serverURL, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	handler, err := newOperationHandler(http.DefaultClient, runtimeclient.New(serverURL.Host, "/", []string{"http"}),
+		"GET", "/items/{itemId}", operation, parameters, method, options)
+	return handler, server.Close, err
+}
+
+// Parameters which can't be mapped to the GetItem request.
+var unmappableParams = map[string]*spec.Parameter{"missing": spec.QueryParam("missing")}
+
+// Tests that lazy adapters are built on first use.
+func TestLazyAdapter(t *testing.T) {
+	assert := assertions.New(t)
+	handler, closeServer, err := newTestOperationHandler(t, testServiceParams, &ServiceOptions{LazyAdapters: true})
+	defer closeServer()
+	require.Nil(t, err)
+	lazy, ok := handler.(*lazyAdapter)
+	require.True(t, ok, "Expected a lazy adapter, got %T", handler)
+	assert.Nil(lazy.adapter, "Adapter built before first use")
+
+	assert.Nil(handler.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	assert.NotNil(lazy.adapter, "Adapter not kept after first use")
+	assert.Nil(handler.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+}
+
+// Tests that lazy adapters return their build error for every call, while eager adapters fail
+// immediately.
+func TestLazyAdapterErrors(t *testing.T) {
+	assert := assertions.New(t)
+	_, closeEager, err := newTestOperationHandler(t, unmappableParams, nil)
+	defer closeEager()
+	assert.NotNil(err, "Expected eager build to fail")
+
+	handler, closeLazy, err := newTestOperationHandler(t, unmappableParams, &ServiceOptions{LazyAdapters: true})
+	defer closeLazy()
+	require.Nil(t, err, "Lazy build should be deferred")
+	for i := 0; i < 2; i++ {
+		err = handler.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+		assert.Equal(codes.Internal, errorCode(err))
+	}
+	assert.Nil(handler.(*lazyAdapter).build, "Build arguments not released")
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Concurrency limiters for backend requests.
+
+import (
+	"container/list"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Limits the number of concurrent requests. Requests over the limit wait in a queue per priority
+// class; when a slot frees, a waiting class is picked at random weighted by its configured weight, so
+// that high-weight classes are dispatched first without starving others entirely.
+type priorityLimiter struct {
+	capacity int
+	// The maximum number of waiting requests; zero means no limit.
+	maxQueue int
+	// Weights of priority classes. Classes not listed have weight 1.
+	weights map[string]int
+	// If set, called with +1 when a request starts waiting and -1 when it stops.
+	onQueueChange func(ctx context.Context, delta int64)
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// The number of requests holding a slot.
+	inFlight int
+	// The number of waiting requests.
+	queued int
+	// Waiting requests, keyed by class. Each list holds *limiterWaiter, oldest first. Lists are
+	// removed when empty.
+	queues map[string]*list.List
+	random *rand.Rand
+}
+
+// A request waiting for a slot.
+type limiterWaiter struct {
+	// Closed when the waiter is handed a slot.
+	admitted chan struct{}
+}
+
+// Returns a limiter allowing capacity concurrent requests, and up to maxQueue waiting requests.
+func newPriorityLimiter(capacity, maxQueue int, weights map[string]int) *priorityLimiter {
+	return &priorityLimiter{
+		capacity: capacity,
+		maxQueue: maxQueue,
+		weights:  weights,
+		queues:   make(map[string]*list.List),
+		random:   rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// Waits for a slot for a request in the given priority class. Returns a gRPC status error if the
+// queue is full, or the context is done first. Every successful acquire must be paired with a
+// release.
+func (l *priorityLimiter) acquire(ctx context.Context, class string) error {
+	l.mutex.Lock()
+	if l.inFlight < l.capacity {
+		l.inFlight++
+		l.mutex.Unlock()
+		return nil
+	}
+	if l.maxQueue > 0 && l.queued >= l.maxQueue {
+		l.mutex.Unlock()
+		return status.Errorf(codes.ResourceExhausted, "too many requests waiting for the backend")
+	}
+	l.queued++
+	waiter := &limiterWaiter{admitted: make(chan struct{})}
+	queue, ok := l.queues[class]
+	if !ok {
+		queue = list.New()
+		l.queues[class] = queue
+	}
+	element := queue.PushBack(waiter)
+	l.mutex.Unlock()
+	if l.onQueueChange != nil {
+		l.onQueueChange(ctx, 1)
+		defer l.onQueueChange(ctx, -1)
+	}
+
+	select {
+	case <-waiter.admitted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mutex.Lock()
+	select {
+	case <-waiter.admitted:
+		// Admitted while giving up; pass the slot on.
+		l.mutex.Unlock()
+		l.release()
+	default:
+		queue.Remove(element)
+		l.queued--
+		if queue.Len() == 0 && l.queues[class] == queue {
+			delete(l.queues, class)
+		}
+		l.mutex.Unlock()
+	}
+	return contextError(ctx)
+}
+
+// Releases a slot, handing it to a waiting request if there is one.
+func (l *priorityLimiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	class, ok := l.pickClass()
+	if !ok {
+		l.inFlight--
+		return
+	}
+	queue := l.queues[class]
+	waiter := queue.Remove(queue.Front()).(*limiterWaiter)
+	l.queued--
+	if queue.Len() == 0 {
+		delete(l.queues, class)
+	}
+	close(waiter.admitted)
+}
+
+// Picks the class to dispatch next, weighted by class weight. Returns false if nothing is waiting.
+// Must be called with the mutex held.
+func (l *priorityLimiter) pickClass() (string, bool) {
+	totalWeight := 0
+	for class := range l.queues {
+		totalWeight += l.weight(class)
+	}
+	if totalWeight == 0 {
+		return "", false
+	}
+	choice := l.random.Intn(totalWeight)
+	for class := range l.queues {
+		choice -= l.weight(class)
+		if choice < 0 {
+			return class, true
+		}
+	}
+	// Unreachable.
+	return "", false
+}
+
+// Returns the weight of a class.
+func (l *priorityLimiter) weight(class string) int {
+	if weight, ok := l.weights[class]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// Returns the priority class of a call: the class named in the configured metadata key, or else the
+// operation's configured class.
+func (p *operationAdapter) priorityClass(ctx context.Context) string {
+	if p.options.PriorityMetadataKey != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if class := firstMetadataValue(md, p.options.PriorityMetadataKey); class != "" {
+			return class
+		}
+	}
+	return p.operationOptions.PriorityClass
+}
+
+// Returns a gRPC status error for a done context.
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+	}
+	return status.Error(codes.Canceled, ctx.Err().Error())
+}
+
+// AdaptiveLimitOptions configures an adaptive concurrency limit. The limit follows a gradient
+// algorithm: it shrinks as recent backend latency rises above its long-term average, and grows while
+// latency is stable. Calls arriving while the limit is reached fail fast with Unavailable, shedding
+// load before a struggling backend is overwhelmed.
+type AdaptiveLimitOptions struct {
+	// The starting limit. Defaults to 20.
+	InitialLimit int `json:"initialLimit"`
+	// Bounds on the limit. Default to 1 and 1000.
+	MinLimit int `json:"minLimit"`
+	MaxLimit int `json:"maxLimit"`
+	// How much recent latency may exceed the long-term average before the limit shrinks, as a ratio.
+	// Defaults to 1.5.
+	Tolerance float64 `json:"tolerance"`
+	// The fraction of each new limit estimate applied, between 0 and 1. Lower values react more
+	// slowly. Defaults to 0.2.
+	Smoothing float64 `json:"smoothing"`
+}
+
+// Decay factors for latency averages; the short-term average tracks roughly the last 10 requests,
+// and the long-term average roughly the last 600.
+const (
+	shortLatencyDecay = 0.1
+	longLatencyDecay  = 1.0 / 600
+)
+
+// An adaptive concurrency limiter, using a simplified form of the gradient algorithm from Netflix's
+// concurrency-limits library.
+type adaptiveLimiter struct {
+	options AdaptiveLimitOptions
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// The current limit.
+	limit float64
+	// The number of requests in flight.
+	inFlight int
+	// Exponentially-weighted average latencies, in seconds. Zero until the first sample.
+	shortLatency float64
+	longLatency  float64
+}
+
+// Returns a limiter with the given options, with defaults filled in.
+func newAdaptiveLimiter(options AdaptiveLimitOptions) *adaptiveLimiter {
+	if options.InitialLimit <= 0 {
+		options.InitialLimit = 20
+	}
+	if options.MinLimit <= 0 {
+		options.MinLimit = 1
+	}
+	if options.MaxLimit <= 0 {
+		options.MaxLimit = 1000
+	}
+	if options.Tolerance <= 0 {
+		options.Tolerance = 1.5
+	}
+	if options.Smoothing <= 0 || options.Smoothing > 1 {
+		options.Smoothing = 0.2
+	}
+	return &adaptiveLimiter{options: options, limit: float64(options.InitialLimit)}
+}
+
+// Takes a slot if one is available under the current limit. Every successful acquire must be paired
+// with a release.
+func (l *adaptiveLimiter) tryAcquire() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if float64(l.inFlight) >= l.limit {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Releases a slot, updating the limit with the request's latency. Requests which got no response
+// from the backend shrink the limit without contributing a latency sample.
+func (l *adaptiveLimiter) release(latency time.Duration, responded bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inFlight--
+
+	var newLimit float64
+	if !responded {
+		newLimit = l.limit * 0.9
+	} else {
+		sample := latency.Seconds()
+		if l.longLatency == 0 {
+			l.shortLatency, l.longLatency = sample, sample
+		} else {
+			l.shortLatency += (sample - l.shortLatency) * shortLatencyDecay
+			l.longLatency += (sample - l.longLatency) * longLatencyDecay
+		}
+		gradient := 1.0
+		if l.shortLatency > 0 {
+			gradient = math.Max(0.5, math.Min(1.0, l.options.Tolerance*l.longLatency/l.shortLatency))
+		}
+		// Leave headroom for queueing proportional to the square root of the limit.
+		newLimit = l.limit*gradient + math.Sqrt(l.limit)
+	}
+	l.limit = l.limit*(1-l.options.Smoothing) + newLimit*l.options.Smoothing
+	l.limit = math.Max(float64(l.options.MinLimit), math.Min(float64(l.options.MaxLimit), l.limit))
+}
+
+// Releases a slot without updating the limit, for requests which say nothing of the backend's
+// capacity.
+func (l *adaptiveLimiter) abandon() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inFlight--
+}
+
+// Returns the current limit.
+func (l *adaptiveLimiter) currentLimit() float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.limit
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Waits until the limiter has the given number of waiting requests.
+func waitForQueued(t *testing.T, limiter *priorityLimiter, count int) {
+	for i := 0; i < 100; i++ {
+		limiter.mutex.Lock()
+		queued := 0
+		for _, queue := range limiter.queues {
+			queued += queue.Len()
+		}
+		limiter.mutex.Unlock()
+		if queued == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d queued requests", count)
+}
+
+// Tests that higher-weight classes are dispatched ahead of lower-weight ones.
+func TestPriorityLimiterOrdering(t *testing.T) {
+	assert := assertions.New(t)
+	limiter := newPriorityLimiter(1, 0, map[string]int{"high": 1000000})
+	limiter.random = rand.New(rand.NewSource(1))
+	assert.Nil(limiter.acquire(context.Background(), "bulk"))
+
+	admitted := make(chan string, 4)
+	for _, class := range []string{"bulk", "bulk", "bulk"} {
+		go func(class string) {
+			limiter.acquire(context.Background(), class)
+			admitted <- class
+		}(class)
+	}
+	waitForQueued(t, limiter, 3)
+	go func() {
+		limiter.acquire(context.Background(), "high")
+		admitted <- "high"
+	}()
+	waitForQueued(t, limiter, 4)
+
+	limiter.release()
+	assert.Equal("high", <-admitted, "High priority should be dispatched first")
+	for i := 0; i < 3; i++ {
+		limiter.release()
+		assert.Equal("bulk", <-admitted)
+	}
+	limiter.release()
+	assert.Equal(0, limiter.inFlight, "Slots not all released")
+}
+
+// Tests that waiting requests give up when their context is done, without leaking slots.
+func TestPriorityLimiterCancel(t *testing.T) {
+	assert := assertions.New(t)
+	limiter := newPriorityLimiter(1, 0, nil)
+	assert.Nil(limiter.acquire(context.Background(), ""))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForQueued(t, limiter, 1)
+		cancel()
+	}()
+	err := limiter.acquire(ctx, "")
+	assert.Equal(codes.Canceled, errorCode(err), "Expected cancellation")
+	assert.Equal(0, len(limiter.queues), "Cancelled waiter not removed")
+
+	limiter.release()
+	assert.Equal(0, limiter.inFlight, "Slot leaked")
+}
+
+// Tests that requests beyond the queue bound are rejected, and queue depth is reported.
+func TestPriorityLimiterMaxQueue(t *testing.T) {
+	assert := assertions.New(t)
+	limiter := newPriorityLimiter(1, 1, nil)
+	depths := make(chan int64, 2)
+	limiter.onQueueChange = func(ctx context.Context, delta int64) { depths <- delta }
+	assert.Nil(limiter.acquire(context.Background(), ""))
+
+	admitted := make(chan error)
+	go func() { admitted <- limiter.acquire(context.Background(), "") }()
+	waitForQueued(t, limiter, 1)
+	assert.Equal(int64(1), <-depths)
+
+	err := limiter.acquire(context.Background(), "")
+	assert.Equal(codes.ResourceExhausted, errorCode(err), "Expected rejection with a full queue")
+
+	limiter.release()
+	assert.Nil(<-admitted)
+	assert.Equal(int64(-1), <-depths)
+	limiter.release()
+	assert.Equal(0, limiter.inFlight, "Slots not all released")
+	assert.Equal(0, limiter.queued, "Queue count not reset")
+}
+
+// Tests that a call's priority class comes from metadata, falling back to the operation's class.
+func TestPriorityClass(t *testing.T) {
+	assert := assertions.New(t)
+	adapter := &operationAdapter{
+		operation:        &spec.Operation{},
+		options:          &ServiceOptions{PriorityMetadataKey: "X-Priority"},
+		operationOptions: &OperationOptions{PriorityClass: "bulk"},
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-priority", "interactive"))
+	assert.Equal("interactive", adapter.priorityClass(ctx))
+	assert.Equal("bulk", adapter.priorityClass(context.Background()))
+}
+
+// Tests that the adaptive limit shrinks when latency rises and sheds load at the limit.
+func TestAdaptiveLimiter(t *testing.T) {
+	assert := assertions.New(t)
+	limiter := newAdaptiveLimiter(AdaptiveLimitOptions{InitialLimit: 10, MaxLimit: 20, Smoothing: 1})
+
+	// Stable latency grows the limit to the maximum.
+	for i := 0; i < 50; i++ {
+		assert.True(limiter.tryAcquire())
+		limiter.release(10*time.Millisecond, true)
+	}
+	assert.Equal(20.0, limiter.currentLimit(), "Expected limit to grow while latency is stable")
+
+	// A latency spike shrinks it.
+	for i := 0; i < 20; i++ {
+		assert.True(limiter.tryAcquire())
+		limiter.release(time.Second, true)
+	}
+	shrunk := limiter.currentLimit()
+	assert.True(shrunk < 20, "Expected limit to shrink under high latency, got %v", shrunk)
+
+	// Calls beyond the limit are shed.
+	admitted := 0
+	for limiter.tryAcquire() {
+		admitted++
+	}
+	assert.Equal(int(math.Ceil(shrunk)), admitted, "Expected shedding at the limit")
+}
+
+// Tests that failed requests shrink the limit down to the minimum.
+func TestAdaptiveLimiterFailures(t *testing.T) {
+	limiter := newAdaptiveLimiter(AdaptiveLimitOptions{InitialLimit: 10, MinLimit: 2, Smoothing: 1})
+	for i := 0; i < 50; i++ {
+		limiter.tryAcquire()
+		limiter.release(0, false)
+	}
+	assertions.Equal(t, 2.0, limiter.currentLimit(), "Expected limit to reach the minimum")
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Parsing of backend Link headers (RFC 5988), as paginated APIs send them:
+//
+//   Link: <https://api.example.com/items?page=3>; rel="next", <...?page=1>; rel="first"
+//
+// Link targets are copied into string fields of the response message by relation type, mapped by
+// API owners with the x-swaggrpc-links operation extension:
+//
+//   x-swaggrpc-links:
+//     next: next_page_url
+//     prev: prev_page_url
+//
+// They can also be returned to callers as header metadata; see ServiceOptions.LinkMetadata. Link
+// targets are returned as written, without being resolved against the request URL.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/metadata"
+)
+
+// Name of the operation extension mapping link relation types to fields.
+const linksExtension = "x-swaggrpc-links"
+
+// Prefix of the metadata keys links are returned as, followed by the relation type.
+const linkMetadataPrefix = "link-"
+
+// A link from a Link header.
+type webLink struct {
+	target string
+	// Relation types, in lower case.
+	rels []string
+}
+
+// A link relation type copied into a field.
+type linkField struct {
+	rel   string
+	field *desc.FieldDescriptor
+}
+
+// Returns the link relation types to copy into fields of the output type, sorted by relation type.
+// Mappings in options override those in the spec; an empty field name removes a mapping.
+func resolveLinkFields(
+	operation *spec.Operation,
+	operationOptions *OperationOptions,
+	outputType *desc.MessageDescriptor,
+) ([]linkField, error) {
+	fromSpec := make(map[string]string)
+	if _, err := decodeExtension(operation.Extensions, linksExtension, &fromSpec); err != nil {
+		return nil, err
+	}
+	// Relation types are compared without regard to case.
+	mapping := make(map[string]string)
+	for rel, field := range fromSpec {
+		mapping[strings.ToLower(rel)] = field
+	}
+	for rel, field := range operationOptions.Links {
+		mapping[strings.ToLower(rel)] = field
+	}
+
+	var fields []linkField
+	for rel, fieldName := range mapping {
+		if fieldName == "" {
+			continue
+		}
+		field := outputType.FindFieldByName(fieldName)
+		if field == nil {
+			return nil, fmt.Errorf("link %s for %s maps to unknown field %q", rel, operation.ID,
+				fieldName)
+		}
+		if field.IsRepeated() || field.GetType() != descriptor.FieldDescriptorProto_TYPE_STRING {
+			return nil, fmt.Errorf("link %s for %s maps to field %q, which isn't a string", rel,
+				operation.ID, fieldName)
+		}
+		fields = append(fields, linkField{rel: rel, field: field})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].rel < fields[j].rel })
+	return fields, nil
+}
+
+// Copies the mapped links of a response into a message. The first link of each relation type is
+// used.
+func setLinkFields(msg *dynamic.Message, fields []linkField, response runtime.ClientResponse) {
+	links := parseLinks(response.GetHeader("Link"))
+	for _, mapped := range fields {
+		if target, ok := findLink(links, mapped.rel); ok {
+			msg.SetField(mapped.field, target)
+		}
+	}
+}
+
+// Returns the target of the first link with the given relation type, and whether there is one.
+func findLink(links []webLink, rel string) (string, bool) {
+	for _, link := range links {
+		for _, linkRel := range link.rels {
+			if linkRel == rel {
+				return link.target, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the targets of links as metadata, keyed by "link-" and relation type. Relation types
+// which aren't valid in metadata keys, like extension URIs, are skipped.
+func linkMetadata(links []webLink) metadata.MD {
+	md := metadata.MD{}
+	for _, link := range links {
+		for _, rel := range link.rels {
+			if key := linkMetadataPrefix + rel; isMetadataKey(key) {
+				md[key] = append(md[key], link.target)
+			}
+		}
+	}
+	return md
+}
+
+// Parses the links in a Link header value. Parsing stops at the first malformed link, returning
+// those before it.
+func parseLinks(header string) []webLink {
+	var links []webLink
+	rest := header
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" || rest[0] != '<' {
+			return links
+		}
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return links
+		}
+		link := webLink{target: strings.TrimSpace(rest[1:end])}
+		rest = rest[end+1:]
+		// Parameters follow the target, each after a semicolon, up to the comma before the next
+		// link.
+		for {
+			rest = strings.TrimLeft(rest, " \t")
+			if rest == "" || rest[0] != ';' {
+				break
+			}
+			var name, value string
+			name, value, rest = parseLinkParam(rest[1:])
+			if name == "rel" && link.rels == nil {
+				link.rels = strings.Fields(strings.ToLower(value))
+			}
+		}
+		links = append(links, link)
+		if rest != "" && rest[0] != ',' {
+			return links
+		}
+	}
+}
+
+// Parses a link parameter, like ` rel="next"`, from the start of a string. Returns the parameter's
+// name in lower case, its value, and the rest of the string.
+func parseLinkParam(text string) (string, string, string) {
+	text = strings.TrimLeft(text, " \t")
+	nameEnd := strings.IndexAny(text, "=;,")
+	if nameEnd < 0 {
+		return strings.ToLower(strings.TrimSpace(text)), "", ""
+	}
+	name := strings.ToLower(strings.TrimSpace(text[:nameEnd]))
+	if text[nameEnd] != '=' {
+		return name, "", text[nameEnd:]
+	}
+	text = strings.TrimLeft(text[nameEnd+1:], " \t")
+	if text == "" || text[0] != '"' {
+		valueEnd := strings.IndexAny(text, ";,")
+		if valueEnd < 0 {
+			return name, strings.TrimSpace(text), ""
+		}
+		return name, strings.TrimSpace(text[:valueEnd]), text[valueEnd:]
+	}
+	// A quoted string, in which backslashes escape the following character.
+	var value []byte
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if i+1 < len(text) {
+				i++
+				value = append(value, text[i])
+			}
+		case '"':
+			return name, string(value), text[i+1:]
+		default:
+			value = append(value, text[i])
+		}
+	}
+	return name, string(value), ""
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that Link headers are parsed, stopping at malformed links.
+func TestParseLinks(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		header   string
+		expected []webLink
+	}{
+		{"empty", "", nil},
+		{"single", `<https://api.example.com/items?page=2>; rel="next"`,
+			[]webLink{{"https://api.example.com/items?page=2", []string{"next"}}}},
+		{"several", `</items?page=3>; rel="next", </items?page=1>; rel=first; title="a, b"`,
+			[]webLink{{"/items?page=3", []string{"next"}}, {"/items?page=1", []string{"first"}}}},
+		{"several relation types", `</items?page=9>; REL="Last Next"`,
+			[]webLink{{"/items?page=9", []string{"last", "next"}}}},
+		{"escaped", `</a>; title="say \"hi\"; bye"; rel="prev"`, []webLink{{"/a", []string{"prev"}}}},
+		{"no relation type", `</a>; title="x"`, []webLink{{"/a", nil}}},
+		{"malformed", `</a>; rel="next", /b; rel="prev"`, []webLink{{"/a", []string{"next"}}}},
+	}
+	for _, fixture := range fixtures {
+		assertions.Equal(t, fixture.expected, parseLinks(fixture.header), "Bad links for %s", fixture.name)
+	}
+}
+
+// Tests that link mappings are merged and validated.
+func TestResolveLinkFields(t *testing.T) {
+	outputType := testMethod(t, headerServiceProto, "header_test.Things", "ListThings").GetOutputType()
+	fixtures := []struct {
+		name      string
+		extension interface{}
+		options   map[string]string
+		expected  map[string]string
+		valid     bool
+	}{
+		{"None", nil, nil, map[string]string{}, true},
+		{"Options override", map[string]interface{}{"Next": "etag", "prev": "etag"},
+			map[string]string{"prev": ""}, map[string]string{"next": "etag"}, true},
+		{"Unknown field", nil, map[string]string{"next": "missing"}, nil, false},
+		{"Not a string", nil, map[string]string{"next": "total_count"}, nil, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "listThings"}}
+			if fixture.extension != nil {
+				operation.AddExtension(linksExtension, fixture.extension)
+			}
+			fields, err := resolveLinkFields(operation, &OperationOptions{Links: fixture.options}, outputType)
+			if !fixture.valid {
+				assertions.Error(t, err)
+				return
+			}
+			require.Nil(t, err)
+			actual := make(map[string]string)
+			for _, mapped := range fields {
+				actual[mapped.rel] = mapped.field.GetName()
+			}
+			assertions.Equal(t, fixture.expected, actual)
+		})
+	}
+}
+
+// Tests that links are copied into the response and returned as metadata.
+func TestHandleGRPCRequestCopiesLinks(t *testing.T) {
+	assert := assertions.New(t)
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	operation.AddExtension(linksExtension, map[string]interface{}{"next": "name"})
+	adapter, closeServer := testOperation{operation: operation, options: &ServiceOptions{LinkMetadata: true},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Link", `</items?page=2>; rel="next", </items?page=9>; rel="last", <x>; rel="http://x/y"`)
+			w.Write([]byte(`{"itemId": "abc"}`))
+		}}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	require.Len(t, stream.sent, 1)
+	assert.Equal("/items?page=2", stream.sent[0].GetFieldByName("name"))
+	assert.Equal(metadata.MD{"link-next": {"/items?page=2"}, "link-last": {"/items?page=9"}}, stream.header)
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Translation of AIP-style list request fields (https://google.aip.dev/158 and
+// https://google.aip.dev/132) to backend pagination, sort and filter parameters.
+//
+// When a request message has a page_size, page_token, order_by or filter field, and the operation
+// has no parameter of the same name, the field is sent as the configured backend parameter, or else
+// as the first parameter the operation declares with a conventional name, like "limit" or "cursor".
+// Unset list fields are not sent, so that the backend's defaults apply. Names can be set by API
+// owners in the spec with the x-swaggrpc-list-params operation extension:
+//
+//   x-swaggrpc-list-params:
+//     pageSize: max_results
+//     pageToken: continuation
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Name of the operation extension holding list parameter names.
+const listParamsExtension = "x-swaggrpc-list-params"
+
+// ListParams names the backend parameters AIP-style list request fields are sent as. Unset names
+// are found by convention.
+type ListParams struct {
+	// The parameter for page_size.
+	PageSize string `json:"pageSize,omitempty"`
+	// The parameter for page_token.
+	PageToken string `json:"pageToken,omitempty"`
+	// The parameter for order_by.
+	OrderBy string `json:"orderBy,omitempty"`
+	// The parameter for filter.
+	Filter string `json:"filter,omitempty"`
+}
+
+// Conventional backend parameter names for each list field, in order of preference.
+var conventionalListParams = []struct {
+	field  string
+	names  []string
+	option func(*ListParams) string
+}{
+	{
+		"page_size",
+		[]string{"pageSize", "limit", "per_page", "perPage", "max_results", "maxResults", "size", "count"},
+		func(l *ListParams) string { return l.PageSize },
+	},
+	{
+		"page_token",
+		[]string{"pageToken", "cursor", "continuation_token", "continuationToken", "next", "page", "offset"},
+		func(l *ListParams) string { return l.PageToken },
+	},
+	{
+		"order_by",
+		[]string{"orderBy", "sort", "sort_by", "sortBy", "order"},
+		func(l *ListParams) string { return l.OrderBy },
+	},
+	{
+		"filter",
+		[]string{"q", "query", "search"},
+		func(l *ListParams) string { return l.Filter },
+	},
+}
+
+// Returns the proto fields sent as differently-named parameters for list options, keyed by
+// parameter name. Programmatic names override those in the spec.
+func resolveListParams(
+	operation *spec.Operation,
+	operationOptions *OperationOptions,
+	parameters map[string]*spec.Parameter,
+	inputType *desc.MessageDescriptor,
+) (map[string]string, error) {
+	configured := &ListParams{}
+	if _, err := decodeExtension(operation.Extensions, listParamsExtension, configured); err != nil {
+		return nil, err
+	}
+	if operationOptions.ListParams != nil {
+		configured.merge(operationOptions.ListParams)
+	}
+
+	fields := make(map[string]string)
+	for _, convention := range conventionalListParams {
+		if inputType.FindFieldByName(convention.field) == nil {
+			continue
+		}
+		if _, ok := parameters[convention.field]; ok {
+			// Sent under its own name.
+			continue
+		}
+		if name := convention.option(configured); name != "" {
+			if _, ok := parameters[name]; !ok {
+				return nil, fmt.Errorf("%s parameter %q for %s is not declared", convention.field, name, operation.ID)
+			}
+			fields[name] = convention.field
+			continue
+		}
+		for _, name := range convention.names {
+			_, declared := parameters[name]
+			if declared && inputType.FindFieldByName(name) == nil {
+				fields[name] = convention.field
+				break
+			}
+		}
+	}
+	return fields, nil
+}
+
+// Overrides the names in these params which are set in other.
+func (l *ListParams) merge(other *ListParams) {
+	if other.PageSize != "" {
+		l.PageSize = other.PageSize
+	}
+	if other.PageToken != "" {
+		l.PageToken = other.PageToken
+	}
+	if other.OrderBy != "" {
+		l.OrderBy = other.OrderBy
+	}
+	if other.Filter != "" {
+		l.Filter = other.Filter
+	}
+}
+
+// Returns true if a message's field has its default value.
+func hasDefaultValue(message *dynamic.Message, fieldDesc *desc.FieldDescriptor) bool {
+	return reflect.DeepEqual(message.GetField(fieldDesc), fieldDesc.GetDefaultValue())
+}
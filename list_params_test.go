@@ -0,0 +1,109 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto with an AIP-style list method.
+const listServiceProto = `
+syntax = "proto3";
+
+package list_test;
+
+message ListItemsRequest {
+  int32 page_size = 1;
+  string page_token = 2;
+  string order_by = 3;
+  string filter = 4;
+}
+
+message ListItemsResponse {
+  string next_page_token = 1;
+  repeated string items = 2;
+}
+
+service Items {
+  rpc ListItems(ListItemsRequest) returns (ListItemsResponse);
+}
+`
+
+// Parameters of the backend list operation.
+var listServiceParams = map[string]*spec.Parameter{
+	"limit":       spec.QueryParam("limit"),
+	"cursor":      spec.QueryParam("cursor"),
+	"sort":        spec.QueryParam("sort"),
+	"search_text": spec.QueryParam("search_text"),
+}
+
+// Returns the ListItems method.
+func listMethod(t *testing.T) *desc.MethodDescriptor {
+	return testMethod(t, listServiceProto, "list_test.Items", "ListItems")
+}
+
+// Tests that list fields are matched to parameters by configuration and convention.
+func TestResolveListParams(t *testing.T) {
+	assert := assertions.New(t)
+	inputType := listMethod(t).GetInputType()
+	operation := parseTestOperation(t, `{"x-swaggrpc-list-params": {"filter": "search_text", "orderBy": "nope"}}`)
+
+	fields, err := resolveListParams(operation, &OperationOptions{ListParams: &ListParams{OrderBy: "sort"}},
+		listServiceParams, inputType)
+	require.Nil(t, err, "Error resolving: %v", err)
+	assert.Equal(map[string]string{
+		"limit":       "page_size",
+		"cursor":      "page_token",
+		"sort":        "order_by",
+		"search_text": "filter",
+	}, fields)
+
+	_, err = resolveListParams(operation, &OperationOptions{}, listServiceParams, inputType)
+	assert.NotNil(err, "Expected error for undeclared parameter")
+}
+
+// Tests that list fields are sent as backend parameters, and omitted when unset.
+func TestHandleGRPCRequestListParams(t *testing.T) {
+	assert := assertions.New(t)
+	var query url.Values
+	adapter, closeServer := testOperation{
+		method: listMethod(t),
+		path:   "/items",
+		operation: parseTestOperation(t,
+			`{"operationId": "listItems", "x-swaggrpc-list-params": {"filter": "search_text"}}`),
+		parameters: listServiceParams,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		},
+	}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"pageSize": 10, "pageToken": "abc", "filter": "color=red"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.Equal(url.Values{
+		"limit":       {"10"},
+		"cursor":      {"abc"},
+		"search_text": {"color=red"},
+	}, query, "Unset order_by should be omitted")
+}
@@ -14,31 +14,139 @@
 
 package swaggrpc
 
-// Helper function & types to load an in-memory proto file.
+// Helper function & types to load in-memory proto files.
 
 import (
 	"bytes"
+	"container/list"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/protoparse"
 )
 
-// Filename used for the in-memory proto file when parsing from memory.
-const dummyFilename = "__dummy"
+// Returns the filename given to an in-memory proto file with the given SHA-256, so that files loaded
+// from different definitions have different names, as served by reflection, and reloading the same
+// definitions gives the same name.
+func loadedProtoFilename(key [sha256.Size]byte) string {
+	return fmt.Sprintf("swaggrpc/%x.proto", key[:8])
+}
+
+// The directory of the well-known type imports, such as google/protobuf/timestamp.proto.
+const wellKnownImportDir = "google/protobuf/"
+
+// The most definitions kept by each cache of loaded protos.
+const maxCachedProtos = 64
+
+// Descriptors loaded from memory, keyed by the SHA-256 of their contents, so that services loading
+// the same definitions share descriptors.
+var loadedProtos = newProtoCache(maxCachedProtos)
+
+// Sets of descriptors loaded from memory by LoadProtoFiles, keyed by the SHA-256 of their names and
+// contents.
+var loadedProtoSets = newProtoCache(maxCachedProtos)
+
+// A cache of parsed descriptors, keyed by the SHA-256 of what they were parsed from. The least
+// recently used are evicted past a limit, so that definitions replaced by spec refreshes aren't kept
+// for the life of the process. Definitions are parsed outside the cache's lock, so that loads of
+// different definitions don't wait for each other.
+type protoCache struct {
+	maxEntries int
+
+	// Guards entries and lru.
+	mutex   sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	// Cache entries, most recently used first.
+	lru *list.List
+}
+
+// A single cached definition.
+type protoCacheEntry struct {
+	key   [sha256.Size]byte
+	value interface{}
+}
+
+// Returns an empty cache holding up to maxEntries definitions.
+func newProtoCache(maxEntries int) *protoCache {
+	return &protoCache{
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Returns the cached value for a key, if there is one.
+func (c *protoCache) get(key [sha256.Size]byte) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*protoCacheEntry).value, true
+}
+
+// Caches a value for a key, unless one was cached meanwhile, evicting the least recently used past
+// the limit. Returns the cached value, so that concurrent loads of a definition share one.
+func (c *protoCache) add(key [sha256.Size]byte, value interface{}) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		return element.Value.(*protoCacheEntry).value
+	}
+	c.entries[key] = c.lru.PushFront(&protoCacheEntry{key: key, value: value})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*protoCacheEntry).key)
+	}
+	return value
+}
 
 // Loads an in-memory proto definition into a single file descriptor. Returns any error encountered.
-// Note that this will open "import"-ed files using os.Open (the default behavior of protoparse),
-// which could introduce security issues if run on arbitrary input.
+// Recently loaded definitions return the same descriptor, unless they import files from disk, which
+// may have changed. Well-known type imports are resolved to built-in copies, so they needn't be
+// installed.
+// Note that this will open other "import"-ed files using os.Open (the default behavior of
+// protoparse), which could introduce security issues if run on arbitrary input.
 func loadProtoFromBytes(contents []byte) (*desc.FileDescriptor, error) {
-	// Generate a fake wrapper for the dummy filename we'll provide.
+	key := sha256.Sum256(contents)
+	if fileDesc, ok := loadedProtos.get(key); ok {
+		return fileDesc.(*desc.FileDescriptor), nil
+	}
+	fileDesc, err := parseProtoFromBytes(loadedProtoFilename(key), contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, dependency := range fileDesc.GetDependencies() {
+		if !isWellKnownImport(dependency.GetName()) {
+			return fileDesc, nil
+		}
+	}
+	return loadedProtos.add(key, fileDesc).(*desc.FileDescriptor), nil
+}
+
+// Parses an in-memory proto definition into a single file descriptor with the given filename.
+func parseProtoFromBytes(name string, contents []byte) (*desc.FileDescriptor, error) {
+	// Generate a fake wrapper for the filename we'll provide.
 	accessor := func(filename string) (io.ReadCloser, error) {
-		if filename == dummyFilename {
+		if filename == name {
 			return ioutil.NopCloser(bytes.NewReader(contents)), nil
 		}
+		// These are never read from disk, where they are rarely installed in containers, and may not
+		// match the built-in types if they are.
+		if isWellKnownImport(filename) {
+			return nil, importNotFound(filename)
+		}
 
 		// Fallback to the default implementation.
 		return os.Open(filename)
@@ -46,7 +154,7 @@ func loadProtoFromBytes(contents []byte) (*desc.FileDescriptor, error) {
 
 	parser := protoparse.Parser{Accessor: accessor}
 
-	descs, err := parser.ParseFiles(dummyFilename)
+	descs, err := parser.ParseFiles(name)
 	if err != nil {
 		return nil, err
 	}
@@ -56,3 +164,72 @@ func loadProtoFromBytes(contents []byte) (*desc.FileDescriptor, error) {
 	}
 	return descs[0], nil
 }
+
+// LoadProtoFiles loads a set of in-memory proto files, such as the output of openapi2proto split
+// across several files, keyed by filename. Imports are resolved among the given files by name, so
+// a file importing "items/common.proto" must be given with that name; the disk is never read.
+// Well-known type imports resolve to built-in copies unless a file of the same name is given.
+// Returns the descriptors of every file, keyed by filename. Recently loaded sets of files return the
+// same descriptors.
+func LoadProtoFiles(files map[string][]byte) (map[string]*desc.FileDescriptor, error) {
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	hash := sha256.New()
+	for _, filename := range filenames {
+		fmt.Fprintf(hash, "%d:%s%d:", len(filename), filename, len(files[filename]))
+		hash.Write(files[filename])
+	}
+	var key [sha256.Size]byte
+	copy(key[:], hash.Sum(nil))
+
+	var descs map[string]*desc.FileDescriptor
+	if cached, ok := loadedProtoSets.get(key); ok {
+		descs = cached.(map[string]*desc.FileDescriptor)
+	} else {
+		parsed, err := parseProtoFiles(files, filenames)
+		if err != nil {
+			return nil, err
+		}
+		descs = loadedProtoSets.add(key, parsed).(map[string]*desc.FileDescriptor)
+	}
+	loaded := make(map[string]*desc.FileDescriptor, len(descs))
+	for filename, fileDesc := range descs {
+		loaded[filename] = fileDesc
+	}
+	return loaded, nil
+}
+
+// Parses the named in-memory proto files, resolving imports among them.
+func parseProtoFiles(files map[string][]byte, filenames []string) (map[string]*desc.FileDescriptor, error) {
+	accessor := func(filename string) (io.ReadCloser, error) {
+		if contents, ok := files[filename]; ok {
+			return ioutil.NopCloser(bytes.NewReader(contents)), nil
+		}
+		return nil, importNotFound(filename)
+	}
+	parser := protoparse.Parser{Accessor: accessor}
+	parsed, err := parser.ParseFiles(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	descs := make(map[string]*desc.FileDescriptor, len(parsed))
+	for i, fileDesc := range parsed {
+		descs[filenames[i]] = fileDesc
+	}
+	return descs, nil
+}
+
+// Returns true if filename is a well-known type import, like google/protobuf/timestamp.proto.
+func isWellKnownImport(filename string) bool {
+	return strings.HasPrefix(filename, wellKnownImportDir)
+}
+
+// Returns the error for an import which isn't available. For well-known type imports, protoparse
+// falls back to its built-in copies, built from the registered descriptors of the golang/protobuf
+// and genproto packages.
+func importNotFound(filename string) error {
+	return fmt.Errorf("%s: %v", filename, os.ErrNotExist)
+}
@@ -15,7 +15,14 @@
 package swaggrpc
 
 import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadProtoFromBytes(t *testing.T) {
@@ -48,3 +55,137 @@ service Example {
 		}
 	}
 }
+
+// Tests that loading the same definition again returns the same descriptor.
+func TestLoadProtoFromBytesShared(t *testing.T) {
+	first, err := loadProtoFromBytes([]byte(testServiceProto))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	second, err := loadProtoFromBytes([]byte(testServiceProto))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if first != second {
+		t.Error("Expected a shared descriptor")
+	}
+}
+
+// Tests that definitions loaded from memory are given distinct names, so reflection serves each.
+func TestLoadProtoFromBytesNames(t *testing.T) {
+	first, err := loadProtoFromBytes([]byte(testServiceProto))
+	require.Nil(t, err)
+	second, err := loadProtoFromBytes([]byte(`syntax = "proto3"; package other; message Other {}`))
+	require.Nil(t, err)
+	assertions.NotEqual(t, first.GetName(), second.GetName())
+	assertions.Equal(t, loadedProtoFilename(sha256.Sum256([]byte(testServiceProto))), first.GetName())
+}
+
+// Tests that the cache of loaded protos evicts the least recently used, and keeps the first value
+// added for a key.
+func TestProtoCache(t *testing.T) {
+	assert := assertions.New(t)
+	cache := newProtoCache(2)
+	keys := [][sha256.Size]byte{sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b")), sha256.Sum256([]byte("c"))}
+	assert.Equal("a", cache.add(keys[0], "a"))
+	assert.Equal("a", cache.add(keys[0], "other"), "Value replaced")
+	cache.add(keys[1], "b")
+	// Used, so b is the least recently used.
+	cache.get(keys[0])
+	cache.add(keys[2], "c")
+	_, ok := cache.get(keys[1])
+	assert.False(ok, "Least recently used not evicted")
+	value, ok := cache.get(keys[0])
+	assert.True(ok)
+	assert.Equal("a", value)
+}
+
+// Tests that a set of files importing each other loads without reading the disk.
+func TestLoadProtoFiles(t *testing.T) {
+	assert := assertions.New(t)
+	files := map[string][]byte{
+		"items/common.proto": []byte(`
+syntax = "proto3";
+package items;
+message Money {
+  string currency = 1;
+  int64 units = 2;
+}
+`),
+		"items/service.proto": []byte(`
+syntax = "proto3";
+package items;
+import "items/common.proto";
+message Item {
+  string name = 1;
+  Money price = 2;
+}
+message GetItemRequest {
+  string item_id = 1;
+}
+service Items {
+  rpc GetItem (GetItemRequest) returns (Item) {}
+}
+`),
+	}
+	descs, err := LoadProtoFiles(files)
+	require.Nil(t, err)
+	require.Len(t, descs, 2)
+	item := descs["items/service.proto"].FindMessage("items.Item")
+	if assert.NotNil(item) {
+		assert.Equal(descs["items/common.proto"].FindMessage("items.Money"),
+			item.FindFieldByName("price").GetMessageType())
+	}
+
+	again, err := LoadProtoFiles(files)
+	require.Nil(t, err)
+	assert.True(descs["items/service.proto"] == again["items/service.proto"], "Descriptors not shared")
+
+	delete(files, "items/common.proto")
+	_, err = LoadProtoFiles(files)
+	assert.Error(err, "Missing import loaded")
+}
+
+// Tests that well-known type imports resolve to built-in copies, even where the disk has others.
+func TestLoadProtoWellKnownImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swaggrpc-loader")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "google", "protobuf"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "google", "protobuf", "timestamp.proto"),
+		[]byte("not a proto"), 0644))
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	require.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	fileDesc, err := parseProtoFromBytes("events.proto", []byte(`
+syntax = "proto3";
+package events;
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/wrappers.proto";
+import "google/protobuf/field_mask.proto";
+message Event {
+  google.protobuf.Timestamp time = 1;
+  google.protobuf.StringValue note = 2;
+  google.protobuf.FieldMask mask = 3;
+}
+`))
+	require.Nil(t, err)
+	event := fileDesc.FindMessage("events.Event")
+	if assertions.NotNil(t, event) {
+		assertions.Equal(t, "google.protobuf.Timestamp",
+			event.FindFieldByName("time").GetMessageType().GetFullyQualifiedName())
+	}
+
+	descs, err := LoadProtoFiles(map[string][]byte{"events.proto": []byte(`
+syntax = "proto3";
+package events;
+import "google/protobuf/duration.proto";
+message Timer {
+  google.protobuf.Duration period = 1;
+}
+`)})
+	require.Nil(t, err)
+	assertions.NotNil(t, descs["events.proto"].FindMessage("events.Timer"))
+}
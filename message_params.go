@@ -0,0 +1,157 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Formats for repeated message fields sent as query parameters.
+//
+// By default, each message is sent as a separate JSON-encoded value of the parameter. A parameter
+// may select another format with the x-swaggrpc-message-format parameter extension, or with
+// OperationOptions.MessageParamFormats.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+)
+
+// Name of the parameter extension selecting a MessageParamFormat.
+const messageFormatExtension = "x-swaggrpc-message-format"
+
+// MessageParamFormat is how a repeated message field is sent as a query parameter.
+type MessageParamFormat string
+
+const (
+	// Each message as a separate JSON value of the parameter: "item={...}&item={...}". This is the
+	// default.
+	MessageParamJSON MessageParamFormat = "json"
+	// All messages as a single JSON array: "item=[{...},{...}]".
+	MessageParamJSONArray MessageParamFormat = "json-array"
+	// Each message field as a separate, indexed parameter: "item[0].x=1&item[0].y=2&item[1].x=3".
+	// Nested messages are named with dots, and repeated fields with indexes.
+	MessageParamIndexed MessageParamFormat = "indexed"
+	// All messages as JSON, joined by commas into a single value: "item={...},{...}".
+	MessageParamCommaJoined MessageParamFormat = "comma"
+)
+
+// Returns the format for a parameter, from options or else from the spec, or the empty string for
+// the default format. Returns an error if the format is unknown, or set for a parameter which isn't
+// a repeated message in the query.
+func resolveMessageFormat(
+	param *spec.Parameter,
+	step *paramStep,
+	operationOptions *OperationOptions,
+) (MessageParamFormat, error) {
+	format, ok := operationOptions.MessageParamFormats[param.Name]
+	if !ok {
+		var fromSpec string
+		found, err := decodeExtension(param.Extensions, messageFormatExtension, &fromSpec)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", nil
+		}
+		format = MessageParamFormat(fromSpec)
+	}
+	switch format {
+	case "", MessageParamJSON:
+		return "", nil
+	case MessageParamJSONArray, MessageParamIndexed, MessageParamCommaJoined:
+	default:
+		return "", fmt.Errorf("unknown message format %q for parameter %s", format, param.Name)
+	}
+	if !step.repeated || step.field.GetMessageType() == nil || step.location != paramInQuery {
+		return "", fmt.Errorf("message format %q for parameter %s needs a repeated message field in "+
+			"the query", format, param.Name)
+	}
+	return format, nil
+}
+
+// Writes the messages of a repeated field as this step's query parameter, in its message format.
+func (step *paramStep) writeMessages(messages []interface{}, request runtime.ClientRequest) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	encoded := make([]json.RawMessage, len(messages))
+	for i, message := range messages {
+		value, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		encoded[i] = value
+	}
+	switch step.messageFormat {
+	case MessageParamJSONArray:
+		array, err := json.Marshal(encoded)
+		if err != nil {
+			return err
+		}
+		return request.SetQueryParam(step.name, string(array))
+	case MessageParamCommaJoined:
+		values := make([]string, len(encoded))
+		for i, value := range encoded {
+			values[i] = string(value)
+		}
+		return request.SetQueryParam(step.name, strings.Join(values, ","))
+	default:
+		params := make(map[string]string)
+		for i, value := range encoded {
+			var decoded interface{}
+			decoder := json.NewDecoder(bytes.NewReader(value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&decoded); err != nil {
+				return err
+			}
+			flattenParams(fmt.Sprintf("%s[%d]", step.name, i), decoded, params)
+		}
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := request.SetQueryParam(name, params[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Adds the scalar values in a decoded JSON value to params, keyed by their path from prefix.
+func flattenParams(prefix string, value interface{}, params map[string]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			flattenParams(prefix+"."+key, nested, params)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			flattenParams(prefix+"["+strconv.Itoa(i)+"]", nested, params)
+		}
+	case string:
+		params[prefix] = value
+	case json.Number:
+		params[prefix] = value.String()
+	case bool:
+		params[prefix] = strconv.FormatBool(value)
+	}
+}
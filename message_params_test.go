@@ -0,0 +1,117 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto with a repeated message field.
+const messageParamsProto = `
+syntax = "proto3";
+
+package message_params_test;
+
+message Point {
+  int32 x = 1;
+  string label = 2;
+  repeated string tags = 3;
+  Point next = 4;
+}
+
+message Request {
+  repeated Point points = 1;
+  string name = 2;
+}
+`
+
+// Tests each format of repeated message query parameters.
+func TestMessageParamFormats(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(messageParamsProto))
+	require.Nil(t, err)
+	requestType := fileDesc.FindMessage("message_params_test.Request")
+	request := messageFromJSON(t, requestType, `{"points": [
+		{"x": 1, "label": "a,b"},
+		{"x": 2, "tags": ["t"], "next": {"x": 3}}
+	]}`)
+	fixtures := []struct {
+		format   MessageParamFormat
+		expected url.Values
+	}{
+		{MessageParamJSON, url.Values{"points": {`{"x":1,"label":"a,b"}`, `{"x":2,"tags":["t"],"next":{"x":3}}`}}},
+		{MessageParamJSONArray, url.Values{"points": {`[{"x":1,"label":"a,b"},{"x":2,"tags":["t"],"next":{"x":3}}]`}}},
+		{MessageParamCommaJoined, url.Values{"points": {`{"x":1,"label":"a,b"},{"x":2,"tags":["t"],"next":{"x":3}}`}}},
+		{MessageParamIndexed, url.Values{
+			"points[0].x":       {"1"},
+			"points[0].label":   {"a,b"},
+			"points[1].x":       {"2"},
+			"points[1].tags[0]": {"t"},
+			"points[1].next.x":  {"3"},
+		}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(string(fixture.format), func(t *testing.T) {
+			param := spec.QueryParam("points")
+			options := &OperationOptions{MessageParamFormats: map[string]MessageParamFormat{"points": fixture.format}}
+			field := requestType.FindFieldByName("points")
+			toString, err := getStringConverter(field, param)
+			require.Nil(t, err)
+			step := paramStep{name: "points", location: paramInQuery, field: field, repeated: true, toString: toString}
+			step.messageFormat, err = resolveMessageFormat(param, &step, options)
+			require.Nil(t, err)
+			plan := paramPlan{}
+			plan.add(step)
+
+			fake := newFakeClientRequest()
+			require.Nil(t, plan.write(request, fake))
+			assertions.Equal(t, fixture.expected, fake.queryParams)
+		})
+	}
+}
+
+// Tests that message formats are read from the spec, and rejected where they don't apply.
+func TestResolveMessageFormat(t *testing.T) {
+	assert := assertions.New(t)
+	fileDesc, err := loadProtoFromBytes([]byte(messageParamsProto))
+	require.Nil(t, err)
+	requestType := fileDesc.FindMessage("message_params_test.Request")
+	points := paramStep{location: paramInQuery, field: requestType.FindFieldByName("points"), repeated: true}
+
+	param := spec.QueryParam("points")
+	param.AddExtension(messageFormatExtension, "indexed")
+	format, err := resolveMessageFormat(param, &points, &OperationOptions{})
+	assert.Nil(err)
+	assert.Equal(MessageParamIndexed, format)
+	format, err = resolveMessageFormat(param, &points, &OperationOptions{
+		MessageParamFormats: map[string]MessageParamFormat{"points": MessageParamJSON},
+	})
+	assert.Nil(err)
+	assert.Equal(MessageParamFormat(""), format)
+
+	_, err = resolveMessageFormat(param, &points, &OperationOptions{
+		MessageParamFormats: map[string]MessageParamFormat{"points": "xml"},
+	})
+	assert.NotNil(err, "Expected error for unknown format")
+	name := paramStep{location: paramInQuery, field: requestType.FindFieldByName("name")}
+	_, err = resolveMessageFormat(spec.QueryParam("name"), &name, &OperationOptions{
+		MessageParamFormats: map[string]MessageParamFormat{"name": MessageParamIndexed},
+	})
+	assert.NotNil(err, "Expected error for a scalar field")
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Message size limits and measurements.
+
+import (
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SizeMetrics records the sizes of proxied messages. A CallMetrics implementation may also implement
+// this to receive message sizes. Empty messages, and those a call failed before decoding, aren't
+// recorded.
+type SizeMetrics interface {
+	// Records the size of a call's request message, in bytes, to the MetricRequestSize histogram.
+	RecordRequestSize(ctx context.Context, bytes int64, attributes CallAttributes)
+	// Records the size of a call's response message, in bytes, to the MetricResponseSize histogram.
+	RecordResponseSize(ctx context.Context, bytes int64, attributes CallAttributes)
+}
+
+// GRPCServerOptions returns options for the gRPC server, so that its message size limits match
+// MaxRequestBytes and MaxResponseBytes.
+func (o *ServiceOptions) GRPCServerOptions() []grpc.ServerOption {
+	var serverOptions []grpc.ServerOption
+	if o.MaxRequestBytes > 0 {
+		serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(o.MaxRequestBytes))
+	}
+	if o.MaxResponseBytes > 0 {
+		serverOptions = append(serverOptions, grpc.MaxSendMsgSize(o.MaxResponseBytes))
+	}
+	return serverOptions
+}
+
+// Returns true if message sizes are needed for each call.
+func (p *operationAdapter) measuresSizes() bool {
+	if p.options.UsageSink != nil || p.options.AccessLog != nil || p.options.MetricsHook != nil {
+		return true
+	}
+	_, ok := p.options.Metrics.(SizeMetrics)
+	return ok
+}
+
+// Reads a backend response body with the given Content-Encoding, failing with ResourceExhausted if
+// it is larger than MaxResponseBytes. The body is decoded by decodeResponseBody.
+func (p *operationAdapter) readResponseBody(body io.Reader, contentEncoding string) ([]byte, error) {
+	limit := p.options.MaxResponseBytes
+	if limit > 0 {
+		body = io.LimitReader(body, int64(limit)+1)
+	}
+	if p.spill != nil && !isIdentityEncoding(contentEncoding) {
+		return p.readSpilledResponseBody(body, contentEncoding)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reading backend response for %s: %v", p.operation.ID, err)
+	}
+	if limit > 0 && len(data) > limit {
+		return nil, p.responseTooLarge()
+	}
+	return p.decodeResponseBody(data, contentEncoding)
+}
+
+// Returns the error for a backend response larger than MaxResponseBytes.
+func (p *operationAdapter) responseTooLarge() error {
+	return status.Errorf(codes.ResourceExhausted,
+		"backend response for %s is larger than the limit of %d bytes", p.operation.ID, p.options.MaxResponseBytes)
+}
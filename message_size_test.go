@@ -0,0 +1,95 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// A CallMetrics implementation also recording message sizes.
+type fakeSizeMetrics struct {
+	fakeCallMetrics
+	requestSizes  []int64
+	responseSizes []int64
+}
+
+func (m *fakeSizeMetrics) RecordRequestSize(ctx context.Context, bytes int64, attributes CallAttributes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requestSizes = append(m.requestSizes, bytes)
+}
+
+func (m *fakeSizeMetrics) RecordResponseSize(ctx context.Context, bytes int64, attributes CallAttributes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.responseSizes = append(m.responseSizes, bytes)
+}
+
+// Tests that server options are only returned for set limits.
+func TestGRPCServerOptions(t *testing.T) {
+	assert := assertions.New(t)
+	assert.Empty((&ServiceOptions{}).GRPCServerOptions())
+	assert.Len((&ServiceOptions{MaxRequestBytes: 1024}).GRPCServerOptions(), 1)
+	assert.Len((&ServiceOptions{MaxRequestBytes: 1024, MaxResponseBytes: 2048}).GRPCServerOptions(), 2)
+}
+
+// Tests that message sizes are recorded by metrics implementing SizeMetrics.
+func TestHandleGRPCRequestRecordsSizes(t *testing.T) {
+	assert := assertions.New(t)
+	metrics := &fakeSizeMetrics{}
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{Metrics: metrics},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "thing"}`))
+		})
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	// Field 1, length 3, "abc".
+	assert.Equal([]int64{5}, metrics.requestSizes)
+	// Field 2, length 5, "thing".
+	assert.Equal([]int64{7}, metrics.responseSizes)
+}
+
+// Tests that backend responses larger than the limit fail with ResourceExhausted.
+func TestMaxResponseBytes(t *testing.T) {
+	fixtures := []struct {
+		name string
+		body string
+		code codes.Code
+	}{
+		{"Under limit", `{"name": "thing"}`, codes.OK},
+		{"Over limit", `{"name": "` + strings.Repeat("x", 100) + `"}`, codes.ResourceExhausted},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adapter, closeServer := newTestAdapter(t, &ServiceOptions{MaxResponseBytes: 64},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(fixture.body))
+				})
+			defer closeServer()
+
+			err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+			assertions.Equal(t, fixture.code, errorCode(err), "Bad result: %v", err)
+		})
+	}
+}
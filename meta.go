@@ -0,0 +1,279 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// The swaggrpc.Meta service, describing proxied operations to tools built on the gRPC surface.
+//
+// Descriptions carry the documentation, examples and JSON schemas from the spec. Examples and
+// schemas are JSON text.
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Definition of the swaggrpc.Meta service.
+const metaServiceProto = `
+syntax = "proto3";
+
+package swaggrpc;
+
+message DescribeOperationRequest {
+  // A full gRPC method name, like "/package.Service/Method", or a swagger operation ID.
+  string method = 1;
+}
+
+message ParameterDescription {
+  string name = 1;
+  // Where the parameter is sent: "query", "header", "path", "formData" or "body".
+  string in = 2;
+  string description = 3;
+  bool required = 4;
+  // JSON example from the parameter's x-example extension, if any.
+  string example = 5;
+}
+
+message Example {
+  string media_type = 1;
+  // The example, as JSON.
+  string value = 2;
+}
+
+message OperationDescription {
+  string operation_id = 1;
+  string full_method = 2;
+  string http_method = 3;
+  string path = 4;
+  string summary = 5;
+  string description = 6;
+  repeated string tags = 7;
+  bool deprecated = 8;
+  repeated ParameterDescription parameters = 9;
+  repeated Example request_examples = 10;
+  repeated Example response_examples = 11;
+  // JSON schemas of the request and success response bodies, if the spec has them.
+  string request_schema = 12;
+  string response_schema = 13;
+}
+
+service Meta {
+  rpc DescribeOperation(DescribeOperationRequest) returns (OperationDescription);
+}
+`
+
+// Extension holding a non-body parameter's example.
+const parameterExampleExtension = "x-example"
+
+// Name of the Meta service's only method.
+const describeOperationMethod = "DescribeOperation"
+
+// A description of an operation, in the JSON form of the OperationDescription message.
+type operationDescription struct {
+	OperationID      string                 `json:"operationId,omitempty"`
+	FullMethod       string                 `json:"fullMethod,omitempty"`
+	HTTPMethod       string                 `json:"httpMethod,omitempty"`
+	Path             string                 `json:"path,omitempty"`
+	Summary          string                 `json:"summary,omitempty"`
+	Description      string                 `json:"description,omitempty"`
+	Tags             []string               `json:"tags,omitempty"`
+	Deprecated       bool                   `json:"deprecated,omitempty"`
+	Parameters       []parameterDescription `json:"parameters,omitempty"`
+	RequestExamples  []exampleDescription   `json:"requestExamples,omitempty"`
+	ResponseExamples []exampleDescription   `json:"responseExamples,omitempty"`
+	RequestSchema    string                 `json:"requestSchema,omitempty"`
+	ResponseSchema   string                 `json:"responseSchema,omitempty"`
+}
+
+type parameterDescription struct {
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Example     string `json:"example,omitempty"`
+}
+
+type exampleDescription struct {
+	MediaType string `json:"mediaType,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// Returns the description of an operation proxied from the given gRPC method.
+func describeOperation(
+	httpMethod string,
+	swaggerPath string,
+	operation *spec.Operation,
+	parameters map[string]*spec.Parameter,
+	method *desc.MethodDescriptor,
+) *operationDescription {
+	description := &operationDescription{
+		OperationID: operation.ID,
+		FullMethod:  fullMethodName(method),
+		HTTPMethod:  httpMethod,
+		Path:        swaggerPath,
+		Summary:     operation.Summary,
+		Description: operation.Description,
+		Tags:        operation.Tags,
+		Deprecated:  operation.Deprecated,
+	}
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param := parameters[name]
+		paramDescription := parameterDescription{
+			Name:        param.Name,
+			In:          param.In,
+			Description: param.Description,
+			Required:    param.Required,
+		}
+		var example interface{}
+		if ok, _ := decodeExtension(param.Extensions, parameterExampleExtension, &example); ok {
+			paramDescription.Example = jsonText(example)
+		}
+		description.Parameters = append(description.Parameters, paramDescription)
+		if param.In == "body" && param.Schema != nil {
+			description.RequestSchema = jsonText(param.Schema)
+			if param.Schema.Example != nil {
+				description.RequestExamples = append(description.RequestExamples,
+					exampleDescription{Value: jsonText(param.Schema.Example)})
+			}
+		}
+	}
+	if response := successResponse(operation); response != nil {
+		if response.Schema != nil {
+			description.ResponseSchema = jsonText(response.Schema)
+		}
+		mediaTypes := make([]string, 0, len(response.Examples))
+		for mediaType := range response.Examples {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+		sort.Strings(mediaTypes)
+		for _, mediaType := range mediaTypes {
+			description.ResponseExamples = append(description.ResponseExamples,
+				exampleDescription{MediaType: mediaType, Value: jsonText(response.Examples[mediaType])})
+		}
+	}
+	return description
+}
+
+// Returns the operation's success response: the 2xx response with the lowest code, or else the
+// default response. Returns nil if there is neither.
+func successResponse(operation *spec.Operation) *spec.Response {
+	if operation.Responses == nil {
+		return nil
+	}
+	statusCodes := make([]int, 0, len(operation.Responses.StatusCodeResponses))
+	for code := range operation.Responses.StatusCodeResponses {
+		if code >= 200 && code < 300 {
+			statusCodes = append(statusCodes, code)
+		}
+	}
+	if len(statusCodes) > 0 {
+		sort.Ints(statusCodes)
+		response := operation.Responses.StatusCodeResponses[statusCodes[0]]
+		return &response
+	}
+	return operation.Responses.Default
+}
+
+// Returns a value as JSON text, or the empty string if it can't be encoded.
+func jsonText(value interface{}) string {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(bytes)
+}
+
+// The handler type of the Meta service.
+type metaServer interface {
+	describe(ctx context.Context, request *dynamic.Message) (*dynamic.Message, error)
+}
+
+// RegisterMetaService registers the swaggrpc.Meta service on a server, describing the operations in
+// the given registry. Its DescribeOperation method returns an operation's documentation, examples
+// and JSON schemas from the spec, for tools such as interactive clients to render.
+func RegisterMetaService(server *grpc.Server, registry *OperationRegistry) error {
+	fileDesc, err := loadProtoFromBytes([]byte(metaServiceProto))
+	if err != nil {
+		return err
+	}
+	service := fileDesc.FindService("swaggrpc.Meta")
+	method := service.FindMethodByName(describeOperationMethod)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: service.GetFullyQualifiedName(),
+		HandlerType: (*metaServer)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: describeOperationMethod,
+			Handler:    metaMethodHandler(method),
+		}},
+		Metadata: fileDesc.GetName(),
+	}, &metaService{registry: registry, method: method})
+	return nil
+}
+
+// Returns the unary handler for the DescribeOperation method.
+func metaMethodHandler(method *desc.MethodDescriptor) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, decode func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		request := dynamic.NewMessage(method.GetInputType())
+		if err := decode(request); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return srv.(metaServer).describe(ctx, request)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethodName(method)}
+		return interceptor(ctx, request, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+			return srv.(metaServer).describe(ctx, request.(*dynamic.Message))
+		})
+	}
+}
+
+// Serves the Meta service from a registry.
+type metaService struct {
+	registry *OperationRegistry
+	// The DescribeOperation method.
+	method *desc.MethodDescriptor
+}
+
+func (s *metaService) describe(ctx context.Context, request *dynamic.Message) (*dynamic.Message, error) {
+	name, _ := request.GetFieldByName("method").(string)
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "a method or operation ID is required")
+	}
+	description := s.registry.describe(name)
+	if description == nil {
+		return nil, status.Errorf(codes.NotFound, "no operation is registered for %q", name)
+	}
+	response := dynamic.NewMessage(s.method.GetOutputType())
+	bytes, err := json.Marshal(description)
+	if err == nil {
+		err = response.UnmarshalJSON(bytes)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not describe %s: %s", name, err)
+	}
+	return response, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// A documented GetItem operation.
+func documentedOperation() *spec.Operation {
+	itemSchema := new(spec.Schema).Typed("object", "").WithExample(map[string]interface{}{"name": "thing"})
+	return &spec.Operation{OperationProps: spec.OperationProps{
+		ID:          "getItem",
+		Summary:     "Gets an item",
+		Description: "Returns a single item by ID.",
+		Tags:        []string{"items"},
+		Responses: &spec.Responses{ResponsesProps: spec.ResponsesProps{StatusCodeResponses: map[int]spec.Response{
+			404: {ResponseProps: spec.ResponseProps{Description: "Not found"}},
+			200: {ResponseProps: spec.ResponseProps{
+				Schema:   itemSchema,
+				Examples: map[string]interface{}{"application/json": map[string]interface{}{"itemId": "abc"}},
+			}},
+		}}},
+	}}
+}
+
+// Returns a registry with the documented GetItem operation.
+func newDocumentedRegistry(t *testing.T) *OperationRegistry {
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+	itemID := *spec.PathParam("itemId").Typed("string", "").WithDescription("The item's ID")
+	itemID.AddExtension(parameterExampleExtension, "abc")
+	parameters := map[string]*spec.Parameter{
+		"itemId": &itemID,
+		"filter": spec.QueryParam("filter").Typed("string", ""),
+	}
+	registry := NewOperationRegistry()
+	swaggerClient := runtimeclient.New("localhost", "/", []string{"http"})
+	require.Nil(t, registry.Add(http.DefaultClient, swaggerClient, "GET", "/items/{itemId}",
+		documentedOperation(), parameters, method, nil))
+	return registry
+}
+
+// Tests that descriptions carry the spec's documentation, examples and schemas.
+func TestDescribeOperation(t *testing.T) {
+	assert := assertions.New(t)
+	registry := newDocumentedRegistry(t)
+	description := registry.describe("/test_service.Items/GetItem")
+	require.NotNil(t, description)
+	assert.Equal(description, registry.describe("getItem"), "Not found by operation ID")
+	assert.Nil(registry.describe("/test_service.Items/Missing"))
+
+	assert.Equal("getItem", description.OperationID)
+	assert.Equal("Gets an item", description.Summary)
+	assert.Equal([]string{"items"}, description.Tags)
+	assert.Equal([]parameterDescription{
+		{Name: "filter", In: "query"},
+		{Name: "itemId", In: "path", Description: "The item's ID", Required: true, Example: `"abc"`},
+	}, description.Parameters)
+	require.Len(t, description.ResponseExamples, 1)
+	assert.Equal("application/json", description.ResponseExamples[0].MediaType)
+	assert.JSONEq(`{"itemId": "abc"}`, description.ResponseExamples[0].Value)
+	assert.JSONEq(`{"type": "object", "example": {"name": "thing"}}`, description.ResponseSchema)
+}
+
+// Tests calling DescribeOperation through the Meta service's handler.
+func TestMetaServiceDescribe(t *testing.T) {
+	assert := assertions.New(t)
+	server := grpc.NewServer()
+	require.Nil(t, RegisterMetaService(server, newDocumentedRegistry(t)))
+	_, ok := server.GetServiceInfo()["swaggrpc.Meta"]
+	assert.True(ok, "Meta service not registered")
+
+	method := testMethod(t, metaServiceProto, "swaggrpc.Meta", describeOperationMethod)
+	service := &metaService{registry: newDocumentedRegistry(t), method: method}
+	call := func(request string) (interface{}, error) {
+		decode := func(m interface{}) error { return jsonpb.UnmarshalString(request, m.(*dynamic.Message)) }
+		return metaMethodHandler(method)(service, context.Background(), decode, nil)
+	}
+
+	response, err := call(`{"method": "getItem"}`)
+	require.Nil(t, err)
+	got, err := response.(*dynamic.Message).MarshalJSON()
+	require.Nil(t, err)
+	assert.Contains(string(got), `"fullMethod":"/test_service.Items/GetItem"`)
+	assert.Contains(string(got), `"summary":"Gets an item"`)
+
+	_, err = call(`{"method": "missing"}`)
+	assert.Equal(codes.NotFound, errorCode(err))
+	_, err = call(`{}`)
+	assert.Equal(codes.InvalidArgument, errorCode(err))
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Copying of the caller's gRPC metadata onto backend request headers.
+//
+// Only allowed keys are copied, since callers' metadata is otherwise passed to the backend
+// unchecked. Keys gRPC itself uses, like content-type and grpc-timeout, and binary keys are never
+// copied. Constant headers are configured with ServiceOptions.Headers.
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataHeaderOptions configures which of the caller's metadata is sent as backend request
+// headers.
+type MetadataHeaderOptions struct {
+	// Metadata keys copied to headers, like "authorization" or "x-request-id". A key ending in "*",
+	// like "x-tenant-*", allows every key with that prefix. Credential headers, like Authorization,
+	// aren't captured in dead letters.
+	Allow []string
+	// Prefixes removed from allowed keys to give header names, like "x-backend-" to send
+	// x-backend-api-key as Api-Key. Only the first matching prefix is removed.
+	StripPrefixes []string
+}
+
+// Metadata keys set by gRPC for every call, which are never copied.
+var transportMetadataKeys = map[string]bool{
+	":authority": true, "content-type": true, "user-agent": true, "te": true,
+}
+
+// Returns the headers for a call's allowed metadata, keyed by header name. Keys stripped to the same
+// name are merged in key order.
+func (o *MetadataHeaderOptions) headers(md metadata.MD) map[string][]string {
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	headers := make(map[string][]string)
+	for _, key := range keys {
+		if transportMetadataKeys[key] || strings.HasPrefix(key, "grpc-") || strings.HasSuffix(key, "-bin") ||
+			!o.allows(key) {
+			continue
+		}
+		name := key
+		for _, prefix := range o.StripPrefixes {
+			if prefix = strings.ToLower(prefix); strings.HasPrefix(name, prefix) {
+				name = name[len(prefix):]
+				break
+			}
+		}
+		if name != "" {
+			headers[name] = append(headers[name], md[key]...)
+		}
+	}
+	return headers
+}
+
+// Returns true if a metadata key is allowed.
+func (o *MetadataHeaderOptions) allows(key string) bool {
+	for _, allowed := range o.Allow {
+		allowed = strings.ToLower(allowed)
+		if strings.HasSuffix(allowed, "*") {
+			if strings.HasPrefix(key, allowed[:len(allowed)-1]) {
+				return true
+			}
+		} else if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets headers on a request from the call's allowed metadata.
+func (p *operationAdapter) writeMetadataHeaders(ctx context.Context, request runtime.ClientRequest) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range p.options.MetadataHeaders.headers(md) {
+		if err := request.SetHeaderParam(name, values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that allowed metadata is selected and named as headers.
+func TestMetadataHeaders(t *testing.T) {
+	options := &MetadataHeaderOptions{
+		Allow:         []string{"Authorization", "x-request-id", "x-backend-*", "grpc-timeout", "content-type"},
+		StripPrefixes: []string{"X-Backend-"},
+	}
+	md := metadata.MD{
+		"authorization":     {"Bearer abc"},
+		"x-request-id":      {"r1"},
+		"x-backend-tenant":  {"t1", "t2"},
+		"x-backend-":        {"empty"},
+		"x-backend-key-bin": {"binary"},
+		"x-other":           {"not allowed"},
+		"grpc-timeout":      {"1S"},
+		"content-type":      {"application/grpc"},
+	}
+	assertions.Equal(t, map[string][]string{
+		"authorization": {"Bearer abc"},
+		"x-request-id":  {"r1"},
+		"tenant":        {"t1", "t2"},
+	}, options.headers(md))
+}
+
+// Tests that metadata headers are sent with backend requests, over constant headers.
+func TestWriteMetadataHeaders(t *testing.T) {
+	var header http.Header
+	options := &ServiceOptions{
+		Headers:         map[string]string{"X-Request-Id": "constant", "X-Client": "proxy"},
+		MetadataHeaders: &MetadataHeaderOptions{Allow: []string{"x-request-id"}},
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "r1"))
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}))
+	assertions.Equal(t, []string{"r1"}, header["X-Request-Id"])
+	assertions.Equal(t, "proxy", header.Get("X-Client"))
+}
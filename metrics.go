@@ -0,0 +1,100 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Call metrics, shaped after OpenTelemetry's synchronous instruments.
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Metric names recorded through CallMetrics. These follow the OpenTelemetry semantic conventions
+// where one exists.
+const (
+	// Histogram of call durations.
+	MetricCallDuration = "rpc.server.duration"
+	// Up-down counter of calls in flight.
+	MetricActiveRequests = "rpc.server.active_requests"
+	// Counter of calls returning a non-OK status.
+	MetricCallErrors = "rpc.server.errors"
+	// Up-down counter of calls waiting for a concurrency limit.
+	MetricQueuedRequests = "swaggrpc.queued_requests"
+	// Histogram of request message sizes.
+	MetricRequestSize = "rpc.server.request.size"
+	// Histogram of response message sizes.
+	MetricResponseSize = "rpc.server.response.size"
+	// Counter of calls to deprecated operations.
+	MetricDeprecatedCalls = "swaggrpc.deprecated_calls"
+	// Gauge of the SLO burn rate of an operation.
+	MetricSLOBurnRate = "swaggrpc.slo.burn_rate"
+)
+
+// CallAttributes describe a proxied call for metrics. An OpenTelemetry bridge should map these to
+// the rpc.system ("grpc"), rpc.service, rpc.method, rpc.grpc.status_code and http.status_code
+// attributes.
+type CallAttributes struct {
+	// The fully-qualified gRPC service name.
+	Service string
+	// The gRPC method name, without the service.
+	Method string
+	// The gRPC status code the call completed with. Unset for active request counts.
+	Code codes.Code
+	// The HTTP status code of the backend response. Zero if no response was received, and for active
+	// request counts.
+	HTTPStatus int
+}
+
+// CallMetrics records measurements for proxied calls. Each method corresponds to one instrument, so
+// that an implementation backed by an OpenTelemetry metric.Meter (or any similar API) only needs to
+// create the instruments and convert attributes. Implementations must be safe for concurrent use.
+type CallMetrics interface {
+	// Adds delta to the MetricActiveRequests up-down counter.
+	AddActiveRequests(ctx context.Context, delta int64, attributes CallAttributes)
+	// Records a completed call's duration to the MetricCallDuration histogram.
+	RecordDuration(ctx context.Context, duration time.Duration, attributes CallAttributes)
+	// Adds one to the MetricCallErrors counter.
+	AddError(ctx context.Context, attributes CallAttributes)
+}
+
+// QueueMetrics records the depth of concurrency limit queues. A CallMetrics implementation may also
+// implement this to receive queue depths.
+type QueueMetrics interface {
+	// Adds delta to the MetricQueuedRequests up-down counter. For a limit shared by the whole service,
+	// the attributes' Method is empty.
+	AddQueuedRequests(ctx context.Context, delta int64, attributes CallAttributes)
+}
+
+// Returns a function recording queue depth changes with the given attributes, or nil if the
+// configured metrics don't record queue depth.
+func queueDepthRecorder(metrics CallMetrics, attributes CallAttributes) func(context.Context, int64) {
+	queueMetrics, ok := metrics.(QueueMetrics)
+	if !ok {
+		return nil
+	}
+	return func(ctx context.Context, delta int64) {
+		queueMetrics.AddQueuedRequests(ctx, delta, attributes)
+	}
+}
+
+// Returns the attributes identifying this adapter's method, with no result set.
+func (p *operationAdapter) methodAttributes() CallAttributes {
+	return CallAttributes{
+		Service: p.method.GetService().GetFullyQualifiedName(),
+		Method:  p.method.GetName(),
+	}
+}
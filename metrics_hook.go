@@ -0,0 +1,145 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Vendor-neutral hooks into the lifecycle of proxied calls.
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MetricsHook receives events for every proxied call, for telemetry pipelines of any kind.
+// CallMetrics is itself recorded through a MetricsHook. Implementations must be safe for concurrent
+// use, and should not block for long; they are called inline.
+type MetricsHook interface {
+	// OnCallStart is called when a call is received.
+	OnCallStart(ctx context.Context, event *CallStartEvent)
+	// OnBackendResponse is called for each backend response, including those which are retried.
+	OnBackendResponse(ctx context.Context, event *BackendResponseEvent)
+	// OnCallEnd is called when a call completes, successfully or not.
+	OnCallEnd(ctx context.Context, event *CallEndEvent)
+}
+
+// CallStartEvent describes a call as it is received.
+type CallStartEvent struct {
+	// The call's service and method.
+	Attributes CallAttributes
+	// When the call was received.
+	Time time.Time
+}
+
+// BackendResponseEvent describes a backend response.
+type BackendResponseEvent struct {
+	// The call's service and method, and the response's HTTP status.
+	Attributes CallAttributes
+	// The time from sending the backend request to receiving the response.
+	Latency time.Duration
+}
+
+// CallEndEvent describes a completed call.
+type CallEndEvent struct {
+	// The call's service, method and gRPC status code, and the HTTP status of the last backend
+	// response.
+	Attributes CallAttributes
+	// The time spent handling the call.
+	Duration time.Duration
+	// The encoded sizes of the request and response messages, or zero if they weren't decoded.
+	RequestBytes  int
+	ResponseBytes int
+	// The error the call returned, or nil on success.
+	Err error
+}
+
+// A MetricsHook recording to CallMetrics.
+type callMetricsHook struct {
+	metrics CallMetrics
+}
+
+func (h callMetricsHook) OnCallStart(ctx context.Context, event *CallStartEvent) {
+	h.metrics.AddActiveRequests(ctx, 1, event.Attributes)
+}
+
+func (h callMetricsHook) OnBackendResponse(ctx context.Context, event *BackendResponseEvent) {}
+
+func (h callMetricsHook) OnCallEnd(ctx context.Context, event *CallEndEvent) {
+	active := event.Attributes
+	active.Code = 0
+	active.HTTPStatus = 0
+	h.metrics.AddActiveRequests(ctx, -1, active)
+	h.metrics.RecordDuration(ctx, event.Duration, event.Attributes)
+	if event.Err != nil {
+		h.metrics.AddError(ctx, event.Attributes)
+	}
+	if sizeMetrics, ok := h.metrics.(SizeMetrics); ok {
+		if event.RequestBytes > 0 {
+			sizeMetrics.RecordRequestSize(ctx, int64(event.RequestBytes), event.Attributes)
+		}
+		if event.ResponseBytes > 0 {
+			sizeMetrics.RecordResponseSize(ctx, int64(event.ResponseBytes), event.Attributes)
+		}
+	}
+}
+
+// Returns the hooks to call for the configured metrics, or nil if there are none.
+func (o *ServiceOptions) metricsHooks() []MetricsHook {
+	var hooks []MetricsHook
+	if o.Metrics != nil {
+		hooks = append(hooks, callMetricsHook{o.Metrics})
+	}
+	if o.MetricsHook != nil {
+		hooks = append(hooks, o.MetricsHook)
+	}
+	if tracker := o.sloTracker(); tracker != nil {
+		hooks = append(hooks, tracker)
+	}
+	return hooks
+}
+
+// Calls each hook's OnCallStart for a call.
+func (p *operationAdapter) recordCallStart(call *proxiedCall) {
+	event := &CallStartEvent{Attributes: p.methodAttributes(), Time: call.startTime}
+	for _, hook := range p.metricsHooks {
+		hook.OnCallStart(call.ctx, event)
+	}
+}
+
+// Calls each hook's OnBackendResponse for a response to a call.
+func (p *operationAdapter) recordBackendResponse(call *proxiedCall) {
+	attributes := p.methodAttributes()
+	attributes.HTTPStatus = call.httpStatus
+	event := &BackendResponseEvent{Attributes: attributes, Latency: time.Since(call.backendStart)}
+	for _, hook := range p.metricsHooks {
+		hook.OnBackendResponse(call.ctx, event)
+	}
+}
+
+// Calls each hook's OnCallEnd for a call, with the error it returned.
+func (p *operationAdapter) recordCallEnd(call *proxiedCall, err error) {
+	attributes := p.methodAttributes()
+	attributes.Code = errorCode(err)
+	attributes.HTTPStatus = call.httpStatus
+	event := &CallEndEvent{
+		Attributes:    attributes,
+		Duration:      time.Since(call.startTime),
+		RequestBytes:  call.requestBytes,
+		ResponseBytes: call.responseBytes,
+		Err:           err,
+	}
+	for _, hook := range p.metricsHooks {
+		hook.OnCallEnd(call.ctx, event)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// A MetricsHook recording every event in memory.
+type fakeMetricsHook struct {
+	mutex     sync.Mutex
+	starts    []*CallStartEvent
+	responses []*BackendResponseEvent
+	ends      []*CallEndEvent
+}
+
+func (h *fakeMetricsHook) OnCallStart(ctx context.Context, event *CallStartEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.starts = append(h.starts, event)
+}
+
+func (h *fakeMetricsHook) OnBackendResponse(ctx context.Context, event *BackendResponseEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.responses = append(h.responses, event)
+}
+
+func (h *fakeMetricsHook) OnCallEnd(ctx context.Context, event *CallEndEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.ends = append(h.ends, event)
+}
+
+// Tests that a hook receives each event of a call, alongside CallMetrics.
+func TestHandleGRPCRequestCallsMetricsHook(t *testing.T) {
+	assert := assertions.New(t)
+	hook := &fakeMetricsHook{}
+	metrics := &fakeCallMetrics{}
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{Metrics: metrics, MetricsHook: hook},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "thing"}`))
+		})
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+
+	if assert.Len(hook.starts, 1) {
+		assert.Equal("GetItem", hook.starts[0].Attributes.Method)
+		assert.False(hook.starts[0].Time.IsZero(), "Start time not set")
+	}
+	if assert.Len(hook.responses, 1) {
+		assert.Equal(http.StatusOK, hook.responses[0].Attributes.HTTPStatus)
+		assert.True(hook.responses[0].Latency > 0, "Backend latency not set")
+	}
+	if assert.Len(hook.ends, 1) {
+		assert.Equal(codes.OK, hook.ends[0].Attributes.Code)
+		assert.Nil(hook.ends[0].Err)
+	}
+	assert.Len(metrics.durations, 1, "CallMetrics not recorded")
+	assert.Equal(int64(0), metrics.active, "Active requests not balanced")
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// A CallMetrics implementation that records everything in memory.
+type fakeCallMetrics struct {
+	mutex     sync.Mutex
+	active    int64
+	durations []CallAttributes
+	errors    []CallAttributes
+}
+
+func (m *fakeCallMetrics) AddActiveRequests(ctx context.Context, delta int64, attributes CallAttributes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.active += delta
+}
+
+func (m *fakeCallMetrics) RecordDuration(ctx context.Context, duration time.Duration, attributes CallAttributes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.durations = append(m.durations, attributes)
+}
+
+func (m *fakeCallMetrics) AddError(ctx context.Context, attributes CallAttributes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.errors = append(m.errors, attributes)
+}
+
+// Tests that successful and failed calls record the expected metrics.
+func TestHandleGRPCRequestRecordsMetrics(t *testing.T) {
+	fixtures := []struct {
+		name       string
+		status     int
+		body       string
+		code       codes.Code
+		errorCount int
+	}{
+		{"Success", http.StatusOK, `{"name": "thing"}`, codes.OK, 0},
+		{"Failure", http.StatusInternalServerError, `{"message": "broken"}`, codes.Internal, 1},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			metrics := &fakeCallMetrics{}
+			adapter, closeServer := newTestAdapter(t, &ServiceOptions{Metrics: metrics},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(fixture.status)
+					w.Write([]byte(fixture.body))
+				})
+			defer closeServer()
+
+			adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+
+			assert.Equal(int64(0), metrics.active, "Active requests not balanced")
+			if assert.Equal(1, len(metrics.durations), "Expected a single duration") {
+				attributes := metrics.durations[0]
+				assert.Equal("test_service.Items", attributes.Service)
+				assert.Equal("GetItem", attributes.Method)
+				assert.Equal(fixture.code, attributes.Code)
+				assert.Equal(fixture.status, attributes.HTTPStatus)
+			}
+			assert.Equal(fixture.errorCount, len(metrics.errors), "Bad error count")
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// An Authorizer querying an Open Policy Agent server.
+//
+// Policies receive an input document of this form:
+//
+//   {
+//     "caller": {"subject": "alice", "claims": {...}},
+//     "operation": {
+//       "id": "getItem",
+//       "fullMethod": "/package.Items/GetItem",
+//       "httpMethod": "GET",
+//       "pathTemplate": "/items/{itemId}",
+//       "tags": ["items"]
+//     },
+//     "request": {"itemId": "abc"}
+//   }
+//
+// "caller" is null for calls which aren't authenticated, and "request" is the request message in
+// its JSON form. For example, this Rego policy lets callers read only their own items:
+//
+//   package swaggrpc
+//
+//   default allow = false
+//
+//   allow {
+//     input.operation.id = "getItem"
+//     input.request.itemId = input.caller.subject
+//   }
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OPAOptions configures an OPAAuthorizer.
+type OPAOptions struct {
+	// URL of the boolean policy decision in OPA's data API, like
+	// "http://localhost:8181/v1/data/swaggrpc/allow".
+	DecisionURL string
+	// Client to query OPA with. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// OPAAuthorizer authorizes calls with a policy decision from an Open Policy Agent server. Calls are
+// denied if the decision is false or undefined, and fail with Unavailable if OPA can't be queried.
+type OPAAuthorizer struct {
+	options OPAOptions
+}
+
+// NewOPAAuthorizer returns an authorizer querying OPA with the given options.
+func NewOPAAuthorizer(options OPAOptions) *OPAAuthorizer {
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &OPAAuthorizer{options: options}
+}
+
+// The input document for a policy query.
+type opaInput struct {
+	Caller    *opaCaller      `json:"caller"`
+	Operation opaOperation    `json:"operation"`
+	Request   json.RawMessage `json:"request"`
+}
+
+type opaCaller struct {
+	Subject string                 `json:"subject"`
+	Claims  map[string]interface{} `json:"claims"`
+}
+
+type opaOperation struct {
+	ID           string   `json:"id"`
+	FullMethod   string   `json:"fullMethod"`
+	HTTPMethod   string   `json:"httpMethod"`
+	PathTemplate string   `json:"pathTemplate"`
+	Tags         []string `json:"tags"`
+}
+
+// Authorize queries OPA for a decision on the call.
+func (a *OPAAuthorizer) Authorize(ctx context.Context, request *AuthorizationRequest) error {
+	message, err := request.Message.MarshalJSON()
+	if err != nil {
+		return status.Errorf(codes.Internal, "could not encode request for authorization: %v", err)
+	}
+	input := opaInput{
+		Operation: opaOperation{
+			ID:           request.Operation.ID,
+			FullMethod:   request.Operation.FullMethod,
+			HTTPMethod:   request.Operation.HTTPMethod,
+			PathTemplate: request.Operation.PathTemplate,
+			Tags:         request.Operation.Tags,
+		},
+		Request: message,
+	}
+	if request.Caller != nil {
+		input.Caller = &opaCaller{Subject: request.Caller.Subject, Claims: request.Caller.Claims}
+	}
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return status.Errorf(codes.Internal, "could not encode authorization input: %v", err)
+	}
+
+	allowed, err := a.query(ctx, body)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "could not query authorization policy: %v", err)
+	}
+	if !allowed {
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed by policy", request.Operation.FullMethod)
+	}
+	return nil
+}
+
+// Posts a query to the decision URL, returning the decision.
+func (a *OPAAuthorizer) query(ctx context.Context, body []byte) (bool, error) {
+	response, err := ctxhttp.Post(ctx, a.options.HTTPClient, a.options.DecisionURL,
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HTTP status %d", response.StatusCode)
+	}
+	var decision struct {
+		// Nil if the decision is undefined.
+		Result *bool `json:"result"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&decision); err != nil {
+		return false, fmt.Errorf("decoding decision: %v", err)
+	}
+	return decision.Result != nil && *decision.Result, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests that the OPA authorizer sends the expected input, and follows the decision.
+func TestOPAAuthorizer(t *testing.T) {
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+
+	fixtures := []struct {
+		name     string
+		response string
+		status   int
+		wantCode codes.Code
+	}{
+		{"Allowed", `{"result": true}`, http.StatusOK, codes.OK},
+		{"Denied", `{"result": false}`, http.StatusOK, codes.PermissionDenied},
+		{"Undefined", `{}`, http.StatusOK, codes.PermissionDenied},
+		{"ServerError", `{}`, http.StatusInternalServerError, codes.Unavailable},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			var input struct {
+				Input opaInput `json:"input"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal("/v1/data/swaggrpc/allow", r.URL.Path)
+				assert.Nil(json.NewDecoder(r.Body).Decode(&input))
+				w.WriteHeader(fixture.status)
+				w.Write([]byte(fixture.response))
+			}))
+			defer server.Close()
+
+			msg := dynamic.NewMessage(method.GetInputType())
+			msg.SetFieldByName("itemId", "abc")
+			authorizer := NewOPAAuthorizer(OPAOptions{DecisionURL: server.URL + "/v1/data/swaggrpc/allow"})
+			err := authorizer.Authorize(context.Background(), &AuthorizationRequest{
+				Caller:    &Caller{Subject: "alice"},
+				Operation: &OperationInfo{ID: "getItem", FullMethod: "/test_service.Items/GetItem"},
+				Message:   msg,
+			})
+			assert.Equal(fixture.wantCode, errorCode(err), "Unexpected result: %v", err)
+			require.NotNil(t, input.Input.Caller, "Caller not sent")
+			assert.Equal("alice", input.Input.Caller.Subject)
+			assert.Equal("getItem", input.Input.Operation.ID)
+			assert.JSONEq(`{"itemId": "abc"}`, string(input.Input.Request))
+		})
+	}
+}
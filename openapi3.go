@@ -0,0 +1,500 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Conversion of OpenAPI 3.0 documents to the Swagger 2.0 model operations are proxied from.
+//
+// Operations are adapted from go-openapi/spec's Swagger 2.0 types throughout, and neither
+// go-openapi nor this package's dependencies read 3.0 documents. Rather than a second adapter, 3.0
+// documents are converted to the 2.0 model, which covers what the adapter supports:
+//
+//   - Each operation's requestBody becomes a body parameter, named by the x-codegen-request-body-name
+//     extension or "body", whose content types become the operation's consumes. The schema is that
+//     of the JSON content type, if there is one. Bodies with only form content types instead become
+//     a formData parameter per property of their schema.
+//   - Parameter schemas become the parameter's type, and 3.0 styles become collection formats:
+//     exploded form parameters are "multi", and simple ones "csv", for example. Styles without a
+//     2.0 equivalent, like deepObject and matrix, fail conversion.
+//   - Response content types become the operation's produces.
+//   - components/schemas become definitions, and references to them, and to components/parameters,
+//     requestBodies and responses, are resolved.
+//   - The first server's URL, with its variables' defaults, becomes the host, base path and scheme.
+//
+// Cookie parameters are kept in the "cookie" location, which has no 2.0 equivalent, and are sent by
+// the adapter in the Cookie header.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+const (
+	// The prefix of references to schemas in 3.0 and 2.0 documents.
+	openAPI3SchemaRefPrefix = "#/components/schemas/"
+	swaggerSchemaRefPrefix  = "#/definitions/"
+	// The extension naming an operation's body parameter.
+	requestBodyNameExtension = "x-codegen-request-body-name"
+	// The body parameter name used without requestBodyNameExtension.
+	defaultRequestBodyName = "body"
+)
+
+// The HTTP methods of 3.0 path items, in the order they are converted.
+var openAPI3Methods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// The parts of a 3.0 document which are converted.
+type openAPI3Document struct {
+	OpenAPI    string                                `json:"openapi"`
+	Info       *spec.Info                            `json:"info"`
+	Servers    []openAPI3Server                      `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Tags       []spec.Tag                            `json:"tags"`
+	Components struct {
+		Schemas       map[string]spec.Schema          `json:"schemas"`
+		Parameters    map[string]*openAPI3Parameter   `json:"parameters"`
+		RequestBodies map[string]*openAPI3RequestBody `json:"requestBodies"`
+		Responses     map[string]*openAPI3Response    `json:"responses"`
+		Headers       map[string]*openAPI3Parameter   `json:"headers"`
+	} `json:"components"`
+}
+
+type openAPI3Server struct {
+	URL       string `json:"url"`
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+type openAPI3Operation struct {
+	OperationID string                       `json:"operationId"`
+	Summary     string                       `json:"summary"`
+	Description string                       `json:"description"`
+	Tags        []string                     `json:"tags"`
+	Deprecated  bool                         `json:"deprecated"`
+	Parameters  []*openAPI3Parameter         `json:"parameters"`
+	RequestBody *openAPI3RequestBody         `json:"requestBody"`
+	Responses   map[string]*openAPI3Response `json:"responses"`
+}
+
+// A parameter, or a response header, which has the same fields apart from name and location.
+type openAPI3Parameter struct {
+	Ref         string                        `json:"$ref"`
+	Name        string                        `json:"name"`
+	In          string                        `json:"in"`
+	Description string                        `json:"description"`
+	Required    bool                          `json:"required"`
+	Style       string                        `json:"style"`
+	Explode     *bool                         `json:"explode"`
+	Schema      *spec.Schema                  `json:"schema"`
+	Content     map[string]*openAPI3MediaType `json:"content"`
+}
+
+type openAPI3RequestBody struct {
+	Ref         string                        `json:"$ref"`
+	Description string                        `json:"description"`
+	Required    bool                          `json:"required"`
+	Content     map[string]*openAPI3MediaType `json:"content"`
+}
+
+type openAPI3Response struct {
+	Ref         string                        `json:"$ref"`
+	Description string                        `json:"description"`
+	Headers     map[string]*openAPI3Parameter `json:"headers"`
+	Content     map[string]*openAPI3MediaType `json:"content"`
+}
+
+type openAPI3MediaType struct {
+	Schema *spec.Schema `json:"schema"`
+}
+
+// ConvertOpenAPI3 converts an OpenAPI 3.0 document, as JSON, to a Swagger 2.0 spec, whose operations
+// may then be proxied as any other. See openapi3.go for how the document is converted.
+func ConvertOpenAPI3(contents []byte) (*spec.Swagger, error) {
+	// Schema references are rewritten throughout, wherever they're nested.
+	contents = []byte(strings.Replace(string(contents), `"`+openAPI3SchemaRefPrefix, `"`+swaggerSchemaRefPrefix, -1))
+	document := &openAPI3Document{}
+	if err := json.Unmarshal(contents, document); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(document.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", document.OpenAPI)
+	}
+	swagger := &spec.Swagger{SwaggerProps: spec.SwaggerProps{
+		Swagger:     "2.0",
+		Info:        document.Info,
+		Tags:        document.Tags,
+		Definitions: spec.Definitions(document.Components.Schemas),
+		Paths:       &spec.Paths{Paths: make(map[string]spec.PathItem, len(document.Paths))},
+	}}
+	if len(document.Servers) > 0 {
+		if err := convertOpenAPI3Server(document.Servers[0], swagger); err != nil {
+			return nil, err
+		}
+	}
+	for path, item := range document.Paths {
+		pathItem, err := document.convertPathItem(item)
+		if err != nil {
+			return nil, fmt.Errorf("converting %s: %v", path, err)
+		}
+		swagger.Paths.Paths[path] = pathItem
+	}
+	return swagger, nil
+}
+
+// Sets the host, base path and scheme of a spec from a server.
+func convertOpenAPI3Server(server openAPI3Server, swagger *spec.Swagger) error {
+	serverURL := server.URL
+	for name, variable := range server.Variables {
+		serverURL = strings.Replace(serverURL, "{"+name+"}", variable.Default, -1)
+	}
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return fmt.Errorf("bad server URL %q: %v", server.URL, err)
+	}
+	swagger.Host = parsed.Host
+	swagger.BasePath = strings.TrimSuffix(parsed.Path, "/")
+	if parsed.Scheme != "" {
+		swagger.Schemes = []string{parsed.Scheme}
+	}
+	return nil
+}
+
+// Converts a path item, whose fields are kept raw so that operations are told apart from the rest.
+func (d *openAPI3Document) convertPathItem(item map[string]json.RawMessage) (spec.PathItem, error) {
+	pathItem := spec.PathItem{}
+	if raw, ok := item["parameters"]; ok {
+		var parameters []*openAPI3Parameter
+		if err := json.Unmarshal(raw, &parameters); err != nil {
+			return pathItem, err
+		}
+		for _, parameter := range parameters {
+			converted, err := d.convertParameter(parameter)
+			if err != nil {
+				return pathItem, err
+			}
+			pathItem.Parameters = append(pathItem.Parameters, *converted)
+		}
+	}
+	for _, method := range openAPI3Methods {
+		raw, ok := item[method]
+		if !ok {
+			continue
+		}
+		operation, err := d.convertOperation(raw)
+		if err != nil {
+			return pathItem, fmt.Errorf("%s: %v", strings.ToUpper(method), err)
+		}
+		switch method {
+		case "get":
+			pathItem.Get = operation
+		case "put":
+			pathItem.Put = operation
+		case "post":
+			pathItem.Post = operation
+		case "delete":
+			pathItem.Delete = operation
+		case "options":
+			pathItem.Options = operation
+		case "head":
+			pathItem.Head = operation
+		case "patch":
+			pathItem.Patch = operation
+		}
+	}
+	return pathItem, nil
+}
+
+// Converts an operation, keeping its extensions.
+func (d *openAPI3Document) convertOperation(raw json.RawMessage) (*spec.Operation, error) {
+	source := &openAPI3Operation{}
+	if err := json.Unmarshal(raw, source); err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	operation := &spec.Operation{OperationProps: spec.OperationProps{
+		ID:          source.OperationID,
+		Summary:     source.Summary,
+		Description: source.Description,
+		Tags:        source.Tags,
+		Deprecated:  source.Deprecated,
+	}}
+	for name, value := range fields {
+		if strings.HasPrefix(strings.ToLower(name), "x-") {
+			operation.AddExtension(name, value)
+		}
+	}
+	for _, parameter := range source.Parameters {
+		converted, err := d.convertParameter(parameter)
+		if err != nil {
+			return nil, err
+		}
+		operation.Parameters = append(operation.Parameters, *converted)
+	}
+	if source.RequestBody != nil {
+		parameters, consumes, err := d.convertRequestBody(source.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := fields[requestBodyNameExtension].(string); ok && name != "" &&
+			parameters[0].In == "body" {
+			parameters[0].Name = name
+		}
+		operation.Parameters = append(operation.Parameters, parameters...)
+		operation.Consumes = consumes
+	}
+	if len(source.Responses) > 0 {
+		responses, produces, err := d.convertResponses(source.Responses)
+		if err != nil {
+			return nil, err
+		}
+		operation.Responses = responses
+		operation.Produces = produces
+	}
+	return operation, nil
+}
+
+// Converts a parameter, resolving any reference to components.
+func (d *openAPI3Document) convertParameter(parameter *openAPI3Parameter) (*spec.Parameter, error) {
+	if parameter.Ref != "" {
+		resolved, ok := d.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+		if !ok {
+			return nil, fmt.Errorf("unresolved parameter reference %q", parameter.Ref)
+		}
+		parameter = resolved
+	}
+	converted := &spec.Parameter{ParamProps: spec.ParamProps{
+		Name:        parameter.Name,
+		In:          parameter.In,
+		Description: parameter.Description,
+		Required:    parameter.Required || parameter.In == "path",
+	}}
+	setSimpleSchema(&converted.SimpleSchema, &converted.CommonValidations, parameter.Schema, parameter.Content)
+	collectionFormat, err := openAPI3CollectionFormat(parameter)
+	if err != nil {
+		return nil, err
+	}
+	converted.CollectionFormat = collectionFormat
+	return converted, nil
+}
+
+// Sets the type of a parameter or header from its 3.0 schema. Parameters with content, rather than
+// a schema, are serialized values which are sent as strings.
+func setSimpleSchema(simple *spec.SimpleSchema, validations *spec.CommonValidations, schema *spec.Schema,
+	content map[string]*openAPI3MediaType) {
+	if schema == nil {
+		if len(content) > 0 {
+			simple.Type = "string"
+		}
+		return
+	}
+	if len(schema.Type) > 0 {
+		simple.Type = schema.Type[0]
+	}
+	simple.Format = schema.Format
+	simple.Default = schema.Default
+	validations.Enum = schema.Enum
+	if simple.Type == "array" && schema.Items != nil && schema.Items.Schema != nil {
+		items := spec.NewItems()
+		setSimpleSchema(&items.SimpleSchema, &items.CommonValidations, schema.Items.Schema, nil)
+		simple.Items = items
+	}
+}
+
+// Returns the 2.0 collection format equivalent to a parameter's style, or empty for the default.
+// Returns an error for styles which have no equivalent.
+func openAPI3CollectionFormat(parameter *openAPI3Parameter) (string, error) {
+	style := parameter.Style
+	if style == "" {
+		// The defaults for each location.
+		style = "simple"
+		if parameter.In == "query" || parameter.In == "cookie" {
+			style = "form"
+		}
+	}
+	switch style {
+	case "form", "simple", "spaceDelimited", "pipeDelimited":
+	default:
+		return "", fmt.Errorf("parameter %s has unsupported style %q", parameter.Name, style)
+	}
+	if parameter.Schema == nil || len(parameter.Schema.Type) == 0 || parameter.Schema.Type[0] != "array" {
+		return "", nil
+	}
+	// Form parameters are exploded by default, others aren't.
+	explode := style == "form"
+	if parameter.Explode != nil {
+		explode = *parameter.Explode
+	}
+	switch style {
+	case "form":
+		if explode {
+			return "multi", nil
+		}
+		return "csv", nil
+	case "spaceDelimited":
+		return "ssv", nil
+	case "pipeDelimited":
+		return "pipes", nil
+	default:
+		return "csv", nil
+	}
+}
+
+// Converts a request body to a body parameter, or to formData parameters if it only has form
+// content types, returning them with the media types it may be sent as.
+func (d *openAPI3Document) convertRequestBody(body *openAPI3RequestBody) ([]spec.Parameter, []string, error) {
+	if body.Ref != "" {
+		resolved, ok := d.Components.RequestBodies[strings.TrimPrefix(body.Ref, "#/components/requestBodies/")]
+		if !ok {
+			return nil, nil, fmt.Errorf("unresolved request body reference %q", body.Ref)
+		}
+		body = resolved
+	}
+	mediaTypes := sortedMediaTypes(body.Content)
+	isForm := len(mediaTypes) > 0
+	for _, mediaType := range mediaTypes {
+		if baseMediaType(mediaType) != formMediaType && baseMediaType(mediaType) != multipartMediaType {
+			isForm = false
+		}
+	}
+	if isForm {
+		parameters, err := d.convertFormBody(contentSchema(body.Content))
+		return parameters, mediaTypes, err
+	}
+	parameter := spec.BodyParam(defaultRequestBodyName, contentSchema(body.Content))
+	parameter.Description = body.Description
+	parameter.Required = body.Required
+	return []spec.Parameter{*parameter}, mediaTypes, nil
+}
+
+// Converts the schema of a form body to a formData parameter per property, sorted by name. Binary
+// properties become file parameters.
+func (d *openAPI3Document) convertFormBody(schema *spec.Schema) ([]spec.Parameter, error) {
+	if schema != nil && schema.Ref.String() != "" {
+		name := strings.TrimPrefix(schema.Ref.String(), swaggerSchemaRefPrefix)
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved schema reference %q", schema.Ref.String())
+		}
+		schema = &resolved
+	}
+	if schema == nil || len(schema.Properties) == 0 {
+		return nil, fmt.Errorf("form request body has no properties")
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	parameters := make([]spec.Parameter, 0, len(names))
+	for _, name := range names {
+		property := schema.Properties[name]
+		parameter := spec.FormDataParam(name)
+		parameter.Description = property.Description
+		parameter.Required = required[name]
+		setSimpleSchema(&parameter.SimpleSchema, &parameter.CommonValidations, &property, nil)
+		switch {
+		case parameter.Type == "string" && parameter.Format == "binary":
+			parameter.Type, parameter.Format = "file", ""
+		case parameter.Type == "object" || property.Ref.String() != "":
+			return nil, fmt.Errorf("form field %s is an object, which can't be sent as a form field", name)
+		case parameter.Type == "array":
+			parameter.CollectionFormat = "multi"
+		}
+		parameters = append(parameters, *parameter)
+	}
+	return parameters, nil
+}
+
+// Converts responses, returning them with every media type they may be received as.
+func (d *openAPI3Document) convertResponses(responses map[string]*openAPI3Response) (
+	*spec.Responses, []string, error) {
+	converted := &spec.Responses{}
+	produces := make(map[string]*openAPI3MediaType)
+	for code, response := range responses {
+		if response.Ref != "" {
+			resolved, ok := d.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+			if !ok {
+				return nil, nil, fmt.Errorf("unresolved response reference %q", response.Ref)
+			}
+			response = resolved
+		}
+		result := spec.NewResponse().WithDescription(response.Description).WithSchema(contentSchema(response.Content))
+		for name, header := range response.Headers {
+			if header.Ref != "" {
+				if header = d.Components.Headers[strings.TrimPrefix(header.Ref, "#/components/headers/")]; header == nil {
+					return nil, nil, fmt.Errorf("unresolved header reference in response %s", code)
+				}
+			}
+			convertedHeader := spec.Header{}
+			convertedHeader.Description = header.Description
+			setSimpleSchema(&convertedHeader.SimpleSchema, &convertedHeader.CommonValidations, header.Schema,
+				header.Content)
+			result.AddHeader(name, &convertedHeader)
+		}
+		for mediaType, content := range response.Content {
+			produces[mediaType] = content
+		}
+		if code == "default" {
+			converted.Default = result
+			continue
+		}
+		var status int
+		if _, err := fmt.Sscanf(code, "%d", &status); err != nil {
+			// Ranges like "2XX" have no 2.0 equivalent.
+			continue
+		}
+		if converted.StatusCodeResponses == nil {
+			converted.StatusCodeResponses = make(map[int]spec.Response)
+		}
+		converted.StatusCodeResponses[status] = *result
+	}
+	return converted, sortedMediaTypes(produces), nil
+}
+
+// Returns the schema of the JSON media type in content, or else of the first media type
+// alphabetically, or nil if there is no content.
+func contentSchema(content map[string]*openAPI3MediaType) *spec.Schema {
+	mediaTypes := sortedMediaTypes(content)
+	for _, mediaType := range mediaTypes {
+		if isJSONMediaType(mediaType) && content[mediaType] != nil {
+			return content[mediaType].Schema
+		}
+	}
+	if len(mediaTypes) > 0 && content[mediaTypes[0]] != nil {
+		return content[mediaTypes[0]].Schema
+	}
+	return nil
+}
+
+// Returns the media types of content, sorted.
+func sortedMediaTypes(content map[string]*openAPI3MediaType) []string {
+	mediaTypes := make([]string, 0, len(content))
+	for mediaType := range content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	return mediaTypes
+}
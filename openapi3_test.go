@@ -0,0 +1,209 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const widgetsOpenAPI3 = `{
+  "openapi": "3.0.1",
+  "info": {"title": "Widgets", "version": "1"},
+  "servers": [{"url": "https://{region}.widgets.example.com/v1", "variables": {"region": {"default": "us"}}}],
+  "paths": {
+    "/widgets": {
+      "parameters": [{"$ref": "#/components/parameters/Trace"}],
+      "post": {
+        "operationId": "createWidget",
+        "tags": ["widgets"],
+        "x-codegen-request-body-name": "widget",
+        "x-swaggrpc-cost-class": "write",
+        "parameters": [
+          {"name": "owner", "in": "query", "schema": {"type": "string"}},
+          {"name": "labels", "in": "query", "explode": false, "schema": {"type": "array", "items": {"type": "string"}}},
+          {"name": "session", "in": "cookie", "schema": {"type": "string"}}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/Widget"}},
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/Widget"}}
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "Created",
+            "headers": {"Location": {"schema": {"type": "string"}}},
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Widget"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Widget": {"type": "object", "properties": {"name": {"type": "string"}}},
+      "Error": {"type": "object", "properties": {"message": {"type": "string"}}}
+    },
+    "parameters": {
+      "Trace": {"name": "X-Trace", "in": "header", "schema": {"type": "array", "items": {"type": "string"}}}
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    }
+  }
+}`
+
+// Tests that a 3.0 document is converted to the equivalent 2.0 spec.
+func TestConvertOpenAPI3(t *testing.T) {
+	assert := assertions.New(t)
+	swagger, err := ConvertOpenAPI3([]byte(widgetsOpenAPI3))
+	require.Nil(t, err)
+
+	assert.Equal("2.0", swagger.Swagger)
+	assert.Equal("us.widgets.example.com", swagger.Host)
+	assert.Equal("/v1", swagger.BasePath)
+	assert.Equal([]string{"https"}, swagger.Schemes)
+	assert.Contains(swagger.Definitions, "Widget")
+
+	pathItem := swagger.Paths.Paths["/widgets"]
+	if assert.Len(pathItem.Parameters, 1) {
+		assert.Equal("X-Trace", pathItem.Parameters[0].Name)
+		assert.Equal("header", pathItem.Parameters[0].In)
+		assert.Equal("csv", pathItem.Parameters[0].CollectionFormat)
+	}
+	operation := pathItem.Post
+	require.NotNil(t, operation)
+	assert.Equal("createWidget", operation.ID)
+	assert.Equal([]string{"widgets"}, operation.Tags)
+	assert.Equal("write", operation.Extensions["x-swaggrpc-cost-class"])
+	assert.Equal([]string{"application/json", "application/x-www-form-urlencoded"}, operation.Consumes)
+	assert.Equal([]string{"application/json", "application/problem+json"}, operation.Produces)
+
+	parameters := make(map[string]spec.Parameter)
+	for _, parameter := range operation.Parameters {
+		parameters[parameter.Name] = parameter
+	}
+	assert.Equal("string", parameters["owner"].Type)
+	assert.Equal("array", parameters["labels"].Type)
+	assert.Equal("csv", parameters["labels"].CollectionFormat)
+	assert.Equal("cookie", parameters["session"].In)
+	body := parameters["widget"]
+	assert.Equal("body", body.In)
+	assert.True(body.Required)
+	if assert.NotNil(body.Schema) {
+		assert.Equal("#/definitions/Widget", body.Schema.Ref.String())
+	}
+
+	if assert.NotNil(operation.Responses) {
+		created := operation.Responses.StatusCodeResponses[201]
+		assert.Equal("Created", created.Description)
+		assert.Equal("string", created.Headers["Location"].Type)
+		if assert.NotNil(operation.Responses.Default) {
+			assert.Equal("#/definitions/Error", operation.Responses.Default.Schema.Ref.String())
+		}
+	}
+
+	_, err = ConvertOpenAPI3([]byte(`{"swagger": "2.0"}`))
+	assert.Error(err, "2.0 document converted")
+}
+
+// Tests that form request bodies become formData parameters, and that styles without a 2.0
+// equivalent fail conversion.
+func TestConvertOpenAPI3FormsAndStyles(t *testing.T) {
+	assert := assertions.New(t)
+	document := `{
+  "openapi": "3.0.0",
+  "paths": {"/uploads": {"post": {
+    "operationId": "upload",
+    "requestBody": {"content": {"multipart/form-data": {"schema": {
+      "type": "object",
+      "required": ["file"],
+      "properties": {
+        "file": {"type": "string", "format": "binary"},
+        "labels": {"type": "array", "items": {"type": "string"}},
+        "title": {"type": "string"}
+      }
+    }}}},
+    "responses": {"200": {"description": "OK"}}
+  }}}
+}`
+	swagger, err := ConvertOpenAPI3([]byte(document))
+	require.Nil(t, err)
+	operation := swagger.Paths.Paths["/uploads"].Post
+	require.Len(t, operation.Parameters, 3)
+	for i, name := range []string{"file", "labels", "title"} {
+		assert.Equal(name, operation.Parameters[i].Name)
+		assert.Equal("formData", operation.Parameters[i].In)
+	}
+	assert.Equal("file", operation.Parameters[0].Type)
+	assert.True(operation.Parameters[0].Required)
+	assert.Equal("multi", operation.Parameters[1].CollectionFormat)
+	assert.Equal([]string{"multipart/form-data"}, operation.Consumes)
+
+	for _, style := range []string{"deepObject", "matrix", "sideways"} {
+		document := `{"openapi": "3.0.0", "paths": {"/items": {"get": {
+  "parameters": [{"name": "filter", "in": "query", "style": "` + style + `", "schema": {"type": "object"}}],
+  "responses": {"200": {"description": "OK"}}
+}}}}`
+		_, err := ConvertOpenAPI3([]byte(document))
+		assert.Error(err, "Style %s converted", style)
+	}
+}
+
+// Tests that a call is proxied to an operation converted from 3.0, with its request body.
+func TestConvertOpenAPI3Proxy(t *testing.T) {
+	assert := assertions.New(t)
+	var body, owner string
+	swagger, err := ConvertOpenAPI3([]byte(widgetsOpenAPI3))
+	require.Nil(t, err)
+	operation := swagger.Paths.Paths["/widgets"].Post
+	parameters := make(map[string]*spec.Parameter)
+	for i, parameter := range operation.Parameters {
+		// The request message only has fields for these.
+		if parameter.Name == "widget" || parameter.Name == "owner" {
+			parameters[parameter.Name] = &operation.Parameters[i]
+		}
+	}
+	adapter, closeServer := testOperation{
+		method:     testMethod(t, pluginsProto, "plugins_test.Widgets", "CreateWidget"),
+		httpMethod: "POST",
+		path:       "/widgets",
+		operation:  operation,
+		parameters: parameters,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			body, owner = string(data), r.URL.Query().Get("owner")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"name": "created"}`))
+		},
+	}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"widget": {"name": "gear"}, "owner": "me"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.JSONEq(`{"name": "gear"}`, body)
+	assert.Equal("me", owner)
+	require.Len(t, stream.sent, 1)
+	assert.Equal("created", stream.sent[0].GetFieldByName("name"))
+}
@@ -6,11 +6,13 @@
 package swaggrpc
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/go-openapi/runtime"
 	runtimeclient "github.com/go-openapi/runtime/client"
@@ -23,16 +25,17 @@ import (
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-// A function to write a single parameter value from a proto message to a swagger request.
-type swaggerParamWriter func(*dynamic.Message, runtime.ClientRequest) error
-
 // Constant unmarshaller, configured to be lenient with respect to extra JSON values.
 var permissiveJSONUnmarshaler jsonpb.Unmarshaler = jsonpb.Unmarshaler{AllowUnknownFields: true}
 
-// Constant no-op AuthWriter, needed for the go-openapi client.
+// Constant no-op AuthWriter, for the go-openapi client, for operations sending no credentials.
 var nopAuthWriter runtime.ClientAuthInfoWriterFunc = func(runtime.ClientRequest, strfmt.Registry) error {
 	return nil
 }
@@ -44,17 +47,91 @@ type operationAdapter struct {
 	httpClient *http.Client
 	// The swagger client to use. This is shared among all endpoints in a swaggerService.
 	swaggerClient *runtimeclient.Runtime
+	// The schemes requests are sent with in place of the swagger client's, or nil to use its own.
+	schemes []string
+	// The apiKey security schemes requests are sent with, if any.
+	apiKeys []*apiKeyScheme
 	// The HTTP method this endpoint talks on.
 	httpMethod string
 	// Swagger path definition for this endpoint. This may contain path templates, and may not contain
 	// query strings.
 	swaggerPath string
-	// All parameter writer functions to serialize a request.
-	paramWriters []swaggerParamWriter
+	// The swagger operation this serves.
+	operation *spec.Operation
+	// The operation's parameters, keyed by name.
+	parameters map[string]*spec.Parameter
+	// Proto fields sent as differently-named list parameters, keyed by parameter name.
+	listFields map[string]string
+	// Explicitly mapped fields for parameters, keyed by parameter name.
+	paramFields map[string]string
+	// The plan for writing a request message's fields as parameters.
+	params paramPlan
 	// The proto message type this receives as input.
 	inputProtoType *desc.MessageDescriptor
 	// The proto message type this returns as output.
 	outputProtoType *desc.MessageDescriptor
+	// The gRPC method this serves.
+	method *desc.MethodDescriptor
+	// Options for the service this operation belongs to. Never nil.
+	options *ServiceOptions
+	// Options for this operation. Never nil.
+	operationOptions *OperationOptions
+	// Retry, circuit breaker and concurrency state for backend requests.
+	resilience *resilience
+	// Describes this operation to hooks, through the call context.
+	info *OperationInfo
+	// The operation's cost class for usage records.
+	costClass string
+	// The request's read mask field, or nil if it has none.
+	readMaskField *desc.FieldDescriptor
+	// Fields to page through the backend with, if every page is fetched in each call.
+	fetchAll *fetchAllFields
+	// How a server-streaming method pages through the operation, or nil if it doesn't.
+	pageStream *pageStream
+	// The User-Agent sent with every request.
+	userAgent string
+	// Constant headers sent with every request, keyed by canonical name.
+	staticHeaders map[string]string
+	// Configured query parameters sent with every request.
+	queryParams []queryParam
+	// Request fields sent as undeclared headers.
+	requestHeaders []headerField
+	// Response headers copied into response fields.
+	responseHeaders []headerField
+	// Link relation types copied into response fields, sorted by relation type.
+	linkFields []linkField
+	// Hooks receiving call events, including any for CallMetrics.
+	metricsHooks []MetricsHook
+	// The operation's deprecation, or nil if it isn't deprecated.
+	deprecation *deprecation
+	// Spilling of large response bodies to temporary files, or nil if they're held in memory.
+	spill *SpillOptions
+	// The Host header sent with every request, or empty to send the backend's host.
+	hostHeader string
+	// Hedging of backend requests, or nil if they aren't hedged.
+	hedging *HedgingOptions
+	// The networks of TrustedProxies.
+	trustedProxies []*net.IPNet
+	// Resolves the types of Any payloads in responses, or nil to use only the output type's file.
+	anyTypes *anyTypeResolver
+	// True if responses are rewritten before they're read, for values jsonpb doesn't read as written.
+	normalizeResponses bool
+	// The output field array-rooted responses are read into, or nil if the output type has none.
+	arrayField *desc.FieldDescriptor
+	// The output field scalar-rooted responses are read into, or nil if the output type has none.
+	scalarField *desc.FieldDescriptor
+	// Reads response bodies into output messages, wrapped by any plugins.
+	decodeResponse ResponseDecoder
+	// The media type request bodies are sent as.
+	bodyMediaType string
+	// The codec encoding request bodies, or nil if they're sent as JSON or forms.
+	bodyCodec BodyCodec
+	// Rewrites request JSON before it is sent, or nil if requests are sent as encoded.
+	requestTransform *jsonTransform
+	// Rewrites response JSON before it is read, or nil if responses are read as sent.
+	responseTransform *jsonTransform
+	// The envelope responses are unwrapped from, or nil if they have none.
+	envelope *responseEnvelope
 }
 
 // Construct a new endpoint from the given swagger & proto method descriptions.
@@ -63,44 +140,249 @@ func newPathWrapper(
 	swaggerClient *runtimeclient.Runtime,
 	httpMethod string,
 	swaggerPath string,
+	operation *spec.Operation,
 	parameters map[string]*spec.Parameter,
 	method *desc.MethodDescriptor,
+	options *ServiceOptions,
 ) (*operationAdapter, error) {
+	options = optionsOrDefault(options)
+	operationOptions := options.operationOptions(operation.ID)
+	if err := validatePathTemplate(swaggerPath, parameters); err != nil {
+		return nil, err
+	}
+	resilienceOptions, err := resolveResilience(options.Resilience, operation, operationOptions.Resilience)
+	if err != nil {
+		return nil, err
+	}
+	costClass, err := resolveCostClass(operation, operationOptions)
+	if err != nil {
+		return nil, err
+	}
+	deprecation, err := resolveDeprecation(operation, operationOptions)
+	if err != nil {
+		return nil, err
+	}
+	if options.Quota != nil {
+		if err := validateQuotaLimits(options.Quota.Limits); err != nil {
+			return nil, err
+		}
+		if err := validateQuotaLimits(operationOptions.QuotaLimits); err != nil {
+			return nil, err
+		}
+	}
+	if options.WrapTransport != nil {
+		httpClient = wrapClientTransport(httpClient, options.WrapTransport)
+	}
+	hostHeader := resolveHostHeader(options, operationOptions)
+	if hostHeader != "" {
+		httpClient = withHostHeader(httpClient, hostHeader)
+	}
+	// Hedging wraps the Host header, so that hedged requests are sent with the same override.
+	hedging := resolveHedging(httpMethod, options, operationOptions)
+	if hedging != nil {
+		httpClient = withHedging(httpClient, hedging)
+	}
+	// Outermost, so that every other transport sees the lengths of buffered bodies.
+	httpClient = withBufferedBodies(httpClient)
+	if len(options.Codecs) > 0 {
+		swaggerClient = withCodecConsumers(swaggerClient, options.Codecs)
+	}
+	swaggerClient = withErrorConsumers(swaggerClient)
+	schemes, err := resolveSchemes(operation, options)
+	if err != nil {
+		return nil, err
+	}
+	if schemes != nil {
+		swaggerClient = withSchemes(swaggerClient, schemes)
+	}
+	trustedProxies, err := parseTrustedProxies(options.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
 	inputProtoType := method.GetInputType()
 	newValue := &operationAdapter{
-		httpClient:      httpClient,
-		swaggerClient:   swaggerClient,
-		httpMethod:      httpMethod,
-		swaggerPath:     swaggerPath,
-		paramWriters:    make([]swaggerParamWriter, 0, len(parameters)),
-		inputProtoType:  inputProtoType,
-		outputProtoType: method.GetOutputType(),
+		httpClient:       httpClient,
+		swaggerClient:    swaggerClient,
+		schemes:          schemes,
+		apiKeys:          resolveAPIKeys(operation, options.APIKeys),
+		httpMethod:       httpMethod,
+		swaggerPath:      swaggerPath,
+		operation:        operation,
+		parameters:       parameters,
+		params:           paramPlan{steps: make([]paramStep, 0, len(parameters))},
+		inputProtoType:   inputProtoType,
+		outputProtoType:  method.GetOutputType(),
+		method:           method,
+		options:          options,
+		operationOptions: operationOptions,
+		costClass:        costClass,
+		readMaskField:    findReadMaskField(inputProtoType),
+		metricsHooks:     options.metricsHooks(),
+		userAgent:        options.userAgent(operation.ID),
+		staticHeaders:    resolveStaticHeaders(options, operationOptions),
+		queryParams:      resolveQueryParams(operationOptions),
+		deprecation:      deprecation,
+		spill:            resolveSpill(options, operationOptions),
+		hostHeader:       hostHeader,
+		hedging:          hedging,
+		trustedProxies:   trustedProxies,
+		anyTypes:         newAnyTypeResolver(options.AnyTypes, method.GetOutputType(), options.MessageFactory),
+	}
+	if operationOptions.FetchAll != nil {
+		newValue.fetchAll, err = newFetchAllFields(operationOptions.FetchAll, inputProtoType, method.GetOutputType())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if newValue.pageStream, err = resolvePageStream(operation, operationOptions, method); err != nil {
+		return nil, err
+	}
+	if newValue.responseTransform, err = resolveTransform(operation, responseTransformExtension,
+		operationOptions.ResponseTransform); err != nil {
+		return nil, err
+	}
+	if newValue.envelope, err = resolveEnvelope(operation, operationOptions); err != nil {
+		return nil, err
+	}
+	newValue.normalizeResponses = newValue.needsNormalizing()
+	newValue.arrayField = resolveArrayField(operation, method.GetOutputType())
+	newValue.scalarField = resolveScalarField(operation, method.GetOutputType())
+	if newValue.readsBinary() {
+		newValue.swaggerClient = withByteStreamConsumers(newValue.swaggerClient, operation.Produces)
+	}
+	newValue.info = newValue.operationInfo()
+	if newValue.decodeResponse, err = wrapResponseDecoder(options.Plugins, newValue.info,
+		newValue.unmarshalResponse); err != nil {
+		return nil, err
+	}
+	if formType := formMediaTypeFor(parameters); formType != "" {
+		newValue.bodyMediaType = formType
+	} else if binaryType := binaryMediaTypeFor(operation, parameters); binaryType != "" {
+		newValue.bodyMediaType = binaryType
+	} else if newValue.bodyMediaType, err = resolveBodyMediaType(operation, options, operationOptions); err != nil {
+		return nil, err
 	}
+	newValue.bodyCodec = options.codecFor(newValue.bodyMediaType)
+	if newValue.requestTransform, err = resolveTransform(operation, requestTransformExtension,
+		operationOptions.RequestTransform); err != nil {
+		return nil, err
+	}
+	baseProducer := bodyProducerFor(newValue.bodyMediaType)
+	if newValue.requestTransform != nil {
+		baseProducer = transformedBodyProducer(newValue.requestTransform, operation.ID, newValue.bodyMediaType)
+	}
+	bodyProducer, err := wrapBodyProducer(options.Plugins, newValue.info, baseProducer)
+	if err != nil {
+		return nil, err
+	}
+	newValue.resilience = newResilience(resilienceOptions, options.PriorityWeights,
+		queueDepthRecorder(options.Metrics, newValue.methodAttributes()))
+	newValue.resilience.serviceLimiter = options.sharedBackendLimiter(method.GetService().GetFullyQualifiedName())
+
+	listFields, err := resolveListParams(operation, operationOptions, parameters, inputProtoType)
+	if err != nil {
+		return nil, err
+	}
+	newValue.listFields = listFields
+	newValue.responseHeaders, err = resolveResponseHeaders(operation, operationOptions, method.GetOutputType())
+	if err != nil {
+		return nil, err
+	}
+	newValue.linkFields, err = resolveLinkFields(operation, operationOptions, method.GetOutputType())
+	if err != nil {
+		return nil, err
+	}
+
+	paramFields, err := resolveParamFields(operation, operationOptions)
+	if err != nil {
+		return nil, err
+	}
+	newValue.paramFields = paramFields
 
 	for _, param := range parameters {
-		// Look up the field for this input proto.
-		// TODO(jkinkead): Test the robustness of this.
-		fieldName := strings.Replace(param.Name, "-", "_", -1)
-		fieldDesc := inputProtoType.FindFieldByName(fieldName)
-		if fieldDesc == nil {
-			return nil, fmt.Errorf("Could not find proto field named %s", fieldName)
+		// List fields are always omitted when unset, so that the backend's defaults apply.
+		listField, isListField := listFields[param.Name]
+		var fieldPath []*desc.FieldDescriptor
+		if fieldName, ok := paramFields[param.Name]; ok {
+			if fieldPath, err = findFieldPath(inputProtoType, fieldName); err != nil {
+				return nil, fmt.Errorf("parameter %s for %s maps to unknown field %q: %s", param.Name,
+					operation.ID, fieldName, err)
+			}
+		} else if isListField {
+			fieldDesc := inputProtoType.FindFieldByName(listField)
+			if fieldDesc == nil {
+				return nil, fmt.Errorf("Could not find proto field named %s", listField)
+			}
+			fieldPath = []*desc.FieldDescriptor{fieldDesc}
+		} else if fieldPath, err = findParamField(inputProtoType, param.Name); err != nil {
+			return nil, err
 		}
+		fieldDesc := fieldPath[len(fieldPath)-1]
 
-		stringConverter, err := getStringConverter(fieldDesc, param)
-		if err != nil {
+		var stringConverter func(interface{}) string
+		var durationFormat DurationFormat
+		file := isFileParam(param)
+		binary := isBinaryBodyParam(param)
+		if file {
+			// File contents are uploaded as-is, without a string converter.
+			if err := checkFileField(param, fieldDesc); err != nil {
+				return nil, err
+			}
+		} else if binary {
+			if err := checkBinaryBodyField(param, fieldDesc); err != nil {
+				return nil, err
+			}
+		} else if converter := options.Converters.lookup(operation.ID, param.Name, fieldDesc); converter != nil {
+			stringConverter = converter
+		} else if isDurationField(fieldDesc) {
+			if durationFormat, err = resolveDurationFormat(param, operationOptions); err != nil {
+				return nil, err
+			}
+			stringConverter = durationStringConverter(fieldDesc, durationFormat)
+		} else if stringConverter, err = getStringConverter(fieldDesc, param); err != nil {
 			return nil, err
 		}
-		paramWriter, err := getParamWriter(param)
+		if !file && !binary {
+			binding := &ParamBinding{Operation: newValue.info, Param: param, Field: fieldDesc}
+			if stringConverter, err = wrapParamConverter(options.Plugins, binding, stringConverter); err != nil {
+				return nil, err
+			}
+			stringConverter = recoverConverter(param.Name, stringConverter)
+		}
+		location, err := getParamLocation(param)
 		if err != nil {
 			return nil, err
 		}
-
-		swaggerParamWriter := func(message *dynamic.Message, request runtime.ClientRequest) error {
-			stringValues := convertValues(message, fieldDesc, stringConverter)
-			return paramWriter(stringValues, request)
+		step := paramStep{
+			name:           param.Name,
+			location:       location,
+			field:          fieldDesc,
+			parents:        fieldPath[:len(fieldPath)-1],
+			repeated:       fieldDesc.IsRepeated() && !fieldDesc.IsMap(),
+			omitDefault:    isListField || omitsUnset(param, location, options),
+			toString:       stringConverter,
+			presence:       !fieldDesc.IsRepeated() && isWrapperField(fieldDesc),
+			omitEmpty:      (location == paramInQuery || location == paramInCookie) && !param.AllowEmptyValue,
+			durationFormat: durationFormat,
+			produceBody:    bodyProducer,
+			file:           file,
+			binary:         binary,
+		}
+		if step.messageFormat, err = resolveMessageFormat(param, &step, operationOptions); err != nil {
+			return nil, err
 		}
+		newValue.params.add(step)
+	}
 
-		newValue.paramWriters = append(newValue.paramWriters, swaggerParamWriter)
+	newValue.requestHeaders, err = resolveRequestHeaders(operation, operationOptions, inputProtoType)
+	if err != nil {
+		return nil, err
+	}
+	if err := newValue.params.addRequestHeaders(newValue.requestHeaders); err != nil {
+		return nil, err
+	}
+	if err := newValue.params.applyHeaderListFormats(options, operationOptions); err != nil {
+		return nil, err
 	}
 
 	return newValue, nil
@@ -138,6 +420,9 @@ func getStringConverter(fieldDesc *desc.FieldDescriptor, param *spec.Parameter)
 
 	switch fieldDesc.GetType() {
 	case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		if isWrapperField(fieldDesc) {
+			return wrapperStringConverter(fieldDesc), nil
+		}
 		// For Swagger 2.0, this should work in all cases where the parameter is a body parameter.
 		// The specification is pretty quiet on how non-primitive items should be formatted when passed
 		// as non-body parameters.
@@ -153,12 +438,12 @@ func getStringConverter(fieldDesc *desc.FieldDescriptor, param *spec.Parameter)
 			return string(bytes)
 		}, nil
 	case descriptor.FieldDescriptorProto_TYPE_BOOL,
-	  descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_UINT64,
+		descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_UINT64,
 		descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_FIXED64,
 		descriptor.FieldDescriptorProto_TYPE_FIXED32, descriptor.FieldDescriptorProto_TYPE_UINT32,
 		descriptor.FieldDescriptorProto_TYPE_SFIXED32, descriptor.FieldDescriptorProto_TYPE_SFIXED64,
 		descriptor.FieldDescriptorProto_TYPE_SINT32, descriptor.FieldDescriptorProto_TYPE_SINT64,
-	  descriptor.FieldDescriptorProto_TYPE_DOUBLE, descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		descriptor.FieldDescriptorProto_TYPE_DOUBLE, descriptor.FieldDescriptorProto_TYPE_FLOAT:
 		// %v does what we want for numeric + boolean types.
 		return func(value interface{}) string { return fmt.Sprintf("%v", value) }, nil
 	case descriptor.FieldDescriptorProto_TYPE_STRING:
@@ -167,9 +452,11 @@ func getStringConverter(fieldDesc *desc.FieldDescriptor, param *spec.Parameter)
 		// Groups are not handled; openapi2proto only generates proto3 files.
 		return nil, fmt.Errorf("got proto2-only type 'group'")
 	case descriptor.FieldDescriptorProto_TYPE_BYTES:
-		// TODO(jkinkead): openapi2proto does not currently handle bytes; both 'byte' and 'binary'
-		// formats are ignored. This is a bug, however, and we should handle bytes here.
-		return nil, fmt.Errorf("bytes not implemented")
+		// Swagger's "byte" format is base64. Parameters of the "binary" format are sent as raw bytes
+		// instead, without a converter; see binary_bodies.go.
+		return func(value interface{}) string {
+			return base64.StdEncoding.EncodeToString(value.([]byte))
+		}, nil
 	case descriptor.FieldDescriptorProto_TYPE_ENUM:
 		return func(value interface{}) string {
 			// Enums are not reliably handled. openapi2proto will treat ANY enum validator
@@ -221,61 +508,133 @@ func convertValues(
 	return stringValues
 }
 
-// Returns a function which will write the given param to a request. The param will be passed into
-// the function as an already-serialized string.
-func getParamWriter(param *spec.Parameter) (func([]string, runtime.ClientRequest) error, error) {
-	// Determine the parameter type, and return an appropriate serializer for it.
-	switch param.In {
-	case "query":
-		return func(values []string, request runtime.ClientRequest) error {
-			return request.SetQueryParam(param.Name, values...)
-		}, nil
-	case "header":
-		return func(values []string, request runtime.ClientRequest) error {
-			return request.SetHeaderParam(param.Name, values...)
-		}, nil
-	case "path":
-		// NOTE: Some swagger files have "path" parameters that are actually in the query string. This
-		// doesn't check for this case.
-		return func(values []string, request runtime.ClientRequest) error {
-			if len(values) > 1 {
-				log.Printf("WARNING: parameter %s had multple values, only one allowed!", param.Name)
-			}
-			return request.SetPathParam(param.Name, values[0])
-		}, nil
-	case "body":
-		// NOTE: This is for Swagger 2.0 only. Swagger 3.0 has the body defined elsewhere.
-		return func(values []string, request runtime.ClientRequest) error {
-			if len(values) > 1 {
-				log.Printf("WARNING: parameter %s had multple values, only one allowed!", param.Name)
-			}
-			// go-openapi expects this to be either a Reader, or something with a configured Producer.
-			return request.SetBodyParam(strings.NewReader(values[0]))
-		}, nil
-	case "formData":
-		// This is not generated by openapi2proto.
-		return nil, fmt.Errorf("formData parameters are not supported")
-	case "cookie":
-		// These are 3.0-only.
-		return nil, fmt.Errorf("swagger 3.0 cookie parameters are not supported")
-	default:
-		return nil, fmt.Errorf("ERROR: Unknown parameter location %q for parameter %q",
-			param.In, param.Name)
-	}
+// State for a single in-flight proxied call.
+type proxiedCall struct {
+	// The context of the incoming gRPC call.
+	ctx context.Context
+	// When the call was received.
+	startTime time.Time
+	// Path parameter values written to the backend request, keyed by name.
+	pathParams map[string]string
+	// When the latest backend request was sent.
+	backendStart time.Time
+	// The HTTP status code of the backend response, or 0 if none was received.
+	httpStatus int
+	// The Location of a created resource to return, from the backend response.
+	location string
+	// Sizes of the request and response messages, if measured.
+	requestBytes  int
+	responseBytes int
+	// The latest backend request written, if captured for dead letters.
+	captured *capturedRequest
+	// The backend session token sent with the latest backend request, if any.
+	sessionToken string
+	// Query parameters for the page being fetched, if streaming pages.
+	pageQuery map[string]string
+	// Metadata for the caller from backend response envelopes.
+	responseMetadata metadata.MD
+	// Header and trailer metadata for the caller from the latest backend response's headers.
+	backendHeader  metadata.MD
+	backendTrailer metadata.MD
+}
+
+// A runtime.ClientRequest wrapper that records the parameters written through it on a call.
+type recordingRequest struct {
+	runtime.ClientRequest
+	call *proxiedCall
+}
+
+func (r recordingRequest) SetPathParam(name string, value string) error {
+	r.call.pathParams[name] = value
+	return r.ClientRequest.SetPathParam(name, value)
 }
 
 // Returns a serializer function for the given message. This is used to send a request through the
 // openapi-go library.
-func (p *operationAdapter) getRequestWriter(msg *dynamic.Message) runtime.ClientRequestWriterFunc {
+func (p *operationAdapter) getRequestWriter(msg *dynamic.Message, call *proxiedCall) runtime.ClientRequestWriterFunc {
 	return func(request runtime.ClientRequest, format strfmt.Registry) error {
-		for _, writer := range p.paramWriters {
-			err := writer(msg, request)
-			if err != nil {
+		call.backendStart = time.Now()
+		if p.options.DeadLetters != nil {
+			call.startCapture()
+		}
+		request = recordingRequest{ClientRequest: request, call: call}
+		// Written first, so that parameters from the request take precedence.
+		if err := p.writeCallHeaders(call, request); err != nil {
+			return err
+		}
+		if p.options.ConditionalRequests {
+			if err := writeConditionalHeaders(call.ctx, request); err != nil {
 				return err
 			}
 		}
-		return nil
+		if err := p.writeQueryParams(call.ctx, request); err != nil {
+			return err
+		}
+		var produceBody BodyProducer
+		if p.bodyCodec != nil {
+			produceBody = p.codecBodyProducer(p.bodyCodec, call, msg, request)
+		}
+		if err := p.params.writeWithBody(msg, request, produceBody); err != nil {
+			return err
+		}
+		if err := writePageQuery(call, request); err != nil {
+			return err
+		}
+		return p.writeCallContext(call, request)
+	}
+}
+
+// Writes the headers sent with every backend request for a call: the static headers, and those
+// copied from the caller's metadata.
+func (p *operationAdapter) writeCallHeaders(call *proxiedCall, request runtime.ClientRequest) error {
+	if err := p.writeStaticHeaders(request); err != nil {
+		return err
+	}
+	if p.options.MetadataHeaders != nil {
+		return p.writeMetadataHeaders(call.ctx, request)
+	}
+	return nil
+}
+
+// Writes the call's context to a backend request: its trace context, and the client's address.
+func (p *operationAdapter) writeCallContext(call *proxiedCall, request runtime.ClientRequest) error {
+	if p.options.Propagator != nil {
+		if err := p.propagateTraceContext(call.ctx, request); err != nil {
+			return err
+		}
 	}
+	if p.options.ForwardClientAddress {
+		return forwardClientAddress(call.ctx, request, p.trustedProxies)
+	}
+	return nil
+}
+
+// Returns the writer of a call's backend credentials: the session token and API keys. These are
+// written apart from the request writer so that they're never captured in dead letters. They're
+// written first, so headers of the same name from the request writer replace them. Returns
+// Unauthenticated if an API key is missing.
+func (p *operationAdapter) getAuthInfoWriter(call *proxiedCall) (runtime.ClientAuthInfoWriter, error) {
+	keys, err := p.apiKeyValues(call.ctx)
+	if err != nil {
+		return nil, err
+	}
+	session := p.options.backendSession()
+	if session == nil && len(keys) == 0 {
+		return nopAuthWriter, nil
+	}
+	return runtime.ClientAuthInfoWriterFunc(func(request runtime.ClientRequest, _ strfmt.Registry) error {
+		if session != nil {
+			if err := session.writeToken(call, request); err != nil {
+				return err
+			}
+		}
+		return p.writeAPIKeys(request, keys)
+	}), nil
+}
+
+// Returns a new empty message of the given type, created by the configured factory.
+func (p *operationAdapter) newMessage(messageType *desc.MessageDescriptor) *dynamic.Message {
+	return dynamic.NewMessageWithMessageFactory(messageType, p.options.MessageFactory)
 }
 
 // The deserializer function for this endpoint. This implements runtime.ClientResponseReader.
@@ -283,40 +642,188 @@ func (p *operationAdapter) ReadResponse(
 	response runtime.ClientResponse,
 	consumer runtime.Consumer) (interface{}, error) {
 
-	protoOut := dynamic.NewMessage(p.outputProtoType)
+	return p.readJSONResponse(response, &proxiedCall{})
+}
+
+// Reads a JSON response into a message of the output type, recording any envelope metadata on the
+// call.
+func (p *operationAdapter) readJSONResponse(response runtime.ClientResponse, call *proxiedCall) (interface{}, error) {
+	protoOut := p.newMessage(p.outputProtoType)
 
-	err := permissiveJSONUnmarshaler.Unmarshal(response.Body(), protoOut)
+	body, err := p.readResponseBody(response.Body(), response.GetHeader("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkResponseDepth(body); err != nil {
+		return nil, err
+	}
+	if p.envelope != nil {
+		if body, err = p.unwrapResponse(body, call); err != nil {
+			return nil, err
+		}
+	}
+	err = p.decodeResponse(body, protoOut)
 	return protoOut, err
 }
 
+// Returns a deserializer for a single call, which records response details on the call before
+// delegating to ReadResponse.
+func (p *operationAdapter) getResponseReader(call *proxiedCall) runtime.ClientResponseReaderFunc {
+	return func(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+		call.httpStatus = response.Code()
+		if p.options.ResponseMetadata != nil || p.options.LinkMetadata {
+			p.recordResponseMetadata(call, response)
+		}
+		if call.httpStatus == http.StatusUnauthorized && call.sessionToken != "" {
+			p.options.backendSession().invalidate(call.sessionToken)
+		}
+		if len(p.metricsHooks) > 0 {
+			p.recordBackendResponse(call)
+		}
+		// The created resource is fetched once the call's backend request completes.
+		if call.location = p.locationToFollow(response); call.location != "" {
+			return p.newMessage(p.outputProtoType), nil
+		}
+		if isErrorResponse(response) {
+			return nil, p.responseError(response)
+		}
+		if p.pageStream != nil {
+			return p.readPage(response)
+		}
+		if call.httpStatus == http.StatusNotModified {
+			call.responseMetadata = metadata.Join(call.responseMetadata, notModifiedMetadata(response))
+			return p.newMessage(p.outputProtoType), nil
+		}
+		var result interface{}
+		var err error
+		if codec := p.options.codecFor(response.GetHeader("Content-Type")); codec != nil {
+			result, err = p.readCodecResponse(codec, call, response)
+		} else if p.readsBinary() && !isJSONMediaType(response.GetHeader("Content-Type")) {
+			result, err = p.readBinaryResponse(response)
+		} else {
+			result, err = p.readJSONResponse(response, call)
+		}
+		if err == nil && len(p.responseHeaders) > 0 {
+			setHeaderFields(result.(*dynamic.Message), p.responseHeaders, response)
+		}
+		if err == nil && len(p.linkFields) > 0 {
+			setLinkFields(result.(*dynamic.Message), p.linkFields, response)
+		}
+		return result, err
+	}
+}
+
 // Handles a single gRPC call by proxying to the underlying swagger service.
 // Returns any error encountered.
-func (p *operationAdapter) handleGRPCRequest(stream grpc.ServerStream) error {
-	protoIn := dynamic.NewMessage(p.inputProtoType)
-	err := stream.RecvMsg(protoIn)
+func (p *operationAdapter) handleGRPCRequest(stream grpc.ServerStream) (err error) {
+	if p.options.AcceptJSON {
+		stream = newJSONAwareStream(stream)
+	}
+	call := &proxiedCall{
+		ctx:        withOperationInfo(stream.Context(), p.info),
+		startTime:  time.Now(),
+		pathParams: make(map[string]string),
+	}
+	if p.options.AuditSink != nil {
+		defer func() { p.audit(call, err) }()
+	}
+	if p.options.UsageSink != nil {
+		defer func() { p.recordUsage(call, err) }()
+	}
+	if p.options.AccessLog != nil {
+		defer func() { p.logAccess(call, err) }()
+	}
+	if len(p.metricsHooks) > 0 {
+		p.recordCallStart(call)
+		defer func() { p.recordCallEnd(call, err) }()
+	}
+	// Deferred after the hooks above, so that they see the error a panic is recovered as.
+	defer p.recoverPanic(call, &err)
+	if p.deprecation != nil {
+		if err = p.checkDeprecation(call.ctx, stream); err != nil {
+			return err
+		}
+	}
+	if p.options.Authenticator != nil {
+		call.ctx, err = p.authenticate(call.ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	protoIn := p.newMessage(p.inputProtoType)
+	err = stream.RecvMsg(protoIn)
 	if err != nil {
 		log.Printf("Error deserializing request: %s", err)
 		return err
 	}
+	if p.options.DeadLetters != nil {
+		defer func() { p.deadLetter(call, protoIn, err) }()
+	}
+	if p.measuresSizes() {
+		call.requestBytes = messageSize(protoIn)
+	}
+	if p.options.Authorizer != nil {
+		if err = p.authorize(call.ctx, protoIn); err != nil {
+			return err
+		}
+	}
+	if p.options.Quota != nil {
+		if err = p.checkQuota(call.ctx); err != nil {
+			return err
+		}
+	}
 
+	// Backend requests are abandoned once the call's deadline passes or it's cancelled. Calls without
+	// a deadline are limited to the swagger client's default request timeout, across all attempts, or
+	// for page streams, each page's.
+	if _, ok := call.ctx.Deadline(); !ok && p.pageStream == nil {
+		var cancel context.CancelFunc
+		call.ctx, cancel = context.WithTimeout(call.ctx, runtimeclient.DefaultTimeout)
+		defer cancel()
+	}
+	authInfo, err := p.getAuthInfoWriter(call)
+	if err != nil {
+		return err
+	}
 	operation := runtime.ClientOperation{
 		// This appears to be ignored client-side.
-		ID:          "",
-		Method:      p.httpMethod,
-		PathPattern: p.swaggerPath,
-		// TODO(jkinkead): Fix these two - they should be determinable from the spec.
-		ConsumesMediaTypes: []string{"application/json"},
+		ID:                 "",
+		Method:             p.httpMethod,
+		PathPattern:        p.swaggerPath,
+		ConsumesMediaTypes: []string{p.bodyMediaType},
+		// TODO(jkinkead): Fix this - it should be determinable from the spec.
 		ProducesMediaTypes: []string{"application/json"},
-		// TODO(jkinkead): Fix this. It should be in the spec.
-		Schemes:  []string{"http"},
-		Params:   p.getRequestWriter(protoIn),
-		Reader:   p,
-		AuthInfo: nopAuthWriter,
-		Context:  nil,
+		// Overridden by the swagger client's own schemes, if it has any.
+		Schemes:  p.schemes,
+		Params:   p.getRequestWriter(protoIn, call),
+		Reader:   p.getResponseReader(call),
+		AuthInfo: authInfo,
+		Context:  call.ctx,
 		Client:   p.httpClient,
 	}
 
-	result, err := p.swaggerClient.Submit(&operation)
+	if p.pageStream != nil {
+		if err = p.streamPages(call, &operation, stream); err != nil && call.ctx.Err() != nil {
+			err = contextError(call.ctx)
+		}
+		return err
+	}
+	var result interface{}
+	if p.fetchAll != nil {
+		result, err = p.submitAllPages(call, &operation, protoIn)
+	} else {
+		result, err = p.submit(call, &operation)
+	}
+	if err == nil && call.location != "" {
+		result, err = p.fetchLocation(call)
+	}
+	if err != nil && call.ctx.Err() != nil {
+		err = contextError(call.ctx)
+	}
+	if len(call.backendTrailer) > 0 {
+		stream.SetTrailer(call.backendTrailer)
+	}
 	if err != nil {
 		log.Printf("Got non-nil error: %s", err)
 		return err
@@ -327,6 +834,40 @@ func (p *operationAdapter) handleGRPCRequest(stream grpc.ServerStream) error {
 		// Should not happen.
 		return fmt.Errorf("could not cast to expected result type")
 	}
+	if paths := p.readMaskPaths(call.ctx, protoIn); len(paths) > 0 {
+		applyFieldMask(resultMessage, paths)
+	}
+	if p.measuresSizes() {
+		call.responseBytes = messageSize(resultMessage)
+	}
+	if header := metadata.Join(call.backendHeader, call.responseMetadata); len(header) > 0 {
+		if err = stream.SetHeader(header); err != nil {
+			return err
+		}
+	}
 
 	return stream.SendMsg(resultMessage)
 }
+
+// Emits an audit event for a completed call to the configured sink.
+func (p *operationAdapter) audit(call *proxiedCall, err error) {
+	p.options.AuditSink.Audit(&AuditEvent{
+		Time:       call.startTime,
+		Caller:     callerFromContext(call.ctx, p.options.CallerMetadataKey),
+		Operation:  p.method.GetFullyQualifiedName(),
+		HTTPMethod: p.httpMethod,
+		Path:       p.swaggerPath,
+		PathParams: call.pathParams,
+		Code:       errorCode(err),
+		Latency:    time.Since(call.startTime),
+	})
+}
+
+// Returns the gRPC status code for an error returned from a call; codes.OK for nil, and
+// codes.Unknown for errors not created by the status package.
+func errorCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return codes.Unknown
+}
@@ -2,14 +2,24 @@ package swaggrpc
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-openapi/runtime"
+	runtimeclient "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/spec"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
 	assertions "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 )
 
 // Tests that getStringConverter returns the correct JSON serializer for proto types.
@@ -35,6 +45,7 @@ message TestMessage {
 	TestEnum enumValue = 6;
 	map<string, int32> mapValue = 7;
 	SubMessage messageValue = 8;
+	bytes bytesValue = 9;
 }
 `
 	fileDesc, err := loadProtoFromBytes(([]byte)(protoContent))
@@ -55,6 +66,7 @@ message TestMessage {
 		{"enumValue", (&spec.Parameter{}).WithEnum("first", "second"), `{"enumValue": "SECOND"}`, "second"},
 		{"mapValue", nil, `{"mapValue": {"bar": 1, "foo": 2}}`, `{"bar":1,"foo":2}`},
 		{"messageValue", nil, `{"messageValue": {"subValue": "str"}}`, `{"subValue":"str"}`},
+		{"bytesValue", nil, `{"bytesValue": "aGk/Pz8="}`, "aGk/Pz8="},
 	}
 	for _, fixture := range fixtures {
 		t.Run(strings.Title(fixture.fieldName), func(t *testing.T) {
@@ -126,3 +138,321 @@ message TestMessage {
 		})
 	}
 }
+
+// Proto fixture for tests that proxy full calls.
+const testServiceProto = `
+syntax = "proto3";
+
+package test_service;
+
+message GetItemRequest {
+	string itemId = 1;
+	string filter = 2;
+}
+
+message Item {
+	string itemId = 1;
+	string name = 2;
+}
+
+service Items {
+	rpc GetItem (GetItemRequest) returns (Item) {}
+}
+`
+
+// Swagger parameters for the GetItem fixture method.
+var testServiceParams = map[string]*spec.Parameter{
+	"itemId": spec.PathParam("itemId"),
+	"filter": spec.QueryParam("filter"),
+}
+
+// A grpc.ServerStream for tests, which receives a single JSON request message and records the
+// messages and metadata sent back.
+type fakeServerStream struct {
+	ctx     context.Context
+	request string
+	sent    []*dynamic.Message
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeServerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *fakeServerStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m.(*dynamic.Message))
+	return nil
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	return jsonpb.UnmarshalString(s.request, m.(*dynamic.Message))
+}
+
+// Returns a method of a service in a fixture proto.
+func testMethod(t testing.TB, protoContent, service, method string) *desc.MethodDescriptor {
+	fileDesc, err := loadProtoFromBytes([]byte(protoContent))
+	require.Nil(t, err, "Couldn't parse test fixture proto: %v", err)
+	found := fileDesc.FindService(service).FindMethodByName(method)
+	require.NotNil(t, found, "Couldn't find %s.%s in parsed proto", service, method)
+	return found
+}
+
+// A proxied operation for tests. Unset fields default to the GetItem fixture method, proxied from
+// GET /items/{itemId} by the getItem operation, with testServiceParams.
+type testOperation struct {
+	// The proto method, or nil for GetItem.
+	method     *desc.MethodDescriptor
+	httpMethod string
+	path       string
+	// The backend's base path, or empty for "/".
+	basePath   string
+	operation  *spec.Operation
+	parameters map[string]*spec.Parameter
+	options    *ServiceOptions
+	// Handles backend requests. If nil, they're answered with 404s.
+	handler http.HandlerFunc
+}
+
+// Builds the operation's adapter, proxying to a test server running its handler. The returned
+// function shuts down the test server.
+func (o testOperation) adapter(t testing.TB) (*operationAdapter, func()) {
+	var handler http.Handler = o.handler
+	if o.handler == nil {
+		handler = http.NotFoundHandler()
+	}
+	server := httptest.NewServer(handler)
+	adapter, err := o.newAdapter(t, server.URL)
+	if err != nil {
+		server.Close()
+	}
+	require.Nil(t, err, "Error constructing adapter: %v", err)
+	return adapter, server.Close
+}
+
+// Constructs the operation's adapter for a backend at the given URL, returning any error.
+func (o testOperation) newAdapter(t testing.TB, backendURL string) (*operationAdapter, error) {
+	if o.method == nil {
+		o.method = testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+	}
+	if o.httpMethod == "" {
+		o.httpMethod = "GET"
+	}
+	if o.path == "" {
+		o.path = "/items/{itemId}"
+	}
+	if o.operation == nil {
+		o.operation = &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	}
+	if o.parameters == nil {
+		o.parameters = testServiceParams
+	}
+	if o.basePath == "" {
+		o.basePath = "/"
+	}
+	serverURL, err := url.Parse(backendURL)
+	require.Nil(t, err, "Bad test server URL: %v", err)
+	swaggerClient := runtimeclient.New(serverURL.Host, o.basePath, []string{"http"})
+	return newPathWrapper(http.DefaultClient, swaggerClient, o.httpMethod, o.path, o.operation, o.parameters,
+		o.method, o.options)
+}
+
+// Builds an adapter for the GetItem fixture method, as testOperation does.
+func newTestAdapter(
+	t *testing.T,
+	options *ServiceOptions,
+	handler http.HandlerFunc,
+) (*operationAdapter, func()) {
+	return testOperation{options: options, handler: handler}.adapter(t)
+}
+
+// Tests that handleGRPCRequest proxies a request to the backend and returns its response.
+func TestHandleGRPCRequest(t *testing.T) {
+	assert := assertions.New(t)
+	adapter, closeServer := newTestAdapter(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/items/abc", r.URL.Path, "Bad request path")
+		assert.Equal("new", r.URL.Query().Get("filter"), "Bad query parameter")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"itemId": "abc", "name": "thing", "extra": true}`))
+	})
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc", "filter": "new"}`}
+	err := adapter.handleGRPCRequest(stream)
+	assert.Nil(err, "Error handling request: %v", err)
+	if assert.Equal(1, len(stream.sent), "Expected a single response") {
+		assert.Equal("thing", stream.sent[0].GetFieldByName("name"), "Bad response field")
+	}
+}
+
+// Tests that backend requests are abandoned when calls are cancelled or their deadlines pass.
+func TestHandleGRPCRequestCancellation(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		context func() (context.Context, context.CancelFunc)
+		code    codes.Code
+	}{
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, codes.DeadlineExceeded},
+		{"cancelled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return ctx, cancel
+		}, codes.Canceled},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			abandoned := make(chan struct{})
+			adapter, closeServer := newTestAdapter(t, nil, func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+					close(abandoned)
+				case <-time.After(5 * time.Second):
+				}
+			})
+			defer closeServer()
+			ctx, cancel := fixture.context()
+			defer cancel()
+
+			stream := &fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}
+			err := adapter.handleGRPCRequest(stream)
+			assertions.Equal(t, fixture.code, errorCode(err), "Wrong error %v", err)
+			select {
+			case <-abandoned:
+			case <-time.After(time.Second):
+				t.Error("Backend request wasn't abandoned")
+			}
+		})
+	}
+}
+
+// A runtime.ClientRequest for tests, which records the parameters set on it.
+type fakeClientRequest struct {
+	headers     http.Header
+	queryParams url.Values
+	formParams  url.Values
+	pathParams  map[string]string
+	fileParams  map[string]runtime.NamedReadCloser
+	body        interface{}
+	timeout     time.Duration
+}
+
+func newFakeClientRequest() *fakeClientRequest {
+	return &fakeClientRequest{
+		headers:     make(http.Header),
+		queryParams: make(url.Values),
+		formParams:  make(url.Values),
+		pathParams:  make(map[string]string),
+		fileParams:  make(map[string]runtime.NamedReadCloser),
+	}
+}
+
+func (r *fakeClientRequest) SetHeaderParam(name string, values ...string) error {
+	r.headers[http.CanonicalHeaderKey(name)] = values
+	return nil
+}
+
+func (r *fakeClientRequest) SetQueryParam(name string, values ...string) error {
+	r.queryParams[name] = values
+	return nil
+}
+
+func (r *fakeClientRequest) SetFormParam(name string, values ...string) error {
+	r.formParams[name] = values
+	return nil
+}
+
+func (r *fakeClientRequest) SetPathParam(name string, value string) error {
+	r.pathParams[name] = value
+	return nil
+}
+
+func (r *fakeClientRequest) SetFileParam(name string, file runtime.NamedReadCloser) error {
+	r.fileParams[name] = file
+	return nil
+}
+
+func (r *fakeClientRequest) SetBodyParam(body interface{}) error {
+	r.body = body
+	return nil
+}
+
+func (r *fakeClientRequest) SetTimeout(timeout time.Duration) error {
+	r.timeout = timeout
+	return nil
+}
+
+// Tests that messages are created by the configured factory, which determines the types of nested
+// messages.
+func TestNewMessage(t *testing.T) {
+	method := maskedMethod(t)
+	fixtures := []struct {
+		name        string
+		factory     *dynamic.MessageFactory
+		dynamicMask bool
+	}{
+		{"default", nil, true},
+		{"with linked types", dynamic.NewMessageFactoryWithDefaults(), false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adapter := &operationAdapter{options: &ServiceOptions{MessageFactory: fixture.factory}}
+			message := adapter.newMessage(method.GetInputType())
+			require.Nil(t, message.UnmarshalJSON([]byte(`{"readMask": {"paths": ["id"]}}`)))
+			_, isDynamic := message.GetFieldByName("read_mask").(*dynamic.Message)
+			assertions.Equal(t, fixture.dynamicMask, isDynamic, "Nested message from the wrong factory")
+		})
+	}
+}
+
+// Benchmarks writing a request's parameters.
+func BenchmarkRequestWriter(b *testing.B) {
+	adapter, err := testOperation{}.newAdapter(b, "http://localhost")
+	require.Nil(b, err)
+	message := dynamic.NewMessage(adapter.method.GetInputType())
+	require.Nil(b, jsonpb.UnmarshalString(`{"itemId": "abc", "filter": "new"}`, message))
+	request := newFakeClientRequest()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		call := &proxiedCall{ctx: context.Background(), pathParams: make(map[string]string)}
+		if err := adapter.getRequestWriter(message, call)(request, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmarks proxying a call, from decoding the request to encoding the response.
+func BenchmarkHandleGRPCRequest(b *testing.B) {
+	adapter, closeServer := testOperation{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"itemId": "abc", "name": "thing", "extra": {"ignored": [1, 2, 3]}}`))
+	}}.adapter(b)
+	defer closeServer()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Information about the swagger operation a call is proxied to, carried in the call context.
+
+import (
+	"golang.org/x/net/context"
+)
+
+// OperationInfo describes the swagger operation a call is proxied to.
+type OperationInfo struct {
+	// The operation's ID in the spec.
+	ID string
+	// The full gRPC method name, like "/package.Service/Method".
+	FullMethod string
+	// The HTTP method of backend requests.
+	HTTPMethod string
+	// The path template of backend requests, like "/items/{itemId}".
+	PathTemplate string
+	// The operation's tags in the spec.
+	Tags []string
+}
+
+// Context key for an *OperationInfo.
+type operationInfoKey struct{}
+
+// OperationFromContext returns the operation a call is proxied to, or nil if there is none. The
+// operation is set on the context passed to hooks called while proxying, such as CallMetrics. The
+// returned info is shared between calls, and must not be modified.
+func OperationFromContext(ctx context.Context) *OperationInfo {
+	info, _ := ctx.Value(operationInfoKey{}).(*OperationInfo)
+	return info
+}
+
+// Returns a copy of ctx holding the given operation.
+func withOperationInfo(ctx context.Context, info *OperationInfo) context.Context {
+	return context.WithValue(ctx, operationInfoKey{}, info)
+}
+
+// Returns the info for this adapter's operation.
+func (p *operationAdapter) operationInfo() *OperationInfo {
+	return &OperationInfo{
+		ID:           p.operation.ID,
+		FullMethod:   fullMethodName(p.method),
+		HTTPMethod:   p.httpMethod,
+		PathTemplate: p.swaggerPath,
+		Tags:         p.operation.Tags,
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// Records the operation seen by metrics hooks.
+type operationRecordingMetrics struct {
+	fakeCallMetrics
+	seen *OperationInfo
+}
+
+func (m *operationRecordingMetrics) RecordDuration(ctx context.Context, duration time.Duration, attributes CallAttributes) {
+	m.seen = OperationFromContext(ctx)
+}
+
+// Tests that hooks can read the operation from the call context.
+func TestOperationFromContext(t *testing.T) {
+	assert := assertions.New(t)
+	assert.Nil(OperationFromContext(context.Background()))
+
+	metrics := &operationRecordingMetrics{}
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{Metrics: metrics},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		})
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	require.NotNil(t, metrics.seen, "No operation in hook context")
+	assert.Equal("getItem", metrics.seen.ID)
+	assert.Equal("/test_service.Items/GetItem", metrics.seen.FullMethod)
+	assert.Equal("GET", metrics.seen.HTTPMethod)
+	assert.Equal("/items/{itemId}", metrics.seen.PathTemplate)
+}
@@ -0,0 +1,320 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Configuration shared by all operations in a swagger service.
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// ServiceOptions configures how the operations of a single swagger service are proxied. The zero
+// value proxies calls with no additional behavior. Options must not be copied once used.
+type ServiceOptions struct {
+	// Sink to emit an audit event to for every proxied call. If nil, no audit events are emitted.
+	AuditSink AuditSink
+	// Recorder for call metrics. If nil, no metrics are recorded.
+	Metrics CallMetrics
+	// Hook receiving events for every call, for telemetry which isn't shaped like CallMetrics. Called
+	// after Metrics, if both are set.
+	MetricsHook MetricsHook
+	// Format to propagate callers' trace context to backend requests in. The caller's context is read
+	// in this format or any of the built-in formats. If nil, no trace context is propagated.
+	Propagator Propagator
+	// If true, optional query and header parameters are sent even when their fields hold default
+	// values. By default they're omitted, so that a zero value isn't read as an explicit filter.
+	SendUnsetParams bool
+	// How repeated fields are sent as headers: as a header line per value, or one comma-separated
+	// line. Defaults to HeaderListRepeated.
+	HeaderListFormat HeaderListFormat
+	// Constant headers sent with every backend request, such as an API version or client ID. Headers
+	// written from request parameters take precedence.
+	Headers map[string]string
+	// If set, the caller's metadata sent as backend request headers. These take precedence over
+	// Headers, and headers written from request parameters over them.
+	MetadataHeaders *MetadataHeaderOptions
+	// If set, the backend response headers returned to the caller as metadata.
+	ResponseMetadata *ResponseMetadataOptions
+	// If set, the Host header sent with backend requests in place of the host connected to, for
+	// backends routed by virtual host.
+	HostHeader string
+	// If set, slow backend requests of read operations are hedged to other hosts.
+	Hedging *HedgingOptions
+	// If set, large compressed backend response bodies are buffered in temporary files rather than in
+	// memory.
+	Spill *SpillOptions
+	// If true, callers' if-none-match and if-modified-since metadata are sent as the backend
+	// request's conditional headers. A 304 Not Modified response is answered with an empty message
+	// either way; see conditional_requests.go.
+	ConditionalRequests bool
+	// If true, the targets of links in backend responses' Link headers are returned to the caller as
+	// header metadata, keyed by "link-" and relation type, like "link-next".
+	LinkMetadata bool
+	// The media types request bodies are preferably sent as, for operations consuming several, most
+	// preferred first. Supported types are "application/json", "application/x-www-form-urlencoded",
+	// and those with Codecs. Defaults to JSON, then forms, then codec types in alphabetical order.
+	ConsumesPreference []string
+	// Codecs for request and response bodies of media types other than JSON, keyed by media type.
+	Codecs map[string]BodyCodec
+	// The User-Agent sent with backend requests, in which "{operationId}" is replaced by the operation's
+	// ID. Defaults to "swaggrpc/<version> (+<operationId>)". A User-Agent in Headers takes precedence.
+	UserAgent string
+	// If set, wraps the transport of the HTTP client used for this service's backend requests. This is
+	// the integration point for APM agents instrumenting outbound HTTP.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+	// Resilience settings for all operations in the service. These are overridden by settings in the
+	// spec and in Operations.
+	Resilience *ResilienceOptions
+	// The incoming gRPC metadata key naming a call's priority class. Calls waiting for a concurrency
+	// limit are dispatched by class; see PriorityWeights.
+	PriorityMetadataKey string
+	// The relative weights of priority classes when dispatching waiting calls. A class with twice the
+	// weight of another is twice as likely to be dispatched next. Classes not listed, including the
+	// default (empty) class, have weight 1.
+	PriorityWeights map[string]int
+	// Options for individual operations, keyed by operation ID.
+	Operations map[string]*OperationOptions
+	// The incoming gRPC metadata key holding the caller's identity, for calls which aren't
+	// authenticated. If empty, such calls are recorded with an empty caller.
+	CallerMetadataKey string
+	// If set, authenticates calls before they are proxied. Calls failing authentication are rejected
+	// without a backend request.
+	Authenticator Authenticator
+	// If set, authorizes calls before they are proxied. Calls which aren't authorized are rejected
+	// without a backend request.
+	Authorizer Authorizer
+	// If set, limits the number of requests each caller may make to each operation.
+	Quota *QuotaOptions
+	// Sink to emit a usage record to for every proxied call. If nil, no usage is recorded.
+	UsageSink UsageSink
+	// Sink to emit a dead letter to for every call failing after its backend request was written. If
+	// nil, failed calls aren't captured.
+	DeadLetters DeadLetterSink
+	// Called with each panic recovered while proxying a call, which fails with Internal. If nil,
+	// panics are logged.
+	OnPanic func(context.Context, *PanicReport)
+	// If set, tracks calls against service level objectives, recording burn rates to Metrics if it
+	// implements SLOMetrics.
+	SLO *SLOOptions
+	// If set, writes an access log line for proxied calls.
+	AccessLog *AccessLogOptions
+	// The incoming gRPC metadata key holding comma-separated field paths to prune responses to, for
+	// requests without a read_mask field. If empty, only read_mask fields are used.
+	ReadMaskMetadataKey string
+	// If true, each operation's adapter is built on the operation's first call rather than up front.
+	// This speeds up loading very large specs, but errors in an operation's mapping are only seen
+	// when it is called, where they are returned as Internal.
+	LazyAdapters bool
+	// If true, calls may send JSON-encoded messages in place of protobuf, and receive JSON responses,
+	// for clients which can only produce JSON, by sending the content type application/grpc+json.
+	// The server must be created with grpc.CustomCodec(NewServerCodec()), and served through
+	// NewContentSubtypeHandler.
+	AcceptJSON bool
+	// The maximum number of concurrent backend requests across all operations in the service, for
+	// backends which can only accept a limited number of connections. This applies after any
+	// per-operation limit. Zero means no limit.
+	MaxBackendConcurrency int
+	// The maximum number of calls waiting for MaxBackendConcurrency. Calls beyond this fail with
+	// ResourceExhausted. Zero means no limit.
+	MaxBackendQueue int
+	// If true, the caller's address is appended to the X-Forwarded-For and Forwarded headers of
+	// backend requests, after any values received in the caller's metadata from a trusted proxy.
+	ForwardClientAddress bool
+	// The addresses of proxies in front of this one, as IPs or CIDR ranges like "10.0.0.0/8", whose
+	// X-Forwarded-For and Forwarded metadata is forwarded. The values of other callers are dropped.
+	TrustedProxies []string
+	// The largest request message accepted, in bytes. This should be no more than the backend's
+	// request body limit. Zero means gRPC's default; see GRPCServerOptions.
+	MaxRequestBytes int
+	// The largest backend response body read, in bytes. Larger responses fail with ResourceExhausted.
+	// Encoded responses are usually smaller than their JSON, so this also bounds response messages.
+	// Zero means no limit; see GRPCServerOptions.
+	MaxResponseBytes int
+	// The largest backend response body decompressed, in bytes, whether by the HTTP transport or by
+	// the proxy for gzip bodies the transport left encoded. Larger responses fail with
+	// ResourceExhausted. Zero means 64 MiB; negative means no limit.
+	MaxDecompressedBytes int
+	// The deepest nesting of objects and arrays decoded from backend responses. Deeper responses fail
+	// with Internal. Zero means 100; negative means no limit.
+	MaxResponseDepth int
+	// If true, calls to deprecated operations after their sunset time fail with Unimplemented.
+	// Otherwise, the sunset is only advertised to callers.
+	EnforceSunset bool
+	// Creates request and response messages. Nested messages, including the contents of Any fields,
+	// use generated types where the factory's registry knows them. One factory may be shared by every
+	// service. If nil, nested messages are dynamic, apart from a few well-known types like Timestamp.
+	MessageFactory *dynamic.MessageFactory
+	// If set, configures how polymorphic backend payloads are read into google.protobuf.Any fields.
+	AnyTypes *AnyTypeOptions
+	// Converters replacing the built-in serialization of fields sent as parameters. If nil, fields are
+	// serialized by their proto type.
+	Converters *ConverterRegistry
+	// Plugins wrapping the conversion of calls to and from backend requests, applied in order after
+	// Converters.
+	Plugins []ConversionPlugin
+	// gRPC codes for backend HTTP error statuses, overriding the built-in mapping, for backends which
+	// use statuses unconventionally. Responses with statuses of 400 or more fail calls with the
+	// status's code and the response body attached as a google.api.HttpBody detail.
+	StatusCodes map[int]codes.Code
+	// If set, a login to the backend, whose token is sent with every backend request.
+	Session *SessionOptions
+	// If set, API keys sent with backend requests as operations' apiKey security requirements
+	// require.
+	APIKeys *APIKeyOptions
+	// If true, backend requests use https, whatever schemes the swagger document allows.
+	ForceHTTPS bool
+
+	// Guards creation of backendLimiter.
+	backendLimiterOnce sync.Once
+	// The limiter shared by all operations, created on first use.
+	backendLimiter *priorityLimiter
+	// Guards creation of defaultQuotaStore.
+	quotaStoreOnce sync.Once
+	// The quota store used if none is configured, created on first use.
+	defaultQuotaStore QuotaStore
+	// Guards creation of slos.
+	sloTrackerOnce sync.Once
+	// The tracker for SLO, shared by all operations and created on first use.
+	slos *sloTracker
+	// Guards creation of session.
+	sessionOnce sync.Once
+	// The backend session shared by all operations, created on first use.
+	session *backendSession
+}
+
+// OperationOptions configures how a single swagger operation is proxied. Settings here override
+// those for the service.
+type OperationOptions struct {
+	// Resilience settings for the operation.
+	Resilience *ResilienceOptions
+	// The priority class of calls to the operation which don't name one in metadata.
+	PriorityClass string
+	// Quota limits for the operation, replacing the service's limits if non-nil. An empty list
+	// disables quotas for the operation.
+	QuotaLimits []QuotaLimit
+	// The operation's cost class for usage records, overriding any class in the spec.
+	CostClass string
+	// Backend parameter names for AIP-style list request fields, overriding any names in the spec.
+	ListParams *ListParams
+	// Request fields to send parameters from, as field names keyed by parameter, for parameters whose
+	// names don't match their fields. These override mappings in the spec; an empty field name removes
+	// a parameter's mapping.
+	ParamFields map[string]string
+	// Formats for repeated message fields sent as query parameters, keyed by parameter, overriding
+	// any format in the spec.
+	MessageParamFormats map[string]MessageParamFormat
+	// Formats for Duration fields sent as parameters, keyed by parameter, overriding any format in the
+	// spec.
+	DurationFormats map[string]DurationFormat
+	// If set, each call pages through the backend and returns every page's items at once.
+	FetchAll *FetchAllOptions
+	// How a server-streaming method pages through the backend, sending each item as a message. This
+	// overrides any configuration in the spec.
+	PageStream *PageStreamOptions
+	// If true, a 201 or 303 backend response with a Location header is answered with the resource
+	// fetched from that location, rather than the response's own body.
+	FollowLocation bool
+	// Response headers to copy into scalar response fields, as field names keyed by header. These
+	// override mappings in the spec; an empty field name removes a header's mapping.
+	ResponseHeaders map[string]string
+	// Link relation types, like "next", whose targets in the response's Link header are copied into
+	// string response fields, as field names keyed by relation type. These override mappings in the
+	// spec; an empty field name removes a relation type's mapping.
+	Links map[string]string
+	// Request fields to send as headers, as field names keyed by header, for headers the spec doesn't
+	// declare. These override mappings in the spec; an empty field name removes a header's mapping.
+	RequestHeaders map[string]string
+	// Query parameters added to the operation's backend requests, as values keyed by name. Values may
+	// include the caller's metadata as "{metadata:key}"; a parameter naming metadata the caller didn't
+	// send is omitted. Parameters from the request message take precedence.
+	QueryParams map[string]string
+	// When the operation is removed, overriding any sunset in the spec. An operation with a sunset is
+	// deprecated, even if the spec doesn't say so.
+	Sunset time.Time
+	// How repeated fields are sent as headers, keyed by header, overriding the service's
+	// HeaderListFormat.
+	HeaderListFormats map[string]HeaderListFormat
+	// Constant headers sent with the operation's backend requests, overriding the service's Headers.
+	// An empty value removes a service header.
+	Headers map[string]string
+	// The media types the operation's request bodies are preferably sent as, overriding the
+	// service's ConsumesPreference.
+	ConsumesPreference []string
+	// A transform applied to the JSON of the operation's request bodies before they're sent, in the
+	// jq subset described in json_transforms.go. Bodies encoded by a codec aren't transformed. This
+	// overrides any transform in the spec.
+	RequestTransform string
+	// A transform applied to the operation's response JSON before it is read, in the same jq subset.
+	// This overrides any transform in the spec.
+	ResponseTransform string
+	// The Host header sent with the operation's backend requests, overriding the service's
+	// HostHeader.
+	HostHeader string
+	// Hedging for the operation's backend requests, overriding the service's Hedging. Options without
+	// hosts disable hedging for the operation.
+	Hedging *HedgingOptions
+	// Spilling of the operation's large response bodies, overriding the service's Spill.
+	Spill *SpillOptions
+	// The envelope the operation's responses are wrapped in, unwrapped before any response
+	// transform. This overrides any envelope in the spec.
+	Envelope *EnvelopeOptions
+}
+
+// Returns the options for the operation with the given ID, or the zero options if there are none.
+func (o *ServiceOptions) operationOptions(operationID string) *OperationOptions {
+	if operationOptions, ok := o.Operations[operationID]; ok && operationOptions != nil {
+		return operationOptions
+	}
+	return &OperationOptions{}
+}
+
+// Returns the limiter for MaxBackendConcurrency, shared by all operations in the service, or nil if
+// there is no limit. The service's name is used in queue depth metrics.
+func (o *ServiceOptions) sharedBackendLimiter(service string) *priorityLimiter {
+	if o.MaxBackendConcurrency <= 0 {
+		return nil
+	}
+	o.backendLimiterOnce.Do(func() {
+		o.backendLimiter = newPriorityLimiter(o.MaxBackendConcurrency, o.MaxBackendQueue, o.PriorityWeights)
+		o.backendLimiter.onQueueChange = queueDepthRecorder(o.Metrics, CallAttributes{Service: service})
+	})
+	return o.backendLimiter
+}
+
+// Returns the configured quota store, or else an in-memory store shared by all operations in the
+// service.
+func (o *ServiceOptions) quotaStore() QuotaStore {
+	if o.Quota.Store != nil {
+		return o.Quota.Store
+	}
+	o.quotaStoreOnce.Do(func() {
+		o.defaultQuotaStore = NewMemoryQuotaStore()
+	})
+	return o.defaultQuotaStore
+}
+
+// Returns the given options, or the zero options if nil.
+func optionsOrDefault(options *ServiceOptions) *ServiceOptions {
+	if options == nil {
+		return &ServiceOptions{}
+	}
+	return options
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Server-streaming methods backed by paginated list operations.
+//
+// A server-streaming method's output type is the type of a list's items. Each call pages through
+// the backend, sending every item of every page as a message, until the pages run out. Pages are
+// fetched by page number, item offset or cursor query parameters, configured by API owners with the
+// x-swaggrpc-page-stream operation extension:
+//
+//   x-swaggrpc-page-stream:
+//     items: /results
+//     cursorParam: cursor
+//     nextCursor: /next
+//
+// Each item is read as a whole response would be, with any response transform applied to it.
+// Calls without a deadline limit each page, rather than the whole stream, to the swagger client's
+// default request timeout.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/go-openapi/jsonpointer"
+	"github.com/go-openapi/runtime"
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the operation extension configuring page streaming.
+const pageStreamExtension = "x-swaggrpc-page-stream"
+
+// PageStreamOptions configures how a server-streaming method pages through its operation. Exactly
+// one of PageParam, OffsetParam and CursorParam must be set.
+type PageStreamOptions struct {
+	// JSON pointer to the array of items in each page, like "/items". Empty if pages are arrays.
+	Items string `json:"items"`
+	// The query parameter numbering pages, like "page". Pages are numbered from 1, or from 0 if
+	// ZeroBased is set.
+	PageParam string `json:"pageParam"`
+	ZeroBased bool   `json:"zeroBased"`
+	// The query parameter giving the number of items to skip, like "offset".
+	OffsetParam string `json:"offsetParam"`
+	// The query parameter giving the cursor of the page to fetch, like "cursor". Paging ends with a
+	// page that has no next cursor, and fails with one the backend already gave.
+	CursorParam string `json:"cursorParam"`
+	// JSON pointer to the next page's cursor in each page, like "/next". Required with CursorParam.
+	NextCursor string `json:"nextCursor"`
+	// If set, the number of items in each page. Page number and offset paging ends with a page of
+	// fewer items; otherwise, it ends with an empty page.
+	PageSize int `json:"pageSize"`
+	// If set, the query parameter PageSize is sent as, like "limit".
+	SizeParam string `json:"sizeParam"`
+	// The maximum number of backend requests per call. Zero means no limit.
+	MaxPages int `json:"maxPages"`
+}
+
+// A parsed page stream configuration.
+type pageStream struct {
+	options    *PageStreamOptions
+	items      jsonpointer.Pointer
+	nextCursor *jsonpointer.Pointer
+}
+
+// A page of items read from a backend response.
+type streamPage struct {
+	items []*dynamic.Message
+	// The next page's cursor, if paging by cursor and there is one.
+	nextCursor string
+}
+
+// Returns a method's page stream configuration, from its operation's options or else the spec, or
+// nil if it has none. Returns an error if the configuration is invalid, or is given for a method
+// which isn't only server-streaming.
+func resolvePageStream(
+	operation *spec.Operation,
+	operationOptions *OperationOptions,
+	method *desc.MethodDescriptor,
+) (*pageStream, error) {
+	options := operationOptions.PageStream
+	if options == nil {
+		options = &PageStreamOptions{}
+		found, err := decodeExtension(operation.Extensions, pageStreamExtension, options)
+		if err != nil || !found {
+			return nil, err
+		}
+	}
+	if !method.IsServerStreaming() || method.IsClientStreaming() {
+		return nil, fmt.Errorf("page streaming %s requires a server-streaming method, not %s", operation.ID,
+			method.GetFullyQualifiedName())
+	}
+	if operationOptions.FetchAll != nil {
+		return nil, fmt.Errorf("operation %s can't both fetch all pages and stream them", operation.ID)
+	}
+	paramCount := 0
+	for _, param := range []string{options.PageParam, options.OffsetParam, options.CursorParam} {
+		if param != "" {
+			paramCount++
+		}
+	}
+	if paramCount != 1 {
+		return nil, fmt.Errorf("page streaming %s requires one of a page, offset or cursor parameter",
+			operation.ID)
+	}
+	items, err := jsonpointer.New(options.Items)
+	if err != nil {
+		return nil, fmt.Errorf("bad page items for %s: %v", operation.ID, err)
+	}
+	stream := &pageStream{options: options, items: items}
+	if options.CursorParam != "" {
+		if options.NextCursor == "" {
+			return nil, fmt.Errorf("page streaming %s by cursor requires a next cursor", operation.ID)
+		}
+		nextCursor, err := jsonpointer.New(options.NextCursor)
+		if err != nil {
+			return nil, fmt.Errorf("bad next cursor for %s: %v", operation.ID, err)
+		}
+		stream.nextCursor = &nextCursor
+	}
+	return stream, nil
+}
+
+// Returns the query parameters fetching a page, given the number of pages and items fetched so
+// far, and the cursor the last page gave.
+func (s *pageStream) query(pages int, items int, cursor string) map[string]string {
+	query := make(map[string]string)
+	switch {
+	case s.options.PageParam != "":
+		first := 1
+		if s.options.ZeroBased {
+			first = 0
+		}
+		query[s.options.PageParam] = strconv.Itoa(first + pages)
+	case s.options.OffsetParam != "":
+		query[s.options.OffsetParam] = strconv.Itoa(items)
+	case cursor != "":
+		query[s.options.CursorParam] = cursor
+	}
+	if s.options.SizeParam != "" && s.options.PageSize > 0 {
+		query[s.options.SizeParam] = strconv.Itoa(s.options.PageSize)
+	}
+	return query
+}
+
+// Returns true if no pages follow the given one.
+func (s *pageStream) isLastPage(page *streamPage) bool {
+	if s.nextCursor != nil {
+		return page.nextCursor == ""
+	}
+	return len(page.items) == 0 || len(page.items) < s.options.PageSize
+}
+
+// Sets a call's page query parameters on a request, overriding any from the request message.
+func writePageQuery(call *proxiedCall, request runtime.ClientRequest) error {
+	for name, value := range call.pageQuery {
+		if err := request.SetQueryParam(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Submits backend requests for every page of results, within the configured limit, sending each
+// page's items to the caller as they're read.
+func (p *operationAdapter) streamPages(
+	call *proxiedCall,
+	operation *runtime.ClientOperation,
+	stream grpc.ServerStream,
+) error {
+	defer func() {
+		if len(call.backendTrailer) > 0 {
+			stream.SetTrailer(call.backendTrailer)
+		}
+	}()
+	s := p.pageStream
+	items := 0
+	cursor := ""
+	seenCursors := make(map[string]bool)
+	for pages := 0; s.options.MaxPages == 0 || pages < s.options.MaxPages; pages++ {
+		call.pageQuery = s.query(pages, items, cursor)
+		page, err := p.submitPage(call, operation)
+		if err != nil {
+			return err
+		}
+		if pages == 0 && len(call.backendHeader) > 0 {
+			if err := stream.SetHeader(call.backendHeader); err != nil {
+				return err
+			}
+		}
+		for _, item := range page.items {
+			if err := stream.SendMsg(item); err != nil {
+				return err
+			}
+		}
+		items += len(page.items)
+		cursor = page.nextCursor
+		if s.isLastPage(page) {
+			return nil
+		}
+		if s.nextCursor != nil {
+			if seenCursors[cursor] {
+				return status.Errorf(codes.Internal, "backend repeated cursor %q for %s", cursor, p.operation.ID)
+			}
+			seenCursors[cursor] = true
+		}
+	}
+	return nil
+}
+
+// Submits the backend request for a page, limited to the default request timeout if the call has
+// no deadline.
+func (p *operationAdapter) submitPage(call *proxiedCall, operation *runtime.ClientOperation) (*streamPage, error) {
+	callCtx := call.ctx
+	if _, ok := callCtx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		call.ctx, cancel = context.WithTimeout(callCtx, runtimeclient.DefaultTimeout)
+		operation.Context = call.ctx
+		defer func() {
+			cancel()
+			call.ctx, operation.Context = callCtx, callCtx
+		}()
+	}
+	result, err := p.submit(call, operation)
+	if err != nil {
+		if call.ctx.Err() != nil {
+			return nil, contextError(call.ctx)
+		}
+		return nil, err
+	}
+	page, ok := result.(*streamPage)
+	if !ok {
+		// Should not happen.
+		return nil, fmt.Errorf("could not cast to expected page type")
+	}
+	return page, nil
+}
+
+// Reads a page of items from a backend response. Fails with Internal if the page isn't JSON, or
+// its items aren't an array. A page without items is read as empty.
+func (p *operationAdapter) readPage(response runtime.ClientResponse) (*streamPage, error) {
+	body, err := p.readResponseBody(response.Body(), response.GetHeader("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkResponseDepth(body); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are kept as written, so that large integers aren't rounded.
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, status.Errorf(codes.Internal, "reading page for %s: %v", p.operation.ID, err)
+	}
+
+	page := &streamPage{}
+	if value, _ := resolveJSONPointer(p.pageStream.items, document); value != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, status.Errorf(codes.Internal, "items at %s in page for %s aren't an array",
+				p.pageStream.items.String(), p.operation.ID)
+		}
+		for _, item := range items {
+			itemBody, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			message := p.newMessage(p.outputProtoType)
+			if err := p.decodeResponse(itemBody, message); err != nil {
+				return nil, err
+			}
+			page.items = append(page.items, message)
+		}
+	}
+	if p.pageStream.nextCursor != nil {
+		cursor, _ := resolveJSONPointer(*p.pageStream.nextCursor, document)
+		switch typed := cursor.(type) {
+		case string:
+			page.nextCursor = typed
+		case json.Number:
+			page.nextCursor = typed.String()
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+const pageStreamProto = `
+syntax = "proto3";
+
+package stream_test;
+
+message ListItemsRequest {
+  string filter = 1;
+}
+
+message Item {
+  string name = 1;
+}
+
+service Items {
+  rpc ListItems(ListItemsRequest) returns (stream Item);
+  rpc GetItem(ListItemsRequest) returns (Item);
+}
+`
+
+// Tests that page stream configurations are validated.
+func TestResolvePageStream(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(pageStreamProto))
+	require.Nil(t, err)
+	service := fileDesc.FindService("stream_test.Items")
+	fixtures := []struct {
+		name      string
+		method    string
+		extension interface{}
+		options   *OperationOptions
+		found     bool
+		valid     bool
+	}{
+		{"none", "ListItems", nil, &OperationOptions{}, false, true},
+		{"spec", "ListItems", map[string]interface{}{"pageParam": "page"}, &OperationOptions{}, true, true},
+		{"options", "ListItems", nil,
+			&OperationOptions{PageStream: &PageStreamOptions{CursorParam: "cursor", NextCursor: "/next"}},
+			true, true},
+		{"unary method", "GetItem", nil,
+			&OperationOptions{PageStream: &PageStreamOptions{PageParam: "page"}}, false, false},
+		{"no parameter", "ListItems", nil, &OperationOptions{PageStream: &PageStreamOptions{}}, false, false},
+		{"several parameters", "ListItems", nil,
+			&OperationOptions{PageStream: &PageStreamOptions{PageParam: "page", OffsetParam: "offset"}},
+			false, false},
+		{"no next cursor", "ListItems", nil,
+			&OperationOptions{PageStream: &PageStreamOptions{CursorParam: "cursor"}}, false, false},
+		{"fetching all", "ListItems", nil, &OperationOptions{
+			PageStream: &PageStreamOptions{PageParam: "page"}, FetchAll: &FetchAllOptions{}}, false, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "listItems"}}
+			if fixture.extension != nil {
+				operation.AddExtension(pageStreamExtension, fixture.extension)
+			}
+			stream, err := resolvePageStream(operation, fixture.options, service.FindMethodByName(fixture.method))
+			if !fixture.valid {
+				assertions.Error(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assertions.Equal(t, fixture.found, stream != nil)
+		})
+	}
+}
+
+// Returns an adapter streaming pages of listItems from a server with the given handler, and a
+// function closing the server.
+func newPageStreamAdapter(
+	t *testing.T,
+	pageStream *PageStreamOptions,
+	handler http.HandlerFunc,
+) (*operationAdapter, func()) {
+	return testOperation{
+		method:     testMethod(t, pageStreamProto, "stream_test.Items", "ListItems"),
+		path:       "/items",
+		operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "listItems"}},
+		parameters: map[string]*spec.Parameter{"filter": spec.QueryParam("filter").Typed("string", "")},
+		options: &ServiceOptions{Operations: map[string]*OperationOptions{
+			"listItems": {PageStream: pageStream},
+		}},
+		handler: handler,
+	}.adapter(t)
+}
+
+// Tests that every item of every page is streamed to the caller.
+func TestStreamPages(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		options  *PageStreamOptions
+		pages    map[string]string
+		expected []string
+		code     codes.Code
+	}{
+		{"page numbers", &PageStreamOptions{Items: "/items", PageParam: "page", PageSize: 2, SizeParam: "limit"},
+			map[string]string{
+				"limit=2&page=1": `{"items": [{"name": "a"}, {"name": "b"}]}`,
+				"limit=2&page=2": `{"items": [{"name": "c"}]}`,
+			}, []string{"a", "b", "c"}, codes.OK},
+		{"offsets", &PageStreamOptions{OffsetParam: "offset"},
+			map[string]string{
+				"offset=0": `[{"name": "a"}, {"name": "b"}]`,
+				"offset=2": `[{"name": "c"}]`,
+				"offset=3": `[]`,
+			}, []string{"a", "b", "c"}, codes.OK},
+		{"cursors", &PageStreamOptions{Items: "/data", CursorParam: "cursor", NextCursor: "/next"},
+			map[string]string{
+				"":         `{"data": [{"name": "a"}], "next": "x"}`,
+				"cursor=x": `{"data": [], "next": "y"}`,
+				"cursor=y": `{"data": [{"name": "b"}], "next": null}`,
+			}, []string{"a", "b"}, codes.OK},
+		{"repeated cursor", &PageStreamOptions{Items: "/data", CursorParam: "cursor", NextCursor: "/next"},
+			map[string]string{
+				"":         `{"data": [{"name": "a"}], "next": "x"}`,
+				"cursor=x": `{"data": [{"name": "b"}], "next": "x"}`,
+			}, []string{"a", "b"}, codes.Internal},
+		{"page limit", &PageStreamOptions{PageParam: "page", ZeroBased: true, MaxPages: 1},
+			map[string]string{
+				"page=0": `[{"name": "a"}]`,
+				"page=1": `[{"name": "b"}]`,
+			}, []string{"a"}, codes.OK},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adapter, closeServer := newPageStreamAdapter(t, fixture.options,
+				func(w http.ResponseWriter, r *http.Request) {
+					assertions.Equal(t, "new", r.URL.Query().Get("filter"), "Request parameters not sent")
+					query := r.URL.Query()
+					query.Del("filter")
+					page, ok := fixture.pages[query.Encode()]
+					if !ok {
+						t.Errorf("Unexpected page request %s", query.Encode())
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(page))
+				})
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"filter": "new"}`}
+			err := adapter.handleGRPCRequest(stream)
+			assertions.Equal(t, fixture.code, errorCode(err), "Bad result: %v", err)
+			var names []string
+			for _, item := range stream.sent {
+				names = append(names, item.GetFieldByName("name").(string))
+			}
+			assertions.Equal(t, fixture.expected, names)
+		})
+	}
+}
+
+// Tests that calls without a deadline limit each page to the default timeout, not the whole stream.
+func TestStreamPagesTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { runtimeclient.DefaultTimeout = timeout }(runtimeclient.DefaultTimeout)
+	runtimeclient.DefaultTimeout = 200 * time.Millisecond
+	adapter, closeServer := newPageStreamAdapter(t, &PageStreamOptions{PageParam: "page", PageSize: 1},
+		func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("page") == "4" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[{"name": "a"}]`))
+		})
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assertions.Len(t, stream.sent, 3)
+}
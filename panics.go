@@ -0,0 +1,93 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Recovery from panics while proxying calls.
+//
+// A panic while proxying a call, such as in a converter given a payload it doesn't expect, fails only
+// that call, with Internal, rather than crashing the process. Each panic is reported with the
+// operation and a stack trace to ServiceOptions.OnPanic, or else logged. Panics in converters are
+// also reported with the parameter being converted.
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PanicReport describes a panic recovered while proxying a call.
+type PanicReport struct {
+	// The operation the call was proxied to.
+	Operation *OperationInfo
+	// The parameter being converted, if the panic was in its converter.
+	Param string
+	// The value passed to panic.
+	Value interface{}
+	// The stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// A panic in a converter, with the parameter being converted, re-raised to be recovered by the call.
+type converterPanic struct {
+	param string
+	value interface{}
+	stack []byte
+}
+
+// Returns a converter which re-raises panics with the parameter being converted.
+func recoverConverter(param string, converter func(interface{}) string) func(interface{}) string {
+	return func(value interface{}) string {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				panic(&converterPanic{param: param, value: recovered, stack: debug.Stack()})
+			}
+		}()
+		return converter(value)
+	}
+}
+
+// Recovers from a panic proxying a call, reporting it and failing the call with Internal. This must
+// be deferred directly.
+func (p *operationAdapter) recoverPanic(call *proxiedCall, err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	report := &PanicReport{Operation: p.info, Value: recovered}
+	if converted, ok := recovered.(*converterPanic); ok {
+		report.Param, report.Value, report.Stack = converted.param, converted.value, converted.stack
+	} else {
+		report.Stack = debug.Stack()
+	}
+	p.reportPanic(call.ctx, report)
+	*err = status.Errorf(codes.Internal, "internal error proxying %s", p.operation.ID)
+}
+
+// Reports a recovered panic to the configured callback, or else logs it.
+func (p *operationAdapter) reportPanic(ctx context.Context, report *PanicReport) {
+	if p.options.OnPanic != nil {
+		p.options.OnPanic(ctx, report)
+		return
+	}
+	param := ""
+	if report.Param != "" {
+		param = fmt.Sprintf(" converting parameter %s", report.Param)
+	}
+	log.Printf("ERROR: panic proxying %s%s: %v\n%s", report.Operation.ID, param, report.Value, report.Stack)
+}
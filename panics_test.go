@@ -0,0 +1,82 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests that a panicking converter fails only its call, and is reported with the operation.
+func TestConverterPanicRecovery(t *testing.T) {
+	assert := assertions.New(t)
+	converters := NewConverterRegistry()
+	converters.RegisterParam("getItem", "itemId", func(value interface{}) string {
+		return value.([]string)[0]
+	})
+	var reports []*PanicReport
+	options := &ServiceOptions{
+		Converters: converters,
+		OnPanic: func(ctx context.Context, report *PanicReport) {
+			assert.Equal("getItem", OperationFromContext(ctx).ID)
+			reports = append(reports, report)
+		},
+	}
+	requested := false
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	})
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	err := adapter.handleGRPCRequest(stream)
+	assert.Equal(codes.Internal, errorCode(err))
+	assert.Contains(err.Error(), "getItem")
+	assert.False(requested, "Backend called after panic")
+	require.Len(t, reports, 1)
+	assert.Equal("getItem", reports[0].Operation.ID)
+	assert.Equal("itemId", reports[0].Param)
+	assert.Contains(reports[0].Value.(error).Error(), "interface conversion")
+	assert.Contains(string(reports[0].Stack), "TestConverterPanicRecovery")
+}
+
+// Tests that panics outside converters are recovered, and that the call's hooks see the error.
+func TestCallPanicRecovery(t *testing.T) {
+	assert := assertions.New(t)
+	var reported *PanicReport
+	var audited []*AuditEvent
+	options := &ServiceOptions{
+		OnPanic:   func(ctx context.Context, report *PanicReport) { reported = report },
+		AuditSink: AuditSinkFunc(func(event *AuditEvent) { audited = append(audited, event) }),
+		WrapTransport: func(http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(*http.Request) (*http.Response, error) { panic("broken transport") })
+		},
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {})
+	defer closeServer()
+
+	err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	assert.Equal(codes.Internal, errorCode(err))
+	require.NotNil(t, reported)
+	assert.Equal("broken transport", reported.Value)
+	assert.Empty(reported.Param)
+	require.Len(t, audited, 1)
+	assert.Equal(codes.Internal, audited[0].Code)
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Matching of swagger parameters to request message fields.
+//
+// Generated protos don't always name fields exactly as the spec names parameters. A parameter is
+// matched to the first field found by:
+//
+//   1. an explicit mapping, from the x-swaggrpc-param-fields operation extension or
+//      OperationOptions.ParamFields;
+//   2. the field's name, with dashes in the parameter name read as underscores, or its JSON name;
+//   3. the same, ignoring case;
+//   4. a field of a nested message, for parameter names with dots, like "filter.date_range.start";
+//   5. the field's name, ignoring case and anything other than letters and digits.
+//
+// A parameter matching several fields at one step is an error, rather than a guess. Explicit
+// mappings may also name fields of nested messages with dots.
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Name of the operation extension mapping parameters to fields.
+const paramFieldsExtension = "x-swaggrpc-param-fields"
+
+// Returns the explicit parameter to field mappings for an operation, as field names keyed by
+// parameter. Mappings in options override those in the spec; an empty field name removes a
+// parameter's mapping.
+func resolveParamFields(operation *spec.Operation, operationOptions *OperationOptions) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if _, err := decodeExtension(operation.Extensions, paramFieldsExtension, &mapping); err != nil {
+		return nil, err
+	}
+	for param, field := range operationOptions.ParamFields {
+		if field == "" {
+			delete(mapping, param)
+		} else {
+			mapping[param] = field
+		}
+	}
+	return mapping, nil
+}
+
+// Returns the field of inputType a parameter is sent from, as the path of fields leading to it.
+func findParamField(inputType *desc.MessageDescriptor, param string) ([]*desc.FieldDescriptor, error) {
+	name := strings.Replace(param, "-", "_", -1)
+	if field := inputType.FindFieldByName(name); field != nil {
+		return []*desc.FieldDescriptor{field}, nil
+	}
+	matchers := []func(field *desc.FieldDescriptor) bool{
+		func(field *desc.FieldDescriptor) bool {
+			return field.GetJSONName() == param
+		},
+		func(field *desc.FieldDescriptor) bool {
+			return strings.EqualFold(field.GetName(), name) || strings.EqualFold(field.GetJSONName(), param)
+		},
+	}
+	normalized := func(field *desc.FieldDescriptor) bool {
+		return alphanumericKey(field.GetName()) == alphanumericKey(param)
+	}
+	for i, matches := range append(matchers, normalized) {
+		if i == len(matchers) && strings.Contains(param, ".") {
+			if path, err := findFieldPath(inputType, param); err == nil {
+				return path, nil
+			}
+		}
+		var found []*desc.FieldDescriptor
+		for _, field := range inputType.GetFields() {
+			if matches(field) {
+				found = append(found, field)
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found, nil
+		default:
+			names := make([]string, len(found))
+			for i, field := range found {
+				names[i] = field.GetName()
+			}
+			return nil, fmt.Errorf("parameter %s matches several fields of %s: %s", param,
+				inputType.GetFullyQualifiedName(), strings.Join(names, ", "))
+		}
+	}
+	return nil, fmt.Errorf("Could not find proto field named %s", name)
+}
+
+// Returns the fields named by a dotted path from inputType, like "filter.date_range.start". Each
+// name may be a proto or JSON name. Every field but the last must be a singular message.
+func findFieldPath(inputType *desc.MessageDescriptor, dotted string) ([]*desc.FieldDescriptor, error) {
+	var path []*desc.FieldDescriptor
+	messageType := inputType
+	for _, name := range strings.Split(dotted, ".") {
+		if messageType == nil {
+			return nil, fmt.Errorf("field %s of %s isn't a singular message", path[len(path)-1].GetName(),
+				inputType.GetFullyQualifiedName())
+		}
+		field := messageType.FindFieldByName(name)
+		if field == nil {
+			field = messageType.FindFieldByJSONName(name)
+		}
+		if field == nil {
+			return nil, fmt.Errorf("no field %s in %s", name, messageType.GetFullyQualifiedName())
+		}
+		path = append(path, field)
+		messageType = field.GetMessageType()
+		if field.IsRepeated() {
+			messageType = nil
+		}
+	}
+	return path, nil
+}
+
+// Returns a name lowercased, with anything other than letters and digits removed.
+func alphanumericKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
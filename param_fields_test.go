@@ -0,0 +1,186 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto with fields named unlike their parameters.
+const paramFieldsProto = `
+syntax = "proto3";
+
+package param_fields_test;
+
+message Request {
+  string user_id = 1;
+  string pageToken = 2;
+  string x_api_key = 3;
+  string Sort = 4;
+  string sort_ = 5;
+  string custom = 6 [json_name = "altName"];
+  Filter filter = 7;
+  repeated Filter filters = 8;
+}
+
+message Filter {
+  DateRange date_range = 1;
+  int32 limit = 2;
+}
+
+message DateRange {
+  string start = 1;
+  string end = 2;
+}
+
+message Response {}
+
+service Things {
+  rpc List(Request) returns (Response);
+}
+`
+
+// Tests each step of matching parameters to fields.
+func TestFindParamField(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(paramFieldsProto))
+	require.Nil(t, err)
+	inputType := fileDesc.FindMessage("param_fields_test.Request")
+	fixtures := []struct {
+		param    string
+		expected []string
+	}{
+		{"user_id", []string{"user_id"}},
+		{"user-id", []string{"user_id"}},
+		{"userId", []string{"user_id"}},
+		{"altName", []string{"custom"}},
+		{"PageToken", []string{"pageToken"}},
+		{"USER_ID", []string{"user_id"}},
+		{"X-API-Key", []string{"x_api_key"}},
+		{"userid", []string{"user_id"}},
+		{"page.token", []string{"pageToken"}},
+		{"Sort", []string{"Sort"}},
+		{"filter.date_range.start", []string{"filter", "date_range", "start"}},
+		{"filter.dateRange.end", []string{"filter", "date_range", "end"}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.param, func(t *testing.T) {
+			path, err := findParamField(inputType, fixture.param)
+			require.Nil(t, err)
+			names := make([]string, len(path))
+			for i, field := range path {
+				names[i] = field.GetName()
+			}
+			assertions.Equal(t, fixture.expected, names)
+		})
+	}
+
+	_, err = findParamField(inputType, "missing")
+	assertions.NotNil(t, err, "Expected error for unknown parameter")
+	_, err = findParamField(inputType, "SORT")
+	assertions.NotNil(t, err, "Expected error for ambiguous parameter")
+	_, err = findParamField(inputType, "filters.limit")
+	assertions.NotNil(t, err, "Expected error for path through a repeated field")
+	_, err = findParamField(inputType, "filter.date_range.start.day")
+	assertions.NotNil(t, err, "Expected error for path through a scalar field")
+}
+
+// Tests that explicit mappings from options override those in the spec.
+func TestResolveParamFields(t *testing.T) {
+	operation := &spec.Operation{VendorExtensible: spec.VendorExtensible{Extensions: spec.Extensions{
+		paramFieldsExtension: map[string]interface{}{"q": "query", "n": "name"},
+	}}}
+	mapping, err := resolveParamFields(operation, &OperationOptions{ParamFields: map[string]string{
+		"q": "filter",
+		"n": "",
+	}})
+	require.Nil(t, err)
+	assertions.Equal(t, map[string]string{"q": "filter"}, mapping)
+}
+
+// Tests that requests are proxied with explicitly mapped parameters.
+func TestParamFieldsSent(t *testing.T) {
+	assert := assertions.New(t)
+	var query string
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{"getItem": {
+		ParamFields: map[string]string{"q": "filter"},
+	}}}
+	params := map[string]*spec.Parameter{
+		"itemId": spec.PathParam("itemId"),
+		"q":      spec.QueryParam("q"),
+	}
+	adapter, closeServer := testOperation{parameters: params, options: options,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query().Get("q")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}}.adapter(t)
+	defer closeServer()
+
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc", "filter": "x"}`}))
+	assert.Equal("x", query)
+}
+
+// Tests that parameters bound to fields of nested messages are sent, and omitted when a message on
+// the way is unset.
+func TestNestedParamFieldsSent(t *testing.T) {
+	var received url.Values
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{"list": {
+		ParamFields: map[string]string{"since": "filter.dateRange.start"},
+	}}}
+	list := testOperation{
+		method:    testMethod(t, paramFieldsProto, "param_fields_test.Things", "List"),
+		path:      "/things",
+		operation: &spec.Operation{OperationProps: spec.OperationProps{ID: "list"}},
+		parameters: map[string]*spec.Parameter{
+			"since":        spec.QueryParam("since").Typed("string", ""),
+			"filter.limit": spec.QueryParam("filter.limit").Typed("integer", "int32"),
+		},
+		options: options,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			received = r.URL.Query()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		},
+	}
+	adapter, closeServer := list.adapter(t)
+	defer closeServer()
+
+	fixtures := []struct {
+		name     string
+		request  string
+		expected url.Values
+	}{
+		{"Set", `{"filter": {"dateRange": {"start": "2017"}, "limit": 5}}`,
+			url.Values{"since": {"2017"}, "filter.limit": {"5"}}},
+		{"PartlySet", `{"filter": {"limit": 5}}`, url.Values{"filter.limit": {"5"}}},
+		{"Unset", `{}`, url.Values{}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: fixture.request}))
+			assertions.Equal(t, fixture.expected, received)
+		})
+	}
+
+	options.Operations["list"].ParamFields["since"] = "filter.date_range.day"
+	_, err := list.newAdapter(t, "http://localhost")
+	assertions.NotNil(t, err, "Expected error for mapping to an unknown nested field")
+}
@@ -0,0 +1,301 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Plans for writing request messages as swagger parameters, resolved once per operation.
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Where a parameter is written in a backend request.
+type paramLocation int
+
+const (
+	paramInQuery paramLocation = iota
+	paramInHeader
+	paramInPath
+	paramInBody
+	paramInForm
+	paramInCookie
+)
+
+// Returns where the given param is written, or an error if its location isn't supported.
+func getParamLocation(param *spec.Parameter) (paramLocation, error) {
+	switch param.In {
+	case "query":
+		return paramInQuery, nil
+	case "header":
+		return paramInHeader, nil
+	case "path":
+		// NOTE: Some swagger files have "path" parameters that are actually in the query string. This
+		// doesn't check for this case.
+		return paramInPath, nil
+	case "body":
+		// NOTE: This is for Swagger 2.0 only. Swagger 3.0 request bodies become body parameters when
+		// documents are converted; see openapi3.go.
+		return paramInBody, nil
+	case "formData":
+		// This is not generated by openapi2proto; see form_params.go.
+		return paramInForm, nil
+	case "cookie":
+		// These are 3.0-only, kept by ConvertOpenAPI3; see openapi3.go.
+		return paramInCookie, nil
+	default:
+		return 0, fmt.Errorf("ERROR: Unknown parameter location %q for parameter %q",
+			param.In, param.Name)
+	}
+}
+
+// Writes one field of a request message as a parameter.
+type paramStep struct {
+	// The parameter name.
+	name     string
+	location paramLocation
+	// The field holding the parameter's value.
+	field *desc.FieldDescriptor
+	// For fields of nested messages, the singular message fields leading to field from the request,
+	// outermost first.
+	parents []*desc.FieldDescriptor
+	// True for repeated, non-map fields, which are written as a value per element.
+	repeated bool
+	// True if the parameter is omitted when the field has its default value.
+	omitDefault bool
+	// True for wrapper fields, whose parameters are omitted when the field is unset.
+	presence bool
+	// True if the parameter is omitted when its serialized value is empty.
+	omitEmpty bool
+	// Serializes a single field value.
+	toString func(interface{}) string
+	// True for message bodies, which are encoded as the request is sent rather than as a string.
+	streamBody bool
+	// True for repeated headers sent as a single, comma-separated line.
+	joinHeader bool
+	// The format of a repeated message query parameter, or empty for the default of a JSON value per
+	// message.
+	messageFormat MessageParamFormat
+	// The format of a Duration field, or empty for other fields.
+	durationFormat DurationFormat
+	// Encodes message bodies. Defaults to JSON.
+	produceBody BodyProducer
+	// True for file form parameters, whose field's bytes are sent as an uploaded file.
+	file bool
+	// True for binary body parameters, whose field's bytes are sent as the body.
+	binary bool
+}
+
+// A plan for writing a request message's fields as parameters.
+type paramPlan struct {
+	steps []paramStep
+	// The number of singular steps, whose values share one buffer in each write.
+	singular int
+}
+
+// Adds a step to the plan.
+func (plan *paramPlan) add(step paramStep) {
+	step.streamBody = step.location == paramInBody && !step.repeated && !step.field.IsMap() &&
+		step.field.GetMessageType() != nil
+	if step.produceBody == nil {
+		step.produceBody = produceJSONBody
+	}
+	plan.steps = append(plan.steps, step)
+	if !step.repeated {
+		plan.singular++
+	}
+}
+
+// Writes the fields of a message to a request.
+func (plan *paramPlan) write(message *dynamic.Message, request runtime.ClientRequest) error {
+	return plan.writeWithBody(message, request, nil)
+}
+
+// Writes the fields of a message to a request as write does, encoding any message body with the
+// given producer instead of each step's own, unless it is nil.
+func (plan *paramPlan) writeWithBody(message *dynamic.Message, request runtime.ClientRequest,
+	produceBody BodyProducer) error {
+	// Requests may keep the value slices they're given, so each step gets its own region.
+	buffer := make([]string, plan.singular)
+	used := 0
+	// Cookie parameters, as name=value pairs sent in one Cookie header.
+	var cookies []string
+	for i := range plan.steps {
+		step := &plan.steps[i]
+		message := message
+		if len(step.parents) > 0 {
+			message = step.nestedMessage(message)
+		}
+		if step.omitDefault && hasDefaultValue(message, step.field) {
+			continue
+		}
+		if step.presence && !message.HasField(step.field) {
+			continue
+		}
+		if step.streamBody && message.HasField(step.field) {
+			if body, ok := message.GetField(step.field).(proto.Message); ok {
+				produce := step.produceBody
+				if produceBody != nil {
+					produce = produceBody
+				}
+				reader, err := produce(body)
+				if err != nil {
+					return err
+				}
+				if err := request.SetBodyParam(reader); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if step.file {
+			if err := step.writeFile(message.GetField(step.field), request); err != nil {
+				return err
+			}
+			continue
+		}
+		if step.binary {
+			if err := step.writeBinaryBody(message.GetField(step.field), request); err != nil {
+				return err
+			}
+			continue
+		}
+		if step.messageFormat != "" {
+			if err := step.writeMessages(message.GetField(step.field).([]interface{}), request); err != nil {
+				return err
+			}
+			continue
+		}
+		var values []string
+		if step.repeated {
+			values = convertValues(message, step.field, step.toString)
+		} else {
+			buffer[used] = step.toString(message.GetField(step.field))
+			if step.omitEmpty && buffer[used] == "" {
+				continue
+			}
+			values = buffer[used : used+1 : used+1]
+			used++
+		}
+		if step.location == paramInCookie {
+			for _, value := range values {
+				if !isCookieValue(value) {
+					return status.Errorf(codes.InvalidArgument, "cookie parameter %s can't contain %q", step.name,
+						value)
+				}
+				cookies = append(cookies, step.name+"="+value)
+			}
+			continue
+		}
+		if err := step.writeValues(values, request); err != nil {
+			return err
+		}
+	}
+	if len(cookies) > 0 {
+		return request.SetHeaderParam("Cookie", strings.Join(cookies, "; "))
+	}
+	return nil
+}
+
+// Returns true if value may be sent as a cookie's value, unquoted, as RFC 6265 defines.
+func isCookieValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the nested message holding this step's field. If a message on the way is unset, returns
+// an empty message, whose field has its default value.
+func (step *paramStep) nestedMessage(message *dynamic.Message) *dynamic.Message {
+	for _, parent := range step.parents {
+		var nested *dynamic.Message
+		if message.HasField(parent) {
+			switch value := message.GetField(parent).(type) {
+			case *dynamic.Message:
+				nested = value
+			case proto.Message:
+				// Generated messages from a MessageFactory are read through a dynamic copy.
+				nested = dynamic.NewMessage(parent.GetMessageType())
+				if err := nested.MergeFrom(value); err != nil {
+					log.Printf("WARNING: Could not read field %s: %s", parent.GetFullyQualifiedName(), err)
+				}
+			}
+		}
+		if nested == nil {
+			return dynamic.NewMessage(step.field.GetOwner())
+		}
+		message = nested
+	}
+	return message
+}
+
+// Writes serialized values for this step's parameter to a request.
+func (step *paramStep) writeValues(values []string, request runtime.ClientRequest) error {
+	switch step.location {
+	case paramInQuery:
+		return request.SetQueryParam(step.name, values...)
+	case paramInHeader:
+		if step.joinHeader && len(values) > 0 {
+			return request.SetHeaderParam(step.name, joinHeaderValues(values))
+		}
+		return request.SetHeaderParam(step.name, values...)
+	case paramInForm:
+		return request.SetFormParam(step.name, values...)
+	case paramInPath:
+		if len(values) > 1 {
+			log.Printf("WARNING: parameter %s had multple values, only one allowed!", step.name)
+		}
+		escaped, err := escapePathValue(step.name, values[0])
+		if err != nil {
+			return err
+		}
+		return request.SetPathParam(step.name, escaped)
+	default:
+		if len(values) > 1 {
+			log.Printf("WARNING: parameter %s had multple values, only one allowed!", step.name)
+		}
+		// go-openapi expects this to be either a Reader, or something with a configured Producer.
+		return request.SetBodyParam(strings.NewReader(values[0]))
+	}
+}
+
+// Returns a reader of the JSON encoding of msg, for large request bodies. The message is encoded as
+// the body is read, rather than into an intermediate string; closing the reader abandons encoding.
+func jsonBodyReader(msg proto.Message) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		// Encoding runs outside the call, so a panic here fails the body rather than the process.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				writer.CloseWithError(fmt.Errorf("panic encoding request body: %v", recovered))
+			}
+		}()
+		writer.CloseWithError((&jsonpb.Marshaler{}).Marshal(writer, msg))
+	}()
+	return reader
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests that parameter locations are resolved, and unsupported locations rejected.
+func TestGetParamLocation(t *testing.T) {
+	fixtures := []struct {
+		in       string
+		location paramLocation
+		valid    bool
+	}{
+		{"query", paramInQuery, true},
+		{"header", paramInHeader, true},
+		{"path", paramInPath, true},
+		{"body", paramInBody, true},
+		{"formData", paramInForm, true},
+		{"cookie", paramInCookie, true},
+		{"elsewhere", 0, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.in, func(t *testing.T) {
+			assert := assertions.New(t)
+			location, err := getParamLocation(&spec.Parameter{ParamProps: spec.ParamProps{In: fixture.in}})
+			if fixture.valid {
+				assert.Nil(err)
+				assert.Equal(fixture.location, location)
+			} else {
+				assert.NotNil(err, "Expected an error for %s", fixture.in)
+			}
+		})
+	}
+}
+
+// Tests that a plan writes each step's values separately, and omits default values where asked.
+func TestParamPlanWrite(t *testing.T) {
+	assert := assertions.New(t)
+	inputType := testMethod(t, testServiceProto, "test_service.Items", "GetItem").GetInputType()
+	toString := func(value interface{}) string { return value.(string) }
+	var plan paramPlan
+	plan.add(paramStep{name: "itemId", location: paramInPath, field: inputType.FindFieldByName("itemId"),
+		toString: toString})
+	plan.add(paramStep{name: "filter", location: paramInQuery, field: inputType.FindFieldByName("filter"),
+		toString: toString})
+	plan.add(paramStep{name: "X-Filter", location: paramInHeader, field: inputType.FindFieldByName("filter"),
+		omitDefault: true, toString: toString})
+
+	message := dynamic.NewMessage(inputType)
+	require.Nil(t, jsonpb.UnmarshalString(`{"itemId": "abc", "filter": "new"}`, message))
+	request := newFakeClientRequest()
+	require.Nil(t, plan.write(message, request))
+	assert.Equal("abc", request.pathParams["itemId"])
+	assert.Equal([]string{"new"}, request.queryParams["filter"])
+	assert.Equal("new", request.headers.Get("X-Filter"))
+
+	message.ClearFieldByName("filter")
+	request = newFakeClientRequest()
+	require.Nil(t, plan.write(message, request))
+	assert.Equal([]string{""}, request.queryParams["filter"])
+	_, ok := request.headers["X-Filter"]
+	assert.False(ok, "Default value was written")
+}
+
+// Proto with a message body parameter.
+const bodyServiceProto = `
+syntax = "proto3";
+
+package body_test;
+
+message Widget {
+  string name = 1;
+  repeated string tags = 2;
+}
+
+message CreateWidgetRequest {
+  Widget widget = 1;
+}
+
+service Widgets {
+  rpc CreateWidget(CreateWidgetRequest) returns (Widget);
+}
+`
+
+// Tests that cookie parameters are sent together in the Cookie header, and unsafe values rejected.
+func TestParamPlanWritesCookies(t *testing.T) {
+	assert := assertions.New(t)
+	fileDesc, err := loadProtoFromBytes([]byte(bodyServiceProto))
+	require.Nil(t, err)
+	widgetType := fileDesc.FindMessage("body_test.Widget")
+	var plan paramPlan
+	for _, name := range []string{"name", "tags"} {
+		field := widgetType.FindFieldByName(name)
+		toString, err := getStringConverter(field, spec.QueryParam(name))
+		require.Nil(t, err)
+		plan.add(paramStep{name: name, location: paramInCookie, field: field, toString: toString,
+			repeated: field.IsRepeated()})
+	}
+
+	request := newFakeClientRequest()
+	require.Nil(t, plan.write(messageFromJSON(t, widgetType, `{"name": "gear", "tags": ["a", "b"]}`), request))
+	assert.Equal([]string{"name=gear; tags=a; tags=b"}, request.headers["Cookie"])
+
+	request = newFakeClientRequest()
+	err = plan.write(messageFromJSON(t, widgetType, `{"name": "gear; admin=1"}`), request)
+	assert.Equal(codes.InvalidArgument, errorCode(err), "Unsafe cookie value sent")
+}
+
+// Tests that message bodies are streamed as JSON, and unset bodies sent as null.
+func TestParamPlanStreamsBody(t *testing.T) {
+	assert := assertions.New(t)
+	inputType := testMethod(t, bodyServiceProto, "body_test.Widgets", "CreateWidget").GetInputType()
+	field := inputType.FindFieldByName("widget")
+	param := spec.BodyParam("widget", nil)
+	toString, err := getStringConverter(field, param)
+	require.Nil(t, err)
+	var plan paramPlan
+	plan.add(paramStep{name: "widget", location: paramInBody, field: field, toString: toString})
+	assert.True(plan.steps[0].streamBody, "Message body not streamed")
+
+	message := messageFromJSON(t, inputType, `{"widget": {"name": "gear", "tags": ["a", "b"]}}`)
+	request := newFakeClientRequest()
+	require.Nil(t, plan.write(message, request))
+	body, ok := request.body.(io.ReadCloser)
+	require.True(t, ok, "Expected a streamed body, got %T", request.body)
+	data, err := ioutil.ReadAll(body)
+	require.Nil(t, err)
+	assert.JSONEq(`{"name": "gear", "tags": ["a", "b"]}`, string(data))
+
+	request = newFakeClientRequest()
+	require.Nil(t, plan.write(dynamic.NewMessage(inputType), request))
+	reader, ok := request.body.(io.Reader)
+	require.True(t, ok, "Expected a body reader, got %T", request.body)
+	data, err = ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal("null", string(data))
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Validation of path templates, and escaping of the values expanded into them.
+//
+// A path segment may hold several parameters and literal text, like "/files/{dir}/{name}.{ext}"
+// or "/report{format}". go-openapi expands each parameter by replacing its placeholder, so values
+// are escaped first: a value can't add placeholders for later parameters. go-openapi then decodes
+// the expanded path and joins it to the base path, cleaning it, so values which would add or remove
+// segments once decoded are rejected: those with a '/', and those of only dots, which could form a
+// "." or ".." segment with the text around them.
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Returns an error if a path template's braces don't match, or it names a parameter which isn't a
+// declared path parameter.
+func validatePathTemplate(template string, parameters map[string]*spec.Parameter) error {
+	rest := template
+	for {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			break
+		}
+		if rest[open] == '}' {
+			return fmt.Errorf("path template %s has an unmatched '}'", template)
+		}
+		length := strings.IndexAny(rest[open+1:], "{}")
+		if length < 0 || rest[open+1+length] == '{' {
+			return fmt.Errorf("path template %s has an unmatched '{'", template)
+		}
+		name := rest[open+1 : open+1+length]
+		if name == "" {
+			return fmt.Errorf("path template %s has an empty parameter", template)
+		}
+		declared := false
+		for _, param := range parameters {
+			if param.In == "path" && param.Name == name {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			return fmt.Errorf("path template %s names undeclared path parameter %s", template, name)
+		}
+		rest = rest[open+1+length+1:]
+	}
+	return nil
+}
+
+// Returns a path parameter value escaped for expansion into a path template. Returns
+// InvalidArgument for values which would change the path's segments once it is decoded and cleaned.
+func escapePathValue(name, value string) (string, error) {
+	if strings.Contains(value, "/") {
+		return "", status.Errorf(codes.InvalidArgument, "path parameter %s can't contain '/'", name)
+	}
+	if value != "" && strings.Trim(value, ".") == "" {
+		return "", status.Errorf(codes.InvalidArgument, "path parameter %s can't be %q", name, value)
+	}
+	return url.PathEscape(value), nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Proto with fields for a multi-parameter path.
+const fileServiceProto = `
+syntax = "proto3";
+
+package file_test;
+
+message GetFileRequest {
+  string dir = 1;
+  string name = 2;
+  string ext = 3;
+}
+
+message File {
+  string content = 1;
+}
+
+service Files {
+  rpc GetFile(GetFileRequest) returns (File);
+}
+`
+
+// Path parameters for the file service.
+var fileServiceParams = map[string]*spec.Parameter{
+	"dir":  spec.PathParam("dir"),
+	"name": spec.PathParam("name"),
+	"ext":  spec.PathParam("ext"),
+}
+
+// Tests validation of path templates.
+func TestValidatePathTemplate(t *testing.T) {
+	fixtures := []struct {
+		template string
+		valid    bool
+	}{
+		{"/files/{dir}/{name}.{ext}", true},
+		{"/report{ext}", true},
+		{"/static/index.html", true},
+		{"/files/{dir", false},
+		{"/files/dir}", false},
+		{"/files/{{dir}}", false},
+		{"/files/{}", false},
+		{"/files/{missing}", false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.template, func(t *testing.T) {
+			err := validatePathTemplate(fixture.template, fileServiceParams)
+			assertions.Equal(t, fixture.valid, err == nil, "Unexpected result: %v", err)
+		})
+	}
+	assertions.NotNil(t, validatePathTemplate("/files/{dir}", map[string]*spec.Parameter{
+		"dir": spec.QueryParam("dir"),
+	}), "Expected error for a query parameter in the path")
+}
+
+// Tests expanding several parameters per segment, with values which need escaping.
+func TestPathTemplateExpansion(t *testing.T) {
+	assert := assertions.New(t)
+	var received string
+	adapter, closeServer := testOperation{
+		method:     testMethod(t, fileServiceProto, "file_test.Files", "GetFile"),
+		path:       "/files/{dir}/{name}.{ext}",
+		operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "getFile"}},
+		parameters: fileServiceParams,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			received = r.URL.EscapedPath()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"content": "hi"}`))
+		},
+	}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"dir": "a?b", "name": "{ext} x", "ext": "txt"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.Equal("/files/a%3Fb/%7Bext%7D%20x.txt", received)
+
+	for _, request := range []string{
+		`{"dir": "..", "name": "passwd", "ext": "txt"}`,
+		`{"dir": "a/b", "name": "passwd", "ext": "txt"}`,
+		`{"dir": "a", "name": ".", "ext": ""}`,
+	} {
+		stream = &fakeServerStream{request: request}
+		assert.Equal(codes.InvalidArgument, errorCode(adapter.handleGRPCRequest(stream)), request)
+	}
+}
+
+// Tests that path parameters can't reach other backend paths under a base path.
+func TestPathTraversal(t *testing.T) {
+	assert := assertions.New(t)
+	var received []string
+	adapter, closeServer := testOperation{basePath: "/api", handler: func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	}}.adapter(t)
+	defer closeServer()
+
+	for _, itemID := range []string{"../admin", "..", "%2e%2e", "a/../../admin"} {
+		stream := &fakeServerStream{request: `{"itemId": "` + itemID + `"}`}
+		err := adapter.handleGRPCRequest(stream)
+		if err == nil {
+			require.NotEmpty(t, received)
+			assert.Equal("/api/items/"+url.PathEscape(itemID), received[len(received)-1], itemID)
+		} else {
+			assert.Equal(codes.InvalidArgument, errorCode(err), itemID)
+		}
+	}
+	for _, path := range received {
+		assert.Contains(path, "/api/items/", "Request escaped the items path")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Plugins wrapping the stages converting calls to and from backend requests.
+//
+// A call is converted in three stages: each field sent as a parameter is serialized, a message sent
+// as the request body is encoded, and the response body is decoded into the output message. A
+// plugin wraps any of these stages by implementing ParamConverterPlugin, BodyProducerPlugin or
+// ResponseDecoderPlugin; each wrapper receives the stage it wraps, and may call it, adjust its
+// input or output, or replace it entirely. This lets conventions shared across an organization,
+// like an ID encoding or a response envelope, be packaged once and installed in every service.
+//
+// Plugins are applied in order, so the first plugin's wrapper is called first. Stages are wrapped
+// when an operation's adapter is built, rather than on each call.
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// ConversionPlugin customizes the conversion of calls. Plugins implement one or more of
+// ParamConverterPlugin, BodyProducerPlugin and ResponseDecoderPlugin; other plugins are ignored.
+type ConversionPlugin interface {
+	// PluginName names the plugin, for errors building adapters.
+	PluginName() string
+}
+
+// ParamConverterPlugin is a ConversionPlugin wrapping the serialization of fields sent as
+// parameters.
+type ParamConverterPlugin interface {
+	ConversionPlugin
+	// WrapParamConverter returns the converter for a parameter, given the converter it wraps. To leave
+	// the parameter unchanged, it returns next.
+	WrapParamConverter(binding *ParamBinding, next ParamConverter) ParamConverter
+}
+
+// BodyProducerPlugin is a ConversionPlugin wrapping the encoding of request bodies.
+type BodyProducerPlugin interface {
+	ConversionPlugin
+	// WrapBodyProducer returns the body producer for an operation, given the producer it wraps.
+	WrapBodyProducer(operation *OperationInfo, next BodyProducer) BodyProducer
+}
+
+// ResponseDecoderPlugin is a ConversionPlugin wrapping the decoding of response bodies.
+type ResponseDecoderPlugin interface {
+	ConversionPlugin
+	// WrapResponseDecoder returns the response decoder for an operation, given the decoder it wraps.
+	WrapResponseDecoder(operation *OperationInfo, next ResponseDecoder) ResponseDecoder
+}
+
+// ParamBinding describes a parameter and the field it is sent from.
+type ParamBinding struct {
+	// The operation the parameter belongs to.
+	Operation *OperationInfo
+	// The parameter, from the spec.
+	Param *spec.Parameter
+	// The request field holding the parameter's value.
+	Field *desc.FieldDescriptor
+}
+
+// BodyProducer encodes a message sent as a request body. By default, messages are encoded as JSON:
+// small messages as the request is written, and larger ones while the body is sent.
+type BodyProducer func(message proto.Message) (io.ReadCloser, error)
+
+// ResponseDecoder reads a response body into an empty message of the operation's output type. By
+// default, bodies are read as JSON, leniently.
+type ResponseDecoder func(body []byte, message *dynamic.Message) error
+
+// The default BodyProducer.
+func produceJSONBody(message proto.Message) (io.ReadCloser, error) {
+	return jsonBody(message), nil
+}
+
+// Returns a param converter wrapped by every plugin which wraps them.
+func wrapParamConverter(plugins []ConversionPlugin, binding *ParamBinding, converter ParamConverter) (ParamConverter, error) {
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if plugin, ok := plugins[i].(ParamConverterPlugin); ok {
+			if converter = plugin.WrapParamConverter(binding, converter); converter == nil {
+				return nil, fmt.Errorf("plugin %s returned no converter for parameter %s", plugin.PluginName(),
+					binding.Param.Name)
+			}
+		}
+	}
+	return converter, nil
+}
+
+// Returns a body producer wrapped by every plugin which wraps them.
+func wrapBodyProducer(plugins []ConversionPlugin, operation *OperationInfo, producer BodyProducer) (BodyProducer, error) {
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if plugin, ok := plugins[i].(BodyProducerPlugin); ok {
+			if producer = plugin.WrapBodyProducer(operation, producer); producer == nil {
+				return nil, fmt.Errorf("plugin %s returned no body producer", plugin.PluginName())
+			}
+		}
+	}
+	return producer, nil
+}
+
+// Returns a response decoder wrapped by every plugin which wraps them.
+func wrapResponseDecoder(plugins []ConversionPlugin, operation *OperationInfo, decoder ResponseDecoder) (ResponseDecoder, error) {
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if plugin, ok := plugins[i].(ResponseDecoderPlugin); ok {
+			if decoder = plugin.WrapResponseDecoder(operation, decoder); decoder == nil {
+				return nil, fmt.Errorf("plugin %s returned no response decoder", plugin.PluginName())
+			}
+		}
+	}
+	return decoder, nil
+}
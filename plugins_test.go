@@ -0,0 +1,139 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/dynamic"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto for an operation with query and body parameters.
+const pluginsProto = `
+syntax = "proto3";
+
+package plugins_test;
+
+message Widget {
+  string name = 1;
+}
+
+message CreateWidgetRequest {
+  Widget widget = 1;
+  string owner = 2;
+}
+
+service Widgets {
+  rpc CreateWidget(CreateWidgetRequest) returns (Widget);
+}
+`
+
+// A plugin sending bodies in, and reading responses from, a {"data": ...} envelope.
+type envelopePlugin struct{}
+
+func (envelopePlugin) PluginName() string { return "envelope" }
+
+func (envelopePlugin) WrapBodyProducer(operation *OperationInfo, next BodyProducer) BodyProducer {
+	return func(message proto.Message) (io.ReadCloser, error) {
+		body, err := next(message)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		enveloped, err := json.Marshal(map[string]json.RawMessage{"data": data})
+		return ioutil.NopCloser(bytes.NewReader(enveloped)), err
+	}
+}
+
+func (envelopePlugin) WrapResponseDecoder(operation *OperationInfo, next ResponseDecoder) ResponseDecoder {
+	return func(body []byte, message *dynamic.Message) error {
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return err
+		}
+		return next(envelope.Data, message)
+	}
+}
+
+// A plugin prefixing parameter values.
+type prefixPlugin string
+
+func (p prefixPlugin) PluginName() string { return "prefix" }
+
+func (p prefixPlugin) WrapParamConverter(binding *ParamBinding, next ParamConverter) ParamConverter {
+	return func(value interface{}) string { return string(p) + next(value) }
+}
+
+// A plugin returning no param converter.
+type brokenPlugin struct{}
+
+func (brokenPlugin) PluginName() string { return "broken" }
+
+func (brokenPlugin) WrapParamConverter(binding *ParamBinding, next ParamConverter) ParamConverter {
+	return nil
+}
+
+// Tests that plugins wrap each conversion stage, in order.
+func TestPlugins(t *testing.T) {
+	assert := assertions.New(t)
+	var owner string
+	var body []byte
+	createWidget := testOperation{
+		method:     testMethod(t, pluginsProto, "plugins_test.Widgets", "CreateWidget"),
+		httpMethod: "POST",
+		path:       "/widgets",
+		operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "createWidget"}},
+		parameters: map[string]*spec.Parameter{
+			"widget": spec.BodyParam("widget", nil),
+			"owner":  spec.QueryParam("owner").Typed("string", ""),
+		},
+		options: &ServiceOptions{
+			Plugins: []ConversionPlugin{prefixPlugin("a:"), envelopePlugin{}, prefixPlugin("b:")},
+		},
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			owner = r.URL.Query().Get("owner")
+			body, _ = ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": {"name": "created"}}`))
+		},
+	}
+	adapter, closeServer := createWidget.adapter(t)
+	defer closeServer()
+	stream := &fakeServerStream{request: `{"widget": {"name": "gear"}, "owner": "me"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.Equal("a:b:me", owner)
+	assert.JSONEq(`{"data": {"name": "gear"}}`, string(body))
+	require.Len(t, stream.sent, 1)
+	assert.Equal("created", stream.sent[0].GetFieldByName("name"))
+
+	createWidget.options = &ServiceOptions{Plugins: []ConversionPlugin{brokenPlugin{}}}
+	_, err := createWidget.newAdapter(t, "http://localhost")
+	assert.NotNil(err, "Expected error for a plugin returning no converter")
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Distinguishing unset parameters from empty ones.
+//
+// Proto3 scalar fields can't tell an unset value from an empty one, so a parameter which must be
+// sent empty is bound to a wrapper field, like google.protobuf.StringValue. A parameter bound to an
+// unset wrapper field is omitted; one bound to a set wrapper field is sent with the wrapper's value,
+// even if it's empty.
+//
+// Query parameters are only sent empty if they declare allowEmptyValue. Otherwise, an empty value
+// is omitted, as if it were unset.
+//
+// Optional query and header parameters are omitted when their fields hold default values, since
+// backends may read an explicit zero value as a filter. ServiceOptions.SendUnsetParams sends them.
+
+import (
+	"fmt"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Returns true if a parameter is omitted when its field has its default value.
+func omitsUnset(param *spec.Parameter, location paramLocation, options *ServiceOptions) bool {
+	return !param.Required && !options.SendUnsetParams &&
+		(location == paramInQuery || location == paramInHeader || location == paramInForm ||
+			location == paramInCookie)
+}
+
+// Fully-qualified names of the wrapper types which may be sent as parameters.
+var wrapperTypeNames = map[string]bool{
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.StringValue": true,
+}
+
+// Returns true if a field holds wrapper messages.
+func isWrapperField(field *desc.FieldDescriptor) bool {
+	return !field.IsMap() && field.GetMessageType() != nil &&
+		wrapperTypeNames[field.GetMessageType().GetFullyQualifiedName()]
+}
+
+// Returns a serializer for the value of a wrapper message field.
+func wrapperStringConverter(field *desc.FieldDescriptor) func(interface{}) string {
+	wrapperType := field.GetMessageType()
+	valueField := wrapperType.FindFieldByName("value")
+	return func(value interface{}) string {
+		source, ok := value.(proto.Message)
+		if !ok {
+			return ""
+		}
+		// The value may be a generated or dynamic message.
+		wrapper := dynamic.NewMessage(wrapperType)
+		if err := wrapper.MergeFrom(source); err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%v", wrapper.GetField(valueField))
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto with wrapper and plain fields for query parameters.
+const presenceServiceProto = `
+syntax = "proto3";
+
+package presence_test;
+
+import "google/protobuf/wrappers.proto";
+
+message SearchRequest {
+  google.protobuf.StringValue name = 1;
+  google.protobuf.Int32Value limit = 2;
+  string tag = 3;
+  string color = 4;
+}
+
+message SearchResponse {}
+
+service Search {
+  rpc Search(SearchRequest) returns (SearchResponse);
+}
+`
+
+// Tests that wrapper fields and optional parameters are omitted when unset, and that empty values
+// are only sent where allowed.
+func TestParamPresence(t *testing.T) {
+	var received url.Values
+	name := spec.QueryParam("name").Typed("string", "")
+	name.AllowEmptyValue = true
+	tag := spec.QueryParam("tag").Typed("string", "")
+	tag.AllowEmptyValue = true
+	parameters := map[string]*spec.Parameter{
+		"name":  name,
+		"limit": spec.QueryParam("limit").Typed("integer", "int32"),
+		"tag":   tag,
+		"color": spec.QueryParam("color").Typed("string", ""),
+	}
+	search := testOperation{
+		method:     testMethod(t, presenceServiceProto, "presence_test.Search", "Search"),
+		path:       "/search",
+		operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: "search"}},
+		parameters: parameters,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			received = r.URL.Query()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		},
+	}
+
+	fixtures := []struct {
+		name      string
+		sendUnset bool
+		request   string
+		expected  url.Values
+	}{
+		{"Unset", false, `{}`, url.Values{}},
+		{"UnsetSent", true, `{}`, url.Values{"tag": {""}}},
+		{"SetEmpty", false, `{"name": "", "limit": 0}`, url.Values{"name": {""}, "limit": {"0"}}},
+		{"Set", false, `{"name": "a", "limit": 5, "tag": "b", "color": "red"}`,
+			url.Values{"name": {"a"}, "limit": {"5"}, "tag": {"b"}, "color": {"red"}}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			search.options = &ServiceOptions{SendUnsetParams: fixture.sendUnset}
+			adapter, closeServer := search.adapter(t)
+			defer closeServer()
+			require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: fixture.request}))
+			assertions.Equal(t, fixture.expected, received)
+		})
+	}
+}
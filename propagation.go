@@ -0,0 +1,269 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Trace-context propagation from incoming gRPC metadata to backend HTTP headers.
+//
+// The proxy does not create spans of its own, so the caller's span ID is forwarded as the parent of
+// the backend request.
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Sampling is a propagated sampling decision.
+type Sampling int
+
+const (
+	// SamplingUnset means no decision was propagated; the receiver decides.
+	SamplingUnset Sampling = iota
+	// SamplingAccept means the trace is sampled.
+	SamplingAccept
+	// SamplingDeny means the trace is not sampled.
+	SamplingDeny
+)
+
+// TraceContext is a trace context received from a caller. Any field may be empty.
+type TraceContext struct {
+	// Hex-encoded trace ID; 32 characters for W3C, 16 or 32 for B3.
+	TraceID string
+	// Hex-encoded 16-character ID of the caller's span.
+	SpanID string
+	// The caller's sampling decision.
+	Sampling Sampling
+	// The caller's request ID, from the x-request-id metadata key.
+	RequestID string
+}
+
+// Propagator reads a trace context from incoming gRPC metadata, and writes it to backend requests in
+// a particular header format.
+type Propagator interface {
+	// Extract reads a trace context in this format from incoming metadata. Returns nil if none is
+	// present.
+	Extract(md metadata.MD) *TraceContext
+	// Inject writes the trace context to a backend request in this format.
+	Inject(tc *TraceContext, request runtime.ClientRequest) error
+}
+
+// Propagators for the built-in formats. Each of these also forwards the request ID, if one was
+// received.
+var (
+	// W3CPropagator uses the W3C Trace Context "traceparent" header.
+	W3CPropagator Propagator = w3cPropagator{}
+	// B3SinglePropagator uses the single Zipkin "b3" header.
+	B3SinglePropagator Propagator = b3SinglePropagator{}
+	// B3MultiPropagator uses the Zipkin "X-B3-*" headers.
+	B3MultiPropagator Propagator = b3MultiPropagator{}
+	// RequestIDPropagator only forwards the "X-Request-ID" header.
+	RequestIDPropagator Propagator = requestIDPropagator{}
+)
+
+// Built-in propagators, in the order they are tried when extracting a caller's trace context.
+var builtinPropagators = []Propagator{
+	W3CPropagator, B3SinglePropagator, B3MultiPropagator, RequestIDPropagator,
+}
+
+// Header & metadata key names.
+const (
+	traceparentHeader = "traceparent"
+	b3Header          = "b3"
+	b3TraceIDHeader   = "X-B3-TraceId"
+	b3SpanIDHeader    = "X-B3-SpanId"
+	b3SampledHeader   = "X-B3-Sampled"
+	requestIDHeader   = "X-Request-ID"
+)
+
+// Returns the trace context of a call, extracted first with the configured propagator and then in
+// any of the built-in formats. Returns nil if the caller sent none.
+func extractTraceContext(propagator Propagator, md metadata.MD) *TraceContext {
+	if tc := propagator.Extract(md); tc != nil {
+		return tc
+	}
+	for _, builtin := range builtinPropagators {
+		if tc := builtin.Extract(md); tc != nil {
+			return tc
+		}
+	}
+	return nil
+}
+
+// Writes the caller's trace context, if they sent one, to a backend request with the configured
+// propagator.
+func (p *operationAdapter) propagateTraceContext(ctx context.Context, request runtime.ClientRequest) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tc := extractTraceContext(p.options.Propagator, md)
+	if tc == nil {
+		return nil
+	}
+	return p.options.Propagator.Inject(tc, request)
+}
+
+// Returns the first value of a metadata key, matched case-insensitively, or the empty string.
+func firstMetadataValue(md metadata.MD, key string) string {
+	values := md[strings.ToLower(key)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Writes the request ID header, if there is a request ID.
+func injectRequestID(tc *TraceContext, request runtime.ClientRequest) error {
+	if tc.RequestID == "" {
+		return nil
+	}
+	return request.SetHeaderParam(requestIDHeader, tc.RequestID)
+}
+
+type w3cPropagator struct{}
+
+func (w3cPropagator) Extract(md metadata.MD) *TraceContext {
+	// Format: version-traceid-parentid-flags.
+	parts := strings.Split(firstMetadataValue(md, traceparentHeader), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil
+	}
+	tc := &TraceContext{
+		TraceID:   parts[1],
+		SpanID:    parts[2],
+		Sampling:  SamplingDeny,
+		RequestID: firstMetadataValue(md, requestIDHeader),
+	}
+	if flags, err := strconv.ParseUint(parts[3], 16, 8); err == nil && flags&1 == 1 {
+		tc.Sampling = SamplingAccept
+	}
+	return tc
+}
+
+func (w3cPropagator) Inject(tc *TraceContext, request runtime.ClientRequest) error {
+	if len(tc.SpanID) == 16 && (len(tc.TraceID) == 32 || len(tc.TraceID) == 16) {
+		flags := "00"
+		if tc.Sampling == SamplingAccept {
+			flags = "01"
+		}
+		// 64-bit B3 trace IDs are left-padded to 128 bits.
+		traceID := strings.Repeat("0", 32-len(tc.TraceID)) + tc.TraceID
+		err := request.SetHeaderParam(traceparentHeader, "00-"+traceID+"-"+tc.SpanID+"-"+flags)
+		if err != nil {
+			return err
+		}
+	}
+	return injectRequestID(tc, request)
+}
+
+type b3SinglePropagator struct{}
+
+func (b3SinglePropagator) Extract(md metadata.MD) *TraceContext {
+	// Format: traceid-spanid[-sampled[-parentspanid]]. A lone sampling flag is also legal, but
+	// carries no trace to propagate.
+	parts := strings.Split(firstMetadataValue(md, b3Header), "-")
+	if len(parts) < 2 {
+		return nil
+	}
+	tc := &TraceContext{
+		TraceID:   parts[0],
+		SpanID:    parts[1],
+		RequestID: firstMetadataValue(md, requestIDHeader),
+	}
+	if len(parts) > 2 {
+		tc.Sampling = parseB3Sampling(parts[2])
+	}
+	return tc
+}
+
+func (b3SinglePropagator) Inject(tc *TraceContext, request runtime.ClientRequest) error {
+	if tc.TraceID != "" && tc.SpanID != "" {
+		value := tc.TraceID + "-" + tc.SpanID
+		switch tc.Sampling {
+		case SamplingAccept:
+			value += "-1"
+		case SamplingDeny:
+			value += "-0"
+		}
+		if err := request.SetHeaderParam(b3Header, value); err != nil {
+			return err
+		}
+	}
+	return injectRequestID(tc, request)
+}
+
+type b3MultiPropagator struct{}
+
+func (b3MultiPropagator) Extract(md metadata.MD) *TraceContext {
+	traceID := firstMetadataValue(md, b3TraceIDHeader)
+	spanID := firstMetadataValue(md, b3SpanIDHeader)
+	if traceID == "" || spanID == "" {
+		return nil
+	}
+	return &TraceContext{
+		TraceID:   traceID,
+		SpanID:    spanID,
+		Sampling:  parseB3Sampling(firstMetadataValue(md, b3SampledHeader)),
+		RequestID: firstMetadataValue(md, requestIDHeader),
+	}
+}
+
+func (b3MultiPropagator) Inject(tc *TraceContext, request runtime.ClientRequest) error {
+	if tc.TraceID != "" && tc.SpanID != "" {
+		if err := request.SetHeaderParam(b3TraceIDHeader, tc.TraceID); err != nil {
+			return err
+		}
+		if err := request.SetHeaderParam(b3SpanIDHeader, tc.SpanID); err != nil {
+			return err
+		}
+		switch tc.Sampling {
+		case SamplingAccept:
+			if err := request.SetHeaderParam(b3SampledHeader, "1"); err != nil {
+				return err
+			}
+		case SamplingDeny:
+			if err := request.SetHeaderParam(b3SampledHeader, "0"); err != nil {
+				return err
+			}
+		}
+	}
+	return injectRequestID(tc, request)
+}
+
+// Parses a B3 sampling flag. "d" is the debug flag, which implies sampling.
+func parseB3Sampling(value string) Sampling {
+	switch value {
+	case "1", "d", "true":
+		return SamplingAccept
+	case "0", "false":
+		return SamplingDeny
+	default:
+		return SamplingUnset
+	}
+}
+
+type requestIDPropagator struct{}
+
+func (requestIDPropagator) Extract(md metadata.MD) *TraceContext {
+	requestID := firstMetadataValue(md, requestIDHeader)
+	if requestID == "" {
+		return nil
+	}
+	return &TraceContext{RequestID: requestID}
+}
+
+func (requestIDPropagator) Inject(tc *TraceContext, request runtime.ClientRequest) error {
+	return injectRequestID(tc, request)
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests conversion between incoming trace metadata and each propagator's headers.
+func TestPropagators(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const spanID = "00f067aa0ba902b7"
+	fixtures := []struct {
+		name       string
+		propagator Propagator
+		incoming   metadata.MD
+		headers    http.Header
+	}{
+		{
+			"W3CToB3Single",
+			B3SinglePropagator,
+			metadata.Pairs("traceparent", "00-"+traceID+"-"+spanID+"-01"),
+			http.Header{"B3": {traceID + "-" + spanID + "-1"}},
+		},
+		{
+			"B3SingleToW3C",
+			W3CPropagator,
+			metadata.Pairs("b3", "a3ce929d0e0e4736-"+spanID+"-0", "x-request-id", "req-1"),
+			http.Header{
+				"Traceparent":  {"00-0000000000000000a3ce929d0e0e4736-" + spanID + "-00"},
+				"X-Request-Id": {"req-1"},
+			},
+		},
+		{
+			"B3MultiToB3Multi",
+			B3MultiPropagator,
+			metadata.Pairs("x-b3-traceid", traceID, "x-b3-spanid", spanID),
+			http.Header{"X-B3-Traceid": {traceID}, "X-B3-Spanid": {spanID}},
+		},
+		{
+			"W3CToB3Multi",
+			B3MultiPropagator,
+			metadata.Pairs("traceparent", "00-"+traceID+"-"+spanID+"-01"),
+			http.Header{"X-B3-Traceid": {traceID}, "X-B3-Spanid": {spanID}, "X-B3-Sampled": {"1"}},
+		},
+		{
+			"RequestIDOnly",
+			RequestIDPropagator,
+			metadata.Pairs("traceparent", "00-"+traceID+"-"+spanID+"-01", "x-request-id", "req-2"),
+			http.Header{"X-Request-Id": {"req-2"}},
+		},
+		{
+			"MalformedTraceparent",
+			W3CPropagator,
+			metadata.Pairs("traceparent", "00-abc"),
+			http.Header{},
+		},
+		{
+			"NoTraceContext",
+			W3CPropagator,
+			metadata.Pairs("other", "value"),
+			http.Header{},
+		},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			adapter := &operationAdapter{options: &ServiceOptions{Propagator: fixture.propagator}}
+			request := newFakeClientRequest()
+			ctx := metadata.NewIncomingContext(context.Background(), fixture.incoming)
+			err := adapter.propagateTraceContext(ctx, request)
+			assert.Nil(err, "Error propagating: %v", err)
+			assert.Equal(fixture.headers, request.headers, "Bad propagated headers")
+		})
+	}
+}
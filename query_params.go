@@ -0,0 +1,98 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Configured query parameters added to every backend request of an operation.
+//
+// Values are constant, like "api-version=2023-01-01", or templates drawing on the caller's
+// metadata, like "tenant={metadata:x-tenant-id}". A parameter whose template names metadata the
+// caller didn't send is omitted.
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/go-openapi/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Matches a metadata reference in a query parameter template.
+var metadataReference = regexp.MustCompile(`\{metadata:([^{}]+)\}`)
+
+// A configured query parameter, with its value template split into literal text and metadata keys.
+type queryParam struct {
+	name string
+	// Literal text, interleaved with the metadata values; there is one more literal than key.
+	literals []string
+	// Metadata keys.
+	keys []string
+}
+
+// Returns the operation's configured query parameters, sorted by name.
+func resolveQueryParams(operationOptions *OperationOptions) []queryParam {
+	params := make([]queryParam, 0, len(operationOptions.QueryParams))
+	for name, template := range operationOptions.QueryParams {
+		param := queryParam{name: name}
+		last := 0
+		for _, match := range metadataReference.FindAllStringSubmatchIndex(template, -1) {
+			param.literals = append(param.literals, template[last:match[0]])
+			param.keys = append(param.keys, template[match[2]:match[3]])
+			last = match[1]
+		}
+		param.literals = append(param.literals, template[last:])
+		params = append(params, param)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].name < params[j].name })
+	return params
+}
+
+// Returns the parameter's value for a call, or false if it names metadata the call doesn't have.
+func (q *queryParam) value(md metadata.MD) (string, bool) {
+	if len(q.keys) == 0 {
+		return q.literals[0], true
+	}
+	value := q.literals[0]
+	for i, key := range q.keys {
+		metadataValue := firstMetadataValue(md, key)
+		if metadataValue == "" {
+			return "", false
+		}
+		value += metadataValue + q.literals[i+1]
+	}
+	return value, true
+}
+
+// Returns the parameter's value template, as configured.
+func (q *queryParam) template() string {
+	template := q.literals[0]
+	for i, key := range q.keys {
+		template += "{metadata:" + key + "}" + q.literals[i+1]
+	}
+	return template
+}
+
+// Sets this operation's configured query parameters on a request.
+func (p *operationAdapter) writeQueryParams(ctx context.Context, request runtime.ClientRequest) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for i := range p.queryParams {
+		if value, ok := p.queryParams[i].value(md); ok {
+			if err := request.SetQueryParam(p.queryParams[i].name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that templates are filled from metadata, and omitted when metadata is missing.
+func TestQueryParamValue(t *testing.T) {
+	md := metadata.Pairs("x-tenant", "acme", "x-region", "west")
+	fixtures := []struct {
+		template string
+		expected string
+		ok       bool
+	}{
+		{"2023-01-01", "2023-01-01", true},
+		{"{metadata:x-tenant}", "acme", true},
+		{"t-{metadata:X-Tenant}/{metadata:x-region}!", "t-acme/west!", true},
+		{"{metadata:x-missing}", "", false},
+		{"{metadata:}", "{metadata:}", true},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.template, func(t *testing.T) {
+			params := resolveQueryParams(&OperationOptions{QueryParams: map[string]string{"p": fixture.template}})
+			require.Len(t, params, 1)
+			value, ok := params[0].value(md)
+			assertions.Equal(t, fixture.ok, ok)
+			assertions.Equal(t, fixture.expected, value)
+		})
+	}
+}
+
+// Tests that configured query parameters are sent, with request parameters taking precedence.
+func TestQueryParamsSent(t *testing.T) {
+	assert := assertions.New(t)
+	var received url.Values
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{"getItem": {QueryParams: map[string]string{
+		"api-version": "2023-01-01",
+		"tenant":      "{metadata:x-tenant}",
+		"filter":      "overridden",
+	}}}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))
+	stream := &fakeServerStream{ctx: ctx, request: `{"itemId": "abc", "filter": "new"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	assert.Equal("2023-01-01", received.Get("api-version"))
+	assert.Equal("acme", received.Get("tenant"))
+	assert.Equal("new", received.Get("filter"))
+}
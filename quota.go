@@ -0,0 +1,168 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Per-caller request quotas.
+//
+// Quotas count requests in fixed windows: a limit of 100 requests per minute allows 100 requests in
+// each calendar minute. Counts are kept in a QuotaStore, which may be shared between proxy
+// instances.
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// QuotaLimit is a limit on the number of requests a caller may make to an operation in a period.
+type QuotaLimit struct {
+	Requests int64
+	Period   time.Duration
+}
+
+// QuotaOptions configures per-caller quotas.
+type QuotaOptions struct {
+	// The incoming gRPC metadata key identifying unauthenticated callers for quotas, such as an API
+	// key. Authenticated callers are identified by their subject, so that they can't choose their own
+	// quota by setting this key. Calls with no identity share a single quota.
+	MetadataKey string
+	// Limits on each caller's requests to each operation. These are overridden by OperationOptions.
+	Limits []QuotaLimit
+	// Store for request counts. Defaults to an in-memory store, shared by the service's operations.
+	Store QuotaStore
+}
+
+// QuotaStore counts requests for quotas. An implementation backed by a shared store, such as Redis
+// (with INCR and EXPIREAT), applies quotas across proxy instances. Implementations must be safe for
+// concurrent use.
+type QuotaStore interface {
+	// Increment adds one to the count for a key in the window ending at windowEnd, returning the new
+	// count. Counts for a window may be discarded once it ends.
+	Increment(ctx context.Context, key string, windowEnd time.Time) (int64, error)
+}
+
+// Returns an error if any of the given limits is invalid.
+func validateQuotaLimits(limits []QuotaLimit) error {
+	for _, limit := range limits {
+		if limit.Period <= 0 {
+			return fmt.Errorf("quota period must be positive, got %s", limit.Period)
+		}
+	}
+	return nil
+}
+
+// Returns the caller's identity for quotas: the authenticated subject, or else the metadata value.
+func (o *QuotaOptions) quotaCaller(ctx context.Context) string {
+	if caller := CallerFromContext(ctx); caller != nil && caller.Subject != "" {
+		return caller.Subject
+	}
+	if o.MetadataKey != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		return firstMetadataValue(md, o.MetadataKey)
+	}
+	return ""
+}
+
+// Counts a call against the caller's quotas for this operation, returning ResourceExhausted with
+// QuotaFailure and RetryInfo details if any is exceeded. Calls are allowed if the store fails.
+func (p *operationAdapter) checkQuota(ctx context.Context) error {
+	quota := p.options.Quota
+	limits := quota.Limits
+	if p.operationOptions.QuotaLimits != nil {
+		limits = p.operationOptions.QuotaLimits
+	}
+	caller := quota.quotaCaller(ctx)
+	now := time.Now()
+	for _, limit := range limits {
+		windowEnd := now.Truncate(limit.Period).Add(limit.Period)
+		key := fmt.Sprintf("%s|%s|%s", p.operation.ID, limit.Period, caller)
+		count, err := p.options.quotaStore().Increment(ctx, key, windowEnd)
+		if err != nil {
+			log.Printf("WARNING: Could not count quota for %s: %s", p.operation.ID, err)
+			continue
+		}
+		if count > limit.Requests {
+			return quotaExceededError(p.operation.ID, caller, limit, windowEnd.Sub(now))
+		}
+	}
+	return nil
+}
+
+// Returns the error for an exceeded quota, which resets after retryDelay.
+func quotaExceededError(operationID, caller string, limit QuotaLimit, retryDelay time.Duration) error {
+	description := fmt.Sprintf("%d requests per %s to %s", limit.Requests, limit.Period, operationID)
+	exceeded := status.Newf(codes.ResourceExhausted, "quota exceeded: %s", description)
+	withDetails, err := exceeded.WithDetails(
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{
+			{Subject: "caller:" + caller, Description: description},
+		}},
+		&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(retryDelay)},
+	)
+	if err != nil {
+		return exceeded.Err()
+	}
+	return withDetails.Err()
+}
+
+// NewMemoryQuotaStore returns a QuotaStore keeping counts in memory, for a single proxy instance.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{counts: make(map[string]*quotaCount)}
+}
+
+// How often a memory store discards counts for ended windows.
+const quotaSweepInterval = time.Minute
+
+type memoryQuotaStore struct {
+	// Guards all fields below.
+	mutex  sync.Mutex
+	counts map[string]*quotaCount
+	// When ended windows were last discarded.
+	lastSweep time.Time
+}
+
+// The count of requests in a window.
+type quotaCount struct {
+	windowEnd time.Time
+	count     int64
+}
+
+func (s *memoryQuotaStore) Increment(ctx context.Context, key string, windowEnd time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= quotaSweepInterval {
+		for countKey, count := range s.counts {
+			if !now.Before(count.windowEnd) {
+				delete(s.counts, countKey)
+			}
+		}
+		s.lastSweep = now
+	}
+	count, ok := s.counts[key]
+	if !ok || !count.windowEnd.Equal(windowEnd) {
+		count = &quotaCount{windowEnd: windowEnd}
+		s.counts[key] = count
+	}
+	count.count++
+	return count.count, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Returns a call stream from the caller with the given API key.
+func apiKeyStream(apiKey string) *fakeServerStream {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", apiKey))
+	return &fakeServerStream{ctx: ctx, request: `{"itemId": "abc"}`}
+}
+
+// Tests that callers are limited to their quota, independently of each other.
+func TestHandleGRPCRequestQuota(t *testing.T) {
+	assert := assertions.New(t)
+	options := &ServiceOptions{Quota: &QuotaOptions{
+		MetadataKey: "X-API-Key",
+		Limits:      []QuotaLimit{{Requests: 2, Period: time.Hour}},
+	}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(apiKeyStream("a")))
+	assert.Nil(adapter.handleGRPCRequest(apiKeyStream("a")))
+	err := adapter.handleGRPCRequest(apiKeyStream("a"))
+	assert.Nil(adapter.handleGRPCRequest(apiKeyStream("b")), "Quota shared between callers")
+
+	errStatus, _ := status.FromError(err)
+	require.Equal(t, codes.ResourceExhausted, errStatus.Code(), "Expected quota to be exceeded")
+	details := errStatus.Details()
+	require.Len(t, details, 2)
+	quotaFailure, ok := details[0].(*errdetails.QuotaFailure)
+	require.True(t, ok, "Expected QuotaFailure, got %T", details[0])
+	assert.Equal("caller:a", quotaFailure.Violations[0].Subject)
+	_, ok = details[1].(*errdetails.RetryInfo)
+	assert.True(ok, "Expected RetryInfo, got %T", details[1])
+}
+
+// Tests that callers are identified by their authenticated subject in preference to metadata.
+func TestQuotaCaller(t *testing.T) {
+	options := &QuotaOptions{MetadataKey: "X-API-Key"}
+	withKey := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "key"))
+	fixtures := []struct {
+		name       string
+		ctx        context.Context
+		wantCaller string
+	}{
+		{"none", context.Background(), ""},
+		{"metadata", withKey, "key"},
+		{"subject", context.WithValue(context.Background(), callerKey{}, &Caller{Subject: "alice"}), "alice"},
+		{"subject and metadata", context.WithValue(withKey, callerKey{}, &Caller{Subject: "alice"}), "alice"},
+		{"empty subject", context.WithValue(withKey, callerKey{}, &Caller{}), "key"},
+	}
+	for _, fixture := range fixtures {
+		assertions.Equal(t, fixture.wantCaller, options.quotaCaller(fixture.ctx), fixture.name)
+	}
+}
+
+// Tests that an operation's empty limits disable the service's quota.
+func TestOperationQuotaOverride(t *testing.T) {
+	options := &ServiceOptions{
+		Quota:      &QuotaOptions{Limits: []QuotaLimit{{Requests: 1, Period: time.Hour}}},
+		Operations: map[string]*OperationOptions{"getItem": {QuotaLimits: []QuotaLimit{}}},
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+	for i := 0; i < 3; i++ {
+		assertions.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	}
+}
+
+// Tests that the memory store counts per key and window.
+func TestMemoryQuotaStore(t *testing.T) {
+	assert := assertions.New(t)
+	store := NewMemoryQuotaStore()
+	ctx := context.Background()
+	window := time.Now().Add(time.Minute)
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Increment(ctx, "a", window)
+		assert.Nil(err)
+		assert.Equal(i, count)
+	}
+	count, _ := store.Increment(ctx, "b", window)
+	assert.Equal(int64(1), count, "Keys not counted separately")
+	count, _ = store.Increment(ctx, "a", window.Add(time.Minute))
+	assert.Equal(int64(1), count, "Count not reset for a new window")
+}
@@ -0,0 +1,265 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Startup readiness gating.
+//
+// A server that starts accepting calls before its adapters are built, its token signing keys are
+// fetched, or its backends can be reached fails those calls. Readiness runs checks of each such
+// dependency, and only reports the server ready, through Ready, the gRPC health service and Gate,
+// once every check has passed. Readiness is for startup only: once ready, a server stays ready.
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// The default interval between rounds of readiness checks in Readiness.Wait.
+const defaultReadinessInterval = time.Second
+
+// ReadinessCheck checks that a dependency of the server is available, returning an error if not.
+type ReadinessCheck func(ctx context.Context) error
+
+// Readiness tracks whether a server's startup dependencies are available. It is safe for concurrent
+// use.
+type Readiness struct {
+	// Closed once the server is ready.
+	ready chan struct{}
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// Names of the checks, in the order they were added.
+	names []string
+	// Checks which haven't yet passed, keyed by name.
+	pending map[string]ReadinessCheck
+	// The error from the last run of each pending check which failed, keyed by name.
+	failures map[string]error
+	// The health server to report readiness to, and the services to report it for.
+	health         *health.Server
+	healthServices []string
+}
+
+// NewReadiness returns readiness with no checks. Until checks are run, it isn't ready.
+func NewReadiness() *Readiness {
+	return &Readiness{
+		ready:    make(chan struct{}),
+		pending:  make(map[string]ReadinessCheck),
+		failures: make(map[string]error),
+	}
+}
+
+// AddCheck adds a check, which must pass before the server is ready. Adding a check with the name of
+// an earlier one replaces it. Checks added once the server is ready are never run.
+func (r *Readiness) AddCheck(name string, check ReadinessCheck) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	known := false
+	for _, existing := range r.names {
+		known = known || existing == name
+	}
+	if !known {
+		r.names = append(r.names, name)
+	}
+	r.pending[name] = check
+}
+
+// Ready returns a channel which is closed once the server is ready.
+func (r *Readiness) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// IsReady returns true if the server is ready.
+func (r *Readiness) IsReady() bool {
+	select {
+	case <-r.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Failures returns the errors from the last run of each check which hasn't passed, keyed by name.
+func (r *Readiness) Failures() map[string]error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	failures := make(map[string]error, len(r.failures))
+	for name, err := range r.failures {
+		failures[name] = err
+	}
+	return failures
+}
+
+// SetHealthServer reports readiness to a gRPC health server, as NOT_SERVING for the given services
+// until the server is ready, and SERVING after. This should list every proxied service; the health
+// server may report the empty service name, the server as a whole, as SERVING regardless.
+func (r *Readiness) SetHealthServer(server *health.Server, services ...string) {
+	r.mutex.Lock()
+	r.health, r.healthServices = server, services
+	r.mutex.Unlock()
+	r.reportHealth()
+}
+
+// Check runs each check which hasn't yet passed, concurrently, and returns true if the server is
+// then ready. The server becomes ready when every check has passed, even if there are none.
+func (r *Readiness) Check(ctx context.Context) bool {
+	if r.IsReady() {
+		return true
+	}
+	r.mutex.Lock()
+	pending := make(map[string]ReadinessCheck, len(r.pending))
+	for name, check := range r.pending {
+		pending[name] = check
+	}
+	r.mutex.Unlock()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(pending))
+	for name, check := range pending {
+		go func(name string, check ReadinessCheck) {
+			results <- result{name, check(ctx)}
+		}(name, check)
+	}
+	for range pending {
+		result := <-results
+		r.mutex.Lock()
+		if result.err == nil {
+			delete(r.pending, result.name)
+			delete(r.failures, result.name)
+		} else {
+			r.failures[result.name] = result.err
+		}
+		r.mutex.Unlock()
+	}
+
+	r.mutex.Lock()
+	ready := len(r.pending) == 0
+	if ready && !r.IsReady() {
+		close(r.ready)
+	}
+	r.mutex.Unlock()
+	if ready {
+		r.reportHealth()
+	}
+	return ready
+}
+
+// Wait runs the checks every interval until the server is ready, or ctx is done. Returns nil once
+// the server is ready, or else an error listing the checks which haven't passed. An interval of zero
+// means one second.
+func (r *Readiness) Wait(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultReadinessInterval
+	}
+	for !r.Check(ctx) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server not ready: %s", r.describeFailures())
+		case <-time.After(interval):
+		}
+	}
+	return nil
+}
+
+// Gate returns a handler failing calls with Unavailable until the server is ready, and passing them
+// to handler after.
+func (r *Readiness) Gate(handler grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		if !r.IsReady() {
+			return status.Error(codes.Unavailable, "server is not ready")
+		}
+		return handler(srv, stream)
+	}
+}
+
+// Reports the current readiness to the health server, if there is one.
+func (r *Readiness) reportHealth() {
+	r.mutex.Lock()
+	server, services := r.health, r.healthServices
+	r.mutex.Unlock()
+	if server == nil {
+		return
+	}
+	servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+	if r.IsReady() {
+		servingStatus = healthpb.HealthCheckResponse_SERVING
+	}
+	for _, service := range services {
+		server.SetServingStatus(service, servingStatus)
+	}
+}
+
+// Returns the failures of checks which haven't passed, in the order the checks were added.
+func (r *Readiness) describeFailures() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var descriptions []string
+	for _, name := range r.names {
+		if _, ok := r.pending[name]; !ok {
+			continue
+		}
+		if err, ok := r.failures[name]; ok {
+			descriptions = append(descriptions, fmt.Sprintf("%s: %v", name, err))
+		} else {
+			descriptions = append(descriptions, name+": not checked")
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// BackendCheck returns a check passing once the backend at baseURL responds to warm-up requests;
+// see WarmUp. Options may be nil.
+func BackendCheck(client *http.Client, baseURL string, options *WarmUpOptions) ReadinessCheck {
+	return func(ctx context.Context) error {
+		return WarmUp(ctx, client, baseURL, options)
+	}
+}
+
+// RegistryCheck returns a check passing once a registry has operations, and each of their adapters
+// has been built. Adapters deferred by LazyAdapters are built by the check.
+func RegistryCheck(registry *OperationRegistry) ReadinessCheck {
+	return func(ctx context.Context) error {
+		operations := registry.current()
+		if len(operations) == 0 {
+			return fmt.Errorf("no operations registered")
+		}
+		var failed []string
+		for method, operation := range operations {
+			if lazy, ok := operation.handler.(*lazyAdapter); ok {
+				if _, err := lazy.get(); err != nil {
+					failed = append(failed, method)
+				}
+			}
+		}
+		if len(failed) > 0 {
+			sort.Strings(failed)
+			return fmt.Errorf("could not build operations for %s", strings.Join(failed, ", "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Tests that readiness waits for every check to pass, and doesn't rerun checks which passed.
+func TestReadiness(t *testing.T) {
+	assert := assertions.New(t)
+	readiness := NewReadiness()
+	healthServer := health.NewServer()
+	readiness.SetHealthServer(healthServer, "test_service.Items", "test_service.Orders")
+	servingStatus := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		response, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.Nil(t, err)
+		return response.Status
+	}
+
+	specRuns := 0
+	readiness.AddCheck("specs", func(ctx context.Context) error {
+		specRuns++
+		return nil
+	})
+	backendErr := errors.New("connection refused")
+	readiness.AddCheck("backend", func(ctx context.Context) error { return backendErr })
+
+	called := false
+	gated := readiness.Gate(func(srv interface{}, stream grpc.ServerStream) error {
+		called = true
+		return nil
+	})
+
+	assert.False(readiness.Check(context.Background()))
+	assert.False(readiness.IsReady())
+	assert.Equal(map[string]error{"backend": backendErr}, readiness.Failures())
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, servingStatus("test_service.Items"))
+	assert.Equal(codes.Unavailable, errorCode(gated(nil, &fakeServerStream{})))
+	assert.False(called, "Call passed before ready")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := readiness.Wait(ctx, 5*time.Millisecond)
+	if assert.Error(err) {
+		assert.Equal("server not ready: backend: connection refused", err.Error())
+	}
+
+	backendErr = nil
+	assert.Nil(readiness.Wait(context.Background(), time.Millisecond))
+	assert.True(readiness.IsReady())
+	assert.Empty(readiness.Failures())
+	assert.Equal(1, specRuns, "Passed check run again")
+	select {
+	case <-readiness.Ready():
+	default:
+		assert.Fail("Ready channel not closed")
+	}
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, servingStatus("test_service.Items"))
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, servingStatus("test_service.Orders"))
+	assert.Nil(gated(nil, &fakeServerStream{}))
+	assert.True(called, "Call not passed once ready")
+}
+
+// Tests that the registry check builds lazy adapters, and fails if any can't be built.
+func TestRegistryCheck(t *testing.T) {
+	assert := assertions.New(t)
+	registry := NewOperationRegistry()
+	check := RegistryCheck(registry)
+	assert.Error(check(context.Background()), "Empty registry passed")
+
+	handler, closeServer, err := newTestOperationHandler(t, testServiceParams, &ServiceOptions{LazyAdapters: true})
+	defer closeServer()
+	require.Nil(t, err)
+	registry.set("/test_service.Items/GetItem", &registeredOperation{handler: handler})
+	assert.Nil(check(context.Background()))
+	assert.True(handler.(*lazyAdapter).built, "Lazy adapter not built")
+
+	broken, closeBroken, err := newTestOperationHandler(t, unmappableParams, &ServiceOptions{LazyAdapters: true})
+	defer closeBroken()
+	require.Nil(t, err)
+	registry.set("/test_service.Items/Broken", &registeredOperation{handler: broken})
+	err = check(context.Background())
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "/test_service.Items/Broken")
+	}
+}
+
+// Tests that the backend check passes once the backend responds.
+func TestBackendCheck(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	check := BackendCheck(http.DefaultClient, server.URL, nil)
+	assertions.Nil(t, check(context.Background()))
+	server.Close()
+	assertions.Error(t, check(context.Background()))
+}
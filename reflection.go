@@ -0,0 +1,230 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// The standard gRPC server reflection service, for proxied operations.
+//
+// grpc's own reflection service describes only services compiled into the binary, so proxied
+// services, loaded from proto files at runtime, are described from a registry instead. Tools like
+// grpcurl can then call them without the proto files. Files are described from the registry as it
+// is at each request, so reloaded specs are reflected as they change, and are described whole,
+// including any methods without registered operations.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterReflectionService registers the grpc.reflection.v1alpha.ServerReflection service on a
+// server, describing the services of the operations in the given registry. Services registered on
+// the server itself, like the Meta service, are listed, but can't be described.
+func RegisterReflectionService(server *grpc.Server, registry *OperationRegistry) {
+	rpb.RegisterServerReflectionServer(server, &reflectionService{server: server, registry: registry})
+}
+
+// Serves reflection requests from a registry.
+type reflectionService struct {
+	server   *grpc.Server
+	registry *OperationRegistry
+}
+
+func (s *reflectionService) ServerReflectionInfo(stream rpb.ServerReflection_ServerReflectionInfoServer) error {
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		response := &rpb.ServerReflectionResponse{ValidHost: request.Host, OriginalRequest: request}
+		if err := s.respond(request, response); err != nil {
+			return err
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+// Sets the answer to a reflection request on a response, returning an error if the request is
+// invalid. Lookups which find nothing are answered with a NotFound error response.
+func (s *reflectionService) respond(
+	request *rpb.ServerReflectionRequest,
+	response *rpb.ServerReflectionResponse,
+) error {
+	files := s.files()
+	var found *desc.FileDescriptor
+	switch typed := request.MessageRequest.(type) {
+	case *rpb.ServerReflectionRequest_ListServices:
+		response.MessageResponse = &rpb.ServerReflectionResponse_ListServicesResponse{
+			ListServicesResponse: s.listServices(),
+		}
+		return nil
+	case *rpb.ServerReflectionRequest_FileByFilename:
+		found = files[typed.FileByFilename]
+	case *rpb.ServerReflectionRequest_FileContainingSymbol:
+		for _, file := range files {
+			if typed.FileContainingSymbol != "" && file.FindSymbol(typed.FileContainingSymbol) != nil {
+				found = file
+			}
+		}
+	case *rpb.ServerReflectionRequest_FileContainingExtension:
+		extension := typed.FileContainingExtension
+		for _, file := range files {
+			if file.FindExtension(extension.GetContainingType(), extension.GetExtensionNumber()) != nil {
+				found = file
+			}
+		}
+	case *rpb.ServerReflectionRequest_AllExtensionNumbersOfType:
+		numbers, ok := extensionNumbers(files, typed.AllExtensionNumbersOfType)
+		if !ok {
+			response.MessageResponse = notFoundResponse("unknown message type " + typed.AllExtensionNumbersOfType)
+			return nil
+		}
+		response.MessageResponse = &rpb.ServerReflectionResponse_AllExtensionNumbersResponse{
+			AllExtensionNumbersResponse: &rpb.ExtensionNumberResponse{
+				BaseTypeName:    typed.AllExtensionNumbersOfType,
+				ExtensionNumber: numbers,
+			},
+		}
+		return nil
+	default:
+		return status.Errorf(codes.InvalidArgument, "invalid reflection request %v", request.MessageRequest)
+	}
+	if found == nil {
+		response.MessageResponse = notFoundResponse(fmt.Sprintf("nothing found for %v", request.MessageRequest))
+		return nil
+	}
+	described, err := fileDescriptorResponse(found)
+	if err != nil {
+		return err
+	}
+	response.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{FileDescriptorResponse: described}
+	return nil
+}
+
+// Returns every file the registry's operations are declared in, and their dependencies, keyed by
+// name.
+func (s *reflectionService) files() map[string]*desc.FileDescriptor {
+	files := make(map[string]*desc.FileDescriptor)
+	for _, operation := range s.registry.current() {
+		addFileWithDependencies(files, operation.method.GetFile())
+	}
+	return files
+}
+
+// Adds a file and its transitive dependencies to a map keyed by name.
+func addFileWithDependencies(files map[string]*desc.FileDescriptor, file *desc.FileDescriptor) {
+	if _, ok := files[file.GetName()]; ok {
+		return
+	}
+	files[file.GetName()] = file
+	for _, dependency := range file.GetDependencies() {
+		addFileWithDependencies(files, dependency)
+	}
+}
+
+// Returns the services of the registry's operations and of the server, sorted by name.
+func (s *reflectionService) listServices() *rpb.ListServiceResponse {
+	names := make(map[string]bool)
+	for name := range s.server.GetServiceInfo() {
+		names[name] = true
+	}
+	for _, operation := range s.registry.current() {
+		names[operation.method.GetService().GetFullyQualifiedName()] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	response := &rpb.ListServiceResponse{}
+	for _, name := range sorted {
+		response.Service = append(response.Service, &rpb.ServiceResponse{Name: name})
+	}
+	return response
+}
+
+// Returns the numbers of the extensions of a message type declared in the given files, sorted, and
+// false if the type isn't declared in them.
+func extensionNumbers(files map[string]*desc.FileDescriptor, typeName string) ([]int32, bool) {
+	found := false
+	var numbers []int32
+	for _, file := range files {
+		if file.FindMessage(typeName) != nil {
+			found = true
+		}
+		for _, extension := range fileExtensions(file) {
+			if extension.GetOwner().GetFullyQualifiedName() == typeName {
+				numbers = append(numbers, extension.GetNumber())
+			}
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, found
+}
+
+// Returns the extensions declared in a file, at its top level or nested in messages.
+func fileExtensions(file *desc.FileDescriptor) []*desc.FieldDescriptor {
+	extensions := append([]*desc.FieldDescriptor(nil), file.GetExtensions()...)
+	messages := file.GetMessageTypes()
+	for len(messages) > 0 {
+		message := messages[0]
+		messages = append(messages[1:], message.GetNestedMessageTypes()...)
+		extensions = append(extensions, message.GetNestedExtensions()...)
+	}
+	return extensions
+}
+
+// Returns the encodings of a file and its transitive dependencies, the file first and then its
+// dependencies by name.
+func fileDescriptorResponse(file *desc.FileDescriptor) (*rpb.FileDescriptorResponse, error) {
+	files := make(map[string]*desc.FileDescriptor)
+	addFileWithDependencies(files, file)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != file.GetName() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{file.GetName()}, names...)
+
+	response := &rpb.FileDescriptorResponse{}
+	for _, name := range names {
+		encoded, err := proto.Marshal(files[name].AsFileDescriptorProto())
+		if err != nil {
+			return nil, err
+		}
+		response.FileDescriptorProto = append(response.FileDescriptorProto, encoded)
+	}
+	return response, nil
+}
+
+// Returns an error response for a lookup which found nothing.
+func notFoundResponse(message string) *rpb.ServerReflectionResponse_ErrorResponse {
+	return &rpb.ServerReflectionResponse_ErrorResponse{
+		ErrorResponse: &rpb.ErrorResponse{ErrorCode: int32(codes.NotFound), ErrorMessage: message},
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// Tests that reflection lists and describes the registry's services.
+func TestReflectionService(t *testing.T) {
+	server := grpc.NewServer()
+	registry := newDocumentedRegistry(t)
+	require.Nil(t, RegisterMetaService(server, registry))
+	RegisterReflectionService(server, registry)
+	service := &reflectionService{server: server, registry: registry}
+	filename := loadedProtoFilename(sha256.Sum256([]byte(testServiceProto)))
+
+	fixtures := []struct {
+		name     string
+		request  *rpb.ServerReflectionRequest
+		services []string
+		file     string
+		code     codes.Code
+	}{
+		{"list services", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+		}, []string{"grpc.reflection.v1alpha.ServerReflection", "swaggrpc.Meta", "test_service.Items"}, "", codes.OK},
+		{"file containing service", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: "test_service.Items",
+			},
+		}, nil, filename, codes.OK},
+		{"file containing message", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: "test_service.Item",
+			},
+		}, nil, filename, codes.OK},
+		{"file by name", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: filename},
+		}, nil, filename, codes.OK},
+		{"unknown symbol", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "missing.Thing"},
+		}, nil, "", codes.NotFound},
+		{"empty symbol", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{},
+		}, nil, "", codes.NotFound},
+		{"unknown file", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: "missing.proto"},
+		}, nil, "", codes.NotFound},
+		{"unknown extended type", &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_AllExtensionNumbersOfType{
+				AllExtensionNumbersOfType: "missing.Thing",
+			},
+		}, nil, "", codes.NotFound},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			response := &rpb.ServerReflectionResponse{}
+			require.Nil(t, service.respond(fixture.request, response))
+			if fixture.code != codes.OK {
+				require.NotNil(t, response.GetErrorResponse())
+				assert.Equal(int32(fixture.code), response.GetErrorResponse().ErrorCode)
+				return
+			}
+			if fixture.services != nil {
+				var names []string
+				for _, listed := range response.GetListServicesResponse().GetService() {
+					names = append(names, listed.Name)
+				}
+				assert.Equal(fixture.services, names)
+				return
+			}
+			encoded := response.GetFileDescriptorResponse().GetFileDescriptorProto()
+			require.NotEmpty(t, encoded)
+			file := &dpb.FileDescriptorProto{}
+			require.Nil(t, proto.Unmarshal(encoded[0], file))
+			assert.Equal(fixture.file, file.GetName())
+		})
+	}
+}
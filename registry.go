@@ -0,0 +1,207 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// A set of proxied operations which can change while serving.
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/transport"
+)
+
+// OperationRegistry routes gRPC calls to proxied operations, which may be added and removed while
+// serving, such as on a spec reload or to disable an operation. Changes don't affect calls already
+// in progress. It is safe for concurrent use.
+type OperationRegistry struct {
+	// Guards operations and source. Writers replace the map rather than modifying it, so readers may
+	// use a map after releasing the lock.
+	mutex sync.RWMutex
+	// Operations keyed by full gRPC method name.
+	operations map[string]*registeredOperation
+	// The spec the operations were loaded from, if known, for Spec.
+	source *spec.Swagger
+}
+
+// An operation in a registry.
+type registeredOperation struct {
+	handler operationHandler
+	// The proxied gRPC method, for API snapshots.
+	method *desc.MethodDescriptor
+	// The operation's description, for the Meta service.
+	description *operationDescription
+}
+
+// NewOperationRegistry returns an empty registry.
+func NewOperationRegistry() *OperationRegistry {
+	return &OperationRegistry{operations: make(map[string]*registeredOperation)}
+}
+
+// Add builds a handler proxying a gRPC method to a swagger operation, and registers it, replacing
+// any handler already registered for the method. Returns an error if the handler can't be built, in
+// which case the registry is unchanged.
+func (r *OperationRegistry) Add(
+	httpClient *http.Client,
+	swaggerClient *runtimeclient.Runtime,
+	httpMethod string,
+	swaggerPath string,
+	operation *spec.Operation,
+	parameters map[string]*spec.Parameter,
+	method *desc.MethodDescriptor,
+	options *ServiceOptions,
+) error {
+	handler, err := newOperationHandler(httpClient, swaggerClient, httpMethod, swaggerPath, operation,
+		parameters, method, options)
+	if err != nil {
+		return err
+	}
+	r.set(fullMethodName(method), &registeredOperation{
+		handler:     handler,
+		method:      method,
+		description: describeOperation(httpMethod, swaggerPath, operation, parameters, method),
+	})
+	return nil
+}
+
+// Remove unregisters the handler for a full gRPC method name, like "/package.Service/Method".
+// Returns false if no handler was registered for the method.
+func (r *OperationRegistry) Remove(fullMethod string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.operations[fullMethod]; !ok {
+		return false
+	}
+	operations := make(map[string]*registeredOperation, len(r.operations))
+	for method, operation := range r.operations {
+		if method != fullMethod {
+			operations[method] = operation
+		}
+	}
+	r.operations = operations
+	return true
+}
+
+// Replace replaces every registered operation with those registered in other, at once, so that no
+// call sees a mix of the two. Operations added to other later aren't registered.
+func (r *OperationRegistry) Replace(other *OperationRegistry) {
+	operations, source := other.currentWithSource()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.operations = operations
+	r.source = source
+}
+
+// Methods returns the full gRPC method names of the registered operations, sorted.
+func (r *OperationRegistry) Methods() []string {
+	operations := r.current()
+	methods := make([]string, 0, len(operations))
+	for method := range operations {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Handler returns a handler for calls to any registered operation, for use with
+// grpc.UnknownServiceHandler. Calls to unregistered methods fail as for NewUnimplementedHandler.
+func (r *OperationRegistry) Handler() grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		fullMethod := "unknown method"
+		if transportStream, ok := transport.StreamFromContext(stream.Context()); ok {
+			fullMethod = transportStream.Method()
+		}
+		return r.handle(fullMethod, stream)
+	}
+}
+
+// Handles a call to the given full method name.
+func (r *OperationRegistry) handle(fullMethod string, stream grpc.ServerStream) error {
+	operation, ok := r.current()[fullMethod]
+	if !ok {
+		return unimplementedError(fullMethod, r.Methods())
+	}
+	return operation.handler.handleGRPCRequest(stream)
+}
+
+// Returns the description of the operation registered for a full method name or operation ID, or
+// nil if there is none.
+func (r *OperationRegistry) describe(name string) *operationDescription {
+	operations := r.current()
+	if operation, ok := operations[name]; ok {
+		return operation.description
+	}
+	for _, operation := range operations {
+		if operation.description.OperationID == name {
+			return operation.description
+		}
+	}
+	return nil
+}
+
+// Registers handlers built for operations, at once.
+func (r *OperationRegistry) addHandlers(sources []operationSource, handlers []operationHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	operations := make(map[string]*registeredOperation, len(r.operations)+len(sources))
+	for method, existing := range r.operations {
+		operations[method] = existing
+	}
+	for i, source := range sources {
+		operations[fullMethodName(source.method)] = &registeredOperation{
+			handler: handlers[i],
+			method:  source.method,
+			description: describeOperation(source.httpMethod, source.swaggerPath, source.operation,
+				source.parameters, source.method),
+		}
+	}
+	r.operations = operations
+}
+
+// Registers an operation for a full method name.
+func (r *OperationRegistry) set(fullMethod string, operation *registeredOperation) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	operations := make(map[string]*registeredOperation, len(r.operations)+1)
+	for method, existing := range r.operations {
+		operations[method] = existing
+	}
+	operations[fullMethod] = operation
+	r.operations = operations
+}
+
+// Returns the current operations, which must not be modified.
+func (r *OperationRegistry) current() map[string]*registeredOperation {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.operations
+}
+
+// Returns the current operations, which must not be modified, and the spec they were loaded from.
+func (r *OperationRegistry) currentWithSource() (map[string]*registeredOperation, *spec.Swagger) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.operations, r.source
+}
+
+// Returns the full gRPC method name of a method, like "/package.Service/Method".
+func fullMethodName(method *desc.MethodDescriptor) string {
+	return "/" + method.GetService().GetFullyQualifiedName() + "/" + method.GetName()
+}
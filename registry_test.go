@@ -0,0 +1,65 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests adding, calling and removing operations.
+func TestOperationRegistry(t *testing.T) {
+	assert := assertions.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+	const fullMethod = "/test_service.Items/GetItem"
+
+	registry := NewOperationRegistry()
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	swaggerClient := runtimeclient.New(serverURL.Host, "/", []string{"http"})
+	require.Nil(t, registry.Add(http.DefaultClient, swaggerClient, "GET", "/items/{itemId}", operation,
+		testServiceParams, method, nil))
+	assert.Equal([]string{fullMethod}, registry.Methods())
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	assert.Nil(registry.handle(fullMethod, stream))
+	assert.Len(stream.sent, 1)
+
+	assert.NotNil(registry.Add(http.DefaultClient, swaggerClient, "GET", "/items/{itemId}", operation,
+		unmappableParams, method, nil), "Expected build error")
+	assert.Equal([]string{fullMethod}, registry.Methods(), "Failed add changed the registry")
+
+	before := registry.current()
+	assert.True(registry.Remove(fullMethod))
+	assert.False(registry.Remove(fullMethod))
+	assert.Empty(registry.Methods())
+	assert.Len(before, 1, "Remove modified an earlier snapshot")
+	err = registry.handle(fullMethod, &fakeServerStream{request: `{"itemId": "abc"}`})
+	assert.Equal(codes.Unimplemented, errorCode(err))
+}
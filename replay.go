@@ -0,0 +1,101 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Replay of dead-lettered calls.
+//
+// A replayed call runs through the operation currently registered for its method, as though it had
+// just been received, so it gets the operation's current options and backend. Replays are themselves
+// dead-lettered if they fail again.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// ReplayResult is the outcome of replaying a dead-lettered call.
+type ReplayResult struct {
+	// The response message, in its JSON encoding, or nil if the call failed.
+	Response json.RawMessage `json:"response,omitempty"`
+	// The gRPC status code of the replayed call.
+	Code codes.Code `json:"code"`
+	// The error of the replayed call, or empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Replay calls the operation registered for a dead letter's method with the letter's request
+// message, in the given context. Incoming metadata, such as credentials, should be set on the
+// context. Returns an error if no operation is registered for the method.
+func (r *OperationRegistry) Replay(ctx context.Context, letter *DeadLetter) (*ReplayResult, error) {
+	if _, ok := r.current()[letter.FullMethod]; !ok {
+		return nil, fmt.Errorf("no operation is registered for %s", letter.FullMethod)
+	}
+	stream := &replayStream{ctx: ctx, request: letter.Request}
+	result := &ReplayResult{}
+	if err := r.handle(letter.FullMethod, stream); err != nil {
+		result.Code, result.Error = errorCode(err), err.Error()
+		return result, nil
+	}
+	if stream.response != nil {
+		encoded, err := (&jsonpb.Marshaler{}).MarshalToString(stream.response)
+		if err != nil {
+			return nil, err
+		}
+		result.Response = json.RawMessage(encoded)
+	}
+	return result, nil
+}
+
+// Replay replays the queued letter with the given ID through a registry, as
+// OperationRegistry.Replay does, and removes it from the queue if the replay succeeds. Returns an
+// error if there is no such letter, or it can't be replayed.
+func (q *DeadLetterQueue) Replay(ctx context.Context, registry *OperationRegistry, id string) (*ReplayResult, error) {
+	letter := q.Get(id)
+	if letter == nil {
+		return nil, fmt.Errorf("no dead letter with ID %q", id)
+	}
+	result, err := registry.Replay(ctx, letter)
+	if err == nil && result.Code == codes.OK {
+		q.Remove(id)
+	}
+	return result, err
+}
+
+// A grpc.ServerStream receiving a dead letter's request, and recording the response.
+type replayStream struct {
+	ctx      context.Context
+	request  json.RawMessage
+	response *dynamic.Message
+}
+
+func (s *replayStream) SetHeader(metadata.MD) error  { return nil }
+func (s *replayStream) SendHeader(metadata.MD) error { return nil }
+func (s *replayStream) SetTrailer(metadata.MD)       {}
+func (s *replayStream) Context() context.Context     { return s.ctx }
+
+func (s *replayStream) SendMsg(m interface{}) error {
+	s.response, _ = m.(*dynamic.Message)
+	return nil
+}
+
+func (s *replayStream) RecvMsg(m interface{}) error {
+	return jsonpb.UnmarshalString(string(s.request), m.(*dynamic.Message))
+}
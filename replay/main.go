@@ -0,0 +1,107 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command replay resends the backend requests of dead-lettered calls, as written by
+// swaggrpc.NewJSONDeadLetterSink, straight to a backend, and reports each outcome. Letters are read
+// as lines of JSON from a file, or from stdin. For example:
+//
+//	go run ./replay -backend https://items.example.com/api -letters dead-letters.jsonl
+//
+// To replay calls through the proxy instead, with its current options, use
+// OperationRegistry.Replay. The command exits with status 1 if any request fails.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Nordstrom/swaggrpc"
+)
+
+var (
+	backend = flag.String("backend", "", "base URL of the backend to send requests to")
+	letters = flag.String("letters", "", "file of dead letters, one JSON object per line; stdin if empty")
+	timeout = flag.Duration("timeout", 30*time.Second, "timeout for each request")
+	dryRun  = flag.Bool("dry-run", false, "list the requests which would be sent, without sending them")
+)
+
+func main() {
+	flag.Parse()
+	if *backend == "" {
+		log.Fatal("-backend is required")
+	}
+	var input io.Reader = os.Stdin
+	if *letters != "" {
+		file, err := os.Open(*letters)
+		if err != nil {
+			log.Fatalf("Could not open letters: %s", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	decoder := json.NewDecoder(input)
+	failed := false
+	for {
+		var letter swaggrpc.DeadLetter
+		if err := decoder.Decode(&letter); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatalf("Could not read letter: %s", err)
+		}
+		if err := replay(client, &letter); err != nil {
+			fmt.Printf("%s %s: %s\n", letter.Time.Format(time.RFC3339), letter.Operation, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Resends a letter's backend request, failing if it can't be sent or has a non-2xx response.
+func replay(client *http.Client, letter *swaggrpc.DeadLetter) error {
+	if letter.HTTPRequest == nil {
+		return fmt.Errorf("no backend request was captured")
+	}
+	request, err := letter.HTTPRequest.NewRequest(*backend)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%s %s: would send %s %s\n", letter.Time.Format(time.RFC3339), letter.Operation,
+			request.Method, request.URL)
+		return nil
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: HTTP status %d", request.Method, request.URL, response.StatusCode)
+	}
+	fmt.Printf("%s %s: %s %s: HTTP status %d\n", letter.Time.Format(time.RFC3339), letter.Operation,
+		request.Method, request.URL, response.StatusCode)
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests replaying dead-lettered calls through a registry once the backend recovers.
+func TestReplay(t *testing.T) {
+	assert := assertions.New(t)
+	body := `not json`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+
+	queue := NewDeadLetterQueue(10)
+	registry := NewOperationRegistry()
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	require.Nil(t, registry.Add(http.DefaultClient, runtimeclient.New(serverURL.Host, "/", []string{"http"}),
+		"GET", "/items/{itemId}", operation, testServiceParams, method, &ServiceOptions{DeadLetters: queue}))
+
+	require.NotNil(t, registry.handle("/test_service.Items/GetItem", &fakeServerStream{request: `{"itemId": "abc"}`}))
+	letters := queue.Letters()
+	require.Len(t, letters, 1)
+	id := letters[0].ID
+	assert.Equal("/test_service.Items/GetItem", letters[0].FullMethod)
+
+	// Still failing: the replay is itself dead-lettered, and the original kept.
+	result, err := queue.Replay(context.Background(), registry, id)
+	require.Nil(t, err)
+	assert.NotEqual(codes.OK, result.Code)
+	assert.NotEmpty(result.Error)
+	assert.Len(queue.Letters(), 2)
+	queue.Remove(queue.Letters()[1].ID)
+
+	body = `{"name": "thing"}`
+	result, err = queue.Replay(context.Background(), registry, id)
+	require.Nil(t, err)
+	assert.Equal(codes.OK, result.Code)
+	assert.JSONEq(`{"name": "thing"}`, string(result.Response))
+	assert.Empty(queue.Letters(), "Replayed letter wasn't removed")
+
+	_, err = queue.Replay(context.Background(), registry, id)
+	assert.NotNil(err, "Expected error for an unknown letter")
+	_, err = registry.Replay(context.Background(), &DeadLetter{FullMethod: "/test_service.Items/Missing"})
+	assert.NotNil(err, "Expected error for an unregistered method")
+}
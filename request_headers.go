@@ -0,0 +1,98 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Sending request message fields as headers the spec doesn't declare.
+//
+// Specs often under-document header requirements. Request fields which aren't swagger parameters
+// are sent as headers by API owners in the spec with the x-swaggrpc-request-headers operation
+// extension:
+//
+//   x-swaggrpc-request-headers:
+//     X-Tenant-Id: tenant_id
+//
+// Unset fields aren't sent.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Name of the operation extension mapping request fields to headers.
+const requestHeadersExtension = "x-swaggrpc-request-headers"
+
+// Returns the request fields to send as headers, sorted by header. Mappings in options override
+// those in the spec; an empty field name removes a header's mapping.
+func resolveRequestHeaders(
+	operation *spec.Operation,
+	operationOptions *OperationOptions,
+	inputType *desc.MessageDescriptor,
+) ([]headerField, error) {
+	mapping, err := resolveHeaderMapping(operation, requestHeadersExtension, operationOptions.RequestHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []headerField
+	for header, fieldName := range mapping {
+		if fieldName == "" {
+			continue
+		}
+		field := inputType.FindFieldByName(fieldName)
+		if field == nil {
+			return nil, fmt.Errorf("request header %s for %s maps to unknown field %q", header, operation.ID,
+				fieldName)
+		}
+		switch field.GetType() {
+		case descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP,
+			descriptor.FieldDescriptorProto_TYPE_ENUM, descriptor.FieldDescriptorProto_TYPE_BYTES:
+			return nil, fmt.Errorf("request header %s for %s maps to field %q, which isn't a scalar",
+				header, operation.ID, fieldName)
+		}
+		fields = append(fields, headerField{header: header, field: field})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].header < fields[j].header })
+	return fields, nil
+}
+
+// Adds steps to the plan sending each mapped request field as a header. Returns an error if a field
+// is already sent as a declared parameter.
+func (plan *paramPlan) addRequestHeaders(fields []headerField) error {
+	for _, mapped := range fields {
+		for _, step := range plan.steps {
+			if step.field == mapped.field {
+				return fmt.Errorf("field %q is sent as parameter %s, and can't also be sent as header %s",
+					mapped.field.GetName(), step.name, mapped.header)
+			}
+		}
+		toString, err := getStringConverter(mapped.field, &spec.Parameter{})
+		if err != nil {
+			return err
+		}
+		plan.add(paramStep{
+			name:        mapped.header,
+			location:    paramInHeader,
+			field:       mapped.field,
+			repeated:    mapped.field.IsRepeated(),
+			omitDefault: true,
+			toString:    toString,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that undeclared request fields are sent as mapped headers, and omitted when unset.
+func TestRequestHeaders(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		request  string
+		expected []string
+	}{
+		{"Set", `{"itemId": "abc", "filter": "new"}`, []string{"new"}},
+		{"Unset", `{"itemId": "abc"}`, nil},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			var received http.Header
+			operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+			operation.AddExtension(requestHeadersExtension, map[string]interface{}{"X-Filter": "filter"})
+			adapter, closeServer := testOperation{
+				operation: operation,
+				// Only itemId is a declared parameter.
+				parameters: map[string]*spec.Parameter{"itemId": spec.PathParam("itemId")},
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					received = r.Header
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"name": "thing"}`))
+				},
+			}.adapter(t)
+			defer closeServer()
+
+			require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: fixture.request}))
+			assert.Equal(fixture.expected, received["X-Filter"])
+		})
+	}
+}
+
+// Tests that fields already sent as parameters, and non-scalar fields, can't be mapped to headers.
+func TestRequestHeadersInvalid(t *testing.T) {
+	assert := assertions.New(t)
+	inputType := testMethod(t, maskedServiceProto, "mask_test.Things", "GetThing").GetInputType()
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getThing"}}
+
+	_, err := resolveRequestHeaders(operation, &OperationOptions{RequestHeaders: map[string]string{
+		"X-Mask": "read_mask",
+	}}, inputType)
+	assert.NotNil(err, "Expected a message field to be rejected")
+
+	fields, err := resolveRequestHeaders(operation, &OperationOptions{RequestHeaders: map[string]string{
+		"X-Id": "id",
+	}}, inputType)
+	require.Nil(t, err)
+	plan := paramPlan{}
+	plan.add(paramStep{name: "id", location: paramInPath, field: inputType.FindFieldByName("id")})
+	assert.NotNil(plan.addRequestHeaders(fields), "Expected a declared parameter to be rejected")
+}
@@ -0,0 +1,400 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Retries, circuit breaking and concurrency limits for backend requests.
+//
+// These can be configured programmatically for a whole service or a single operation, and by API
+// owners in the spec with the x-swaggrpc-resilience operation extension:
+//
+//   x-swaggrpc-resilience:
+//     retry:
+//       maxAttempts: 3
+//       initialBackoff: 100ms
+//       maxBackoff: 2s
+//       retryableStatuses: [502, 503, 504]
+//     circuitBreaker:
+//       failureThreshold: 5
+//       openDuration: 30s
+//     maxConcurrency: 10
+//     maxQueue: 100
+//     adaptiveLimit:
+//       initialLimit: 20
+//       maxLimit: 200
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the operation extension holding resilience settings.
+const resilienceExtension = "x-swaggrpc-resilience"
+
+// ResilienceOptions configures how an operation's backend requests are protected. Unset sections
+// are disabled.
+type ResilienceOptions struct {
+	// Policy for retrying failed backend requests.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+	// Policy for failing fast when the backend is failing.
+	CircuitBreaker *CircuitBreakerPolicy `json:"circuitBreaker,omitempty"`
+	// The maximum number of concurrent backend requests for the operation. Calls beyond this wait for a
+	// slot, in order of priority class, until their deadline. Zero means no limit.
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+	// The maximum number of calls waiting for MaxConcurrency. Calls beyond this fail with
+	// ResourceExhausted. Zero means no limit.
+	MaxQueue int `json:"maxQueue,omitempty"`
+	// If set, an adaptive limit sheds load with Unavailable when backend latency rises. This applies
+	// before, and independently of, MaxConcurrency.
+	AdaptiveLimit *AdaptiveLimitOptions `json:"adaptiveLimit,omitempty"`
+}
+
+// RetryPolicy configures retries of failed backend requests. Requests are retried when no response
+// was received, or the response status is retryable. Only idempotent HTTP methods are retried.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first.
+	MaxAttempts int
+	// The delay before the first retry. Each later retry doubles the delay, up to MaxBackoff if it is
+	// set. A random jitter of up to half the delay is subtracted.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// HTTP statuses to retry. If empty, 502, 503 and 504 are retried.
+	RetryableStatuses []int
+}
+
+// The form of a RetryPolicy in the spec extension.
+type retryPolicyJSON struct {
+	MaxAttempts       int          `json:"maxAttempts"`
+	InitialBackoff    jsonDuration `json:"initialBackoff,omitempty"`
+	MaxBackoff        jsonDuration `json:"maxBackoff,omitempty"`
+	RetryableStatuses []int        `json:"retryableStatuses,omitempty"`
+}
+
+// MarshalJSON writes a policy in its form in the spec extension.
+func (r RetryPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(retryPolicyJSON{
+		MaxAttempts:       r.MaxAttempts,
+		InitialBackoff:    jsonDuration(r.InitialBackoff),
+		MaxBackoff:        jsonDuration(r.MaxBackoff),
+		RetryableStatuses: r.RetryableStatuses,
+	})
+}
+
+// UnmarshalJSON reads a policy from its form in the spec extension.
+func (r *RetryPolicy) UnmarshalJSON(data []byte) error {
+	var fromSpec retryPolicyJSON
+	if err := json.Unmarshal(data, &fromSpec); err != nil {
+		return err
+	}
+	*r = RetryPolicy{
+		MaxAttempts:       fromSpec.MaxAttempts,
+		InitialBackoff:    time.Duration(fromSpec.InitialBackoff),
+		MaxBackoff:        time.Duration(fromSpec.MaxBackoff),
+		RetryableStatuses: fromSpec.RetryableStatuses,
+	}
+	return nil
+}
+
+// CircuitBreakerPolicy configures a circuit breaker. After FailureThreshold consecutive failures
+// (backend 5xx responses, or no response), calls fail with Unavailable for OpenDuration; then a
+// single trial request is let through, which closes the breaker if it succeeds.
+type CircuitBreakerPolicy struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// The form of a CircuitBreakerPolicy in the spec extension.
+type circuitBreakerPolicyJSON struct {
+	FailureThreshold int          `json:"failureThreshold"`
+	OpenDuration     jsonDuration `json:"openDuration"`
+}
+
+// MarshalJSON writes a policy in its form in the spec extension.
+func (b CircuitBreakerPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(circuitBreakerPolicyJSON{
+		FailureThreshold: b.FailureThreshold,
+		OpenDuration:     jsonDuration(b.OpenDuration),
+	})
+}
+
+// UnmarshalJSON reads a policy from its form in the spec extension.
+func (b *CircuitBreakerPolicy) UnmarshalJSON(data []byte) error {
+	var fromSpec circuitBreakerPolicyJSON
+	if err := json.Unmarshal(data, &fromSpec); err != nil {
+		return err
+	}
+	*b = CircuitBreakerPolicy{
+		FailureThreshold: fromSpec.FailureThreshold,
+		OpenDuration:     time.Duration(fromSpec.OpenDuration),
+	}
+	return nil
+}
+
+// HTTP statuses retried when a retry policy doesn't list any.
+var defaultRetryableStatuses = []int{
+	http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+}
+
+// HTTP methods which are safe to retry.
+var idempotentMethods = map[string]bool{
+	"GET": true, "HEAD": true, "OPTIONS": true, "PUT": true, "DELETE": true,
+}
+
+// Returns the resilience settings for an operation: the service's settings, overridden by those in
+// the spec, overridden by the operation's programmatic settings. Each field is overridden as a whole.
+func resolveResilience(
+	serviceOptions *ResilienceOptions,
+	operation *spec.Operation,
+	operationOptions *ResilienceOptions,
+) (*ResilienceOptions, error) {
+	resolved := &ResilienceOptions{}
+	resolved.merge(serviceOptions)
+	var fromSpec ResilienceOptions
+	if _, err := decodeExtension(operation.Extensions, resilienceExtension, &fromSpec); err != nil {
+		return nil, err
+	}
+	resolved.merge(&fromSpec)
+	resolved.merge(operationOptions)
+	return resolved, nil
+}
+
+// Overrides the sections of these options which are set in other. Other may be nil.
+func (r *ResilienceOptions) merge(other *ResilienceOptions) {
+	if other == nil {
+		return
+	}
+	if other.Retry != nil {
+		r.Retry = other.Retry
+	}
+	if other.CircuitBreaker != nil {
+		r.CircuitBreaker = other.CircuitBreaker
+	}
+	if other.MaxConcurrency != 0 {
+		r.MaxConcurrency = other.MaxConcurrency
+	}
+	if other.MaxQueue != 0 {
+		r.MaxQueue = other.MaxQueue
+	}
+	if other.AdaptiveLimit != nil {
+		r.AdaptiveLimit = other.AdaptiveLimit
+	}
+}
+
+// Runtime state protecting a single operation's backend.
+type resilience struct {
+	options *ResilienceOptions
+	// Limits concurrent requests, if configured.
+	limiter *priorityLimiter
+	// Limits concurrent requests across the whole service, if configured.
+	serviceLimiter *priorityLimiter
+	// Sheds load adaptively, if configured.
+	adaptiveLimiter *adaptiveLimiter
+	// The circuit breaker, if configured.
+	breaker *circuitBreaker
+}
+
+// Returns the runtime state for the given options, using the given priority class weights. If set,
+// onQueueChange records changes to the operation's queue depth.
+func newResilience(
+	options *ResilienceOptions,
+	priorityWeights map[string]int,
+	onQueueChange func(context.Context, int64),
+) *resilience {
+	r := &resilience{options: options}
+	if options.MaxConcurrency > 0 {
+		r.limiter = newPriorityLimiter(options.MaxConcurrency, options.MaxQueue, priorityWeights)
+		r.limiter.onQueueChange = onQueueChange
+	}
+	if options.AdaptiveLimit != nil {
+		r.adaptiveLimiter = newAdaptiveLimiter(*options.AdaptiveLimit)
+	}
+	if options.CircuitBreaker != nil {
+		r.breaker = &circuitBreaker{policy: options.CircuitBreaker}
+	}
+	return r
+}
+
+// Submits a backend request with the configured protections, returning the result of the last
+// attempt.
+func (p *operationAdapter) submit(call *proxiedCall, operation *runtime.ClientOperation) (interface{}, error) {
+	r := p.resilience
+	// The operation's limit is acquired first, so that calls waiting on it don't hold slots in the
+	// service's, and the adaptive limit last, so that calls waiting on either don't hold its slots.
+	for _, limiter := range []*priorityLimiter{r.limiter, r.serviceLimiter} {
+		if limiter == nil {
+			continue
+		}
+		if err := limiter.acquire(call.ctx, p.priorityClass(call.ctx)); err != nil {
+			return nil, err
+		}
+		defer limiter.release()
+	}
+	// When backend requests started, after any queueing.
+	startTime := time.Now()
+	if r.adaptiveLimiter != nil {
+		if !r.adaptiveLimiter.tryAcquire() {
+			return nil, status.Errorf(codes.Unavailable,
+				"shedding load for %s %s: backend is overloaded", p.httpMethod, p.swaggerPath)
+		}
+		defer func() {
+			// Calls which sent no backend request, like those rejected by an open breaker, and those
+			// cancelled by their callers, don't update the limit.
+			if call.backendStart.Before(startTime) || call.ctx.Err() == context.Canceled {
+				r.adaptiveLimiter.abandon()
+				return
+			}
+			r.adaptiveLimiter.release(time.Since(startTime), call.httpStatus != 0)
+		}()
+	}
+
+	maxAttempts := 1
+	if r.options.Retry != nil && idempotentMethods[p.httpMethod] {
+		maxAttempts = r.options.Retry.MaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		if r.breaker != nil && !r.breaker.allow() {
+			return nil, status.Errorf(codes.Unavailable,
+				"circuit breaker open for %s %s", p.httpMethod, p.swaggerPath)
+		}
+		call.httpStatus = 0
+		result, err := p.swaggerClient.Submit(operation)
+		if r.breaker != nil {
+			// Requests the caller cancelled, or ran out of time for, say nothing of the backend's health.
+			if call.ctx.Err() != nil {
+				r.breaker.abandon()
+			} else {
+				r.breaker.record(isBackendFailure(call.httpStatus, err))
+			}
+		}
+		if attempt >= maxAttempts || !r.options.Retry.shouldRetry(call.httpStatus, err) {
+			return result, err
+		}
+		if sleepErr := sleepContext(call.ctx, r.options.Retry.backoff(attempt)); sleepErr != nil {
+			return result, err
+		}
+	}
+}
+
+// Returns true if a backend request should count as a failure for circuit breaking.
+func isBackendFailure(httpStatus int, err error) bool {
+	if httpStatus == 0 {
+		return err != nil
+	}
+	return httpStatus >= 500
+}
+
+// Returns true if a request attempt with the given outcome should be retried.
+func (r *RetryPolicy) shouldRetry(httpStatus int, err error) bool {
+	if httpStatus == 0 {
+		return err != nil
+	}
+	statuses := r.RetryableStatuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryableStatuses
+	}
+	for _, retryable := range statuses {
+		if httpStatus == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the delay before retrying after the given attempt number.
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := r.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if r.MaxBackoff > 0 && delay >= r.MaxBackoff {
+			delay = r.MaxBackoff
+			break
+		}
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// Waits for the given duration, returning early with the context's error if it is done first.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A consecutive-failure circuit breaker.
+type circuitBreaker struct {
+	policy *CircuitBreakerPolicy
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// The number of consecutive failures seen.
+	failures int
+	// When the breaker opened; zero if closed.
+	openedAt time.Time
+	// True while a trial request is in flight after the open duration has passed.
+	trialInFlight bool
+}
+
+// Returns true if a request may be made.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.trialInFlight || time.Since(b.openedAt) < b.policy.OpenDuration {
+		return false
+	}
+	b.trialInFlight = true
+	return true
+}
+
+// Ends a request without recording its outcome, allowing another trial request if it was one.
+func (b *circuitBreaker) abandon() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trialInFlight = false
+}
+
+// Records the outcome of a request.
+func (b *circuitBreaker) record(failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trialInFlight = false
+	if !failed {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.policy.FailureThreshold {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Returns a swagger operation parsed from JSON.
+func parseTestOperation(t *testing.T, operationJSON string) *spec.Operation {
+	var operation spec.Operation
+	require.Nil(t, json.Unmarshal([]byte(operationJSON), &operation), "Bad operation JSON")
+	return &operation
+}
+
+// Tests that spec settings override service settings, and operation settings override both.
+func TestResolveResilience(t *testing.T) {
+	assert := assertions.New(t)
+	operation := parseTestOperation(t, `{
+		"operationId": "getItem",
+		"x-swaggrpc-resilience": {
+			"retry": {"maxAttempts": 3, "initialBackoff": "10ms", "maxBackoff": "1s"},
+			"maxConcurrency": 5
+		}
+	}`)
+	service := &ResilienceOptions{
+		Retry:          &RetryPolicy{MaxAttempts: 2},
+		CircuitBreaker: &CircuitBreakerPolicy{FailureThreshold: 4},
+		MaxConcurrency: 100,
+	}
+	resolved, err := resolveResilience(service, operation, &ResilienceOptions{MaxConcurrency: 1})
+	require.Nil(t, err, "Error resolving: %v", err)
+	assert.Equal(3, resolved.Retry.MaxAttempts, "Spec retry policy not applied")
+	assert.Equal(10*time.Millisecond, resolved.Retry.InitialBackoff)
+	assert.Equal(4, resolved.CircuitBreaker.FailureThreshold, "Service breaker not kept")
+	assert.Equal(1, resolved.MaxConcurrency, "Operation override not applied")
+
+	_, err = resolveResilience(nil, parseTestOperation(t,
+		`{"x-swaggrpc-resilience": {"retry": {"initialBackoff": 10}}}`), nil)
+	assert.NotNil(err, "Expected error for numeric duration")
+}
+
+// Tests that retryable statuses are retried up to the attempt limit.
+func TestRetries(t *testing.T) {
+	assert := assertions.New(t)
+	var requests int32
+	options := &ServiceOptions{Resilience: &ResilienceOptions{
+		Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	assert.Nil(adapter.handleGRPCRequest(stream))
+	assert.Equal(int32(3), requests, "Expected two retries")
+}
+
+// Tests that the circuit breaker fails fast once open, and closes after a successful trial.
+func TestCircuitBreaker(t *testing.T) {
+	assert := assertions.New(t)
+	var failing int32 = 1
+	var requests int32
+	options := &ServiceOptions{Operations: map[string]*OperationOptions{
+		"getItem": {Resilience: &ResilienceOptions{CircuitBreaker: &CircuitBreakerPolicy{
+			FailureThreshold: 2,
+			OpenDuration:     20 * time.Millisecond,
+		}}},
+	}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	call := func() error {
+		return adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	}
+	call()
+	call()
+	assert.Equal(codes.Unavailable, errorCode(call()), "Expected open breaker")
+	assert.Equal(int32(2), requests, "Open breaker should not reach the backend")
+
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&failing, 0)
+	assert.Nil(call(), "Expected trial request to succeed")
+	assert.Nil(call(), "Expected closed breaker")
+	assert.Equal(int32(4), requests)
+}
+
+// Tests that calls cancelled by their callers, or past their deadlines, don't trip the breaker.
+func TestCircuitBreakerIgnoresCallerCancellation(t *testing.T) {
+	assert := assertions.New(t)
+	options := &ServiceOptions{Resilience: &ResilienceOptions{
+		CircuitBreaker: &CircuitBreakerPolicy{FailureThreshold: 1, OpenDuration: time.Minute},
+	}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/items/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	deadlineCtx, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	err := adapter.handleGRPCRequest(&fakeServerStream{ctx: deadlineCtx, request: `{"itemId": "slow"}`})
+	assert.Equal(codes.DeadlineExceeded, errorCode(err), "Expected deadline: %v", err)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err = adapter.handleGRPCRequest(&fakeServerStream{ctx: cancelledCtx, request: `{"itemId": "slow"}`})
+	assert.Equal(codes.Canceled, errorCode(err), "Expected cancellation: %v", err)
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}),
+		"Caller cancellation opened the breaker")
+}
+
+// Tests that calls beyond the concurrency limit wait until their deadline.
+func TestMaxConcurrency(t *testing.T) {
+	assert := assertions.New(t)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	options := &ServiceOptions{Resilience: &ResilienceOptions{MaxConcurrency: 1}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	done := make(chan error)
+	go func() { done <- adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "a"}`}) }()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "b"}`})
+	assert.Equal(codes.DeadlineExceeded, errorCode(err), "Expected deadline while waiting at limit")
+	close(release)
+	assert.Nil(<-done)
+}
+
+// Tests that calls failing before their backend request is sent, or cancelled by their callers,
+// don't shrink the adaptive limit.
+func TestAdaptiveLimitLocalFailures(t *testing.T) {
+	assert := assertions.New(t)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	options := &ServiceOptions{Resilience: &ResilienceOptions{
+		MaxConcurrency: 1,
+		AdaptiveLimit:  &AdaptiveLimitOptions{InitialLimit: 10, Smoothing: 1},
+		CircuitBreaker: &CircuitBreakerPolicy{FailureThreshold: 1, OpenDuration: time.Minute},
+	}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer closeServer()
+	limiter := adapter.resilience.adaptiveLimiter
+
+	done := make(chan error)
+	go func() { done <- adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "a"}`}) }()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := adapter.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "b"}`})
+	assert.Equal(codes.DeadlineExceeded, errorCode(err), "Expected deadline while waiting at limit")
+	assert.Equal(10.0, limiter.currentLimit(), "Queued call changed the limit")
+
+	// The failure opens the breaker, which then rejects calls without sending them.
+	close(release)
+	assert.NotNil(<-done)
+	afterFailure := limiter.currentLimit()
+	err = adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "c"}`})
+	assert.Equal(codes.Unavailable, errorCode(err), "Expected open breaker: %v", err)
+	assert.Equal(afterFailure, limiter.currentLimit(), "Rejected call changed the limit")
+	assert.True(limiter.tryAcquire(), "Slot not released")
+}
+
+// Tests that the service-wide limit is shared by all of the service's operations.
+func TestMaxBackendConcurrency(t *testing.T) {
+	assert := assertions.New(t)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	options := &ServiceOptions{MaxBackendConcurrency: 1}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}
+	first, closeFirst := newTestAdapter(t, options, handler)
+	defer closeFirst()
+	second, closeSecond := newTestAdapter(t, options, handler)
+	defer closeSecond()
+
+	done := make(chan error)
+	go func() { done <- first.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "a"}`}) }()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := second.handleGRPCRequest(&fakeServerStream{ctx: ctx, request: `{"itemId": "b"}`})
+	assert.Equal(codes.DeadlineExceeded, errorCode(err), "Expected deadline while waiting at service limit")
+	close(release)
+	assert.Nil(<-done)
+}
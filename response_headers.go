@@ -0,0 +1,160 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Copying of backend response headers into response message fields.
+//
+// Data from legacy APIs often lives only in headers, like X-Total-Count or ETag. Headers are mapped
+// to scalar fields of the response message by API owners in the spec with the
+// x-swaggrpc-response-headers operation extension:
+//
+//   x-swaggrpc-response-headers:
+//     X-Total-Count: total_count
+//     ETag: etag
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Name of the operation extension mapping response headers to fields.
+const responseHeadersExtension = "x-swaggrpc-response-headers"
+
+// A response header copied into a field.
+type headerField struct {
+	header string
+	field  *desc.FieldDescriptor
+}
+
+// Returns the response headers to copy into fields of the output type, sorted by header. Mappings
+// in options override those in the spec; an empty field name removes a header's mapping.
+func resolveResponseHeaders(
+	operation *spec.Operation,
+	operationOptions *OperationOptions,
+	outputType *desc.MessageDescriptor,
+) ([]headerField, error) {
+	mapping, err := resolveHeaderMapping(operation, responseHeadersExtension, operationOptions.ResponseHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []headerField
+	for header, fieldName := range mapping {
+		if fieldName == "" {
+			continue
+		}
+		field := outputType.FindFieldByName(fieldName)
+		if field == nil {
+			return nil, fmt.Errorf("response header %s for %s maps to unknown field %q", header, operation.ID,
+				fieldName)
+		}
+		if field.IsRepeated() || parseHeaderValue(field, "0") == nil {
+			return nil, fmt.Errorf("response header %s for %s maps to field %q, which isn't a scalar",
+				header, operation.ID, fieldName)
+		}
+		fields = append(fields, headerField{header: header, field: field})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].header < fields[j].header })
+	return fields, nil
+}
+
+// Returns the field names mapped to headers by the given extension, keyed by canonical header name.
+// Mappings in overrides replace those in the spec; an empty field name removes a header's mapping.
+func resolveHeaderMapping(
+	operation *spec.Operation,
+	extension string,
+	overrides map[string]string,
+) (map[string]string, error) {
+	fromSpec := make(map[string]string)
+	if _, err := decodeExtension(operation.Extensions, extension, &fromSpec); err != nil {
+		return nil, err
+	}
+	// Keyed by canonical header name, so that overrides apply regardless of case.
+	mapping := make(map[string]string)
+	for header, field := range fromSpec {
+		mapping[http.CanonicalHeaderKey(header)] = field
+	}
+	for header, field := range overrides {
+		mapping[http.CanonicalHeaderKey(header)] = field
+	}
+	return mapping, nil
+}
+
+// Copies the mapped headers of a response into a message. Headers which are missing, or which
+// can't be parsed as their field's type, are skipped.
+func setHeaderFields(msg *dynamic.Message, fields []headerField, response runtime.ClientResponse) {
+	for _, mapped := range fields {
+		text := response.GetHeader(mapped.header)
+		if text == "" {
+			continue
+		}
+		value := parseHeaderValue(mapped.field, text)
+		if value == nil {
+			log.Printf("WARNING: Could not parse response header %s value %q as %s", mapped.header, text,
+				mapped.field.GetType())
+			continue
+		}
+		msg.SetField(mapped.field, value)
+	}
+}
+
+// Returns a header value parsed as the field's type, or nil if it can't be parsed or the field
+// isn't a supported scalar.
+func parseHeaderValue(field *desc.FieldDescriptor, text string) interface{} {
+	switch field.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return text
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		if value, err := strconv.ParseBool(text); err == nil {
+			return value
+		}
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SINT32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		if value, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return int32(value)
+		}
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SINT64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return value
+		}
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		if value, err := strconv.ParseUint(text, 10, 32); err == nil {
+			return uint32(value)
+		}
+	case descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		if value, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return value
+		}
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		if value, err := strconv.ParseFloat(text, 32); err == nil {
+			return float32(value)
+		}
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		if value, err := strconv.ParseFloat(text, 64); err == nil {
+			return value
+		}
+	}
+	return nil
+}
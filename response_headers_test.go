@@ -0,0 +1,116 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Proto with a response carrying header-only data.
+const headerServiceProto = `
+syntax = "proto3";
+
+package header_test;
+
+message ListThingsRequest {}
+
+message ListThingsResponse {
+  repeated string names = 1;
+  int64 total_count = 2;
+  string etag = 3;
+  bool partial = 4;
+}
+
+service Things {
+  rpc ListThings(ListThingsRequest) returns (ListThingsResponse);
+}
+`
+
+// Tests that header mappings are merged and validated.
+func TestResolveResponseHeaders(t *testing.T) {
+	outputType := testMethod(t, headerServiceProto, "header_test.Things", "ListThings").GetOutputType()
+	fixtures := []struct {
+		name      string
+		extension interface{}
+		options   map[string]string
+		expected  map[string]string
+		valid     bool
+	}{
+		{"None", nil, nil, map[string]string{}, true},
+		{"Spec", map[string]interface{}{"X-Total-Count": "total_count", "etag": "etag"}, nil,
+			map[string]string{"X-Total-Count": "total_count", "Etag": "etag"}, true},
+		{"Options override", map[string]interface{}{"X-Total-Count": "total_count", "ETag": "etag"},
+			map[string]string{"etag": "", "X-Partial": "partial"},
+			map[string]string{"X-Total-Count": "total_count", "X-Partial": "partial"}, true},
+		{"Unknown field", nil, map[string]string{"ETag": "missing"}, nil, false},
+		{"Repeated field", nil, map[string]string{"X-Names": "names"}, nil, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "listThings"}}
+			if fixture.extension != nil {
+				operation.AddExtension(responseHeadersExtension, fixture.extension)
+			}
+			fields, err := resolveResponseHeaders(operation, &OperationOptions{ResponseHeaders: fixture.options},
+				outputType)
+			if !fixture.valid {
+				assert.NotNil(err, "Expected an error")
+				return
+			}
+			require.Nil(t, err)
+			actual := make(map[string]string)
+			for _, mapped := range fields {
+				actual[mapped.header] = mapped.field.GetName()
+			}
+			assert.Equal(fixture.expected, actual)
+		})
+	}
+}
+
+// Tests that mapped headers are copied into the response, skipping unparseable values.
+func TestHandleGRPCRequestCopiesHeaders(t *testing.T) {
+	assert := assertions.New(t)
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem"}}
+	operation.AddExtension(responseHeadersExtension, map[string]interface{}{"X-Item-Name": "name"})
+	adapter, closeServer := testOperation{operation: operation,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Item-Name", "from header")
+			w.Write([]byte(`{"itemId": "abc", "name": "from body"}`))
+		}}.adapter(t)
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	require.Len(t, stream.sent, 1)
+	assert.Equal("from header", stream.sent[0].GetFieldByName("name"))
+	assert.Equal("abc", stream.sent[0].GetFieldByName("itemId"))
+}
+
+// Tests that header values are parsed as their field's type.
+func TestParseHeaderValue(t *testing.T) {
+	assert := assertions.New(t)
+	outputType := testMethod(t, headerServiceProto, "header_test.Things", "ListThings").GetOutputType()
+	assert.Equal(int64(42), parseHeaderValue(outputType.FindFieldByName("total_count"), "42"))
+	assert.Nil(parseHeaderValue(outputType.FindFieldByName("total_count"), "many"))
+	assert.Equal(true, parseHeaderValue(outputType.FindFieldByName("partial"), "true"))
+	assert.Equal(`"abc"`, parseHeaderValue(outputType.FindFieldByName("etag"), `"abc"`))
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Normalization of backend JSON responses before they're read into messages.
+//
+// Backends write some values in forms jsonpb doesn't read: polymorphic payloads without "@type"
+// (see any_types.go), and durations as ISO 8601 or plain seconds (see durations.go). Responses
+// which may hold such values are decoded, rewritten and encoded again before being read. Any
+// configured transform (see json_transforms.go) is applied first, and then array- and scalar-rooted
+// responses are wrapped (see array_responses.go and scalar_responses.go).
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Reads a JSON response body into a message of the operation's output type.
+func (p *operationAdapter) unmarshalResponse(body []byte, message *dynamic.Message) error {
+	unmarshaler := &permissiveJSONUnmarshaler
+	if p.anyTypes != nil {
+		unmarshaler = &jsonpb.Unmarshaler{AllowUnknownFields: true, AnyResolver: p.anyTypes}
+	}
+	var err error
+	if p.responseTransform != nil {
+		if body, err = p.transformResponse(body); err != nil {
+			return err
+		}
+	}
+	if p.arrayField != nil {
+		body = p.wrapArrayResponse(body)
+	}
+	if p.scalarField != nil {
+		body = p.wrapScalarResponse(body)
+	}
+	if p.normalizeResponses {
+		if body, err = p.normalizeResponse(body); err != nil {
+			return err
+		}
+	}
+	return unmarshaler.Unmarshal(bytes.NewReader(body), message)
+}
+
+// Returns true if responses of an operation need normalizing before they're read.
+func (p *operationAdapter) needsNormalizing() bool {
+	return containsMessageType(p.outputProtoType, durationTypeName, make(map[*desc.MessageDescriptor]bool)) ||
+		(p.anyTypes != nil && p.anyTypes.discriminator != "")
+}
+
+// Returns a response body rewritten for jsonpb, or the body unchanged if it needn't be.
+func (p *operationAdapter) normalizeResponse(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are kept as written, so that large integers aren't rounded.
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value, changed := p.normalizeJSON(p.outputProtoType, value)
+	if !changed {
+		return body, nil
+	}
+	return json.Marshal(value)
+}
+
+// Rewrites a JSON value of the given message type for jsonpb. Returns the value, and true if it
+// changed.
+func (p *operationAdapter) normalizeJSON(messageType *desc.MessageDescriptor, value interface{}) (interface{}, bool) {
+	if messageType.GetFullyQualifiedName() == durationTypeName {
+		return normalizeDurationJSON(value)
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value, false
+	}
+	if messageType.GetFullyQualifiedName() == anyTypeName {
+		if p.anyTypes == nil {
+			return value, false
+		}
+		// The payload's fields are read from the Any's own object.
+		payloadType, tagged := p.anyTypes.tagPayload(object)
+		if payloadType == nil {
+			return value, tagged
+		}
+		_, changed := p.normalizeJSON(payloadType, object)
+		return value, tagged || changed
+	}
+	return value, visitMessageFields(messageType, object, p.normalizeJSON)
+}
+
+// Calls visit with the type and JSON value of each message in the fields of a JSON object of the
+// given message type: the values of singular message fields, the elements of repeated ones, and the
+// values of maps of messages. Values are replaced with those visit returns. Returns true if visit
+// reported any change.
+func visitMessageFields(
+	messageType *desc.MessageDescriptor,
+	object map[string]interface{},
+	visit func(*desc.MessageDescriptor, interface{}) (interface{}, bool),
+) bool {
+	changed := false
+	for _, field := range messageType.GetFields() {
+		fieldType := field.GetMessageType()
+		if fieldType == nil {
+			continue
+		}
+		key := field.GetJSONName()
+		fieldValue, ok := object[key]
+		if !ok {
+			key = field.GetName()
+			if fieldValue, ok = object[key]; !ok {
+				continue
+			}
+		}
+		switch {
+		case field.IsMap():
+			valueType := field.GetMapValueType().GetMessageType()
+			if valueType == nil {
+				continue
+			}
+			entries, _ := fieldValue.(map[string]interface{})
+			for entryKey, entry := range entries {
+				if replaced, ok := visit(valueType, entry); ok {
+					entries[entryKey] = replaced
+					changed = true
+				}
+			}
+		case field.IsRepeated():
+			elements, _ := fieldValue.([]interface{})
+			for i, element := range elements {
+				if replaced, ok := visit(fieldType, element); ok {
+					elements[i] = replaced
+					changed = true
+				}
+			}
+		default:
+			if replaced, ok := visit(fieldType, fieldValue); ok {
+				object[key] = replaced
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// Returns true if a message type is the named type or has a field of it, directly or in nested
+// messages.
+func containsMessageType(messageType *desc.MessageDescriptor, name string,
+	visited map[*desc.MessageDescriptor]bool) bool {
+	if messageType.GetFullyQualifiedName() == name {
+		return true
+	}
+	if visited[messageType] {
+		return false
+	}
+	visited[messageType] = true
+	for _, field := range messageType.GetFields() {
+		if fieldType := field.GetMessageType(); fieldType != nil && containsMessageType(fieldType, name, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Limits protecting the proxy from oversized or malicious backend responses.
+//
+// MaxResponseBytes bounds the body as received. A compressed body may expand far beyond this, so
+// bodies are also bounded once decompressed, whether by the HTTP transport or here, and JSON nested
+// deeper than decoding can afford is rejected before it is decoded.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// The default for ServiceOptions.MaxDecompressedBytes.
+	defaultMaxDecompressedBytes = 64 << 20
+	// The default for ServiceOptions.MaxResponseDepth.
+	defaultMaxResponseDepth = 100
+)
+
+// Returns the limit on decompressed response bodies, or zero for none.
+func (p *operationAdapter) maxDecompressedBytes() int {
+	switch limit := p.options.MaxDecompressedBytes; {
+	case limit < 0:
+		return 0
+	case limit == 0:
+		return defaultMaxDecompressedBytes
+	default:
+		return limit
+	}
+}
+
+// Returns the limit on response JSON nesting, or zero for none.
+func (p *operationAdapter) maxResponseDepth() int {
+	switch depth := p.options.MaxResponseDepth; {
+	case depth < 0:
+		return 0
+	case depth == 0:
+		return defaultMaxResponseDepth
+	default:
+		return depth
+	}
+}
+
+// Decodes a response body read with the given Content-Encoding, failing with ResourceExhausted if it
+// decompresses beyond MaxDecompressedBytes, and with Internal if its encoding can't be read. Bodies
+// the transport already decompressed have no Content-Encoding, but are still bounded.
+func (p *operationAdapter) decodeResponseBody(data []byte, contentEncoding string) ([]byte, error) {
+	if isIdentityEncoding(contentEncoding) {
+		return p.checkDecompressedSize(data)
+	}
+	return p.decompressResponseBody(bytes.NewReader(data), contentEncoding)
+}
+
+// Decompresses a response body read with the given Content-Encoding, other than identity, as
+// decodeResponseBody does.
+func (p *operationAdapter) decompressResponseBody(body io.Reader, contentEncoding string) ([]byte, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(contentEncoding)); encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "reading gzip response for %s: %v", p.operation.ID, err)
+		}
+		var decompressed io.Reader = reader
+		if limit := p.maxDecompressedBytes(); limit > 0 {
+			decompressed = io.LimitReader(reader, int64(limit)+1)
+		}
+		data, err := ioutil.ReadAll(decompressed)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "reading gzip response for %s: %v", p.operation.ID, err)
+		}
+		return p.checkDecompressedSize(data)
+	default:
+		return nil, status.Errorf(codes.Internal, "backend response for %s has unsupported content encoding %q",
+			p.operation.ID, contentEncoding)
+	}
+}
+
+// Returns a decompressed response body, failing with ResourceExhausted if it's larger than
+// MaxDecompressedBytes.
+func (p *operationAdapter) checkDecompressedSize(data []byte) ([]byte, error) {
+	if limit := p.maxDecompressedBytes(); limit > 0 && len(data) > limit {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"backend response for %s decompresses to more than the limit of %d bytes", p.operation.ID, limit)
+	}
+	return data, nil
+}
+
+// Returns true for the Content-Encoding of bodies which aren't encoded.
+func isIdentityEncoding(contentEncoding string) bool {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return true
+	}
+	return false
+}
+
+// Checks a JSON response body before it is decoded, failing with Internal if it is nested beyond
+// MaxResponseDepth.
+func (p *operationAdapter) checkResponseDepth(data []byte) error {
+	if depth := p.maxResponseDepth(); depth > 0 && jsonDepthExceeds(data, depth) {
+		return status.Errorf(codes.Internal,
+			"backend response for %s is nested deeper than the limit of %d", p.operation.ID, depth)
+	}
+	return nil
+}
+
+// Returns true if the JSON objects and arrays in data nest deeper than limit. Malformed JSON is left
+// for the decoder to reject.
+func jsonDepthExceeds(data []byte, limit int) bool {
+	depth := 0
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			if depth++; depth > limit {
+				return true
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+// Returns data compressed with gzip.
+func gzipBytes(data string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(data))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+// Tests that gzip responses are decompressed within the limits, and deeply nested responses rejected.
+func TestResponseLimits(t *testing.T) {
+	bomb := `{"name": "` + strings.Repeat("x", 4096) + `"}`
+	fixtures := []struct {
+		name     string
+		options  *ServiceOptions
+		encoding string
+		body     []byte
+		code     codes.Code
+	}{
+		{"Gzip", &ServiceOptions{}, "gzip", gzipBytes(`{"name": "thing"}`), codes.OK},
+		{"Gzip under limit", &ServiceOptions{MaxDecompressedBytes: 8192}, "gzip", gzipBytes(bomb), codes.OK},
+		{"Gzip over limit", &ServiceOptions{MaxResponseBytes: 1024, MaxDecompressedBytes: 1024}, "gzip",
+			gzipBytes(bomb), codes.ResourceExhausted},
+		{"Plain over limit", &ServiceOptions{MaxDecompressedBytes: 1024}, "", []byte(bomb), codes.ResourceExhausted},
+		{"No limit", &ServiceOptions{MaxDecompressedBytes: -1}, "gzip", gzipBytes(bomb), codes.OK},
+		{"Corrupt gzip", &ServiceOptions{}, "gzip", []byte(`{"name": "thing"}`), codes.Internal},
+		{"Unsupported encoding", &ServiceOptions{}, "br", []byte(`{}`), codes.Internal},
+		{"Shallow", &ServiceOptions{MaxResponseDepth: 3}, "", []byte(`{"name": "[[[[{{{"}`), codes.OK},
+		{"Too deep", &ServiceOptions{MaxResponseDepth: 3}, "", []byte(`{"other": [[{}]]}`), codes.Internal},
+		{"Default depth", &ServiceOptions{}, "",
+			[]byte(`{"other": ` + strings.Repeat("[", 200) + strings.Repeat("]", 200) + `}`), codes.Internal},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adapter, closeServer := newTestAdapter(t, fixture.options,
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if fixture.encoding != "" {
+						w.Header().Set("Content-Encoding", fixture.encoding)
+					}
+					w.Write(fixture.body)
+				})
+			defer closeServer()
+
+			err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+			assertions.Equal(t, fixture.code, errorCode(err), "Bad result: %v", err)
+		})
+	}
+}
+
+// Tests measuring JSON nesting, ignoring brackets in strings.
+func TestJSONDepthExceeds(t *testing.T) {
+	assert := assertions.New(t)
+	assert.False(jsonDepthExceeds([]byte(`{"a": [1, {"b": 2}]}`), 3))
+	assert.True(jsonDepthExceeds([]byte(`{"a": [1, {"b": []}]}`), 3))
+	assert.False(jsonDepthExceeds([]byte(`{"a": "\"[[[["}`), 1))
+}
+
+// Tests decompressing gzip bodies the transport left encoded.
+func TestDecodeGzipResponseBody(t *testing.T) {
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{MaxDecompressedBytes: 1024}, nil)
+	defer closeServer()
+
+	data, err := adapter.decodeResponseBody(gzipBytes(`{"name": "thing"}`), "GZIP")
+	assertions.Nil(t, err)
+	assertions.Equal(t, `{"name": "thing"}`, string(data))
+	_, err = adapter.decodeResponseBody(gzipBytes(strings.Repeat(" ", 4096)+"{}"), "gzip")
+	assertions.Equal(t, codes.ResourceExhausted, errorCode(err), "Bad result: %v", err)
+	_, err = adapter.decodeResponseBody([]byte(`{}`), "gzip")
+	assertions.Equal(t, codes.Internal, errorCode(err), "Bad result: %v", err)
+}
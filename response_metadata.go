@@ -0,0 +1,69 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Returning backend response headers to the caller as gRPC metadata.
+//
+// Only allowed headers are returned. Headers returned as trailers, like rate limits, are sent for
+// failed calls too; header metadata is only sent with a response message. Headers are read into
+// message fields with the x-swaggrpc-response-headers extension instead; see response_headers.go.
+
+import (
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"google.golang.org/grpc/metadata"
+)
+
+// ResponseMetadataOptions configures which backend response headers are returned to the caller as
+// metadata, keyed by header name in lower case.
+type ResponseMetadataOptions struct {
+	// Headers returned as header metadata, like "ETag".
+	Header []string
+	// Headers returned as trailer metadata, like "X-RateLimit-Remaining".
+	Trailer []string
+	// If set, a prefix added to metadata keys, like "x-backend-". Headers whose keys gRPC reserves,
+	// like Content-Type, are only returned with a prefix.
+	Prefix string
+}
+
+// Returns the metadata for the named headers of a response. Missing headers are skipped, as are
+// headers whose keys aren't valid metadata keys.
+func (o *ResponseMetadataOptions) metadata(names []string, response runtime.ClientResponse) metadata.MD {
+	md := metadata.MD{}
+	for _, name := range names {
+		value := response.GetHeader(name)
+		key := strings.ToLower(o.Prefix + name)
+		if value == "" || transportMetadataKeys[key] || !isMetadataKey(key) {
+			continue
+		}
+		md[key] = append(md[key], value)
+	}
+	return md
+}
+
+// Records the metadata returned to the caller from a backend response's headers on a call,
+// replacing that of any earlier response.
+func (p *operationAdapter) recordResponseMetadata(call *proxiedCall, response runtime.ClientResponse) {
+	call.backendHeader, call.backendTrailer = nil, nil
+	if options := p.options.ResponseMetadata; options != nil {
+		call.backendHeader = options.metadata(options.Header, response)
+		call.backendTrailer = options.metadata(options.Trailer, response)
+	}
+	if p.options.LinkMetadata {
+		links := parseLinks(response.GetHeader("Link"))
+		call.backendHeader = metadata.Join(call.backendHeader, linkMetadata(links))
+	}
+}
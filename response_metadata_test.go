@@ -0,0 +1,66 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests that allowed response headers are returned as header and trailer metadata.
+func TestResponseMetadata(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		status  int
+		options *ResponseMetadataOptions
+		header  metadata.MD
+		trailer metadata.MD
+	}{
+		{"header and trailer", http.StatusOK,
+			&ResponseMetadataOptions{Header: []string{"ETag", "X-Missing"},
+				Trailer: []string{"X-RateLimit-Remaining"}},
+			metadata.MD{"etag": {`"v1"`}}, metadata.MD{"x-ratelimit-remaining": {"9"}}},
+		{"failed call", http.StatusTooManyRequests,
+			&ResponseMetadataOptions{Header: []string{"ETag"}, Trailer: []string{"X-RateLimit-Remaining"}},
+			nil, metadata.MD{"x-ratelimit-remaining": {"9"}}},
+		{"reserved header", http.StatusOK, &ResponseMetadataOptions{Header: []string{"Content-Type"}}, nil, nil},
+		{"prefixed", http.StatusOK, &ResponseMetadataOptions{Header: []string{"Content-Type"}, Prefix: "X-Backend-"},
+			metadata.MD{"x-backend-content-type": {"application/json"}}, nil},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			options := &ServiceOptions{ResponseMetadata: fixture.options}
+			adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("X-RateLimit-Remaining", "9")
+				w.WriteHeader(fixture.status)
+				w.Write([]byte(`{"name": "thing"}`))
+			})
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			err := adapter.handleGRPCRequest(stream)
+			assert.Equal(fixture.status == http.StatusOK, errorCode(err) == codes.OK, "Unexpected error %v", err)
+			assert.Equal(fixture.header, stream.header)
+			assert.Equal(fixture.trailer, stream.trailer)
+		})
+	}
+}
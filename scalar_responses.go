@@ -0,0 +1,62 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Reading of scalar-rooted response bodies.
+//
+// As with arrays (see array_responses.go), operations returning a bare string, number or boolean
+// have their output wrapped in a message with a single field. A response which is a scalar is read
+// into that field. Strings may also be sent unquoted, as text/plain responses usually are.
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/go-openapi/spec"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Returns the field scalar responses are read into: the output type's only field, if it's a
+// singular scalar. Returns nil if the output type has other fields, or the success response's
+// schema is declared as an object or array.
+func resolveScalarField(operation *spec.Operation, outputType *desc.MessageDescriptor) *desc.FieldDescriptor {
+	fields := outputType.GetFields()
+	if len(fields) != 1 || fields[0].IsRepeated() || fields[0].GetMessageType() != nil {
+		return nil
+	}
+	if response := successResponse(operation); response != nil && response.Schema != nil {
+		schemaType := response.Schema.Type
+		if schemaType.Contains("object") || schemaType.Contains("array") {
+			return nil
+		}
+	}
+	return fields[0]
+}
+
+// Returns a response body with a scalar at its root wrapped in an object, as the value of the
+// operation's scalar field. Objects and empty bodies are returned unchanged.
+func (p *operationAdapter) wrapScalarResponse(body []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] == '{' {
+		return body
+	}
+	if p.scalarField.GetType() == descriptor.FieldDescriptorProto_TYPE_STRING && !json.Valid(trimmed) {
+		// Encoding a string can't fail.
+		quoted, _ := json.Marshal(string(body))
+		return wrapRootValue(p.scalarField, quoted)
+	}
+	return wrapRootValue(p.scalarField, trimmed)
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scalarResponsesProto = `
+syntax = "proto3";
+
+package scalar_test;
+
+message Empty {}
+
+message Count {
+  int64 count = 1;
+}
+
+message Greeting {
+  string text = 1;
+}
+
+message Flag {
+  bool enabled = 1;
+}
+
+message Wrapped {
+  Greeting greeting = 1;
+}
+
+service Scalars {
+  rpc GetCount(Empty) returns (Count);
+  rpc GetGreeting(Empty) returns (Greeting);
+  rpc GetFlag(Empty) returns (Flag);
+}
+`
+
+// Tests that only outputs with a single scalar field, for scalar schemas, get a scalar field.
+func TestResolveScalarField(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(scalarResponsesProto))
+	require.Nil(t, err)
+	withType := func(schemaType string) *spec.Operation {
+		return &spec.Operation{OperationProps: spec.OperationProps{Responses: &spec.Responses{
+			ResponsesProps: spec.ResponsesProps{StatusCodeResponses: map[int]spec.Response{
+				200: {ResponseProps: spec.ResponseProps{
+					Schema: &spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{schemaType}}},
+				}},
+			}},
+		}}}
+	}
+	fixtures := []struct {
+		name      string
+		operation *spec.Operation
+		output    string
+		found     bool
+	}{
+		{"integer schema", withType("integer"), "scalar_test.Count", true},
+		{"no schema", &spec.Operation{}, "scalar_test.Greeting", true},
+		{"object schema", withType("object"), "scalar_test.Greeting", false},
+		{"message field", &spec.Operation{}, "scalar_test.Wrapped", false},
+		{"no fields", &spec.Operation{}, "scalar_test.Empty", false},
+	}
+	for _, fixture := range fixtures {
+		field := resolveScalarField(fixture.operation, fileDesc.FindMessage(fixture.output))
+		assertions.Equal(t, fixture.found, field != nil, "Wrong scalar field for %s", fixture.name)
+	}
+}
+
+// Tests that scalar responses are read into the output's field.
+func TestScalarResponses(t *testing.T) {
+	fixtures := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		field       string
+		value       interface{}
+	}{
+		{"number", "GetCount", "application/json", "42\n", "count", int64(42)},
+		{"quoted number", "GetCount", "application/json", `"42"`, "count", int64(42)},
+		{"string", "GetGreeting", "application/json", `"hello"`, "text", "hello"},
+		{"text", "GetGreeting", "text/plain", "hello, world", "text", "hello, world"},
+		{"boolean", "GetFlag", "application/json", "true", "enabled", true},
+		{"object", "GetFlag", "application/json", `{"enabled": true}`, "enabled", true},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adapter, closeServer := testOperation{
+				method:     testMethod(t, scalarResponsesProto, "scalar_test.Scalars", fixture.method),
+				path:       "/value",
+				operation:  &spec.Operation{OperationProps: spec.OperationProps{ID: fixture.method}},
+				parameters: map[string]*spec.Parameter{},
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", fixture.contentType)
+					w.Write([]byte(fixture.body))
+				},
+			}.adapter(t)
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{}`}
+			require.Nil(t, adapter.handleGRPCRequest(stream))
+			require.Len(t, stream.sent, 1)
+			assertions.Equal(t, fixture.value, stream.sent[0].GetFieldByName(fixture.field))
+		})
+	}
+}
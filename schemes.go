@@ -0,0 +1,122 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// The backend host, base path and URL schemes, from the swagger document.
+//
+// A document's schemes apply to all its operations, unless an operation lists its own. As swagger
+// clients do, https is preferred when a choice of schemes allows it.
+
+import (
+	"fmt"
+	"net/url"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+)
+
+// NewSwaggerClient returns a client for the backend a swagger document describes, with the
+// document's host, base path and schemes. As the specification requires, the host and scheme
+// default to those of the URL the document was served from, which may be empty if the document
+// names its host. Returns an error if the document has no host and no URL is given, or allows only
+// schemes other than http and https.
+func NewSwaggerClient(swagger *spec.Swagger, specURL string) (*runtimeclient.Runtime, error) {
+	host := swagger.Host
+	schemes := swagger.Schemes
+	if host == "" || len(schemes) == 0 {
+		parsed, err := url.Parse(specURL)
+		if err != nil {
+			return nil, fmt.Errorf("bad spec URL %q: %v", specURL, err)
+		}
+		if host == "" {
+			host = parsed.Host
+		}
+		if len(schemes) == 0 && parsed.Scheme != "" {
+			schemes = []string{parsed.Scheme}
+		}
+	}
+	if host == "" {
+		return nil, fmt.Errorf("swagger document has no host, and no spec URL was given")
+	}
+	schemes, err := supportedSchemes(schemes)
+	if err != nil {
+		return nil, err
+	}
+	basePath := swagger.BasePath
+	if basePath == "" {
+		basePath = "/"
+	}
+	return runtimeclient.New(host, basePath, schemes), nil
+}
+
+// Returns the schemes an operation's requests use in place of its client's, or nil to use the
+// client's: https if forced by the options, or the operation's own schemes.
+func resolveSchemes(operation *spec.Operation, options *ServiceOptions) ([]string, error) {
+	if options.ForceHTTPS {
+		return []string{"https"}, nil
+	}
+	if len(operation.Schemes) == 0 {
+		return nil, nil
+	}
+	schemes, err := supportedSchemes(operation.Schemes)
+	if err != nil {
+		return nil, fmt.Errorf("operation %s: %v", operation.ID, err)
+	}
+	return schemes, nil
+}
+
+// Returns the schemes requests can be sent with, http and https, from the given schemes. Returns an
+// error if some were given and none are supported.
+func supportedSchemes(schemes []string) ([]string, error) {
+	var supported []string
+	for _, scheme := range schemes {
+		if scheme == "http" || scheme == "https" {
+			supported = append(supported, scheme)
+		}
+	}
+	if len(schemes) > 0 && len(supported) == 0 {
+		return nil, fmt.Errorf("none of the schemes %v are supported; only http and https are", schemes)
+	}
+	return supported, nil
+}
+
+// Returns the scheme requests are sent with, given the allowed schemes: https if allowed, otherwise
+// the first. Defaults to http.
+func preferredScheme(schemes []string) string {
+	for _, scheme := range schemes {
+		if scheme == "https" {
+			return scheme
+		}
+	}
+	if len(schemes) > 0 {
+		return schemes[0]
+	}
+	return "http"
+}
+
+// Returns a copy of a swagger client sending requests with the given schemes, in place of its own.
+func withSchemes(swaggerClient *runtimeclient.Runtime, schemes []string) *runtimeclient.Runtime {
+	copied := runtimeclient.New(swaggerClient.Host, swaggerClient.BasePath, schemes)
+	copied.DefaultMediaType = swaggerClient.DefaultMediaType
+	copied.DefaultAuthentication = swaggerClient.DefaultAuthentication
+	copied.Consumers = swaggerClient.Consumers
+	copied.Producers = swaggerClient.Producers
+	copied.Transport = swaggerClient.Transport
+	copied.Jar = swaggerClient.Jar
+	copied.Formats = swaggerClient.Formats
+	copied.Debug = swaggerClient.Debug
+	copied.Context = swaggerClient.Context
+	return copied
+}
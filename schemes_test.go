@@ -0,0 +1,100 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	runtimeclient "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that clients are created for the host and base path of a document.
+func TestNewSwaggerClient(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		swagger  spec.SwaggerProps
+		specURL  string
+		host     string
+		basePath string
+		valid    bool
+	}{
+		{"from document", spec.SwaggerProps{Host: "api.example.com", BasePath: "/v1", Schemes: []string{"https"}},
+			"", "api.example.com", "/v1", true},
+		{"from spec URL", spec.SwaggerProps{}, "https://docs.example.com:8443/swagger.json",
+			"docs.example.com:8443", "/", true},
+		{"no host", spec.SwaggerProps{BasePath: "/v1"}, "", "", "", false},
+		{"unsupported schemes", spec.SwaggerProps{Host: "api.example.com", Schemes: []string{"ws", "wss"}},
+			"", "", "", false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			client, err := NewSwaggerClient(&spec.Swagger{SwaggerProps: fixture.swagger}, fixture.specURL)
+			if !fixture.valid {
+				assertions.Error(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assertions.Equal(t, fixture.host, client.Host)
+			assertions.Equal(t, fixture.basePath, client.BasePath)
+		})
+	}
+}
+
+// Tests that operation schemes and ForceHTTPS override the swagger client's schemes.
+func TestSchemeOverrides(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	method := testMethod(t, testServiceProto, "test_service.Items", "GetItem")
+
+	fixtures := []struct {
+		name    string
+		schemes []string
+		options *ServiceOptions
+		valid   bool
+	}{
+		{"client scheme", nil, nil, false},
+		{"operation schemes", []string{"http", "https"}, nil, true},
+		{"forced", []string{"http"}, &ServiceOptions{ForceHTTPS: true}, true},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem", Schemes: fixture.schemes}}
+			swaggerClient := runtimeclient.New(serverURL.Host, "/", []string{"http"})
+			adapter, err := newPathWrapper(server.Client(), swaggerClient, "GET", "/items/{itemId}", operation,
+				testServiceParams, method, fixture.options)
+			require.Nil(t, err)
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			err = adapter.handleGRPCRequest(stream)
+			assertions.Equal(t, fixture.valid, err == nil, "Unexpected error %v", err)
+		})
+	}
+
+	operation := &spec.Operation{OperationProps: spec.OperationProps{ID: "getItem", Schemes: []string{"ws"}}}
+	_, err = newPathWrapper(server.Client(), runtimeclient.New(serverURL.Host, "/", nil), "GET",
+		"/items/{itemId}", operation, testServiceParams, method, nil)
+	assertions.Error(t, err, "Unsupported scheme accepted")
+}
@@ -0,0 +1,208 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Naming of the gRPC services and methods which proxy a spec's operations.
+//
+// Operations are grouped into one gRPC service per swagger tag, so that the gRPC API mirrors the
+// spec's logical modules: an operation tagged "pet store" is served by the PetStore service.
+// Operations with several tags are served by the service for their first tag.
+//
+// Methods are named after operation IDs. Operations without an ID are named after their HTTP method
+// and path, so GET /users/{id} is named GetUsersById; a name already used in the service gets a
+// numeric suffix, like GetUsersById2.
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// The service for untagged operations, if none is configured.
+const defaultUntaggedService = "Default"
+
+// ServiceGroupingOptions configures how operations are grouped into gRPC services.
+type ServiceGroupingOptions struct {
+	// The service name for operations with no tags. Defaults to "Default".
+	UntaggedService string
+}
+
+// OperationMethod names the gRPC method proxying a swagger operation.
+type OperationMethod struct {
+	// The gRPC service name, without the package.
+	Service string
+	// The gRPC method name.
+	Method string
+	// The HTTP method of the operation.
+	HTTPMethod string
+	// The operation's path template, like "/items/{itemId}".
+	Path string
+	// The operation. If the spec's operation has no ID, this is a copy with the method name as its
+	// ID, so that options can refer to it.
+	Operation *spec.Operation
+}
+
+// GroupOperationsByTag returns the gRPC methods for every operation in a spec, grouped into
+// services by tag. Methods are sorted by path, then HTTP method.
+func GroupOperationsByTag(swagger *spec.Swagger, options *ServiceGroupingOptions) []OperationMethod {
+	untagged := defaultUntaggedService
+	if options != nil && options.UntaggedService != "" {
+		untagged = options.UntaggedService
+	}
+	var methods []OperationMethod
+	if swagger.Paths == nil {
+		return methods
+	}
+	paths := make([]string, 0, len(swagger.Paths.Paths))
+	for path := range swagger.Paths.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		pathItem := swagger.Paths.Paths[path]
+		for _, httpMethod := range []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH"} {
+			operation := pathItemOperation(&pathItem, httpMethod)
+			if operation == nil {
+				continue
+			}
+			service := untagged
+			if len(operation.Tags) > 0 && camelCase(operation.Tags[0]) != "" {
+				service = identifierName(operation.Tags[0], "Service")
+			}
+			methods = append(methods, OperationMethod{
+				Service:    service,
+				Method:     identifierName(operation.ID, "Operation"),
+				HTTPMethod: httpMethod,
+				Path:       path,
+				Operation:  operation,
+			})
+		}
+	}
+	nameMethods(methods)
+	return methods
+}
+
+// Makes method names unique within their service, numbering any name already used: IDs differing
+// only in case or separators, such as get_user and getUser, camel case to the same name. Methods
+// named by ID are named first, so that adding an operation without an ID never renames them.
+// Methods for operations without IDs are then named after their HTTP method and path.
+func nameMethods(methods []OperationMethod) {
+	// Method names in use, keyed by service.
+	used := make(map[string]map[string]bool)
+	uniqueName := func(service, name string) string {
+		if used[service] == nil {
+			used[service] = make(map[string]bool)
+		}
+		unique := name
+		for suffix := 2; used[service][unique]; suffix++ {
+			unique = name + strconv.Itoa(suffix)
+		}
+		used[service][unique] = true
+		return unique
+	}
+	for i := range methods {
+		if method := &methods[i]; method.Method != "" {
+			method.Method = uniqueName(method.Service, method.Method)
+		}
+	}
+	for i := range methods {
+		method := &methods[i]
+		if method.Method != "" {
+			continue
+		}
+		method.Method = uniqueName(method.Service, synthesizeMethodName(method.HTTPMethod, method.Path))
+		named := *method.Operation
+		named.ID = method.Method
+		method.Operation = &named
+	}
+}
+
+// Returns a method name for an HTTP method and path template: the HTTP method, followed by each
+// path segment, with parameters preceded by "By". GET /users/{id}/posts becomes GetUsersByIdPosts.
+func synthesizeMethodName(httpMethod, path string) string {
+	name := camelCase(strings.ToLower(httpMethod))
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name += "By" + camelCase(segment[1:len(segment)-1])
+		} else {
+			name += camelCase(segment)
+		}
+	}
+	return name
+}
+
+// FindMethod returns the method's descriptor in the given proto file, or nil if the file doesn't
+// define it.
+func (m *OperationMethod) FindMethod(file *desc.FileDescriptor) *desc.MethodDescriptor {
+	serviceName := m.Service
+	if file.GetPackage() != "" {
+		serviceName = file.GetPackage() + "." + serviceName
+	}
+	service := file.FindService(serviceName)
+	if service == nil {
+		return nil
+	}
+	return service.FindMethodByName(m.Method)
+}
+
+// Returns the path item's operation for an HTTP method, or nil if it has none.
+func pathItemOperation(pathItem *spec.PathItem, httpMethod string) *spec.Operation {
+	switch httpMethod {
+	case "GET":
+		return pathItem.Get
+	case "PUT":
+		return pathItem.Put
+	case "POST":
+		return pathItem.Post
+	case "DELETE":
+		return pathItem.Delete
+	case "OPTIONS":
+		return pathItem.Options
+	case "HEAD":
+		return pathItem.Head
+	case "PATCH":
+		return pathItem.Patch
+	}
+	return nil
+}
+
+// Returns a proto identifier for a spec name, in upper camel case, with the given prefix if it would
+// otherwise start with a digit: a tag "2fa" names the service "Service2fa". Empty if the name has no
+// letters or digits.
+func identifierName(name, prefix string) string {
+	if name = camelCase(name); name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = prefix + name
+	}
+	return name
+}
+
+// Returns a name in upper camel case, as used for proto services and methods: words separated by
+// anything other than letters and digits are capitalized and joined, so "pet store" and "pet-store"
+// both become "PetStore", and "getItem" becomes "GetItem".
+func camelCase(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, "")
+}
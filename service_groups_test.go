@@ -0,0 +1,133 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"testing"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns an operation with the given ID and tags.
+func taggedOperation(id string, tags ...string) *spec.Operation {
+	return &spec.Operation{OperationProps: spec.OperationProps{ID: id, Tags: tags}}
+}
+
+// Tests that operations are grouped by their first tag, with a fallback for untagged operations.
+func TestGroupOperationsByTag(t *testing.T) {
+	assert := assertions.New(t)
+	swagger := &spec.Swagger{SwaggerProps: spec.SwaggerProps{Paths: &spec.Paths{Paths: map[string]spec.PathItem{
+		"/items/{itemId}": {PathItemProps: spec.PathItemProps{
+			Get:    taggedOperation("getItem", "items"),
+			Delete: taggedOperation("delete-item", "items", "admin"),
+		}},
+		"/health": {PathItemProps: spec.PathItemProps{Get: taggedOperation("health")}},
+		"/pets":   {PathItemProps: spec.PathItemProps{Post: taggedOperation("create_pet", "pet store")}},
+		"/verify": {PathItemProps: spec.PathItemProps{Post: taggedOperation("2fa-verify", "2fa")}},
+		"/other":  {PathItemProps: spec.PathItemProps{Get: taggedOperation("other", "--")}},
+	}}}}
+
+	var names []string
+	for _, method := range GroupOperationsByTag(swagger, nil) {
+		names = append(names, method.HTTPMethod+" "+method.Path+" "+method.Service+"/"+method.Method)
+	}
+	assert.Equal([]string{
+		"GET /health Default/Health",
+		"GET /items/{itemId} Items/GetItem",
+		"DELETE /items/{itemId} Items/DeleteItem",
+		"GET /other Default/Other",
+		"POST /pets PetStore/CreatePet",
+		"POST /verify Service2fa/Operation2faVerify",
+	}, names)
+
+	methods := GroupOperationsByTag(swagger, &ServiceGroupingOptions{UntaggedService: "Misc"})
+	assert.Equal("Misc", methods[0].Service)
+	assert.Empty(GroupOperationsByTag(&spec.Swagger{}, nil))
+}
+
+// Tests that operation IDs camel casing to the same name are numbered within their service.
+func TestGroupOperationsCollidingIDs(t *testing.T) {
+	swagger := &spec.Swagger{SwaggerProps: spec.SwaggerProps{Paths: &spec.Paths{Paths: map[string]spec.PathItem{
+		"/a": {PathItemProps: spec.PathItemProps{Get: taggedOperation("get_user", "users")}},
+		"/b": {PathItemProps: spec.PathItemProps{Get: taggedOperation("getUser", "users")}},
+		"/c": {PathItemProps: spec.PathItemProps{Get: taggedOperation("get-user", "admin")}},
+	}}}}
+	names := make(map[string]string)
+	for _, method := range GroupOperationsByTag(swagger, nil) {
+		names[method.Operation.ID] = method.Service + "/" + method.Method
+	}
+	assertions.Equal(t, map[string]string{
+		"get_user": "Users/GetUser",
+		"getUser":  "Users/GetUser2",
+		"get-user": "Admin/GetUser",
+	}, names)
+}
+
+// Tests finding grouped methods in a proto file.
+func TestOperationMethodFindMethod(t *testing.T) {
+	fileDesc, err := loadProtoFromBytes([]byte(testServiceProto))
+	require.Nil(t, err)
+	found := (&OperationMethod{Service: "Items", Method: "GetItem"}).FindMethod(fileDesc)
+	require.NotNil(t, found)
+	assertions.Equal(t, "test_service.Items.GetItem", found.GetFullyQualifiedName())
+	assertions.Nil(t, (&OperationMethod{Service: "Items", Method: "Missing"}).FindMethod(fileDesc))
+	assertions.Nil(t, (&OperationMethod{Service: "Missing", Method: "GetItem"}).FindMethod(fileDesc))
+}
+
+// Tests naming operations without IDs after their HTTP method and path.
+func TestSynthesizeMethodName(t *testing.T) {
+	fixtures := []struct {
+		httpMethod string
+		path       string
+		expected   string
+	}{
+		{"GET", "/users/{id}", "GetUsersById"},
+		{"DELETE", "/users/{user_id}/posts/{post-id}", "DeleteUsersByUserIdPostsByPostId"},
+		{"POST", "/v1/pet-store/pets", "PostV1PetStorePets"},
+		{"GET", "/", "Get"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.expected, func(t *testing.T) {
+			assertions.Equal(t, fixture.expected, synthesizeMethodName(fixture.httpMethod, fixture.path))
+		})
+	}
+}
+
+// Tests that synthesized names don't collide with other methods in their service.
+func TestGroupOperationsWithoutIDs(t *testing.T) {
+	assert := assertions.New(t)
+	swagger := &spec.Swagger{SwaggerProps: spec.SwaggerProps{Paths: &spec.Paths{Paths: map[string]spec.PathItem{
+		"/users/{id}":   {PathItemProps: spec.PathItemProps{Get: taggedOperation("", "users")}},
+		"/users/{name}": {PathItemProps: spec.PathItemProps{Get: taggedOperation("", "users")}},
+		"/users":        {PathItemProps: spec.PathItemProps{Get: taggedOperation("GetUsersById", "users")}},
+		"/other/{id}":   {PathItemProps: spec.PathItemProps{Get: taggedOperation("", "other")}},
+	}}}}
+	original := swagger.Paths.Paths["/users/{id}"].Get
+
+	names := make(map[string]string)
+	for _, method := range GroupOperationsByTag(swagger, nil) {
+		names[method.Path] = method.Service + "/" + method.Method
+		assert.Equal(method.Method, method.Operation.ID)
+	}
+	assert.Equal(map[string]string{
+		"/other/{id}":   "Other/GetOtherById",
+		"/users":        "Users/GetUsersById",
+		"/users/{id}":   "Users/GetUsersById2",
+		"/users/{name}": "Users/GetUsersByName",
+	}, names)
+	assert.Empty(original.ID, "Spec operation modified")
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Backend sessions, for backends which require a login call returning a token to send with
+// subsequent calls.
+//
+// The proxy logs in on the first call, and again when the token nears the end of its lifetime or
+// the backend rejects it with a 401. Calls wait for a login in progress rather than starting their
+// own.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/jsonpointer"
+	"github.com/go-openapi/runtime"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The most time before a token expires that it's replaced by logging in again. Tokens with short
+// lifetimes are replaced halfway through.
+const sessionRefreshMargin = 30 * time.Second
+
+// SessionOptions configures the login for a backend session. The token from the login response is
+// sent in a header with every backend request.
+type SessionOptions struct {
+	// URL of the login request.
+	LoginURL string
+	// Method of the login request. Defaults to POST.
+	LoginMethod string
+	// Body of the login request, such as JSON credentials.
+	LoginBody []byte
+	// Content type of the login body. Defaults to "application/json".
+	LoginContentType string
+	// Additional headers for the login request, such as an API key.
+	LoginHeaders map[string]string
+	// JSON pointer to the token in the login response, like "/data/token". Defaults to "/token".
+	TokenPointer string
+	// If set, a JSON pointer to the token's lifetime in seconds in the login response, like
+	// "/expires_in". If unset, or the response has no such number, TTL is used.
+	ExpiresInPointer string
+	// How long a token is used before logging in again. Defaults to 15 minutes.
+	TTL time.Duration
+	// The header the token is sent in. Defaults to "Authorization".
+	Header string
+	// Format of the header value, with %s for the token. Defaults to "Bearer %s".
+	HeaderFormat string
+	// Client to log in with. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// A backend session, shared by all operations of a service.
+type backendSession struct {
+	options SessionOptions
+
+	// Held while logging in, so that concurrent calls share a login. Guards all fields below.
+	mutex sync.Mutex
+	// The current token, or empty before the first login or after the token is rejected.
+	token string
+	// When the token should be replaced.
+	refreshAt time.Time
+}
+
+// Returns a session with the given options, with defaults applied.
+func newBackendSession(options SessionOptions) *backendSession {
+	if options.LoginMethod == "" {
+		options.LoginMethod = http.MethodPost
+	}
+	if options.LoginContentType == "" {
+		options.LoginContentType = "application/json"
+	}
+	if options.TokenPointer == "" {
+		options.TokenPointer = "/token"
+	}
+	if options.TTL <= 0 {
+		options.TTL = 15 * time.Minute
+	}
+	if options.Header == "" {
+		options.Header = "Authorization"
+	}
+	if options.HeaderFormat == "" {
+		options.HeaderFormat = "Bearer %s"
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &backendSession{options: options}
+}
+
+// Returns the session for the service's backend, created on first use, or nil if it has none.
+func (o *ServiceOptions) backendSession() *backendSession {
+	if o.Session == nil {
+		return nil
+	}
+	o.sessionOnce.Do(func() {
+		o.session = newBackendSession(*o.Session)
+	})
+	return o.session
+}
+
+// Returns a current token, logging in if there's none. Fails with Unavailable if the login fails.
+func (s *backendSession) currentToken(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token != "" && time.Now().Before(s.refreshAt) {
+		return s.token, nil
+	}
+	token, ttl, err := s.login(ctx)
+	if err != nil {
+		return "", status.Errorf(codes.Unavailable, "backend login failed: %v", err)
+	}
+	margin := sessionRefreshMargin
+	if margin > ttl/2 {
+		margin = ttl / 2
+	}
+	s.token, s.refreshAt = token, time.Now().Add(ttl-margin)
+	return token, nil
+}
+
+// Discards a token the backend rejected, unless it has already been replaced.
+func (s *backendSession) invalidate(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// Sends the login request, returning the token and its lifetime.
+func (s *backendSession) login(ctx context.Context) (string, time.Duration, error) {
+	request, err := http.NewRequest(s.options.LoginMethod, s.options.LoginURL,
+		bytes.NewReader(s.options.LoginBody))
+	if err != nil {
+		return "", 0, err
+	}
+	if len(s.options.LoginBody) > 0 {
+		request.Header.Set("Content-Type", s.options.LoginContentType)
+	}
+	for name, value := range s.options.LoginHeaders {
+		request.Header.Set(name, value)
+	}
+	response, err := ctxhttp.Do(ctx, s.options.HTTPClient, request)
+	if err != nil {
+		return "", 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return "", 0, fmt.Errorf("HTTP status %d from %s", response.StatusCode, s.options.LoginURL)
+	}
+	var document interface{}
+	if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+		return "", 0, fmt.Errorf("decoding login response: %v", err)
+	}
+
+	value, err := lookupJSONPointer(document, s.options.TokenPointer)
+	if err != nil {
+		return "", 0, err
+	}
+	token, ok := value.(string)
+	if !ok || token == "" {
+		return "", 0, fmt.Errorf("no token at %s in login response", s.options.TokenPointer)
+	}
+	ttl := s.options.TTL
+	if s.options.ExpiresInPointer != "" {
+		if value, err := lookupJSONPointer(document, s.options.ExpiresInPointer); err == nil {
+			if seconds, ok := value.(float64); ok && seconds > 0 {
+				ttl = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return token, ttl, nil
+}
+
+// Returns the value at a JSON pointer in a decoded JSON document.
+func lookupJSONPointer(document interface{}, pointer string) (interface{}, error) {
+	parsed, err := jsonpointer.New(pointer)
+	if err != nil {
+		return nil, fmt.Errorf("bad JSON pointer %q: %v", pointer, err)
+	}
+	value, _, err := parsed.Get(document)
+	if err != nil {
+		return nil, fmt.Errorf("nothing at %s: %v", pointer, err)
+	}
+	return value, nil
+}
+
+// Sets a current token on a backend request, recording it on the call.
+func (s *backendSession) writeToken(call *proxiedCall, request runtime.ClientRequest) error {
+	token, err := s.currentToken(call.ctx)
+	if err != nil {
+		return err
+	}
+	call.sessionToken = token
+	return request.SetHeaderParam(s.options.Header, fmt.Sprintf(s.options.HeaderFormat, token))
+}
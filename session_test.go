@@ -0,0 +1,121 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests that the session token is sent with backend requests, replaced when rejected, and never
+// captured in dead letters.
+func TestSessionToken(t *testing.T) {
+	assert := assertions.New(t)
+	logins := 0
+	loginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(`{"user": "proxy"}`, string(body))
+		assert.Equal("key", r.Header.Get("X-Api-Key"))
+		logins++
+		fmt.Fprintf(w, `{"data": {"token": "t%d"}}`, logins)
+	}))
+	defer loginServer.Close()
+
+	var authorizations []string
+	queue := NewDeadLetterQueue(10)
+	options := &ServiceOptions{Session: &SessionOptions{
+		LoginURL:     loginServer.URL,
+		LoginBody:    []byte(`{"user": "proxy"}`),
+		LoginHeaders: map[string]string{"X-Api-Key": "key"},
+		TokenPointer: "/data/token",
+	}, DeadLetters: queue}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if len(authorizations) == 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	for i := 0; i < 3; i++ {
+		adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+	}
+	assert.Equal([]string{"Bearer t1", "Bearer t1", "Bearer t2"}, authorizations)
+	assert.Equal(2, logins, "Rejected token not replaced")
+	letters := queue.Drain()
+	require.Len(t, letters, 1)
+	assert.Empty(letters[0].HTTPRequest.Header.Get("Authorization"), "Token captured in dead letter")
+}
+
+// Tests that tokens are replaced before the lifetime in the login response ends.
+func TestSessionTokenLifetime(t *testing.T) {
+	assert := assertions.New(t)
+	loginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token": "abc", "expires_in": 600}`))
+	}))
+	defer loginServer.Close()
+
+	session := newBackendSession(SessionOptions{LoginURL: loginServer.URL, ExpiresInPointer: "/expires_in"})
+	token, err := session.currentToken(context.Background())
+	require.Nil(t, err)
+	assert.Equal("abc", token)
+	refreshIn := time.Until(session.refreshAt)
+	assert.True(refreshIn > 9*time.Minute && refreshIn <= 10*time.Minute-sessionRefreshMargin,
+		"Unexpected refresh in %s", refreshIn)
+}
+
+// Tests that calls fail with Unavailable when the login fails.
+func TestSessionLoginFailure(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		response string
+		status   int
+	}{
+		{"error status", `{"token": "abc"}`, http.StatusForbidden},
+		{"missing token", `{"session": "abc"}`, http.StatusOK},
+		{"not JSON", `abc`, http.StatusOK},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			loginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(fixture.status)
+				w.Write([]byte(fixture.response))
+			}))
+			defer loginServer.Close()
+			called := false
+			options := &ServiceOptions{Session: &SessionOptions{LoginURL: loginServer.URL}}
+			adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+			defer closeServer()
+
+			err := adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`})
+			assertions.Equal(t, codes.Unavailable, errorCode(err))
+			assertions.False(t, called, "Backend called without a token")
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Service level objective tracking, with burn-rate alerts.
+//
+// A call is bad if it fails or takes longer than its objective's target latency. Over a sliding
+// window, an operation's burn rate is its fraction of bad calls divided by its error budget: at a
+// rate of 1 the budget is spent exactly as fast as the objective allows, and at higher rates it will
+// be exhausted early.
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// The default for SLOOptions.Window.
+	defaultSLOWindow = time.Hour
+	// The default for SLOOptions.AlertBurnRate.
+	defaultSLOAlertBurnRate = 1
+	// The default for SLOOptions.MinCalls.
+	defaultSLOMinCalls = 20
+	// The number of buckets each window is counted in.
+	sloBuckets = 60
+)
+
+// SLOObjective is the service level objective of an operation.
+type SLOObjective struct {
+	// Calls taking longer than this count against the error budget. Zero means calls are only judged
+	// by their result.
+	TargetLatency time.Duration
+	// The fraction of calls which may fail or exceed TargetLatency, such as 0.001 for 99.9%.
+	ErrorBudget float64
+}
+
+// SLOOptions configures service level objectives for the operations of a service.
+type SLOOptions struct {
+	// The objective of operations without one in Objectives. If nil, only those operations are
+	// tracked.
+	Default *SLOObjective
+	// Objectives for individual operations, keyed by operation ID.
+	Objectives map[string]*SLOObjective
+	// The sliding window burn rates are computed over. Defaults to an hour.
+	Window time.Duration
+	// The burn rate at which OnAlert is called. Defaults to 1, the rate exhausting the budget by the
+	// end of the window.
+	AlertBurnRate float64
+	// The fewest calls in the window for which alerts are raised, so that a few early failures don't
+	// page anyone. Defaults to 20.
+	MinCalls int
+	// Called when an operation's burn rate reaches AlertBurnRate. It is called again only once the
+	// rate has fallen below AlertBurnRate and reached it again. Called inline, so it should not block
+	// for long.
+	OnAlert func(*SLOAlert)
+}
+
+// SLOAlert describes an operation burning its error budget too fast.
+type SLOAlert struct {
+	// The operation's ID and full gRPC method name.
+	OperationID string
+	FullMethod  string
+	// The operation's objective.
+	Objective SLOObjective
+	// The burn rate over Window.
+	BurnRate float64
+	Window   time.Duration
+	// The calls in the window, and how many of them were bad.
+	Calls    int64
+	BadCalls int64
+	// When the alert was raised.
+	Time time.Time
+}
+
+// SLOMetrics records SLO burn rates. A CallMetrics implementation may also implement this to receive
+// the burn rate of each operation with an objective after each of its calls.
+type SLOMetrics interface {
+	// Records the MetricSLOBurnRate gauge.
+	RecordBurnRate(ctx context.Context, burnRate float64, attributes CallAttributes)
+}
+
+// The calls counted in one bucket of a window.
+type sloBucket struct {
+	// The bucket's index since the epoch, identifying which span of time it counts.
+	epoch int64
+	calls int64
+	bad   int64
+}
+
+// The sliding window of calls to one operation.
+type sloWindow struct {
+	mutex    sync.Mutex
+	buckets  [sloBuckets]sloBucket
+	alerting bool
+}
+
+// Counts a call at the given time, and returns the calls and bad calls in the window ending then.
+func (w *sloWindow) record(now time.Time, width time.Duration, bad bool) (calls int64, badCalls int64) {
+	epoch := now.UnixNano() / int64(width)
+	bucket := &w.buckets[epoch%sloBuckets]
+	if bucket.epoch != epoch {
+		*bucket = sloBucket{epoch: epoch}
+	}
+	bucket.calls++
+	if bad {
+		bucket.bad++
+	}
+	for i := range w.buckets {
+		if w.buckets[i].epoch > epoch-sloBuckets {
+			calls += w.buckets[i].calls
+			badCalls += w.buckets[i].bad
+		}
+	}
+	return calls, badCalls
+}
+
+// A MetricsHook tracking calls against their objectives. One tracker is shared by all operations in
+// a service.
+type sloTracker struct {
+	options *SLOOptions
+	metrics SLOMetrics
+	// Returns the current time. Replaced in tests.
+	now func() time.Time
+
+	mutex   sync.Mutex
+	windows map[string]*sloWindow
+}
+
+func newSLOTracker(options *SLOOptions, metrics CallMetrics) *sloTracker {
+	tracker := &sloTracker{options: options, now: time.Now, windows: make(map[string]*sloWindow)}
+	tracker.metrics, _ = metrics.(SLOMetrics)
+	return tracker
+}
+
+// Returns the objective of the operation with the given ID, or nil if it has none.
+func (o *SLOOptions) objective(operationID string) *SLOObjective {
+	if objective, ok := o.Objectives[operationID]; ok && objective != nil {
+		return objective
+	}
+	return o.Default
+}
+
+func (o *SLOOptions) window() time.Duration {
+	if o.Window > 0 {
+		return o.Window
+	}
+	return defaultSLOWindow
+}
+
+func (o *SLOOptions) alertBurnRate() float64 {
+	if o.AlertBurnRate > 0 {
+		return o.AlertBurnRate
+	}
+	return defaultSLOAlertBurnRate
+}
+
+func (o *SLOOptions) minCalls() int64 {
+	if o.MinCalls > 0 {
+		return int64(o.MinCalls)
+	}
+	return defaultSLOMinCalls
+}
+
+// Returns the window of the operation with the given ID, creating it on first use.
+func (t *sloTracker) window(operationID string) *sloWindow {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	window, ok := t.windows[operationID]
+	if !ok {
+		window = &sloWindow{}
+		t.windows[operationID] = window
+	}
+	return window
+}
+
+func (t *sloTracker) OnCallStart(ctx context.Context, event *CallStartEvent) {}
+
+func (t *sloTracker) OnBackendResponse(ctx context.Context, event *BackendResponseEvent) {}
+
+func (t *sloTracker) OnCallEnd(ctx context.Context, event *CallEndEvent) {
+	info := OperationFromContext(ctx)
+	if info == nil {
+		return
+	}
+	objective := t.options.objective(info.ID)
+	if objective == nil || objective.ErrorBudget <= 0 {
+		return
+	}
+	bad := event.Err != nil || (objective.TargetLatency > 0 && event.Duration > objective.TargetLatency)
+	now := t.now()
+	period := t.options.window()
+	window := t.window(info.ID)
+
+	window.mutex.Lock()
+	calls, badCalls := window.record(now, period/sloBuckets, bad)
+	burnRate := float64(badCalls) / float64(calls) / objective.ErrorBudget
+	alert := false
+	if burnRate >= t.options.alertBurnRate() {
+		alert = !window.alerting && calls >= t.options.minCalls()
+		window.alerting = window.alerting || alert
+	} else {
+		window.alerting = false
+	}
+	window.mutex.Unlock()
+
+	if t.metrics != nil {
+		attributes := event.Attributes
+		attributes.Code = 0
+		attributes.HTTPStatus = 0
+		t.metrics.RecordBurnRate(ctx, burnRate, attributes)
+	}
+	if alert && t.options.OnAlert != nil {
+		t.options.OnAlert(&SLOAlert{
+			OperationID: info.ID,
+			FullMethod:  info.FullMethod,
+			Objective:   *objective,
+			BurnRate:    burnRate,
+			Window:      period,
+			Calls:       calls,
+			BadCalls:    badCalls,
+			Time:        now,
+		})
+	}
+}
+
+// Returns the tracker for the configured objectives, shared by all operations in the service, or nil
+// if there are none.
+func (o *ServiceOptions) sloTracker() *sloTracker {
+	if o.SLO == nil {
+		return nil
+	}
+	o.sloTrackerOnce.Do(func() {
+		o.slos = newSLOTracker(o.SLO, o.Metrics)
+	})
+	return o.slos
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// CallMetrics also recording burn rates.
+type fakeSLOMetrics struct {
+	fakeCallMetrics
+	burnRates []float64
+}
+
+func (m *fakeSLOMetrics) RecordBurnRate(ctx context.Context, burnRate float64, attributes CallAttributes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.burnRates = append(m.burnRates, burnRate)
+}
+
+// Tests that burn rates are computed over the window, and alerts are raised once per breach.
+func TestSLOTrackerAlerts(t *testing.T) {
+	assert := assertions.New(t)
+	var alerts []*SLOAlert
+	tracker := newSLOTracker(&SLOOptions{
+		Objectives: map[string]*SLOObjective{
+			"getItem": {TargetLatency: 100 * time.Millisecond, ErrorBudget: 0.1},
+		},
+		Window:   time.Minute,
+		MinCalls: 11,
+		OnAlert:  func(alert *SLOAlert) { alerts = append(alerts, alert) },
+	}, nil)
+	now := time.Unix(1500000000, 0)
+	tracker.now = func() time.Time { return now }
+	ctx := withOperationInfo(context.Background(), &OperationInfo{ID: "getItem", FullMethod: "/Items/GetItem"})
+	call := func(duration time.Duration, err error) {
+		tracker.OnCallEnd(ctx, &CallEndEvent{Duration: duration, Err: err})
+	}
+
+	for i := 0; i < 9; i++ {
+		call(10*time.Millisecond, nil)
+	}
+	call(10*time.Millisecond, errors.New("failed"))
+	assert.Empty(alerts, "Alert raised at a burn rate of 1 with too few calls")
+	call(200*time.Millisecond, nil)
+	if assert.Len(alerts, 1, "Slow call didn't raise an alert") {
+		assert.Equal("getItem", alerts[0].OperationID)
+		assert.Equal("/Items/GetItem", alerts[0].FullMethod)
+		assert.Equal(int64(11), alerts[0].Calls)
+		assert.Equal(int64(2), alerts[0].BadCalls)
+		assert.InDelta(2.0/11/0.1, alerts[0].BurnRate, 1e-9)
+		assert.Equal(time.Minute, alerts[0].Window)
+	}
+	call(10*time.Millisecond, errors.New("failed"))
+	assert.Len(alerts, 1, "Alert raised again during the same breach")
+
+	// Once the window has passed, the earlier calls no longer count.
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 20; i++ {
+		call(10*time.Millisecond, nil)
+	}
+	assert.Len(alerts, 1)
+	for i := 0; i < 3; i++ {
+		call(10*time.Millisecond, errors.New("failed"))
+	}
+	assert.Len(alerts, 2, "Alert not raised again after recovering")
+}
+
+// Tests that operations without an objective aren't tracked, and the default objective applies to
+// the rest.
+func TestSLOOptionsObjective(t *testing.T) {
+	assert := assertions.New(t)
+	specific := &SLOObjective{ErrorBudget: 0.01}
+	options := &SLOOptions{Objectives: map[string]*SLOObjective{"getItem": specific}}
+	assert.Equal(specific, options.objective("getItem"))
+	assert.Nil(options.objective("listItems"))
+	options.Default = &SLOObjective{ErrorBudget: 0.1}
+	assert.Equal(options.Default, options.objective("listItems"))
+}
+
+// Tests that proxied calls record burn rates to metrics implementing SLOMetrics.
+func TestHandleGRPCRequestRecordsBurnRate(t *testing.T) {
+	assert := assertions.New(t)
+	metrics := &fakeSLOMetrics{}
+	var mutex sync.Mutex
+	body := `{"name": "thing"}`
+	adapter, closeServer := newTestAdapter(t, &ServiceOptions{
+		Metrics: metrics,
+		SLO:     &SLOOptions{Default: &SLOObjective{ErrorBudget: 0.5}},
+	}, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	mutex.Lock()
+	body = `not json`
+	mutex.Unlock()
+	assert.NotNil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+
+	assert.Equal([]float64{0, 1}, metrics.burnRates)
+}
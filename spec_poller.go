@@ -0,0 +1,243 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Polling of specs from a remote registry.
+//
+// Specs are fetched with conditional requests, so an unchanged spec costs the registry a 304. Failed
+// polls are retried with exponential backoff rather than at the usual interval, so a struggling
+// registry isn't hammered. Specs may be required to carry a detached signature from a trusted key,
+// checked before they're applied.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	// The default for SpecPollerOptions.Interval.
+	defaultSpecPollInterval = time.Minute
+	// The default for SpecPollerOptions.MaxBackoff.
+	defaultSpecPollMaxBackoff = 10 * time.Minute
+	// The largest spec or signature read from a registry.
+	maxSpecBytes = 32 << 20
+)
+
+// SpecPollerOptions configures a SpecPoller.
+type SpecPollerOptions struct {
+	// The URL of the spec, as JSON.
+	URL string
+	// Client to fetch specs with. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// The time between polls. Defaults to a minute.
+	Interval time.Duration
+	// The longest time between polls after failures. Each consecutive failure doubles the time from
+	// Interval, less a random jitter of up to half. Defaults to ten minutes.
+	MaxBackoff time.Duration
+	// Keys trusted to sign specs. If set, each spec must have a detached signature by one of them:
+	// RSA PKCS #1 v1.5 or ECDSA, over the SHA-256 of the spec, raw or base64-encoded. If empty, specs
+	// aren't verified.
+	SignatureKeys []crypto.PublicKey
+	// The URL of each spec's signature. Defaults to URL with ".sig" appended.
+	SignatureURL string
+	// Called with each new spec, and its contents, once verified. If it returns an error, the spec is
+	// fetched again at the next poll.
+	OnSpec func(swagger *spec.Swagger, contents []byte) error
+}
+
+// SpecPoller polls a remote registry for changes to a spec.
+type SpecPoller struct {
+	options SpecPollerOptions
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// Validators of the last spec applied, sent with the next poll.
+	etag         string
+	lastModified string
+	// The number of consecutive failed polls.
+	failures int
+}
+
+// NewSpecPoller returns a poller with the given options.
+func NewSpecPoller(options SpecPollerOptions) *SpecPoller {
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.Interval <= 0 {
+		options.Interval = defaultSpecPollInterval
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultSpecPollMaxBackoff
+	}
+	if options.SignatureURL == "" {
+		options.SignatureURL = options.URL + ".sig"
+	}
+	return &SpecPoller{options: options}
+}
+
+// Run polls until ctx is done, starting immediately. Errors are logged, and delay the next poll as
+// described by MaxBackoff.
+func (p *SpecPoller) Run(ctx context.Context) {
+	for {
+		if _, err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("WARNING: Could not poll spec from %s: %s.", p.options.URL, err)
+		}
+		if sleepContext(ctx, p.nextDelay()) != nil {
+			return
+		}
+	}
+}
+
+// Poll fetches the spec if it has changed since the last one applied, and applies it with OnSpec.
+// Returns true if a spec was applied.
+func (p *SpecPoller) Poll(ctx context.Context) (bool, error) {
+	applied, err := p.poll(ctx)
+	p.mutex.Lock()
+	if err != nil {
+		p.failures++
+	} else {
+		p.failures = 0
+	}
+	p.mutex.Unlock()
+	return applied, err
+}
+
+func (p *SpecPoller) poll(ctx context.Context) (bool, error) {
+	request, err := http.NewRequest(http.MethodGet, p.options.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	p.mutex.Lock()
+	if p.etag != "" {
+		request.Header.Set("If-None-Match", p.etag)
+	}
+	if p.lastModified != "" {
+		request.Header.Set("If-Modified-Since", p.lastModified)
+	}
+	p.mutex.Unlock()
+	request.Header.Set("Accept", jsonMediaType)
+
+	response, err := ctxhttp.Do(ctx, p.options.HTTPClient, request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	contents, err := readRegistryBody(response)
+	if err != nil {
+		return false, err
+	}
+	if len(p.options.SignatureKeys) > 0 {
+		if err := p.verify(ctx, contents); err != nil {
+			return false, err
+		}
+	}
+	swagger := &spec.Swagger{}
+	if err := json.Unmarshal(contents, swagger); err != nil {
+		return false, fmt.Errorf("could not parse spec from %s: %v", p.options.URL, err)
+	}
+	if p.options.OnSpec != nil {
+		if err := p.options.OnSpec(swagger, contents); err != nil {
+			return false, err
+		}
+	}
+	p.mutex.Lock()
+	p.etag = response.Header.Get("ETag")
+	p.lastModified = response.Header.Get("Last-Modified")
+	p.mutex.Unlock()
+	return true, nil
+}
+
+// Returns the time to wait before the next poll.
+func (p *SpecPoller) nextDelay() time.Duration {
+	p.mutex.Lock()
+	failures := p.failures
+	p.mutex.Unlock()
+	if failures == 0 {
+		return p.options.Interval
+	}
+	backoff := &RetryPolicy{InitialBackoff: p.options.Interval, MaxBackoff: p.options.MaxBackoff}
+	return backoff.backoff(failures + 1)
+}
+
+// Fetches the signature of a spec, failing unless one of the trusted keys made it.
+func (p *SpecPoller) verify(ctx context.Context, contents []byte) error {
+	response, err := ctxhttp.Get(ctx, p.options.HTTPClient, p.options.SignatureURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	signature, err := readRegistryBody(response)
+	if err != nil {
+		return fmt.Errorf("could not fetch spec signature: %v", err)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature))); err == nil {
+		signature = decoded
+	}
+	if !verifySpecSignature(p.options.SignatureKeys, contents, signature) {
+		return fmt.Errorf("spec from %s is not signed by a trusted key", p.options.URL)
+	}
+	return nil
+}
+
+// Returns true if any of the keys produced the signature of contents. ECDSA signatures may be
+// ASN.1-encoded, as by OpenSSL, or the concatenated R and S values.
+func verifySpecSignature(keys []crypto.PublicKey, contents, signature []byte) bool {
+	digest := sha256.Sum256(contents)
+	for _, key := range keys {
+		if ecdsaKey, ok := key.(*ecdsa.PublicKey); ok {
+			var values struct{ R, S *big.Int }
+			if rest, err := asn1.Unmarshal(signature, &values); err == nil && len(rest) == 0 &&
+				ecdsa.Verify(ecdsaKey, digest[:], values.R, values.S) {
+				return true
+			}
+		}
+	}
+	return verifyJWTSignature(keys, crypto.SHA256, contents, signature)
+}
+
+// Reads the body of a successful registry response.
+func readRegistryBody(response *http.Response) ([]byte, error) {
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry responded with %s", response.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxSpecBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSpecBytes {
+		return nil, fmt.Errorf("registry response is larger than %d bytes", maxSpecBytes)
+	}
+	return body, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const polledSpec = `{"swagger": "2.0", "info": {"title": "Items", "version": "1"}, "paths": {}}`
+
+// Tests that specs are fetched conditionally, and only applied when they change.
+func TestSpecPollerConditionalFetch(t *testing.T) {
+	assert := assertions.New(t)
+	var conditions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(polledSpec))
+	}))
+	defer server.Close()
+
+	var titles []string
+	applyErr := errors.New("could not apply")
+	poller := NewSpecPoller(SpecPollerOptions{
+		URL: server.URL,
+		OnSpec: func(swagger *spec.Swagger, contents []byte) error {
+			titles = append(titles, swagger.Info.Title)
+			return applyErr
+		},
+	})
+
+	applied, err := poller.Poll(context.Background())
+	assert.False(applied)
+	assert.Equal(applyErr, err)
+	applyErr = nil
+	applied, err = poller.Poll(context.Background())
+	assert.True(applied)
+	assert.Nil(err)
+	applied, err = poller.Poll(context.Background())
+	assert.False(applied, "Unchanged spec applied")
+	assert.Nil(err)
+
+	assert.Equal([]string{"", "", `"v1"`}, conditions, "Validators sent before spec was applied")
+	assert.Equal([]string{"Items", "Items"}, titles)
+}
+
+// Tests that specs must be signed by a trusted key when keys are configured.
+func TestSpecPollerSignatures(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	digest := sha256.Sum256([]byte(polledSpec))
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	require.Nil(t, err)
+	// ecdsa.PrivateKey.Sign returns the ASN.1 encoding, as OpenSSL writes it.
+	ecSignature, err := ecKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.Nil(t, err)
+
+	fixtures := []struct {
+		name      string
+		keys      []crypto.PublicKey
+		signature []byte
+		valid     bool
+	}{
+		{"RSA", []crypto.PublicKey{&rsaKey.PublicKey}, rsaSignature, true},
+		{"base64 RSA", []crypto.PublicKey{&rsaKey.PublicKey},
+			[]byte(base64.StdEncoding.EncodeToString(rsaSignature) + "\n"), true},
+		{"ECDSA", []crypto.PublicKey{&otherKey.PublicKey, &ecKey.PublicKey}, ecSignature, true},
+		{"untrusted key", []crypto.PublicKey{&otherKey.PublicKey}, rsaSignature, false},
+		{"no signature", []crypto.PublicKey{&rsaKey.PublicKey}, nil, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/items.json":
+					w.Write([]byte(polledSpec))
+				case r.URL.Path == "/items.json.sig" && fixture.signature != nil:
+					w.Write(fixture.signature)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+			applied := false
+			poller := NewSpecPoller(SpecPollerOptions{
+				URL:           server.URL + "/items.json",
+				SignatureKeys: fixture.keys,
+				OnSpec: func(swagger *spec.Swagger, contents []byte) error {
+					applied = true
+					return nil
+				},
+			})
+			_, err := poller.Poll(context.Background())
+			assertions.Equal(t, fixture.valid, err == nil, "Unexpected error %v", err)
+			assertions.Equal(t, fixture.valid, applied)
+		})
+	}
+}
+
+// Tests that failed polls back off from the interval, up to the limit.
+func TestSpecPollerBackoff(t *testing.T) {
+	assert := assertions.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	poller := NewSpecPoller(SpecPollerOptions{URL: server.URL, Interval: time.Second, MaxBackoff: 5 * time.Second})
+	assert.Equal(time.Second, poller.nextDelay())
+
+	for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		_, err := poller.Poll(context.Background())
+		assert.Error(err)
+		delay := poller.nextDelay()
+		assert.True(delay >= expected/2 && delay <= expected, "Delay %s not within jitter of %s", delay, expected)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Hot reloading of a registry's operations from a changing spec.
+//
+// A refresher loads its spec periodically, and when the contents change, builds operations for the
+// new spec and replaces the registry's with them at once. Calls already in progress finish with the
+// operations they started with. A spec which fails to build leaves the registry as it was, and is
+// built again at the next refresh.
+
+import (
+	"crypto/sha256"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// SpecRefresherOptions configures a SpecRefresher.
+type SpecRefresherOptions struct {
+	// Where the spec is loaded from. Specs served by a registry are loaded with NewPolledSpecSource.
+	Source SpecSource
+	// The time between refreshes. Defaults to a minute.
+	Interval time.Duration
+	// The longest time between refreshes after failures. Each consecutive failure doubles the time
+	// from Interval, less a random jitter of up to half. Defaults to ten minutes.
+	MaxBackoff time.Duration
+	// Builds the operations for a spec. Defaults to NewProxyFromSwagger with Proxy.
+	Build func(contents []byte) (*OperationRegistry, error)
+	// Options for NewProxyFromSwagger, if Build isn't set.
+	Proxy *ProxyOptions
+}
+
+// SpecRefresher keeps a registry's operations up to date with a spec.
+type SpecRefresher struct {
+	registry *OperationRegistry
+	options  SpecRefresherOptions
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// The SHA-256 of the spec last applied, if any.
+	applied *[sha256.Size]byte
+	// The number of consecutive failed refreshes.
+	failures int
+}
+
+// NewSpecRefresher returns a refresher replacing the operations of the given registry.
+func NewSpecRefresher(registry *OperationRegistry, options SpecRefresherOptions) *SpecRefresher {
+	if options.Interval <= 0 {
+		options.Interval = defaultSpecPollInterval
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultSpecPollMaxBackoff
+	}
+	if options.Build == nil {
+		proxy := options.Proxy
+		options.Build = func(contents []byte) (*OperationRegistry, error) {
+			return NewProxyFromSwagger(contents, proxy)
+		}
+	}
+	return &SpecRefresher{registry: registry, options: options}
+}
+
+// Run refreshes until ctx is done, starting immediately. Errors are logged, and delay the next
+// refresh as described by MaxBackoff.
+func (r *SpecRefresher) Run(ctx context.Context) {
+	for {
+		if _, err := r.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("WARNING: Could not refresh spec: %s.", err)
+		}
+		if sleepContext(ctx, r.nextDelay()) != nil {
+			return
+		}
+	}
+}
+
+// Refresh loads the spec, and if it has changed since the last one applied, replaces the registry's
+// operations with those built for it. Returns true if the operations were replaced.
+func (r *SpecRefresher) Refresh(ctx context.Context) (bool, error) {
+	applied, err := r.refresh(ctx)
+	r.mutex.Lock()
+	if err != nil {
+		r.failures++
+	} else {
+		r.failures = 0
+	}
+	r.mutex.Unlock()
+	return applied, err
+}
+
+func (r *SpecRefresher) refresh(ctx context.Context) (bool, error) {
+	contents, err := r.options.Source.Load(ctx)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(contents)
+	r.mutex.Lock()
+	unchanged := r.applied != nil && *r.applied == sum
+	r.mutex.Unlock()
+	if unchanged {
+		return false, nil
+	}
+	built, err := r.options.Build(contents)
+	if err != nil {
+		return false, err
+	}
+	r.registry.Replace(built)
+	r.mutex.Lock()
+	r.applied = &sum
+	r.mutex.Unlock()
+	return true, nil
+}
+
+// Returns the time to wait before the next refresh.
+func (r *SpecRefresher) nextDelay() time.Duration {
+	r.mutex.Lock()
+	failures := r.failures
+	r.mutex.Unlock()
+	if failures == 0 {
+		return r.options.Interval
+	}
+	backoff := &RetryPolicy{InitialBackoff: r.options.Interval, MaxBackoff: r.options.MaxBackoff}
+	return backoff.backoff(failures + 1)
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// A SpecSource returning whatever spec it's set to.
+type settableSpecSource struct {
+	contents string
+}
+
+func (s *settableSpecSource) Load(ctx context.Context) ([]byte, error) {
+	return []byte(s.contents), nil
+}
+
+// Tests that a registry's operations are replaced when its spec changes, and kept when the new spec
+// can't be built.
+func TestSpecRefresher(t *testing.T) {
+	assert := assertions.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"itemId": "abc"}`))
+	}))
+	defer server.Close()
+
+	source := &settableSpecSource{contents: generatedProtoSpec}
+	registry := NewOperationRegistry()
+	refresher := NewSpecRefresher(registry, SpecRefresherOptions{
+		Source: source,
+		Proxy:  &ProxyOptions{Package: "items.v1", SpecURL: server.URL},
+	})
+
+	applied, err := refresher.Refresh(context.Background())
+	require.Nil(t, err)
+	assert.True(applied)
+	assert.Contains(registry.Methods(), "/items.v1.Items/GetItem")
+	before := registry.current()
+	applied, err = refresher.Refresh(context.Background())
+	assert.Nil(err)
+	assert.False(applied, "Unchanged spec applied")
+
+	// Operations are renamed by tag, as a changed spec might.
+	source.contents = strings.Replace(generatedProtoSpec, `"tags": ["items"]`, `"tags": ["things"]`, -1)
+	applied, err = refresher.Refresh(context.Background())
+	require.Nil(t, err)
+	assert.True(applied)
+	assert.Contains(registry.Methods(), "/items.v1.Things/GetItem")
+	assert.NotContains(registry.Methods(), "/items.v1.Items/GetItem")
+	assert.Contains(before, "/items.v1.Items/GetItem", "Replace modified an earlier snapshot")
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, registry.handle("/items.v1.Things/GetItem", stream))
+	require.Len(t, stream.sent, 1)
+
+	source.contents = `{"swagger": `
+	_, err = refresher.Refresh(context.Background())
+	assert.Error(err)
+	assert.Contains(registry.Methods(), "/items.v1.Things/GetItem", "Bad spec changed the registry")
+	assert.True(refresher.nextDelay() > refresher.options.Interval/2, "No backoff after failure")
+}
+
+// Tests refreshing with a custom build function.
+func TestSpecRefresherBuild(t *testing.T) {
+	buildErr := errors.New("could not build")
+	refresher := NewSpecRefresher(NewOperationRegistry(), SpecRefresherOptions{
+		Source: NewBytesSpecSource([]byte(polledSpec)),
+		Build:  func(contents []byte) (*OperationRegistry, error) { return nil, buildErr },
+	})
+	applied, err := refresher.Refresh(context.Background())
+	assertions.False(t, applied)
+	assertions.Equal(t, buildErr, err)
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Sources of swagger specs: in memory, on disk, or served by a registry.
+//
+// Sources return a spec's current contents each time they're loaded; deciding whether it changed is
+// left to the caller. Specs served over HTTP are polled with a SpecPoller, so are fetched
+// conditionally and may be required to be signed, and an unchanged spec's last contents are
+// returned again.
+
+import (
+	"io/ioutil"
+	"sync"
+
+	"github.com/go-openapi/spec"
+	"golang.org/x/net/context"
+)
+
+// SpecSource provides the contents of a swagger spec, as JSON.
+type SpecSource interface {
+	// Load returns the spec's current contents.
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// NewBytesSpecSource returns a source of a spec which never changes.
+func NewBytesSpecSource(contents []byte) SpecSource {
+	return bytesSpecSource(contents)
+}
+
+// A spec in memory.
+type bytesSpecSource []byte
+
+func (s bytesSpecSource) Load(ctx context.Context) ([]byte, error) {
+	return s, nil
+}
+
+// NewFileSpecSource returns a source of the spec in a file, read at each load.
+func NewFileSpecSource(path string) SpecSource {
+	return fileSpecSource(path)
+}
+
+// A spec on disk.
+type fileSpecSource string
+
+func (s fileSpecSource) Load(ctx context.Context) ([]byte, error) {
+	return ioutil.ReadFile(string(s))
+}
+
+// NewPolledSpecSource returns a source of the spec served at a registry, fetched and verified by a
+// SpecPoller with the given options. Its OnSpec, if set, is called before each new spec is loaded.
+func NewPolledSpecSource(options SpecPollerOptions) SpecSource {
+	source := &polledSpecSource{}
+	onSpec := options.OnSpec
+	options.OnSpec = func(swagger *spec.Swagger, contents []byte) error {
+		if onSpec != nil {
+			if err := onSpec(swagger, contents); err != nil {
+				return err
+			}
+		}
+		source.mutex.Lock()
+		source.contents = contents
+		source.mutex.Unlock()
+		return nil
+	}
+	source.poller = NewSpecPoller(options)
+	return source
+}
+
+// A spec polled from a registry.
+type polledSpecSource struct {
+	poller *SpecPoller
+
+	// Guards all fields below.
+	mutex sync.Mutex
+	// The contents last applied by the poller.
+	contents []byte
+}
+
+func (s *polledSpecSource) Load(ctx context.Context) ([]byte, error) {
+	if _, err := s.poller.Poll(ctx); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.contents, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// Tests loading specs from memory and from files.
+func TestBytesAndFileSpecSources(t *testing.T) {
+	assert := assertions.New(t)
+	contents, err := NewBytesSpecSource([]byte(polledSpec)).Load(context.Background())
+	assert.Nil(err)
+	assert.Equal(polledSpec, string(contents))
+
+	dir, err := ioutil.TempDir("", "swaggrpc")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "swagger.json")
+	source := NewFileSpecSource(path)
+	_, err = source.Load(context.Background())
+	assert.Error(err, "Missing file loaded")
+	require.Nil(t, ioutil.WriteFile(path, []byte(polledSpec), 0600))
+	contents, err = source.Load(context.Background())
+	assert.Nil(err)
+	assert.Equal(polledSpec, string(contents))
+}
+
+// Tests that polled specs are fetched conditionally, with unchanged specs loaded from the last fetch.
+func TestPolledSpecSource(t *testing.T) {
+	assert := assertions.New(t)
+	var conditions []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(polledSpec))
+	}))
+	defer server.Close()
+
+	source := NewPolledSpecSource(SpecPollerOptions{URL: server.URL})
+	for i := 0; i < 2; i++ {
+		contents, err := source.Load(context.Background())
+		assert.Nil(err)
+		assert.Equal(polledSpec, string(contents))
+	}
+	assert.Equal([]string{"", `"v1"`}, conditions)
+
+	status = http.StatusInternalServerError
+	_, err := source.Load(context.Background())
+	assert.Error(err)
+}
+
+// Tests that polled specs must be signed when keys are configured.
+func TestPolledSpecSourceSignatures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/items.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(polledSpec))
+	}))
+	defer server.Close()
+
+	source := NewPolledSpecSource(SpecPollerOptions{
+		URL:           server.URL + "/items.json",
+		SignatureKeys: []crypto.PublicKey{&key.PublicKey},
+	})
+	_, err = source.Load(context.Background())
+	assertions.Error(t, err, "Unsigned spec loaded")
+}
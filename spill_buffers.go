@@ -0,0 +1,128 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Spilling of large backend response bodies to temporary files.
+//
+// Response bodies are read whole before they're decompressed and decoded. For operations exchanging
+// large payloads, compressed bodies above a threshold are written to a temporary file as they
+// arrive, and decompressed from it, so that the compressed and decompressed bodies aren't both held
+// in memory. The decompressed body is still read into memory to be decoded, so uncompressed bodies,
+// which would only be read back from the file, aren't spilled. Request bodies are encoded as they're
+// sent to the backend, so are never buffered.
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SpillOptions configures spilling of large compressed response bodies to temporary files.
+// Uncompressed bodies are always read into memory, as they're decoded from memory either way.
+type SpillOptions struct {
+	// Bodies larger than this many bytes are spilled. Zero spills every body.
+	Threshold int
+	// The directory of temporary files. Defaults to os.TempDir().
+	Dir string
+}
+
+// Returns the spill settings for an operation: the operation's, or else the service's, or nil if
+// bodies aren't spilled.
+func resolveSpill(options *ServiceOptions, operationOptions *OperationOptions) *SpillOptions {
+	if operationOptions.Spill != nil {
+		return operationOptions.Spill
+	}
+	return options.Spill
+}
+
+// A buffer held in memory up to a threshold, and in a temporary file beyond it.
+type spillBuffer struct {
+	options *SpillOptions
+	memory  bytes.Buffer
+	// The temporary file, once the buffer has spilled.
+	file *os.File
+	size int
+}
+
+func (b *spillBuffer) Write(data []byte) (int, error) {
+	if b.file == nil && b.size+len(data) <= b.options.Threshold {
+		b.size += len(data)
+		return b.memory.Write(data)
+	}
+	if b.file == nil {
+		file, err := ioutil.TempFile(b.options.Dir, "swaggrpc-spill-")
+		if err != nil {
+			return 0, err
+		}
+		b.file = file
+		if _, err := file.Write(b.memory.Bytes()); err != nil {
+			return 0, err
+		}
+		// Released, since it's now on disk.
+		b.memory = bytes.Buffer{}
+	}
+	written, err := b.file.Write(data)
+	b.size += written
+	return written, err
+}
+
+// Returns the number of bytes written.
+func (b *spillBuffer) Len() int {
+	return b.size
+}
+
+// Returns a reader of everything written, from the start.
+func (b *spillBuffer) reader() (io.Reader, error) {
+	if b.file == nil {
+		return bytes.NewReader(b.memory.Bytes()), nil
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return b.file, nil
+}
+
+// Releases the buffer, removing any temporary file.
+func (b *spillBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	closeErr := b.file.Close()
+	if err := os.Remove(b.file.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Reads a compressed backend response body as readResponseBody does, through a spill buffer.
+func (p *operationAdapter) readSpilledResponseBody(body io.Reader, contentEncoding string) ([]byte, error) {
+	buffer := &spillBuffer{options: p.spill}
+	defer buffer.Close()
+	if _, err := io.Copy(buffer, body); err != nil {
+		return nil, status.Errorf(codes.Internal, "reading backend response for %s: %v", p.operation.ID, err)
+	}
+	if limit := p.options.MaxResponseBytes; limit > 0 && buffer.Len() > limit {
+		return nil, p.responseTooLarge()
+	}
+	reader, err := buffer.reader()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reading backend response for %s: %v", p.operation.ID, err)
+	}
+	return p.decompressResponseBody(reader, contentEncoding)
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Returns a temporary directory for spilled files, and a function removing it.
+func spillDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "swaggrpc-spill-test")
+	require.Nil(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// Tests that buffers move to a temporary file beyond their threshold, which is removed on close.
+func TestSpillBuffer(t *testing.T) {
+	assert := assertions.New(t)
+	dir, removeDir := spillDir(t)
+	defer removeDir()
+
+	buffer := &spillBuffer{options: &SpillOptions{Threshold: 8, Dir: dir}}
+	buffer.Write([]byte("12345"))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(files, "Spilled under the threshold")
+	buffer.Write([]byte("67890"))
+	files, _ = ioutil.ReadDir(dir)
+	assert.Len(files, 1, "Not spilled over the threshold")
+	assert.Equal(10, buffer.Len())
+
+	reader, err := buffer.reader()
+	require.Nil(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("1234567890", string(contents))
+	assert.Nil(buffer.Close())
+	files, _ = ioutil.ReadDir(dir)
+	assert.Empty(files, "Spilled file not removed")
+}
+
+// Tests reading responses through spill buffers, within the usual limits.
+func TestSpilledResponses(t *testing.T) {
+	large := `{"name": "` + strings.Repeat("x", 4096) + `"}`
+	fixtures := []struct {
+		name     string
+		options  *ServiceOptions
+		encoding string
+		body     []byte
+		itemName string
+		code     codes.Code
+	}{
+		{"under threshold", &ServiceOptions{Spill: &SpillOptions{Threshold: 1024}}, "",
+			[]byte(`{"name": "thing"}`), "thing", codes.OK},
+		{"over threshold", &ServiceOptions{Spill: &SpillOptions{}}, "",
+			[]byte(`{"name": "thing"}`), "thing", codes.OK},
+		{"gzip", &ServiceOptions{Spill: &SpillOptions{}}, "gzip", gzipBytes(large),
+			strings.Repeat("x", 4096), codes.OK},
+		{"operation", &ServiceOptions{Operations: map[string]*OperationOptions{
+			"getItem": {Spill: &SpillOptions{}},
+		}}, "", []byte(`{"name": "thing"}`), "thing", codes.OK},
+		{"over response limit", &ServiceOptions{Spill: &SpillOptions{}, MaxResponseBytes: 1024}, "",
+			[]byte(large), "", codes.ResourceExhausted},
+		{"over decompressed limit", &ServiceOptions{Spill: &SpillOptions{}, MaxDecompressedBytes: 1024}, "gzip",
+			gzipBytes(large), "", codes.ResourceExhausted},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dir, removeDir := spillDir(t)
+			defer removeDir()
+			if fixture.options.Spill != nil {
+				fixture.options.Spill.Dir = dir
+			} else {
+				fixture.options.Operations["getItem"].Spill.Dir = dir
+			}
+			adapter, closeServer := newTestAdapter(t, fixture.options,
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if fixture.encoding != "" {
+						w.Header().Set("Content-Encoding", fixture.encoding)
+					}
+					w.Write(fixture.body)
+				})
+			defer closeServer()
+
+			stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+			err := adapter.handleGRPCRequest(stream)
+			assertions.Equal(t, fixture.code, errorCode(err), "Bad result: %v", err)
+			if fixture.code == codes.OK {
+				require.Len(t, stream.sent, 1)
+				assertions.Equal(t, fixture.itemName, stream.sent[0].GetFieldByName("name"))
+			}
+			files, _ := ioutil.ReadDir(dir)
+			assertions.Empty(t, files, "Spilled file not removed")
+		})
+	}
+}
+
+// Tests that uncompressed bodies are read into memory, rather than spilled.
+func TestUncompressedResponsesNotSpilled(t *testing.T) {
+	dir, removeDir := spillDir(t)
+	defer removeDir()
+	// Spilling to a missing directory fails.
+	options := &ServiceOptions{Spill: &SpillOptions{Dir: dir + "/missing"}}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	stream := &fakeServerStream{request: `{"itemId": "abc"}`}
+	require.Nil(t, adapter.handleGRPCRequest(stream))
+	require.Len(t, stream.sent, 1)
+	assertions.Equal(t, "thing", stream.sent[0].GetFieldByName("name"))
+}
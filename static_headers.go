@@ -0,0 +1,55 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Constant headers sent with every backend request.
+
+import (
+	"net/http"
+
+	"github.com/go-openapi/runtime"
+)
+
+// Returns the constant headers for an operation's requests, keyed by canonical name: the service's
+// headers, overridden by the operation's. An empty value in the operation's headers removes a
+// service header.
+func resolveStaticHeaders(options *ServiceOptions, operationOptions *OperationOptions) map[string]string {
+	headers := make(map[string]string)
+	for name, value := range options.Headers {
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, value := range operationOptions.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if value == "" {
+			delete(headers, name)
+		} else {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// Sets this operation's User-Agent and constant headers on a request.
+func (p *operationAdapter) writeStaticHeaders(request runtime.ClientRequest) error {
+	if err := request.SetHeaderParam(userAgentHeader, p.userAgent); err != nil {
+		return err
+	}
+	for name, value := range p.staticHeaders {
+		if err := request.SetHeaderParam(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
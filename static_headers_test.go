@@ -0,0 +1,50 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that operation headers override and remove service headers.
+func TestResolveStaticHeaders(t *testing.T) {
+	headers := resolveStaticHeaders(
+		&ServiceOptions{Headers: map[string]string{"x-api-version": "1", "X-Client-Id": "proxy"}},
+		&OperationOptions{Headers: map[string]string{"X-Api-Version": "2", "x-client-id": "", "X-Extra": "yes"}})
+	assertions.Equal(t, map[string]string{"X-Api-Version": "2", "X-Extra": "yes"}, headers)
+}
+
+// Tests that static headers are sent with backend requests.
+func TestStaticHeadersSent(t *testing.T) {
+	var received http.Header
+	options := &ServiceOptions{
+		Headers:    map[string]string{"X-Api-Version": "1"},
+		Operations: map[string]*OperationOptions{"getItem": {Headers: map[string]string{"X-Client-Id": "me"}}},
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "thing"}`))
+	})
+	defer closeServer()
+
+	require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	assertions.Equal(t, "1", received.Get("X-Api-Version"))
+	assertions.Equal(t, "me", received.Get("X-Client-Id"))
+}
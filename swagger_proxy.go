@@ -0,0 +1,125 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Proxies built from a swagger document alone.
+//
+// The proto is generated from the document as generate_proto.go describes, so it can't drift from
+// the spec. Callers needing the generated definitions, such as to build clients, can read them
+// through the reflection service.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/spec"
+)
+
+// The proto package of generated services, if none is configured.
+const defaultGeneratedPackage = "swagger"
+
+// ProxyOptions configures a proxy built from a swagger document.
+type ProxyOptions struct {
+	// The proto package of the generated services. Defaults to "swagger".
+	Package string
+	// The URL the document was served from, giving the backend host and scheme if the document
+	// doesn't name them.
+	SpecURL string
+	// The client backend requests are sent with. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// How operations are grouped into services.
+	Grouping *ServiceGroupingOptions
+	// Options for every proxied operation.
+	Service *ServiceOptions
+	// The number of workers building operations' handlers concurrently. Defaults to one per CPU.
+	Workers int
+	// If set, called with timings from building the operations' handlers.
+	OnStartup func(*StartupReport)
+}
+
+// NewProxyFromSwagger returns a registry proxying every operation in a swagger document, with a
+// proto generated from the document. Operations are grouped into services as GroupOperationsByTag
+// groups them. Returns an error if the document can't be parsed, a proto can't be generated from
+// it, or an operation can't be proxied.
+func NewProxyFromSwagger(specBytes []byte, options *ProxyOptions) (*OperationRegistry, error) {
+	if options == nil {
+		options = &ProxyOptions{}
+	}
+	swagger := &spec.Swagger{}
+	if err := json.Unmarshal(specBytes, swagger); err != nil {
+		return nil, fmt.Errorf("bad swagger document: %v", err)
+	}
+	packageName := options.Package
+	if packageName == "" {
+		packageName = defaultGeneratedPackage
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	swaggerClient, err := NewSwaggerClient(swagger, options.SpecURL)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := GroupOperationsByTag(swagger, options.Grouping)
+	contents, err := generateProto(swagger, methods, packageName)
+	if err != nil {
+		return nil, err
+	}
+	fileDesc, err := loadProtoFromBytes(contents)
+	if err != nil {
+		return nil, fmt.Errorf("loading generated proto: %v", err)
+	}
+
+	sources := make([]operationSource, len(methods))
+	for i, method := range methods {
+		methodDesc := method.FindMethod(fileDesc)
+		if methodDesc == nil {
+			// Should not happen.
+			return nil, fmt.Errorf("generated proto has no method %s.%s", method.Service, method.Method)
+		}
+		method := method
+		sources[i] = operationSource{
+			httpMethod:  method.HTTPMethod,
+			swaggerPath: method.Path,
+			operation:   method.Operation,
+			resolveParameters: func() (map[string]*spec.Parameter, error) {
+				params, err := operationParameters(swagger, method.Path, method.Operation)
+				if err != nil {
+					return nil, err
+				}
+				parameters := make(map[string]*spec.Parameter, len(params))
+				for _, param := range params {
+					parameters[param.Name] = param
+				}
+				return parameters, nil
+			},
+			method: methodDesc,
+		}
+	}
+	handlers, report, err := buildOperationHandlers(httpClient, swaggerClient, sources, options.Service,
+		options.Workers)
+	if err != nil {
+		return nil, err
+	}
+	if options.OnStartup != nil {
+		options.OnStartup(report)
+	}
+	registry := &OperationRegistry{operations: make(map[string]*registeredOperation), source: swagger}
+	registry.addHandlers(sources, handlers)
+	return registry, nil
+}
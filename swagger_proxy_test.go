@@ -0,0 +1,73 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests proxying a spec's operations with a generated proto.
+func TestNewProxyFromSwagger(t *testing.T) {
+	assert := assertions.New(t)
+	var requested *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"itemId": "abc", "item_count": 3, "extra": {"color": "red"}, "owner": {"name": "me"}}`))
+	}))
+	defer server.Close()
+
+	var report *StartupReport
+	registry, err := NewProxyFromSwagger([]byte(generatedProtoSpec), &ProxyOptions{
+		Package:   "items.v1",
+		SpecURL:   server.URL + "/swagger.json",
+		Workers:   2,
+		OnStartup: func(startup *StartupReport) { report = startup },
+	})
+	require.Nil(t, err)
+	require.NotNil(t, report, "No startup report")
+	assert.Equal(4, report.Operations)
+	assert.Equal(2, report.Workers)
+	require.NotNil(t, registry.describe("getItem"), "Operation not described")
+	assert.NotEmpty(registry.describe("getItem").Parameters)
+	assert.Equal([]string{
+		"/items.v1.Items/CountItems",
+		"/items.v1.Items/DeleteItem",
+		"/items.v1.Items/GetItem",
+		"/items.v1.Items/ListItems",
+	}, registry.Methods())
+
+	stream := &fakeServerStream{request: `{"itemId": "abc", "X_Request_Id": "r1", "fields": ["name"]}`}
+	require.Nil(t, registry.handle("/items.v1.Items/GetItem", stream))
+	require.NotNil(t, requested)
+	assert.Equal("/items/abc", requested.URL.Path)
+	assert.Equal("name", requested.URL.Query().Get("fields"))
+	assert.Equal("r1", requested.Header.Get("X-Request-Id"))
+	require.Len(t, stream.sent, 1)
+	got, err := stream.sent[0].MarshalJSON()
+	require.Nil(t, err)
+	assert.JSONEq(`{"itemId": "abc", "item_count": 3, "extra": {"color": "red"}, "owner": {"name": "me"}}`,
+		string(got))
+
+	_, err = NewProxyFromSwagger([]byte(`{"swagger": `), nil)
+	assert.Error(err, "Bad document accepted")
+	_, err = NewProxyFromSwagger([]byte(generatedProtoSpec), nil)
+	assert.Error(err, "Document without a host accepted")
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Pinning of backend TLS certificates.
+//
+// Pins are SHA-256 digests, base64-encoded as in HTTP public key pinning, of either a whole DER
+// certificate or its SubjectPublicKeyInfo. SPKI pins survive a certificate being reissued for the
+// same key, so are usually preferred.
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// PinOptions pins the certificates a backend may present.
+type PinOptions struct {
+	// Digests of DER certificates, any of which may be presented.
+	Certificates []string
+	// Digests of SubjectPublicKeyInfos, any of which may be presented.
+	SPKIs []string
+	// If true, certificates aren't verified against the system CA store, and only the backend's own
+	// certificate is matched against the pins. Otherwise, the certificate must be verified as usual,
+	// and any certificate in a verified chain, such as an intermediate CA, may match.
+	PinsOnly bool
+}
+
+// A set of pinned digests.
+type certificatePins struct {
+	certificates map[[sha256.Size]byte]bool
+	spkis        map[[sha256.Size]byte]bool
+	pinsOnly     bool
+}
+
+// Parses pin options, failing if any pin isn't a base64 SHA-256 digest or no pins are given.
+func newCertificatePins(options *PinOptions) (*certificatePins, error) {
+	pins := &certificatePins{
+		certificates: make(map[[sha256.Size]byte]bool),
+		spkis:        make(map[[sha256.Size]byte]bool),
+		pinsOnly:     options.PinsOnly,
+	}
+	for _, set := range []struct {
+		encoded []string
+		digests map[[sha256.Size]byte]bool
+	}{{options.Certificates, pins.certificates}, {options.SPKIs, pins.spkis}} {
+		for _, encoded := range set.encoded {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("pin %q is not a base64 SHA-256 digest", encoded)
+			}
+			var digest [sha256.Size]byte
+			copy(digest[:], decoded)
+			set.digests[digest] = true
+		}
+	}
+	if len(pins.certificates) == 0 && len(pins.spkis) == 0 {
+		return nil, errors.New("no certificate or SPKI pins given")
+	}
+	return pins, nil
+}
+
+// Returns a TLS config enforcing the pins.
+func (p *certificatePins) tlsConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify:    p.pinsOnly,
+		VerifyPeerCertificate: p.verify,
+	}
+}
+
+// Verifies a backend's certificates, as tls.Config.VerifyPeerCertificate.
+func (p *certificatePins) verify(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if p.pinsOnly {
+		if len(rawCerts) == 0 {
+			return errors.New("backend presented no certificate")
+		}
+		leaf, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		if p.matches(leaf) {
+			return nil
+		}
+	}
+	for _, chain := range verifiedChains {
+		for _, certificate := range chain {
+			if p.matches(certificate) {
+				return nil
+			}
+		}
+	}
+	return errors.New("backend certificate matches no pin")
+}
+
+// Returns true if a certificate or its public key is pinned.
+func (p *certificatePins) matches(certificate *x509.Certificate) bool {
+	return p.certificates[sha256.Sum256(certificate.Raw)] ||
+		p.spkis[sha256.Sum256(certificate.RawSubjectPublicKeyInfo)]
+}
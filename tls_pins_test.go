@@ -0,0 +1,79 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns the base64 SHA-256 digest of data.
+func pinDigest(data []byte) string {
+	digest := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// Tests that backends are only reached when presenting a pinned certificate.
+func TestCertificatePins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	certificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.Nil(t, err)
+	other := pinDigest([]byte("other"))
+
+	fixtures := []struct {
+		name string
+		pins *PinOptions
+		ok   bool
+	}{
+		{"Certificate", &PinOptions{Certificates: []string{other, pinDigest(certificate.Raw)}, PinsOnly: true}, true},
+		{"SPKI", &PinOptions{SPKIs: []string{pinDigest(certificate.RawSubjectPublicKeyInfo)}, PinsOnly: true}, true},
+		{"Unpinned", &PinOptions{Certificates: []string{other}, SPKIs: []string{other}, PinsOnly: true}, false},
+		// The test server's certificate isn't signed by a trusted CA.
+		{"Untrusted", &PinOptions{SPKIs: []string{pinDigest(certificate.RawSubjectPublicKeyInfo)}}, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			transport, err := NewBackendTransport(server.URL, &TransportOptions{Pins: fixture.pins})
+			require.Nil(t, err)
+			response, err := (&http.Client{Transport: transport}).Get(server.URL)
+			if fixture.ok {
+				require.Nil(t, err)
+				response.Body.Close()
+			} else {
+				assertions.NotNil(t, err, "Expected error for unpinned certificate")
+			}
+		})
+	}
+}
+
+// Tests rejecting malformed pins.
+func TestCertificatePinErrors(t *testing.T) {
+	for _, pins := range []*PinOptions{
+		{},
+		{SPKIs: []string{"not base64!"}},
+		{Certificates: []string{base64.StdEncoding.EncodeToString([]byte("short"))}},
+	} {
+		_, err := NewBackendTransport("https://localhost", &TransportOptions{Pins: pins})
+		assertions.NotNil(t, err, "Expected error for pins %+v", pins)
+	}
+}
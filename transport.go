@@ -0,0 +1,282 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Helpers for configuring the HTTP transport used for backend requests.
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/proxy"
+)
+
+// Scheme for backend base URLs naming a unix domain socket.
+const unixScheme = "unix"
+
+// TransportOptions configures the transport used to reach a backend. The zero value connects
+// directly.
+type TransportOptions struct {
+	// If set, all connections are made through this SOCKS5 proxy.
+	SOCKS5 *SOCKS5Options
+	// The dialer for backend connections. Its FallbackDelay controls how quickly IPv4 is tried when
+	// IPv6 is slow to connect, and its LocalAddr pins the source address. If nil, a dialer with the
+	// same settings as http.DefaultTransport's is used.
+	Dialer *net.Dialer
+	// If set, backend hostnames are resolved through this cache, and the resolved addresses dialed
+	// with the dialer's Timeout and FallbackDelay. It is not used for unix sockets, or with a SOCKS5
+	// proxy, which resolves hostnames itself.
+	DNSCache *DNSCache
+	// If set, called for every new backend connection instead of dialing directly. The hook may
+	// inspect the request context, rewrite the network or address, or dial some other way; dial makes
+	// the connection the transport would have made without the hook.
+	DialHook func(ctx context.Context, network, addr string, dial DialFunc) (net.Conn, error)
+	// If set, TLS connections are only made to backends presenting a pinned certificate.
+	Pins *PinOptions
+	// If set, this client certificate is presented to backends requesting one, and reloaded as its
+	// files change.
+	ClientCertificate *ClientCertificateOptions
+}
+
+// DialFunc makes a network connection; it has the signature of net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// SOCKS5Options configures a SOCKS5 proxy for backend connections.
+type SOCKS5Options struct {
+	// The proxy's host:port.
+	Address string
+	// Credentials for username/password authentication. If Username is empty, no authentication is
+	// offered to the proxy.
+	Username string
+	Password string
+}
+
+// NewBackendTransport returns a transport for requests to the backend at the given base URL, with
+// the given options. Options may be nil.
+//
+// URLs with the "unix" scheme (e.g. unix:///var/run/svc.sock) name a unix domain socket; the returned
+// transport dials that socket for every request, regardless of the request's host. Swagger clients
+// using it should be configured with a placeholder host such as "localhost" and the "http" scheme.
+// All other URLs get a transport with the same settings as http.DefaultTransport.
+func NewBackendTransport(baseURL string, options *TransportOptions) (*http.Transport, error) {
+	if options == nil {
+		options = &TransportOptions{}
+	}
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := options.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}
+	}
+	var dial DialFunc = dialer.DialContext
+	if options.DNSCache != nil {
+		dial = options.DNSCache.wrapDial(dialer, dial)
+	}
+	proxyFunc := http.ProxyFromEnvironment
+	if parsedURL.Scheme == unixScheme {
+		if parsedURL.Path == "" {
+			return nil, fmt.Errorf("unix backend URL %q has no socket path", baseURL)
+		}
+		socketPath := parsedURL.Path
+		// Proxies can't be used to reach a local socket.
+		proxyFunc = nil
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, unixScheme, socketPath)
+		}
+	}
+	if options.SOCKS5 != nil {
+		if parsedURL.Scheme == unixScheme {
+			return nil, fmt.Errorf("unix backend URL %q can't be reached through a SOCKS5 proxy", baseURL)
+		}
+		var auth *proxy.Auth
+		if options.SOCKS5.Username != "" {
+			auth = &proxy.Auth{User: options.SOCKS5.Username, Password: options.SOCKS5.Password}
+		}
+		socksDialer, err := proxy.SOCKS5("tcp", options.SOCKS5.Address, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		// HTTP proxies from the environment would bypass the SOCKS5 proxy.
+		proxyFunc = nil
+		dial = contextDialer(socksDialer)
+	}
+	if options.DialHook != nil {
+		hook, next := options.DialHook, dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return hook(ctx, network, addr, next)
+		}
+	}
+	var tlsConfig *tls.Config
+	if options.Pins != nil {
+		pins, err := newCertificatePins(options.Pins)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = pins.tlsConfig()
+	}
+	if options.ClientCertificate != nil {
+		certificate, err := newClientCertificate(options.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.GetClientCertificate = certificate.get
+	}
+	return &http.Transport{
+		Proxy:                 proxyFunc,
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dial,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
+
+// Adapts a dialer without context support to a DialContext function. If the context is done before
+// the dial completes, the dial is abandoned and any connection it later makes is closed.
+func contextDialer(dialer proxy.Dialer) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		type dialResult struct {
+			conn net.Conn
+			err  error
+		}
+		results := make(chan dialResult, 1)
+		go func() {
+			conn, err := dialer.Dial(network, addr)
+			results <- dialResult{conn, err}
+		}()
+		select {
+		case result := <-results:
+			return result.conn, result.err
+		case <-ctx.Done():
+			go func() {
+				if result := <-results; result.conn != nil {
+					result.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Returns a shallow copy of the given client with its transport wrapped by wrap. The copy shares the
+// original's underlying transport, so connections are still pooled across all users of the client.
+// A nil client is treated as http.DefaultClient.
+func wrapClientTransport(client *http.Client, wrap func(http.RoundTripper) http.RoundTripper) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = wrap(transport)
+	return &wrapped
+}
+
+// A transport which prefers one round tripper, falling back to another when it fails.
+type fallbackTransport struct {
+	preferred http.RoundTripper
+	fallback  http.RoundTripper
+	// How long to skip the preferred transport for a host after it fails.
+	retryAfter time.Duration
+
+	// Guards brokenUntil.
+	mutex sync.Mutex
+	// For hosts where the preferred transport recently failed, when to try it again.
+	brokenUntil map[string]time.Time
+}
+
+// NewFallbackTransport returns a transport sending requests with preferred, and retrying them with
+// fallback when preferred fails to produce a response. After a failure, requests to the same host go
+// straight to fallback for the retryAfter duration.
+//
+// This is intended for experimental HTTP/3 backends: pass a QUIC round tripper (such as quic-go's
+// http3.RoundTripper) as preferred, and a transport from NewBackendTransport as fallback, so that
+// backends or networks without working QUIC are still served over HTTP/2 or HTTP/1.1.
+//
+// Requests with bodies are only retried if their GetBody is set, as it is for requests with
+// in-memory bodies.
+func NewFallbackTransport(preferred, fallback http.RoundTripper, retryAfter time.Duration) http.RoundTripper {
+	return &fallbackTransport{
+		preferred:   preferred,
+		fallback:    fallback,
+		retryAfter:  retryAfter,
+		brokenUntil: make(map[string]time.Time),
+	}
+}
+
+func (t *fallbackTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if t.isBroken(request.URL.Host) {
+		return t.fallback.RoundTrip(request)
+	}
+	response, err := t.preferred.RoundTrip(request)
+	if err == nil {
+		return response, nil
+	}
+	if request.Context().Err() != nil {
+		// The caller gave up; this isn't the transport's fault.
+		return nil, err
+	}
+	t.markBroken(request.URL.Host)
+	if request.Body != nil && request.Body != http.NoBody {
+		if request.GetBody == nil {
+			return nil, err
+		}
+		body, bodyErr := request.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		retry := *request
+		retry.Body = body
+		request = &retry
+	}
+	return t.fallback.RoundTrip(request)
+}
+
+// Returns true if the preferred transport recently failed for a host.
+func (t *fallbackTransport) isBroken(host string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	until, ok := t.brokenUntil[host]
+	if ok && time.Now().After(until) {
+		delete(t.brokenUntil, host)
+		return false
+	}
+	return ok
+}
+
+// Records a failure of the preferred transport for a host.
+func (t *fallbackTransport) markBroken(host string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.brokenUntil[host] = time.Now().Add(t.retryAfter)
+}
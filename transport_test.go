@@ -0,0 +1,243 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// A RoundTripper adapter for plain functions.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// Tests that a configured transport wrapper sees every backend request.
+func TestWrapTransport(t *testing.T) {
+	assert := assertions.New(t)
+	var seenPaths []string
+	options := &ServiceOptions{
+		WrapTransport: func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				seenPaths = append(seenPaths, request.URL.Path)
+				return next.RoundTrip(request)
+			})
+		},
+	}
+	adapter, closeServer := newTestAdapter(t, options, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	assert.Equal([]string{"/items/abc"}, seenPaths, "Wrapper didn't see request")
+	assert.Nil(http.DefaultClient.Transport, "Shared client was modified")
+}
+
+// Tests that a unix backend URL routes requests over the named socket.
+func TestNewBackendTransportUnixSocket(t *testing.T) {
+	assert := assertions.New(t)
+	dir, err := ioutil.TempDir("", "swaggrpc")
+	require.Nil(t, err, "Couldn't create temp dir: %v", err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "backend.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.Nil(t, err, "Couldn't listen on socket: %v", err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("over the socket"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	transport, err := NewBackendTransport("unix://"+socketPath, nil)
+	require.Nil(t, err, "Error creating transport: %v", err)
+	response, err := (&http.Client{Transport: transport}).Get("http://localhost/anything")
+	require.Nil(t, err, "Error making request: %v", err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	assert.Nil(err)
+	assert.Equal("over the socket", string(body))
+}
+
+// Tests that unix backend URLs require a socket path.
+func TestNewBackendTransportErrors(t *testing.T) {
+	_, err := NewBackendTransport("unix://", nil)
+	assertions.NotNil(t, err, "Expected error for missing socket path")
+	_, err = NewBackendTransport("http://example.com/api", nil)
+	assertions.Nil(t, err, "Unexpected error for http URL: %v", err)
+}
+
+// Runs a minimal SOCKS5 proxy requiring the given credentials, which connects all requests to
+// target regardless of the requested address. Returns the proxy's address, and a function which
+// stops the proxy.
+func runTestSOCKS5Proxy(t *testing.T, username, password, target string) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, "Couldn't listen: %v", err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buffer := make([]byte, 512)
+				// Greeting: version, method count, methods. Select username/password auth.
+				io.ReadFull(conn, buffer[:2])
+				io.ReadFull(conn, buffer[:buffer[1]])
+				conn.Write([]byte{5, 2})
+				// Auth: version, username, password.
+				io.ReadFull(conn, buffer[:2])
+				user := make([]byte, buffer[1])
+				io.ReadFull(conn, user)
+				io.ReadFull(conn, buffer[:1])
+				pass := make([]byte, buffer[0])
+				io.ReadFull(conn, pass)
+				if string(user) != username || string(pass) != password {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+				// Connect request: version, command, reserved, address type, address, port.
+				io.ReadFull(conn, buffer[:4])
+				switch buffer[3] {
+				case 1:
+					io.ReadFull(conn, buffer[:4+2])
+				case 3:
+					io.ReadFull(conn, buffer[:1])
+					io.ReadFull(conn, buffer[:buffer[0]+2])
+				}
+				backend, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer backend.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(backend, conn)
+				io.Copy(conn, backend)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// Tests that backend requests are routed through a configured SOCKS5 proxy.
+func TestNewBackendTransportSOCKS5(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks"))
+	}))
+	defer server.Close()
+	proxyAddress, closeProxy := runTestSOCKS5Proxy(t, "user", "secret", server.Listener.Addr().String())
+	defer closeProxy()
+
+	fixtures := []struct {
+		name     string
+		password string
+		success  bool
+	}{
+		{"GoodCredentials", "secret", true},
+		{"BadCredentials", "wrong", false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert := assertions.New(t)
+			transport, err := NewBackendTransport("http://backend.internal", &TransportOptions{
+				SOCKS5: &SOCKS5Options{Address: proxyAddress, Username: "user", Password: fixture.password},
+			})
+			require.Nil(t, err, "Error creating transport: %v", err)
+			response, err := (&http.Client{Transport: transport}).Get("http://backend.internal/")
+			if !fixture.success {
+				assert.NotNil(err, "Expected proxy auth failure")
+				return
+			}
+			require.Nil(t, err, "Error making request: %v", err)
+			defer response.Body.Close()
+			body, err := ioutil.ReadAll(response.Body)
+			assert.Nil(err)
+			assert.Equal("via socks", string(body))
+		})
+	}
+}
+
+// Tests that the fallback transport retries failed requests, and skips a failing transport for a
+// while.
+func TestFallbackTransport(t *testing.T) {
+	assert := assertions.New(t)
+	preferredCalls := 0
+	preferred := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		preferredCalls++
+		return nil, errors.New("no quic here")
+	})
+	var fallbackBodies []string
+	fallback := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(request.Body)
+		fallbackBodies = append(fallbackBodies, string(body))
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	transport := NewFallbackTransport(preferred, fallback, time.Minute)
+
+	for _, body := range []string{"first", "second"} {
+		request, err := http.NewRequest("POST", "https://backend.internal/", strings.NewReader(body))
+		require.Nil(t, err)
+		response, err := transport.RoundTrip(request)
+		assert.Nil(err, "Expected fallback to succeed: %v", err)
+		assert.Equal(http.StatusOK, response.StatusCode)
+	}
+	assert.Equal(1, preferredCalls, "Failing transport should be skipped after one failure")
+	assert.Equal([]string{"first", "second"}, fallbackBodies, "Bodies not replayed to fallback")
+}
+
+// Tests that dial hooks see and can redirect backend connections, using the configured dialer.
+func TestNewBackendTransportDialHook(t *testing.T) {
+	assert := assertions.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("redirected"))
+	}))
+	defer server.Close()
+
+	var dialedAddrs []string
+	transport, err := NewBackendTransport("http://backend.internal", &TransportOptions{
+		Dialer: &net.Dialer{Timeout: time.Second, LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}},
+		DialHook: func(ctx context.Context, network, addr string, dial DialFunc) (net.Conn, error) {
+			dialedAddrs = append(dialedAddrs, addr)
+			return dial(ctx, network, server.Listener.Addr().String())
+		},
+	})
+	require.Nil(t, err, "Error creating transport: %v", err)
+	response, err := (&http.Client{Transport: transport}).Get("http://backend.internal:8080/")
+	require.Nil(t, err, "Error making request: %v", err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	assert.Nil(err)
+	assert.Equal("redirected", string(body))
+	assert.Equal([]string{"backend.internal:8080"}, dialedAddrs, "Hook not called with original address")
+}
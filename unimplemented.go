@@ -0,0 +1,110 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Diagnostics for calls to methods with no swagger operation.
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/transport"
+)
+
+// The number of nearest mapped methods suggested for an unmapped method.
+const maxSuggestedMethods = 3
+
+// NewUnimplementedHandler returns a handler for calls to methods which aren't mapped to a swagger
+// operation, for use with grpc.UnknownServiceHandler. Calls fail with Unimplemented, listing the
+// mapped methods with the nearest names in the message, nearest first. Mapped methods are full gRPC
+// method names, like "/package.Service/Method".
+func NewUnimplementedHandler(mappedMethods []string) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		fullMethod := "unknown method"
+		if transportStream, ok := transport.StreamFromContext(stream.Context()); ok {
+			fullMethod = transportStream.Method()
+		}
+		return unimplementedError(fullMethod, mappedMethods)
+	}
+}
+
+// Returns the Unimplemented error for a call to the given unmapped method.
+func unimplementedError(fullMethod string, mappedMethods []string) error {
+	suggestions := nearestMethods(fullMethod, mappedMethods)
+	if len(suggestions) == 0 {
+		return status.Errorf(codes.Unimplemented,
+			"%s is not mapped to a swagger operation", fullMethod)
+	}
+	return status.Errorf(codes.Unimplemented,
+		"%s is not mapped to a swagger operation; nearest mapped methods: %s",
+		fullMethod, strings.Join(suggestions, ", "))
+}
+
+// Returns up to maxSuggestedMethods of the candidates nearest to the given method by edit distance,
+// nearest first.
+func nearestMethods(fullMethod string, candidates []string) []string {
+	type scored struct {
+		method   string
+		distance int
+	}
+	target := strings.ToLower(fullMethod)
+	scores := make([]scored, 0, len(candidates))
+	for _, candidate := range candidates {
+		scores = append(scores, scored{candidate, editDistance(target, strings.ToLower(candidate))})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].distance != scores[j].distance {
+			return scores[i].distance < scores[j].distance
+		}
+		return scores[i].method < scores[j].method
+	})
+	nearest := make([]string, 0, maxSuggestedMethods)
+	for i := 0; i < len(scores) && i < maxSuggestedMethods; i++ {
+		nearest = append(nearest, scores[i].method)
+	}
+	return nearest
+}
+
+// Returns the Levenshtein distance between two strings, in bytes.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Returns the smaller of two ints.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
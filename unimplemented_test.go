@@ -0,0 +1,67 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"strings"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tests that unmapped methods fail with the nearest mapped methods suggested.
+func TestUnimplementedError(t *testing.T) {
+	assert := assertions.New(t)
+	mapped := []string{
+		"/test_service.Items/GetItem",
+		"/test_service.Items/ListItems",
+		"/test_service.Items/DeleteItem",
+		"/test_service.Orders/GetOrder",
+	}
+	err := unimplementedError("/test_service.Items/GetItems", mapped)
+	errStatus, ok := status.FromError(err)
+	require.True(t, ok, "Expected a status error")
+	assert.Equal(codes.Unimplemented, errStatus.Code())
+	assert.True(strings.HasSuffix(errStatus.Message(), "nearest mapped methods: /test_service.Items/GetItem, "+
+		"/test_service.Items/ListItems, /test_service.Items/DeleteItem"), "Bad suggestions: %s", errStatus.Message())
+	assert.Empty(errStatus.Details())
+}
+
+// Tests that the handler fails calls with Unimplemented when nothing is mapped.
+func TestUnimplementedHandler(t *testing.T) {
+	err := NewUnimplementedHandler(nil)(nil, &fakeServerStream{})
+	errStatus, _ := status.FromError(err)
+	assertions.Equal(t, codes.Unimplemented, errStatus.Code())
+	assertions.Empty(t, errStatus.Details())
+}
+
+// Tests edit distances.
+func TestEditDistance(t *testing.T) {
+	fixtures := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"GetItem", "GetItems", 1},
+	}
+	for _, fixture := range fixtures {
+		assertions.Equal(t, fixture.distance, editDistance(fixture.a, fixture.b), "%s -> %s", fixture.a, fixture.b)
+	}
+}
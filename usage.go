@@ -0,0 +1,124 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Usage records for charging back proxied API consumption.
+//
+// An operation's cost class can be set by API owners in the spec with the x-swaggrpc-cost-class
+// operation extension, or programmatically with OperationOptions.CostClass:
+//
+//   x-swaggrpc-cost-class: expensive
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+)
+
+// Name of the operation extension holding the cost class.
+const costClassExtension = "x-swaggrpc-cost-class"
+
+// UsageRecord records the resources used by a single proxied call.
+type UsageRecord struct {
+	// When the call was received.
+	Time time.Time `json:"time"`
+	// The caller's identity, as for audit events. Empty if unknown.
+	Caller string `json:"caller"`
+	// The fully-qualified gRPC method name that was called.
+	Operation string `json:"operation"`
+	// The operation's cost class. Empty if none is set.
+	CostClass string `json:"costClass,omitempty"`
+	// The size of the request message, in its binary encoding. Zero if it wasn't received.
+	RequestBytes int `json:"requestBytes"`
+	// The size of the response message, in its binary encoding. Zero if none was sent.
+	ResponseBytes int `json:"responseBytes"`
+	// The gRPC status code returned to the caller.
+	Code codes.Code `json:"code"`
+}
+
+// UsageSink receives usage records. Implementations must be safe for concurrent use, and should not
+// block for long; they are called inline at the end of every call.
+type UsageSink interface {
+	RecordUsage(record *UsageRecord)
+}
+
+// UsageSinkFunc adapts a plain function to a UsageSink.
+type UsageSinkFunc func(record *UsageRecord)
+
+// RecordUsage calls f(record).
+func (f UsageSinkFunc) RecordUsage(record *UsageRecord) {
+	f(record)
+}
+
+// A UsageSink writing one JSON object per line to a writer.
+type jsonUsageSink struct {
+	// Guards writes, so that concurrent records don't interleave.
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONUsageSink returns a UsageSink writing each record as a line of JSON to the given writer.
+func NewJSONUsageSink(writer io.Writer) UsageSink {
+	return &jsonUsageSink{encoder: json.NewEncoder(writer)}
+}
+
+func (s *jsonUsageSink) RecordUsage(record *UsageRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.encoder.Encode(record); err != nil {
+		log.Printf("WARNING: Error writing usage record: %s", err)
+	}
+}
+
+// Returns the cost class of an operation: the programmatic class if set, or else the class in the
+// spec.
+func resolveCostClass(operation *spec.Operation, operationOptions *OperationOptions) (string, error) {
+	if operationOptions.CostClass != "" {
+		return operationOptions.CostClass, nil
+	}
+	var costClass string
+	if _, err := decodeExtension(operation.Extensions, costClassExtension, &costClass); err != nil {
+		return "", err
+	}
+	return costClass, nil
+}
+
+// Returns the size of a message's binary encoding, or zero if it can't be encoded.
+func messageSize(msg *dynamic.Message) int {
+	encoded, err := msg.Marshal()
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+// Emits a usage record for a completed call to the configured sink.
+func (p *operationAdapter) recordUsage(call *proxiedCall, err error) {
+	p.options.UsageSink.RecordUsage(&UsageRecord{
+		Time:          call.startTime,
+		Caller:        callerFromContext(call.ctx, p.options.CallerMetadataKey),
+		Operation:     p.method.GetFullyQualifiedName(),
+		CostClass:     p.costClass,
+		RequestBytes:  call.requestBytes,
+		ResponseBytes: call.responseBytes,
+		Code:          errorCode(err),
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Tests that proxied calls emit a usage record with message sizes and the spec's cost class.
+func TestHandleGRPCRequestRecordsUsage(t *testing.T) {
+	assert := assertions.New(t)
+	var records []*UsageRecord
+	options := &ServiceOptions{
+		UsageSink: UsageSinkFunc(func(record *UsageRecord) { records = append(records, record) }),
+	}
+	operation := parseTestOperation(t, `{"operationId": "getItem", "x-swaggrpc-cost-class": "expensive"}`)
+	adapter, closeServer := testOperation{operation: operation, options: options,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "thing"}`))
+		}}.adapter(t)
+	defer closeServer()
+
+	assert.Nil(adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal("test_service.Items.GetItem", record.Operation)
+	assert.Equal("expensive", record.CostClass)
+	// A tag and length byte for each string field, plus its contents.
+	assert.Equal(5, record.RequestBytes)
+	assert.Equal(7, record.ResponseBytes)
+	assert.Equal(codes.OK, record.Code)
+}
+
+// Tests that a programmatic cost class overrides the spec.
+func TestResolveCostClass(t *testing.T) {
+	assert := assertions.New(t)
+	operation := parseTestOperation(t, `{"x-swaggrpc-cost-class": "expensive"}`)
+	costClass, err := resolveCostClass(operation, &OperationOptions{})
+	assert.Nil(err)
+	assert.Equal("expensive", costClass)
+	costClass, err = resolveCostClass(operation, &OperationOptions{CostClass: "cheap"})
+	assert.Nil(err)
+	assert.Equal("cheap", costClass)
+	_, err = resolveCostClass(parseTestOperation(t, `{"x-swaggrpc-cost-class": 3}`), &OperationOptions{})
+	assert.NotNil(err, "Expected error for non-string cost class")
+}
+
+// Tests that the JSON sink writes one record per line.
+func TestJSONUsageSink(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewJSONUsageSink(&buffer)
+	sink.RecordUsage(&UsageRecord{Caller: "alice", RequestBytes: 10})
+	sink.RecordUsage(&UsageRecord{Caller: "bob", ResponseBytes: 20})
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var decoded UsageRecord
+	require.Nil(t, json.Unmarshal(lines[1], &decoded))
+	assertions.Equal(t, "bob", decoded.Caller)
+	assertions.Equal(t, 20, decoded.ResponseBytes)
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// The User-Agent sent with backend requests, which backends use to attribute traffic.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is the version of swaggrpc, as sent in the default User-Agent.
+const Version = "0.1.0"
+
+// Name of the User-Agent header.
+const userAgentHeader = "User-Agent"
+
+// Placeholder in ServiceOptions.UserAgent replaced by the operation's ID.
+const userAgentOperationID = "{operationId}"
+
+// Returns the User-Agent for an operation's backend requests.
+func (o *ServiceOptions) userAgent(operationID string) string {
+	if o.UserAgent != "" {
+		return strings.Replace(o.UserAgent, userAgentOperationID, operationID, -1)
+	}
+	return fmt.Sprintf("swaggrpc/%s (+%s)", Version, operationID)
+}
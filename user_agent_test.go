@@ -0,0 +1,50 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests the User-Agent sent to the backend by default, when configured, and when set as a header.
+func TestUserAgentSent(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		options  *ServiceOptions
+		expected string
+	}{
+		{"Default", &ServiceOptions{}, "swaggrpc/" + Version + " (+getItem)"},
+		{"Configured", &ServiceOptions{UserAgent: "catalog-proxy/2 ({operationId})"}, "catalog-proxy/2 (getItem)"},
+		{"Header", &ServiceOptions{UserAgent: "ignored", Headers: map[string]string{"user-agent": "mine"}}, "mine"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			var received string
+			adapter, closeServer := newTestAdapter(t, fixture.options, func(w http.ResponseWriter, r *http.Request) {
+				received = r.UserAgent()
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "thing"}`))
+			})
+			defer closeServer()
+
+			require.Nil(t, adapter.handleGRPCRequest(&fakeServerStream{request: `{"itemId": "abc"}`}))
+			assertions.Equal(t, fixture.expected, received)
+		})
+	}
+}
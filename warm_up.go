@@ -0,0 +1,151 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+// Warm-up of backend connections before a server accepts calls.
+//
+// The first call to a backend otherwise pays for resolving its host, connecting, and the TLS
+// handshake. Warm-up requests pay those costs up front and leave idle connections in the client's
+// pool for the first calls to reuse.
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	// The default for WarmUpOptions.Timeout.
+	defaultWarmUpTimeout = 10 * time.Second
+	// The most of a warm-up response body read, so that its connection can be reused.
+	maxWarmUpBodyBytes = 4 << 10
+)
+
+// WarmUpOptions configures the warm-up requests sent to a backend. The zero value sends one HEAD
+// request for the backend's base URL.
+type WarmUpOptions struct {
+	// The HTTP method of warm-up requests. Defaults to HEAD.
+	Method string
+	// The path of a cheap endpoint to request, relative to the backend's base URL, such as a health
+	// check. Any response, whatever its status, warms the connection. Defaults to the base URL itself.
+	Path string
+	// The number of requests sent concurrently, and so the number of connections opened. Connections
+	// beyond the transport's MaxIdleConnsPerHost are closed once their requests complete. Defaults to
+	// one.
+	Connections int
+	// How long to wait for all warm-up requests. Defaults to ten seconds.
+	Timeout time.Duration
+	// If set, the backend's host is resolved into this cache first. This should be the cache in the
+	// client's TransportOptions.
+	DNSCache *DNSCache
+}
+
+// WarmUp resolves the host of the backend at baseURL and sends it warm-up requests with the given
+// client, which should be the client its operations use. It should be called for each backend before
+// the gRPC server starts serving. Options may be nil.
+//
+// An error is returned if any request fails to get a response. Callers may choose to serve anyway;
+// the backend is then connected to on its first call, as it would be without warm-up.
+func WarmUp(ctx context.Context, client *http.Client, baseURL string, options *WarmUpOptions) error {
+	if options == nil {
+		options = &WarmUpOptions{}
+	}
+	target, err := warmUpURL(baseURL, options.Path)
+	if err != nil {
+		return err
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultWarmUpTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if options.DNSCache != nil && target.Scheme != unixScheme {
+		if _, err := options.DNSCache.LookupHost(ctx, target.Hostname()); err != nil {
+			return fmt.Errorf("warming up %s: %v", baseURL, err)
+		}
+	}
+	if target.Scheme == unixScheme {
+		// Transports for unix sockets dial the socket whatever the request's host.
+		target = &url.URL{Scheme: "http", Host: "localhost", Path: target.Path, RawQuery: target.RawQuery}
+	}
+	method := options.Method
+	if method == "" {
+		method = http.MethodHead
+	}
+	connections := options.Connections
+	if connections <= 0 {
+		connections = 1
+	}
+	errs := make(chan error, connections)
+	for i := 0; i < connections; i++ {
+		go func() {
+			errs <- warmUpRequest(ctx, client, method, target.String())
+		}()
+	}
+	var firstErr error
+	for i := 0; i < connections; i++ {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("warming up %s: %v", baseURL, err)
+		}
+	}
+	return firstErr
+}
+
+// Returns the URL of warm-up requests for a backend. For unix socket backends, whose URL path names
+// the socket, the path is that of the request.
+func warmUpURL(baseURL, path string) (*url.URL, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == unixScheme {
+		return url.Parse(unixScheme + ":///" + strings.TrimPrefix(path, "/"))
+	}
+	if path == "" {
+		return base, nil
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	reference, err := url.Parse(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return base.ResolveReference(reference), nil
+}
+
+// Sends one warm-up request, reading and closing its response so that the connection is kept.
+func warmUpRequest(ctx context.Context, client *http.Client, method, target string) error {
+	request, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return err
+	}
+	response, err := ctxhttp.Do(ctx, client, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxWarmUpBodyBytes))
+	return err
+}
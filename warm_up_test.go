@@ -0,0 +1,79 @@
+// Copyright 2017 Nordstrom, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swaggrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	assertions "github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// Tests that warm-up requests are built relative to the backend's base URL.
+func TestWarmUpURL(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		baseURL  string
+		path     string
+		expected string
+	}{
+		{"base URL", "https://backend.example.com/api", "", "https://backend.example.com/api"},
+		{"path under base", "https://backend.example.com/api", "/healthz", "https://backend.example.com/api/healthz"},
+		{"base with slash", "https://backend.example.com/api/", "ping?quick=1", "https://backend.example.com/api/ping?quick=1"},
+		{"unix socket", "unix:///var/run/backend.sock", "/healthz", "unix:///healthz"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			target, err := warmUpURL(fixture.baseURL, fixture.path)
+			if assertions.NoError(t, err) {
+				assertions.Equal(t, fixture.expected, target.String())
+			}
+		})
+	}
+}
+
+// Tests that the configured number of warm-up requests are sent, and that any response status counts
+// as warm.
+func TestWarmUp(t *testing.T) {
+	assert := assertions.New(t)
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	assert.NoError(WarmUp(context.Background(), http.DefaultClient, server.URL+"/api", nil))
+	assert.Equal([]string{"HEAD /api"}, requests)
+
+	requests = nil
+	assert.NoError(WarmUp(context.Background(), http.DefaultClient, server.URL+"/api",
+		&WarmUpOptions{Method: http.MethodGet, Path: "/noop", Connections: 3}))
+	assert.Equal([]string{"GET /api/noop", "GET /api/noop", "GET /api/noop"}, requests)
+}
+
+// Tests that backends which can't be reached fail warm-up.
+func TestWarmUpUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	err := WarmUp(context.Background(), http.DefaultClient, server.URL, nil)
+	assertions.Error(t, err)
+}